@@ -3,6 +3,7 @@ package config
 import (
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"strings"
 
@@ -18,6 +19,15 @@ type Config struct {
 	EmailInfo emailInfo `json:"EmailInfo"`
 	Wechat    wechat    `json:"Wechat"`
 	Qiniu     qiniu     `json:"Qiniu"`
+
+	OfficialAccount officialAccount `json:"OfficialAccount"` // 公众号, 用于接收关注/取关和扫码事件
+
+	Storage storage `json:"Storage"` // 文件存储, 默认使用七牛
+
+	Trash trash `json:"Trash"`
+
+	// RateLimit 限流规则, key 为操作名: graphql 和 REST 接口按 IP, graphql 的各个操作按用户
+	RateLimit map[string]rateLimitRule `json:"RateLimit"`
 }
 
 type appInfo struct {
@@ -32,9 +42,34 @@ type logConf struct {
 }
 
 type security struct {
+	Secret   string   `json:"Secret"`
+	AdminIDs []string `json:"AdminIDs"` // 管理员的 unionid, 可查看定时任务执行记录等
+
+	// GroupCodeKey 生成圈子邀请码的密钥, 为空时使用 Secret; 修改后新生成的邀请码可能与已有的重复
+	GroupCodeKey string `json:"GroupCodeKey"`
+
+	// ServiceKeys 调用 /api/unopen 接口的服务密钥, 为空时拒绝所有调用
+	// 轮换时先加入新密钥, 调用方切换后再删除旧密钥
+	ServiceKeys []serviceKey `json:"ServiceKeys"`
+
+	// TrustedProxies 反向代理(如 nginx)的地址或网段, 只有来自这些地址的请求才使用 X-Real-IP、X-Forwarded-For 作为客户端地址
+	TrustedProxies []string `json:"TrustedProxies"`
+}
+
+type serviceKey struct {
+	KeyID  string `json:"KeyID"`
 	Secret string `json:"Secret"`
 }
 
+type trash struct {
+	RetentionDays int `json:"RetentionDays"` // 回收站保留天数, 超过后彻底删除, 为 0 时使用默认值
+}
+
+type rateLimitRule struct {
+	Rate  int `json:"Rate"`  // 每分钟补充的请求数, 为 0 时不限流
+	Burst int `json:"Burst"` // 允许的突发请求数
+}
+
 type emailInfo struct {
 	From     string   `json:"From"`
 	To       []string `json:"To"`
@@ -46,12 +81,51 @@ type emailInfo struct {
 type wechat struct {
 	AppID     string `json:"AppID"`
 	AppSecret string `json:"AppSecret"`
+
+	// SubscribeTemplateID 小程序订阅消息模板id, 为空时不使用订阅消息渠道
+	SubscribeTemplateID string `json:"SubscribeTemplateID"`
+}
+
+type officialAccount struct {
+	AppID          string `json:"AppID"`
+	AppSecret      string `json:"AppSecret"`
+	Token          string `json:"Token"`          // 服务器配置中的令牌, 为空时不启用事件接收
+	EncodingAESKey string `json:"EncodingAESKey"` // 安全模式的消息加解密密钥
 }
 
 type qiniu struct {
 	AccessKey string `json:"AccessKey"`
 	SecretKey string `json:"SecretKey"`
 	Bucket    string `json:"Bucket"` // 空间
+
+	// CallbackURL 上传回调地址, 七牛上传成功后回调登记文件, 为空时不登记也不校验上传的文件, 用于本地调试
+	CallbackURL string `json:"CallbackURL"`
+}
+
+type storage struct {
+	Backend string       `json:"Backend"` // qiniu, s3, local, 为空时使用 qiniu
+	S3      s3Storage    `json:"S3"`
+	Local   localStorage `json:"Local"`
+
+	// Private 私有空间: 作业、提交、反馈的图片和附件只能通过有效期为 constant.FileURLExpire 的临时链接访问
+	// 七牛和 S3 需要同时将空间设为私有, 本地存储由本服务校验链接签名
+	Private bool `json:"Private"`
+}
+
+// s3Storage MinIO 等 S3 兼容存储, 使用 path-style 访问, 客户端通过 POST policy 直传
+type s3Storage struct {
+	Endpoint  string `json:"Endpoint"` // example: http://127.0.0.1:9000
+	Region    string `json:"Region"`
+	Bucket    string `json:"Bucket"`
+	AccessKey string `json:"AccessKey"`
+	SecretKey string `json:"SecretKey"`
+	PublicURL string `json:"PublicURL"` // 文件的访问地址前缀, 为空时为 <Endpoint>/<Bucket>/
+}
+
+// localStorage 本地磁盘存储, 用于开发和测试, 文件由本服务接收和提供访问
+type localStorage struct {
+	Dir     string `json:"Dir"`     // 文件保存目录
+	BaseURL string `json:"BaseURL"` // 本服务的访问地址, example: http://127.0.0.1:3000
 }
 
 type db struct {
@@ -62,6 +136,8 @@ type db struct {
 	User        string `json:"User"`
 	PW          string `json:"PW"`
 	AdminDBName string `json:"AdminDBName"`
+
+	EnableTransaction bool `json:"EnableTransaction"` // 是否开启事务，需要 mongo 副本集
 }
 
 type redis struct {
@@ -131,6 +207,32 @@ func initConf() {
 	if v, ok := os.LookupEnv("WeixinAppSecret"); ok {
 		Conf.Wechat.AppSecret = v
 	}
+	if v, ok := os.LookupEnv("WeixinSubscribeTemplateID"); ok {
+		Conf.Wechat.SubscribeTemplateID = v
+	}
+
+	if v, ok := os.LookupEnv("OfficialAccountAppID"); ok {
+		Conf.OfficialAccount.AppID = v
+	}
+	if v, ok := os.LookupEnv("OfficialAccountAppSecret"); ok {
+		Conf.OfficialAccount.AppSecret = v
+	}
+	if v, ok := os.LookupEnv("OfficialAccountToken"); ok {
+		Conf.OfficialAccount.Token = v
+	}
+	if v, ok := os.LookupEnv("OfficialAccountEncodingAESKey"); ok {
+		Conf.OfficialAccount.EncodingAESKey = v
+	}
+
+	if v, ok := os.LookupEnv("GroupCodeKey"); ok {
+		Conf.Security.GroupCodeKey = v
+	}
+	if v, ok := os.LookupEnv("ServiceKeys"); ok {
+		Conf.Security.ServiceKeys = parseServiceKeys(v)
+	}
+	if v, ok := os.LookupEnv("TrustedProxies"); ok {
+		Conf.Security.TrustedProxies = strings.Fields(v)
+	}
 
 	if v, ok := os.LookupEnv("QINIU_ACCESS_KEY"); ok {
 		Conf.Qiniu.AccessKey = v
@@ -141,6 +243,28 @@ func initConf() {
 	if v, ok := os.LookupEnv("QINIU_BUCKET"); ok {
 		Conf.Qiniu.Bucket = v
 	}
+	if v, ok := os.LookupEnv("QINIU_CALLBACK_URL"); ok {
+		Conf.Qiniu.CallbackURL = v
+	}
+
+	if v, ok := os.LookupEnv("STORAGE_BACKEND"); ok {
+		Conf.Storage.Backend = v
+	}
+	if v, ok := os.LookupEnv("STORAGE_PRIVATE"); ok {
+		Conf.Storage.Private = v == "true"
+	}
+	if v, ok := os.LookupEnv("S3_ENDPOINT"); ok {
+		Conf.Storage.S3.Endpoint = v
+	}
+	if v, ok := os.LookupEnv("S3_ACCESS_KEY"); ok {
+		Conf.Storage.S3.AccessKey = v
+	}
+	if v, ok := os.LookupEnv("S3_SECRET_KEY"); ok {
+		Conf.Storage.S3.SecretKey = v
+	}
+	if v, ok := os.LookupEnv("S3_BUCKET"); ok {
+		Conf.Storage.S3.Bucket = v
+	}
 
 	if v, ok := os.LookupEnv("Slogan"); ok {
 		Conf.AppInfo.Slogan = v
@@ -174,3 +298,56 @@ func initConf() {
 
 	log.Println("over init default config")
 }
+
+// parseServiceKeys 解析环境变量中的服务密钥, 格式: <keyID>:<secret>, 空格分开
+func parseServiceKeys(v string) []serviceKey {
+	keys := []serviceKey{}
+	for _, field := range strings.Fields(v) {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			log.Println("config-initConf: ignore invalid service key")
+			continue
+		}
+		keys = append(keys, serviceKey{KeyID: kv[0], Secret: kv[1]})
+	}
+	return keys
+}
+
+// ServiceKeySecret 根据 keyID 获取服务密钥
+func ServiceKeySecret(keyID string) (string, bool) {
+	for _, key := range Conf.Security.ServiceKeys {
+		if key.KeyID == keyID && key.Secret != "" {
+			return key.Secret, true
+		}
+	}
+	return "", false
+}
+
+// IsTrustedProxy ip 是否为配置的反向代理, TrustedProxies 中可以是单个地址或 CIDR 网段
+func IsTrustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range Conf.Security.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, n, err := net.ParseCIDR(proxy); err == nil && n.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if proxyAddr := net.ParseIP(proxy); proxyAddr != nil && proxyAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitRule 获取操作的限流规则, 未配置时不限流
+func RateLimitRule(op string) (rate, burst int, ok bool) {
+	rule, ok := Conf.RateLimit[op]
+	if !ok || rule.Rate <= 0 || rule.Burst <= 0 {
+		return 0, 0, false
+	}
+	return rule.Rate, rule.Burst, true
+}
@@ -16,25 +16,187 @@ const (
 
 	MPPagePath = "pages/home/Home" // 微信公众号跳转小程序的页面, 支持带参数
 
+	// 小程序订阅消息模板的 thing 类型的值最长 20 个字符, 模板id见 config.Conf.Wechat.SubscribeTemplateID
+	SubscribeThingMaxLen = 20
+
 	/****************************************** timer ****************************************/
 
-	TimerSendDayNotice  = "0 0 9 * * *"  // 每天九点提醒
-	TimerSendWeekNotice = "0 0 18 * * 5" // 每周周五18点提醒
-	TimerEveryHour      = "@hourly"      // 每小时触发
+	// 提醒任务每小时执行, 按用户所在时区和免打扰时段决定是否发送, 每人每天/每周只发送一次
+	TimerSendDayNotice  = "0 0 * * * *"    // 每小时检查, 用户本地时间九点后发送每日提醒
+	TimerSendWeekNotice = "0 30 * * * 5,6" // 周五、周六每小时检查, 用户本地时间周五18点后发送每周提醒
+	TimerEveryHour      = "@hourly"        // 每小时触发
+	TimerPurgeTrash     = "0 0 4 * * *"    // 每天四点清理回收站
+
+	/****************************************** job ****************************************/
+
+	// 定时任务名, 同时作为分布式锁名
+	JobUpdateAccessToken  = "update_access_token"
+	JobUpdateExpireNotice = "update_expire_notice"
+	JobSendDayNotice      = "send_day_notice"
+	JobSendWeekNotice     = "send_week_notice"
+	JobPurgeTrash         = "purge_trash"
+
+	JobLockTTL  = time.Minute     // 锁过期时间, 持有期间每 1/3 TTL 续期一次
+	JobLockHold = time.Minute * 5 // 任务结束后锁继续保留的时间, 防止各实例时钟偏差导致重复执行
+
+	/****************************************** trash ****************************************/
+
+	// 解散的群组和删除的通知在回收站保留的天数, 可通过 config.Trash.RetentionDays 修改
+	TrashDefaultRetentionDays = 30
+
+	/****************************************** notice ****************************************/
+
+	NoticeMaxGroupNum = 10 // 多群组通知最多的接收群组数量
+
+	/****************************************** submission ****************************************/
+
+	// 提醒时间前 SubmissionRemindBefore 内, 每小时检查一次, 提醒还没有提交的用户, 每条通知每人只提醒一次
+	SubmissionRemindBefore  = time.Hour * 3
+	SubmissionContentMaxLen = 1000
+	SubmissionImgMaxNum     = 9
+
+	JobSendSubmissionRemind     = "send_submission_remind"
+	NotifyEventSubmissionRemind = "submissionRemind" // 提醒未提交作业的用户
+
+	SubmissionRemindTitle   = "作业还未提交：%s"
+	SubmissionRemindContent = "请在截止前完成并在小程序中提交"
+
+	/****************************************** comment ****************************************/
+
+	// 评论只有两层, 回复的回复归到同一条评论下, 通过 replyToUserID 区分回复对象
+	CommentContentMaxLen = 500
+	CommentMentionMaxNum = 10 // 每条评论最多提到的人数
+	CommentPageMaxNum    = 20
+
+	NotifyEventNoticeComment = "noticeComment" // 通知被评论、评论被回复或被提到
+
+	CommentNotifyTitle   = "新评论：%s"
+	CommentNotifyContent = "%s：%s"
+
+	/****************************************** subgroup ****************************************/
+
+	// 群组内的分组, 用于定向发送通知
+	SubgroupMaxNum     = 20
+	SubgroupNameMaxLen = 20
 
 	/****************************************** user ****************************************/
 
+	UserDefaultTimezone = "Asia/Shanghai"
+	UserQuietTimeLayout = "15:04" // 免打扰时段格式 HH:MM
+
+	// 注销账号: unionid 替换为匿名 id, 创建的群组按策略转让或解散
+	UserAnonIDPrefix           = "deleted:"
+	AccountGroupPolicyTransfer = "transfer" // 转让给第一个管理员, 没有管理员时转让给第一个成员, 都没有时解散
+	AccountGroupPolicyDissolve = "dissolve"
+
+	DayNoticeHour  = 9  // 每日提醒的本地时间
+	WeekNoticeHour = 18 // 每周提醒的本地时间(周五)
+
+	// 提醒方式
+	NotifyDigestAll  = 0 // 每日和每周提醒
+	NotifyDigestDay  = 1 // 仅每日提醒
+	NotifyDigestWeek = 2 // 仅每周提醒
+
+	// 提醒渠道
+	NotifyChannelOfficialAccount = "officialAccount" // 公众号模板消息
+	NotifyChannelSubscribe       = "subscribe"       // 小程序订阅消息
+	NotifyChannelEmail           = "email"           // 邮件
+	NotifyChannelWebhook         = "webhook"         // 用户自定义的 https 回调
+
+	// 提醒事件
+	NotifyEventDayNotice  = "dayNotice"  // 每日提醒
+	NotifyEventWeekNotice = "weekNotice" // 每周提醒
+	NotifyEventGroupJoin  = "groupJoin"  // 加入群组成功
+	NotifyEventFeedback   = "feedback"   // 用户反馈, 发送给管理员
+
+	/****************************************** webhook ****************************************/
+
+	// 群组 webhook 事件
+	WebhookEventNoticeCreated = "notice.created"
+	WebhookEventNoticeUpdated = "notice.updated"
+	WebhookEventNoticeDeleted = "notice.deleted"
+	WebhookEventNoticeExpired = "notice.expired"
+	WebhookEventMemberJoined  = "member.joined"
+	WebhookEventMemberLeft    = "member.left"
+
+	// 请求头, 签名为 hex(HMAC-SHA256(secret, "<timestamp>.<body>"))
+	WebhookHeaderEvent     = "X-Phs-Event"
+	WebhookHeaderDelivery  = "X-Phs-Delivery"
+	WebhookHeaderTimestamp = "X-Phs-Timestamp"
+	WebhookHeaderSignature = "X-Phs-Signature"
+
+	GroupWebhookMaxNum   = 5               // 每个群组最多的 webhook 数量
+	WebhookMaxAttempts   = 3               // 每次投递最多尝试次数
+	WebhookRetryInterval = time.Second * 2 // 首次重试间隔, 之后每次翻倍
+	WebhookSecretLen     = 16              // 自动生成的 secret 字节数
+
+	/****************************************** group role ****************************************/
+
+	GroupRoleMaxNum     = 10 // 每个群组最多的自定义角色数量
+	GroupRoleNameMaxLen = 20
+
+	/****************************************** group transfer ****************************************/
+
+	GroupTransferExpire = time.Hour * 72 // 转让请求的有效期, 过期后需重新发起
+
+	NotifyEventGroupTransfer = "groupTransfer" // 群组转让, 发送给转让双方
+
+	GroupTransferNotifyTitle    = "群组转让：%s"
+	GroupTransferRequestContent = "%s 想将群组转让给你, 请在小程序中确认"
+	GroupTransferAcceptContent  = "%s 已接受群组转让"
+	GroupTransferDeclineContent = "%s 拒绝了群组转让"
+
+	/****************************************** service auth ****************************************/
+
+	// /api/unopen 服务间认证的请求头
+	// 签名为 hex(HMAC-SHA256(secret, "<method>\n<uri>\n<timestamp>\n<nonce>\n<hex(sha256(body))>"))
+	ServiceAuthHeaderKeyID     = "X-Phs-Key-Id"
+	ServiceAuthHeaderTimestamp = "X-Phs-Timestamp"
+	ServiceAuthHeaderNonce     = "X-Phs-Nonce"
+	ServiceAuthHeaderSignature = "X-Phs-Signature"
+
+	ServiceAuthMaxSkew     = time.Minute * 5 // 请求时间与服务器时间的最大偏差
+	ServiceAuthNonceMinLen = 16
+	ServiceAuthBodyMax     = 1 << 20
+
+	/****************************************** rate limit ****************************************/
+
+	// 限流的操作名, 对应 config.RateLimit 中的 key
+	RateLimitGraphql = "graphql"
+	RateLimitLogin   = "login"
+	RateLimitUnopen  = "unopen"
+	RateLimitUpload  = "upload"
+
+	RateLimitSubjectUser = "user:%s" // 登录用户按 unionid 限流
+	RateLimitSubjectIP   = "ip:%s"
+
+	RateLimitContextKey ContextKey = "rateLimit"
+
 	/****************************************** feedback ****************************************/
 
 	/****************************************** wechat ****************************************/
 
 	WechatScanCodeJoinPhsMPGroup = "join/phs-mp/group/%s" // 加入班级事件 join/phs-mp/group/<group-code>
 
+	// 公众号事件
+	WechatMsgTypeEvent         = "event"
+	WechatEventSubscribe       = "subscribe"
+	WechatEventUnsubscribe     = "unsubscribe"
+	WechatEventScan            = "SCAN"
+	WechatSubscribeScenePrefix = "qrscene_" // 未关注用户扫码关注时 EventKey 的前缀
+	WechatEncryptTypeAES       = "aes"
+	WechatEventReplySuccess    = "success"
+
+	WechatEventMaxSkew = time.Minute * 5 // 公众号推送的 timestamp 与服务器时间的最大偏差
+	WechatEventTimeout = time.Second * 4 // 处理公众号事件的时间, 微信 5 秒内收不到回复会重试
+
 	/****************************************** img ****************************************/
 
 	ImgOps       = "imageView2/2/w/160/h/160" // 图片做缩略处理：w: 160, h: 160
 	ImgURIPrefix = "http://<image hostname>/"
 	ImgMicroSize = 160
+	ImgSizeLimit = 10 << 20 // 图片上传的大小上限, 单位字节
+	ImgMimeLimit = "image/*"
 
 	ImgDefaultGraoupHead = "http://<image hostname>/mp/head/logo1_%E6%96%B9.png"
 
@@ -47,6 +209,47 @@ const (
 	ImgPrefixFeedback      = "mp/feedback/"
 	ImgPrefixMicroFeedback = "mp/feedback/micro/"
 
+	ImgPrefixSubmission      = "mp/submission/"
+	ImgPrefixMicroSubmission = "mp/submission/micro/"
+
+	/****************************************** attachment ****************************************/
+
+	// 附件文件为 <AttachmentPrefix><kind>/<uuid><suffix>, 处理结果存放在下面的前缀中
+	AttachmentPrefix        = "mp/attachment/"
+	AttachmentThumbPrefix   = "mp/attachment/thumb/"   // 图片缩略图、视频封面
+	AttachmentPreviewPrefix = "mp/attachment/preview/" // 音频转码的 mp3、文档转换的 pdf
+
+	AttachmentAudioOps   = "avthumb/mp3/ab/64k"        // 音频转码为 mp3, 微信录音的 silk、amr 等格式无法直接播放
+	AttachmentVideoOps   = "vframe/jpg/offset/1/w/480" // 视频第一秒的画面作为封面
+	AttachmentFileOps    = "yifangyun_preview/v2"      // office 文档转换为 pdf 预览, pdf 文件不需要转换
+	AttachmentPDFSuffix  = ".pdf"
+	AttachmentMP3Suffix  = ".mp3"
+	AttachmentSuffixExpr = `^\.[A-Za-z0-9]{1,8}$`
+
+	AttachmentMaxNum     = 9 // 每条通知最多的附件数量
+	AttachmentNameMaxLen = 100
+
+	/****************************************** upload ****************************************/
+
+	// UploadCallbackBody 七牛上传回调的内容, 上传者和用途由服务端写入凭证, 客户端无法修改
+	// 使用表单格式, 七牛回调的签名只覆盖表单格式的请求体
+	UploadCallbackBody = "key=$(key)&hash=$(etag)&fsize=$(fsize)&mimeType=$(mimeType)&owner=%s&purpose=%d"
+
+	/****************************************** storage ****************************************/
+
+	StorageBackendQiniu = "qiniu"
+	StorageBackendS3    = "s3"
+	StorageBackendLocal = "local"
+
+	// 本地存储的上传和访问地址
+	LocalUploadPath = "/api/v1/files/upload"
+	LocalFilesPath  = "/files/"
+
+	// 数据库中只保存文件名, 返回给客户端时生成链接, 私有空间时为临时链接
+	FileKeyPrefix        = "mp/"
+	FileURLExpire        = time.Hour
+	FeedbackImgURLExpire = 7 * 24 * time.Hour // 反馈邮件中的图片链接, S3 最长 7 天
+
 	/****************************************** token ****************************************/
 
 	TokenQiniuExpire            = 7200
@@ -54,9 +257,21 @@ const (
 	JWTAuthScheme               = "Bearer"
 	JWTExpire                   = time.Hour * 24 * 7
 
+	/****************************************** timeout ****************************************/
+
+	RequestTimeout        = time.Second * 10 // 单个请求的处理时间
+	UpstreamTimeout       = time.Second * 5  // 调用微信等上游服务
+	RedisTimeout          = time.Second * 2  // 单条 redis 命令
+	BackgroundTaskTimeout = time.Minute      // 异步任务，如发送加群模板消息
+	TimerJobTimeout       = time.Minute * 30 // 定时任务，如发送每日提醒
+	ShutdownTimeout       = time.Second * 50 // 退出时等待请求和任务完成，需小于部署时的 stop_grace_period
+
 	/****************************************** other ****************************************/
 
 	APIPrefix = "/api/v1"
 
-	EmailFeedbackNotice = "联系方式：%s <br /> 反馈内容：%s <br />"
+	EmailFeedbackNotice  = "联系方式：%s <br /> 反馈内容：%s <br />"
+	EmailFeedbackSubject = "小灵通反馈"
+	EmailNoticeSubject   = "小灵通提醒：%s"
+	EmailNoticeContent   = "%s <br /> %s <br /> 时间：%s <br />"
 )
@@ -8,6 +8,15 @@ const (
 	TableGroup    = "group"
 	TableNotice   = "notice"
 	TableTemplate = "template"
+	TableFeedback = "feedback"
+	TableJobRun   = "job_runs"
+
+	TableGroupWebhook    = "group_webhook"
+	TableWebhookDelivery = "webhook_delivery"
+	TableGroupTransfer   = "group_transfer"
+	TableSubmission      = "submission"
+	TableComment         = "comment"
+	TableUpload          = "upload"
 
 	/****************************************** user ****************************************/
 
@@ -31,6 +40,39 @@ const (
 	FeedbackUnReadStatus = 0
 	FeedbackReadedStatus = 1
 
+	/****************************************** webhook ****************************************/
+
+	GroupWebhookDelStatus    = -10
+	GroupWebhookCommonStatus = 5
+
+	WebhookDeliveryFailStatus    = -5
+	WebhookDeliveryPendingStatus = 0
+	WebhookDeliverySuccessStatus = 5
+
+	/****************************************** group transfer ****************************************/
+
+	GroupTransferCancelStatus  = -10
+	GroupTransferDeclineStatus = -5
+	GroupTransferExpireStatus  = -1
+	GroupTransferPendingStatus = 0
+	GroupTransferAcceptStatus  = 5
+
+	/****************************************** submission ****************************************/
+
+	SubmissionUndoneStatus = 0 // 撤回完成
+	SubmissionDoneStatus   = 5
+
+	/****************************************** comment ****************************************/
+
+	CommentDeleteStatus = -10
+	CommentCommonStatus = 5
+
+	/****************************************** job run ****************************************/
+
+	JobRunRunningStatus = 0
+	JobRunSuccessStatus = 5
+	JobRunFailStatus    = -5
+
 	/****************************************** redis ****************************************/
 
 	RedisDefaultExpire     = 3600 * 24 * 7 // 7天
@@ -38,17 +80,30 @@ const (
 
 	RedisUserInfo = "user:info:%s" // format: user:info:<unionid>
 
-	// RedisUserWeekNotice RedisUserWeekNotice
-	//  format: user:notice:week:<week start timestamp>:<unionid>
-	// list value: notice id
-	RedisUserWeekNotice = "user:notice:week:%d:%s"
-	RedisUserWeek       = "user:notice:week:%d:*"
+	// 已发送提醒的标记, 避免每小时检查时重复发送
+	RedisUserDayNoticeSent  = "user:notice:day:%s:%s"  // format: user:notice:day:<local date>:<unionid>
+	RedisUserWeekNoticeSent = "user:notice:week:%d:%s" // format: user:notice:week:<week start timestamp>:<unionid>
+	RedisNoticeSentExpire   = 3600 * 24 * 8            // 8天
+
+	RedisSubmissionRemindSent = "submission:remind:%s:%s" // format: submission:remind:<notice _id>:<unionid>
 
-	RedisGroupInfo        = "group:info:%s"   // format: group:info:<_id>
-	RedisGroupCodePool    = "group:code:pool" // 列表存储圈子code, 每次存储 100 个
+	RedisGroupInfo        = "group:info:%s"      // format: group:info:<_id>
+	RedisGroupCodePool    = "group:code:pool:v2" // 列表存储预生成的圈子code, 每次存储 100 个, 旧的 group:code:pool 已不再使用
 	RedisGroupCodePoolNum = 100
-	RedisGroupCodeNextNum = "group:code:next_num" // 记录圈子code转换数字，初始 1000
-	RedisGroupInitNextNum = 1000
+	RedisGroupCodeSeq     = "group:code:seq" // 已分配的圈子code序号, 替代旧的 group:code:next_num
 
 	RedisWeixinAccessToken = "weixin:access_token"
+
+	RedisOfficialAccountAccessToken = "weixin:oa:access_token"
+	RedisWechatEventDedup           = "weixin:event:%s:%d:%s" // format: weixin:event:<openid>:<createTime>:<event>, 微信超时会重试
+	RedisWechatEventDedupExpire     = 600                     // 大于两倍的 constant.WechatEventMaxSkew, 覆盖重放的时间窗口
+
+	RedisServiceNonce       = "service:nonce:%s:%s" // format: service:nonce:<keyID>:<nonce>, 防止请求重放
+	RedisServiceNonceExpire = 600                   // 大于两倍的 constant.ServiceAuthMaxSkew
+
+	RedisRateLimit = "ratelimit:%s:%s" // format: ratelimit:<op>:<subject>, 令牌桶
+
+	RedisLock      = "lock:%s"       // format: lock:<name>, value: <owner>:<token>
+	RedisLockToken = "lock:token:%s" // format: lock:token:<name>, 自增的 fencing token
+	RedisLockFence = "lock:fence:%s" // format: lock:fence:<name>, 最近一次加锁成功的 token, 更小的 token 不能写入
 )
@@ -6,6 +6,8 @@ const (
 	ErrorMsgParamWrong = "param wrong"
 	ErrorMsgUserCreate = "创建用户错误"
 	ErrorMsgUnAuth     = "un auth"
+
+	ErrorMsgTooManyRequests = "请求过于频繁, 请 %d 秒后重试"
 )
 
 var (
@@ -14,9 +16,13 @@ var (
 	ErrorNotFound      = errors.New("not found")
 	ErrorHasExist      = errors.New("has exist")
 	ErrorNotExist      = errors.New("not exist")
+	ErrorExpired       = errors.New("expired")
 	ErrorParamWrong    = errors.New("param is wrong")
 	ErrorUnAuth        = errors.New("un auth")
+	ErrorNoPermission  = errors.New("no permission")
 	ErrorEmpty         = errors.New("empty error")
 	ErrorUnFollow      = errors.New("你还没有关注公众号")
 	ErrorBadGateway    = errors.New("服务器错误")
+	ErrorLockHeld      = errors.New("lock is held by others")
+	ErrorLockLost      = errors.New("lock is lost")
 )
@@ -22,12 +22,30 @@ const (
 	ReqNoticeUpdateNoteType
 	ReqNoticeUpdateNoticeTimeType
 	ReqNoticeUpdateGroupIDType
+	ReqNoticeUpdateAttachmentsType
 )
 
 const (
 	ImgTypeHomework = iota + 1
 	ImgTypeHead
 	ImgTypeFeedback
+	ImgTypeSubmission
+)
+
+// 附件的上传类型, 与 ImgType* 共用 qiniuToken 的 type 参数
+const (
+	UploadTypeAttachmentImage = iota + 101
+	UploadTypeAttachmentAudio
+	UploadTypeAttachmentVideo
+	UploadTypeAttachmentFile
+)
+
+// 附件类型
+const (
+	AttachmentKindImage = "image"
+	AttachmentKindAudio = "audio"
+	AttachmentKindVideo = "video"
+	AttachmentKindFile  = "file" // pdf 和 office 文档
 )
 
 const (
@@ -36,15 +54,75 @@ const (
 	GroupUserStatusMember
 )
 
+// 群组权限, 创建者拥有全部权限, 管理员和成员使用预设权限或被指定的自定义角色的权限
+const (
+	GroupPermPostNotice       = "postNotice"       // 发布通知
+	GroupPermEditOthersNotice = "editOthersNotice" // 编辑、删除他人发布的通知
+	GroupPermManageMembers    = "manageMembers"    // 移除成员
+	GroupPermManageRoles      = "manageRoles"      // 设置、取消、移除管理员, 管理自定义角色
+	GroupPermInvite           = "invite"           // 生成邀请二维码
+)
+
+// GroupTransferOldOwnerLeave 转让后原拥有者退出群组, 留在群组时为 GroupUserStatusManager 或 GroupUserStatusMember
+const GroupTransferOldOwnerLeave = 0
+
 var (
+	GroupPermissions = []string{
+		GroupPermPostNotice,
+		GroupPermEditOthersNotice,
+		GroupPermManageMembers,
+		GroupPermManageRoles,
+		GroupPermInvite,
+	}
+	// GroupRolePresets 未指定自定义角色时管理员和成员的权限
+	GroupRolePresets = map[int][]string{
+		GroupUserStatusManager: {
+			GroupPermPostNotice,
+			GroupPermEditOthersNotice,
+			GroupPermManageMembers,
+			GroupPermInvite,
+		},
+		GroupUserStatusMember: {
+			GroupPermInvite,
+		},
+	}
+
 	ImgPrefix = map[int]string{
-		ImgTypeHomework: ImgPrefixHomework,
-		ImgTypeHead:     ImgPrefixHead,
-		ImgTypeFeedback: ImgPrefixFeedback,
+		ImgTypeHomework:   ImgPrefixHomework,
+		ImgTypeHead:       ImgPrefixHead,
+		ImgTypeFeedback:   ImgPrefixFeedback,
+		ImgTypeSubmission: ImgPrefixSubmission,
 	}
 	ImgPrefixMicro = map[int]string{
-		ImgTypeHomework: ImgPrefixMicroHomework,
-		ImgTypeHead:     ImgPrefixMicroHead,
-		ImgTypeFeedback: ImgPrefixMicroFeedback,
+		ImgTypeHomework:   ImgPrefixMicroHomework,
+		ImgTypeHead:       ImgPrefixMicroHead,
+		ImgTypeFeedback:   ImgPrefixMicroFeedback,
+		ImgTypeSubmission: ImgPrefixMicroSubmission,
+	}
+	// PrivateFilePrefixes 私有空间时需要临时链接才能访问的文件, 头像等仍使用公开链接
+	PrivateFilePrefixes = []string{ImgPrefixHomework, ImgPrefixSubmission, ImgPrefixFeedback, AttachmentPrefix}
+
+	AttachmentUploadKinds = map[int]string{
+		UploadTypeAttachmentImage: AttachmentKindImage,
+		UploadTypeAttachmentAudio: AttachmentKindAudio,
+		UploadTypeAttachmentVideo: AttachmentKindVideo,
+		UploadTypeAttachmentFile:  AttachmentKindFile,
+	}
+	// AttachmentSizeLimit 各类附件的大小上限, 单位字节
+	AttachmentSizeLimit = map[string]int64{
+		AttachmentKindImage: 10 << 20,
+		AttachmentKindAudio: 20 << 20,
+		AttachmentKindVideo: 200 << 20,
+		AttachmentKindFile:  20 << 20,
+	}
+	// AttachmentMimeLimit 七牛上传策略的 mimeLimit, 多个用 ; 分隔
+	AttachmentMimeLimit = map[string]string{
+		AttachmentKindImage: "image/*",
+		AttachmentKindAudio: "audio/*",
+		AttachmentKindVideo: "video/*",
+		AttachmentKindFile: "application/pdf;application/msword;application/vnd.ms-excel;application/vnd.ms-powerpoint;" +
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document;" +
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet;" +
+			"application/vnd.openxmlformats-officedocument.presentationml.presentation",
 	}
 )
@@ -9,8 +9,13 @@ const (
 	// format https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=APPID&secret=APPSECRET
 	WechatTokenURIPrefix = "https://api.weixin.qq.com/cgi-bin/token"
 	// https://api.weixin.qq.com/cgi-bin/message/wxopen/template/send?access_token=ACCESS_TOKEN
+	// 小程序模板消息需要 form_id, 已被微信下线, 使用订阅消息 WechatSubscribeSendURIPrefix 代替
 	WechatTemplateSendURIPrefix = "https://api.weixin.qq.com/cgi-bin/message/wxopen/template/send"
-	WechatDefaultHeadImgURL     = "http://<image hostname>/user/wechat-default-headimgurl.jpg"
+	// https://api.weixin.qq.com/cgi-bin/message/subscribe/send?access_token=ACCESS_TOKEN
+	WechatSubscribeSendURIPrefix = "https://api.weixin.qq.com/cgi-bin/message/subscribe/send"
+	// https://api.weixin.qq.com/cgi-bin/user/info?access_token=ACCESS_TOKEN&openid=OPENID&lang=zh_CN
+	WechatUserInfoURIPrefix = "https://api.weixin.qq.com/cgi-bin/user/info"
+	WechatDefaultHeadImgURL = "http://<image hostname>/user/wechat-default-headimgurl.jpg"
 
 	URLCreateQrcode = "https://<hostname>/api/v1/qrcode"
 	URLQrcodeTicket = "https://mp.weixin.qq.com/cgi-bin/showqrcode?ticket=%s"
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var ownedGroupPolicyEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "ownedGroupPolicyEnum",
+	Description: "注销账号时创建的群组的处理方式",
+	Values: graphql.EnumValueConfigMap{
+		"transfer": &graphql.EnumValueConfig{
+			Value:       constant.AccountGroupPolicyTransfer,
+			Description: "转让给第一个管理员, 没有管理员时转让给第一个成员, 都没有时解散",
+		},
+		"dissolve": &graphql.EnumValueConfig{
+			Value:       constant.AccountGroupPolicyDissolve,
+			Description: "全部解散",
+		},
+	},
+})
+
+var deleteMyAccountArgs = graphql.FieldConfigArgument{
+	"ownedGroupPolicy": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(ownedGroupPolicyEnumType),
+		Description: "创建的群组的处理方式",
+	},
+}
+
+// exportMyData 以 JSON 字符串返回个人数据
+func exportMyData(p graphql.ResolveParams) (interface{}, error) {
+	userID := getJWTUserID(p)
+	data, err := model.ExportUserData(p.Context, userID)
+	if err != nil {
+		writeAccountLog("exportMyData", "导出个人数据失败", err)
+		return nil, err
+	}
+	res, err := jsoniter.MarshalToString(data)
+	if err != nil {
+		writeAccountLog("exportMyData", "导出个人数据失败", err)
+		return nil, constant.ErrorBadGateway
+	}
+	return res, nil
+}
+
+func deleteMyAccount(p graphql.ResolveParams) (interface{}, error) {
+	policy, _ := p.Args["ownedGroupPolicy"].(string)
+	userID := getJWTUserID(p)
+	if err := model.DeleteUserAccount(p.Context, userID, policy); err != nil {
+		writeAccountLog("deleteMyAccount", "注销账号失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func writeAccountLog(funcName, errMsg string, err error) {
+	writeLog("account.go", funcName, errMsg, err)
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var commentType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "comment",
+	Description: "提醒的评论",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if comment, ok := p.Source.(model.Comment); ok {
+					return comment.ID.Hex(), nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"noticeID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "提醒id",
+		},
+		"parentID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "所属的一级评论id, 一级评论为空",
+		},
+		"replyToUserID": &graphql.Field{
+			Type:        graphql.String,
+			Description: "回复的用户 unionid",
+		},
+		"userID": &graphql.Field{
+			Type:        graphql.String,
+			Description: "作者 unionid",
+		},
+		"content": &graphql.Field{
+			Type:        graphql.String,
+			Description: "内容",
+		},
+		"mentionUserIDs": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "提到的用户 unionid",
+		},
+		"createTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "创建时间",
+		},
+		"updateTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "更新时间",
+		},
+	},
+})
+
+var commentConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "commentConnection",
+	Description: "分页的一级评论",
+	Fields: graphql.Fields{
+		"totalCount": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "一级评论总数",
+		},
+		"comments": &graphql.Field{
+			Type:        graphql.NewList(commentType),
+			Description: "一级评论",
+		},
+		"hasNextPage": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "是否有下一页",
+		},
+		"endCursor": &graphql.Field{
+			Type:        graphql.String,
+			Description: "最后一条评论的 id, 作为下一页的 after",
+		},
+	},
+})
+
+func init() {
+	commentType.AddFieldConfig("replies", &graphql.Field{
+		Type:        graphql.NewList(commentType),
+		Description: "回复, 只有一级评论有",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if comment, ok := p.Source.(model.Comment); ok {
+				replies, err := model.GetCommentReplies(p.Context, comment)
+				if err != nil {
+					writeCommentLog("comment.replies", "获取回复失败", err)
+					return nil, constant.ErrorBadGateway
+				}
+				return replies, nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
+	noticeType.AddFieldConfig("comments", &graphql.Field{
+		Type:        commentConnectionType,
+		Description: "评论, 按发表顺序分页",
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{
+				Type:         graphql.Int,
+				Description:  "一页数量，限制范围: 1~20",
+				DefaultValue: 10,
+			},
+			"after": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "上一页的 endCursor, 为空时从第一条开始",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			notice, ok := p.Source.(model.Notice)
+			if !ok {
+				return nil, constant.ErrorEmpty
+			}
+			first, _ := p.Args["first"].(int)
+			after, _ := p.Args["after"].(string)
+			connection, err := model.GetNoticeComments(p.Context, notice.ID.Hex(), getJWTUserID(p), first, after)
+			if err != nil {
+				writeCommentLog("notice.comments", "获取评论失败", err)
+				return nil, err
+			}
+			return connection, nil
+		},
+	})
+}
+
+var addCommentArgs = graphql.FieldConfigArgument{
+	"noticeID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "提醒id",
+	},
+	"parentID": &graphql.ArgumentConfig{
+		Type:        graphql.ID,
+		Description: "回复的评论id, 为空时评论提醒",
+	},
+	"content": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "内容, 最长500个字符",
+	},
+	"mentionUserIDs": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.String),
+		Description: "提到的用户 unionid, 须为接收群组中的用户, 最多10个",
+	},
+}
+
+var updateCommentArgs = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "评论id",
+	},
+	"content": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "内容, 最长500个字符",
+	},
+	"mentionUserIDs": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.String),
+		Description: "提到的用户 unionid, 整体替换, 只提醒新增的用户",
+	},
+}
+
+func addComment(p graphql.ResolveParams) (interface{}, error) {
+	comment := model.Comment{}
+	comment.NoticeID, _ = p.Args["noticeID"].(string)
+	comment.ParentID, _ = p.Args["parentID"].(string)
+	comment.Content, _ = p.Args["content"].(string)
+	comment.MentionUserIDs = getMentionUserIDsArg(p)
+
+	comment, err := model.AddComment(p.Context, getJWTUserID(p), comment)
+	if err != nil {
+		writeCommentLog("addComment", "发表评论失败", err)
+		return nil, err
+	}
+	return comment, nil
+}
+
+func updateComment(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	content, _ := p.Args["content"].(string)
+	comment, err := model.UpdateComment(p.Context, id, getJWTUserID(p), content, getMentionUserIDsArg(p))
+	if err != nil {
+		writeCommentLog("updateComment", "编辑评论失败", err)
+		return nil, err
+	}
+	return comment, nil
+}
+
+func deleteComment(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if err := model.DeleteComment(p.Context, id, getJWTUserID(p)); err != nil {
+		writeCommentLog("deleteComment", "删除评论失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func getMentionUserIDsArg(p graphql.ResolveParams) []string {
+	userIDs := []string{}
+	if list, ok := p.Args["mentionUserIDs"].([]interface{}); ok {
+		for _, userID := range list {
+			if s, ok := userID.(string); ok {
+				userIDs = append(userIDs, s)
+			}
+		}
+	}
+	return userIDs
+}
+
+func writeCommentLog(funcName, errMsg string, err error) {
+	writeLog("comment.go", funcName, errMsg, err)
+}
@@ -1,9 +1,7 @@
 package controller
 
 import (
-	"config"
-	"constant"
-	"fmt"
+	"context"
 	"model"
 	"util"
 
@@ -31,15 +29,20 @@ func createFeedback(p graphql.ResolveParams) (interface{}, error) {
 	if err != nil {
 		return false, err
 	}
+	feedback, err = model.NewFeedback(p.Context, getJWTUserID(p), feedback)
+	if err != nil {
+		writeFeedbackLog("createFeedback", "创建反馈失败", err)
+		return false, err
+	}
+	if err := model.SaveFeedback(p.Context, feedback); err != nil {
+		writeFeedbackLog("createFeedback", "保存反馈失败", err)
+	}
 	// 提醒管理员有人反馈了
-	go func() {
-		imgHTML := "<img src=\"%s\"  alt=\"反馈图片\" />"
-		content := fmt.Sprintf(constant.EmailFeedbackNotice, feedback.ContactWay, feedback.Content)
-		for _, img := range feedback.Imgs {
-			content += "<br />" + fmt.Sprintf(imgHTML, img.URL)
+	util.GoBackground(func(ctx context.Context) {
+		if err := model.NotifyFeedback(ctx, feedback); err != nil {
+			writeFeedbackLog("createFeedback", "发送反馈提醒失败", err)
 		}
-		util.SendEmail("小灵通", "小灵通反馈", content, config.Conf.EmailInfo.To)
-	}()
+	})
 
 	return true, nil
 }
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"constant"
+	"context"
 	"controller/param"
 	"fmt"
 	"model"
@@ -95,7 +96,7 @@ var groupType = graphql.NewObject(graphql.ObjectConfig{
 		},
 		"ticket": &graphql.Field{
 			Type:        ticketType,
-			Description: "二维码",
+			Description: "邀请二维码, 没有邀请权限时为空",
 			Resolve:     getGroupQrcode,
 		},
 		"nickname": &graphql.Field{
@@ -110,6 +111,10 @@ var groupType = graphql.NewObject(graphql.ObjectConfig{
 			Type:        graphql.Int,
 			Description: "创建时间毫秒时间戳",
 		},
+		"deletedAt": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "删除时间毫秒时间戳, 仅回收站中有值",
+		},
 		"personNum": &graphql.Field{
 			Type:        graphql.Int,
 			Description: "总人数：1 + 管理员人数 + 成员人数",
@@ -123,7 +128,7 @@ func init() {
 		Description: "创建者信息",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if group, ok := p.Source.(model.Group); ok {
-				return model.GetRedisUserInfo(group.OwnerID)
+				return model.GetRedisUserInfo(p.Context, group.OwnerID)
 			}
 			writeGroupLog("managers", "获取群组创建者信息失败", nil)
 			return nil, constant.ErrorEmpty
@@ -134,7 +139,7 @@ func init() {
 		Description: "管理员",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if group, ok := p.Source.(model.Group); ok {
-				return model.GetRedisUserInfos(group.ManagerIDs)
+				return model.GetRedisUserInfos(p.Context, group.ManagerIDs)
 			}
 			writeGroupLog("managers", "获取群组管理员信息失败", nil)
 			return nil, constant.ErrorEmpty
@@ -145,7 +150,7 @@ func init() {
 		Description: "成员",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if group, ok := p.Source.(model.Group); ok {
-				return model.GetRedisUserInfos(group.MemberIDs)
+				return model.GetRedisUserInfos(p.Context, group.MemberIDs)
 			}
 			writeGroupLog("managers", "获取群组成员信息失败", nil)
 			return nil, constant.ErrorEmpty
@@ -154,11 +159,15 @@ func init() {
 }
 
 func getGroupQrcode(p graphql.ResolveParams) (interface{}, error) {
-	code, _ := p.Args["code"].(string)
-	if code == "" {
-		return nil, constant.ErrorParamWrong
+	group, ok := p.Source.(model.Group)
+	if !ok {
+		return nil, constant.ErrorEmpty
+	}
+	// 没有邀请权限时不生成二维码
+	if !model.HasGroupPermission(group, getJWTUserID(p), constant.GroupPermInvite) {
+		return nil, nil
 	}
-	res, err := model.CreateQrcodeByGroupCode(code)
+	res, err := model.CreateQrcodeByGroupCode(p.Context, group.Code)
 	if err != nil {
 		writeGroupLog("getGroupQrcode", "获取二维码失败", err)
 		return nil, constant.ErrorBadGateway
@@ -194,7 +203,7 @@ func getGroupUserStatus(p graphql.ResolveParams) (interface{}, error) {
 
 func getGroupByCode(p graphql.ResolveParams) (interface{}, error) {
 	if code, ok := p.Args["code"].(string); ok {
-		return model.GetGroupByCode(code)
+		return model.GetGroupByCode(p.Context, code)
 	}
 	return nil, constant.ErrorParamWrong
 }
@@ -215,11 +224,11 @@ func createGroup(p graphql.ResolveParams) (interface{}, error) {
 	nickname := p.Args["nickname"].(string)
 	avatarURL := p.Args["avatarUrl"].(string)
 	userID := getJWTUserID(p)
-	// if isFollow, _ := model.IsFollowOfficeAccount(userID); !isFollow {
-	// 	model.SetUserFollowStatus(userID, isFollow)
+	// if isFollow, _ := model.IsFollowOfficeAccount(p.Context, userID); !isFollow {
+	// 	model.SetUserFollowStatus(p.Context, userID, isFollow)
 	// 	return nil, constant.ErrorUnFollow
 	// }
-	code, err := model.CreateGroup(userID, nickname, avatarURL)
+	code, err := model.CreateGroup(p.Context, userID, nickname, avatarURL)
 	if err != nil {
 		writeGroupLog("CreateGroup", "创建群组失败", err)
 		return nil, err
@@ -235,11 +244,17 @@ func joinGroup(p graphql.ResolveParams) (interface{}, error) {
 	code := p.Args["code"].(string)
 	userID := getJWTUserID(p)
 
-	if isFollow, _ := model.IsFollowOfficeAccount(userID); !isFollow {
-		model.SetUserFollowStatus(userID, isFollow)
+	isFollow, err := model.IsUserFollow(p.Context, userID)
+	if err != nil {
+		// 客户端断开或上游超时，不能据此认为用户未关注
+		writeGroupLog("joinGroup", "获取关注状态失败", err)
+		return false, constant.ErrorBadGateway
+	}
+	if !isFollow {
+		model.SetUserFollowStatus(p.Context, userID, isFollow)
 		return false, constant.ErrorUnFollow
 	}
-	err := model.JoinGroup(code, userID)
+	err = model.JoinGroup(p.Context, code, userID)
 	if err != nil {
 		writeGroupLog("joinGroup", "加入群组失败", err)
 		return false, err
@@ -252,7 +267,7 @@ func leaveGroup(p graphql.ResolveParams) (interface{}, error) {
 	code := p.Args["code"].(string)
 	userID := getJWTUserID(p)
 
-	err := model.LeaveGroup(code, userID)
+	err := model.LeaveGroup(p.Context, code, userID)
 	if err != nil {
 		writeGroupLog("leaveGroup", "离开群组失败", err)
 		return false, err
@@ -267,7 +282,7 @@ var updateGroupMembersEnumType = graphql.NewEnum(graphql.EnumConfig{
 	Values: graphql.EnumValueConfigMap{
 		"UpdateOwner": &graphql.EnumValueConfig{
 			Value:       constant.ReqGroupUpdateOwnerType,
-			Description: "更新拥有者(转让群组，且只能转给管理员)",
+			Description: "更新拥有者(发起群组转让，接收人确认后生效，原拥有者成为成员)",
 		},
 		"DelOwner": &graphql.EnumValueConfig{
 			Value:       constant.ReqGroupDelOwnerType,
@@ -315,7 +330,7 @@ func updateGroupMembers(p graphql.ResolveParams) (interface{}, error) {
 		return false, err
 	}
 
-	update := map[int]func(string, string, []string) error{
+	update := map[int]func(context.Context, string, string, []string) error{
 		constant.ReqGroupUpdateOwnerType:  model.UpdateGroupOwner,
 		constant.ReqGroupDelOwnerType:     model.DelGroupOwner,
 		constant.ReqGroupSetManagerType:   model.SetGroupManager,
@@ -325,8 +340,7 @@ func updateGroupMembers(p graphql.ResolveParams) (interface{}, error) {
 	}
 	if f, ok := update[data.Type]; ok {
 		userID := getJWTUserID(p)
-		err = f(data.GroupID, userID, data.UserIDs)
-
+		err = f(p.Context, data.GroupID, userID, data.UserIDs)
 	} else {
 		err = constant.ErrorParamWrong
 	}
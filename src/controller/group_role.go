@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var groupPermissionEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "groupPermissionEnum",
+	Description: "群组权限",
+	Values: graphql.EnumValueConfigMap{
+		"postNotice": &graphql.EnumValueConfig{
+			Value:       constant.GroupPermPostNotice,
+			Description: "发布通知",
+		},
+		"editOthersNotice": &graphql.EnumValueConfig{
+			Value:       constant.GroupPermEditOthersNotice,
+			Description: "编辑、删除他人发布的通知",
+		},
+		"manageMembers": &graphql.EnumValueConfig{
+			Value:       constant.GroupPermManageMembers,
+			Description: "移除成员",
+		},
+		"manageRoles": &graphql.EnumValueConfig{
+			Value:       constant.GroupPermManageRoles,
+			Description: "设置、取消、移除管理员, 管理自定义角色",
+		},
+		"invite": &graphql.EnumValueConfig{
+			Value:       constant.GroupPermInvite,
+			Description: "生成邀请二维码",
+		},
+	},
+})
+
+var groupRoleType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "groupRole",
+	Description: "群组自定义角色",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "角色id",
+		},
+		"name": &graphql.Field{
+			Type:        graphql.String,
+			Description: "名称",
+		},
+		"permissions": &graphql.Field{
+			Type:        graphql.NewList(groupPermissionEnumType),
+			Description: "权限",
+		},
+	},
+})
+
+var groupUserRoleType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "groupUserRole",
+	Description: "被指定了自定义角色的用户",
+	Fields: graphql.Fields{
+		"userID": &graphql.Field{
+			Type:        graphql.String,
+			Description: "用户 unionid",
+		},
+		"roleID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "角色id",
+		},
+	},
+})
+
+func init() {
+	groupType.AddFieldConfig("roles", &graphql.Field{
+		Type:        graphql.NewList(groupRoleType),
+		Description: "自定义角色",
+	})
+	groupType.AddFieldConfig("userRoles", &graphql.Field{
+		Type:        graphql.NewList(groupUserRoleType),
+		Description: "被指定了自定义角色的用户",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if group, ok := p.Source.(model.Group); ok {
+				res := []map[string]interface{}{}
+				for userID, roleID := range group.UserRoles {
+					res = append(res, map[string]interface{}{
+						"userID": userID,
+						"roleID": roleID,
+					})
+				}
+				return res, nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
+	groupType.AddFieldConfig("permissions", &graphql.Field{
+		Type:        graphql.NewList(groupPermissionEnumType),
+		Description: "当前用户在群组中的权限",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if group, ok := p.Source.(model.Group); ok {
+				return model.GroupUserPermissions(group, getJWTUserID(p)), nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
+}
+
+var groupRoleArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"roleID": &graphql.ArgumentConfig{
+		Type:        graphql.ID,
+		Description: "角色id, 更新时必填",
+	},
+	"name": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "名称, 最长20个字符",
+	},
+	"permissions": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.NewList(groupPermissionEnumType)),
+		Description: "权限",
+	},
+}
+
+var deleteGroupRoleArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"roleID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "角色id",
+	},
+}
+
+var setGroupUserRoleArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"userID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "管理员或成员的 unionid",
+	},
+	"roleID": &graphql.ArgumentConfig{
+		Type:        graphql.ID,
+		Description: "角色id, 为空时恢复为预设权限",
+	},
+}
+
+func createGroupRole(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	name, _ := p.Args["name"].(string)
+	role, err := model.CreateGroupRole(p.Context, groupID, getJWTUserID(p), name, getPermissionsArg(p))
+	if err != nil {
+		writeGroupRoleLog("createGroupRole", "创建角色失败", err)
+		return nil, err
+	}
+	return role, nil
+}
+
+func updateGroupRole(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	roleID, _ := p.Args["roleID"].(string)
+	name, _ := p.Args["name"].(string)
+	if roleID == "" {
+		return nil, constant.ErrorParamWrong
+	}
+	role, err := model.UpdateGroupRole(p.Context, groupID, getJWTUserID(p), roleID, name, getPermissionsArg(p))
+	if err != nil {
+		writeGroupRoleLog("updateGroupRole", "更新角色失败", err)
+		return nil, err
+	}
+	return role, nil
+}
+
+func deleteGroupRole(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	roleID, _ := p.Args["roleID"].(string)
+	if err := model.DeleteGroupRole(p.Context, groupID, getJWTUserID(p), roleID); err != nil {
+		writeGroupRoleLog("deleteGroupRole", "删除角色失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func setGroupUserRole(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	userID, _ := p.Args["userID"].(string)
+	roleID, _ := p.Args["roleID"].(string)
+	if err := model.SetGroupUserRole(p.Context, groupID, getJWTUserID(p), userID, roleID); err != nil {
+		writeGroupRoleLog("setGroupUserRole", "指定角色失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func getPermissionsArg(p graphql.ResolveParams) []string {
+	permissions := []string{}
+	if list, ok := p.Args["permissions"].([]interface{}); ok {
+		for _, permission := range list {
+			if s, ok := permission.(string); ok {
+				permissions = append(permissions, s)
+			}
+		}
+	}
+	return permissions
+}
+
+func writeGroupRoleLog(funcName, errMsg string, err error) {
+	writeLog("group_role.go", funcName, errMsg, err)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var groupTransferStatusEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "groupTransferStatusEnum",
+	Description: "群组转让状态",
+	Values: graphql.EnumValueConfigMap{
+		"cancel": &graphql.EnumValueConfig{
+			Value:       constant.GroupTransferCancelStatus,
+			Description: "已取消",
+		},
+		"decline": &graphql.EnumValueConfig{
+			Value:       constant.GroupTransferDeclineStatus,
+			Description: "已拒绝",
+		},
+		"expire": &graphql.EnumValueConfig{
+			Value:       constant.GroupTransferExpireStatus,
+			Description: "已过期",
+		},
+		"pending": &graphql.EnumValueConfig{
+			Value:       constant.GroupTransferPendingStatus,
+			Description: "待确认",
+		},
+		"accept": &graphql.EnumValueConfig{
+			Value:       constant.GroupTransferAcceptStatus,
+			Description: "已接受",
+		},
+	},
+})
+
+var oldOwnerRoleEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "oldOwnerRoleEnum",
+	Description: "转让后原拥有者的身份",
+	Values: graphql.EnumValueConfigMap{
+		"manager": &graphql.EnumValueConfig{
+			Value:       constant.GroupUserStatusManager,
+			Description: "成为管理员",
+		},
+		"member": &graphql.EnumValueConfig{
+			Value:       constant.GroupUserStatusMember,
+			Description: "成为成员",
+		},
+		"leave": &graphql.EnumValueConfig{
+			Value:       constant.GroupTransferOldOwnerLeave,
+			Description: "退出群组",
+		},
+	},
+})
+
+var groupTransferType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "groupTransfer",
+	Description: "群组转让",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if transfer, ok := p.Source.(model.GroupTransfer); ok {
+					return transfer.ID.Hex(), nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"status": &graphql.Field{
+			Type:        groupTransferStatusEnumType,
+			Description: "状态",
+		},
+		"groupID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "群组id",
+		},
+		"fromUserID": &graphql.Field{
+			Type:        graphql.String,
+			Description: "原拥有者 unionid",
+		},
+		"toUserID": &graphql.Field{
+			Type:        graphql.String,
+			Description: "接收人 unionid",
+		},
+		"oldOwnerRole": &graphql.Field{
+			Type:        oldOwnerRoleEnumType,
+			Description: "转让后原拥有者的身份",
+		},
+		"createTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "创建时间",
+		},
+		"expireTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "过期时间, 过期后不能再接受",
+		},
+		"updateTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "更新时间",
+		},
+	},
+})
+
+var transferGroupOwnershipArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"toUserID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "接收人 unionid, 须为群组的管理员或成员",
+	},
+	"oldOwnerRole": &graphql.ArgumentConfig{
+		Type:         oldOwnerRoleEnumType,
+		Description:  "转让后自己的身份, 默认成为成员",
+		DefaultValue: constant.GroupUserStatusMember,
+	},
+}
+
+var respondGroupTransferArgs = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "转让id",
+	},
+	"accept": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Boolean),
+		Description: "是否接受",
+	},
+}
+
+func transferGroupOwnership(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	toUserID, _ := p.Args["toUserID"].(string)
+	oldOwnerRole, _ := p.Args["oldOwnerRole"].(int)
+
+	transfer, err := model.TransferGroupOwnership(p.Context, groupID, getJWTUserID(p), toUserID, oldOwnerRole)
+	if err != nil {
+		writeGroupTransferLog("transferGroupOwnership", "发起转让失败", err)
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func respondGroupTransfer(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	accept, _ := p.Args["accept"].(bool)
+
+	transfer, err := model.RespondGroupTransfer(p.Context, id, getJWTUserID(p), accept)
+	if err != nil {
+		writeGroupTransferLog("respondGroupTransfer", "处理转让失败", err)
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func cancelGroupTransfer(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if err := model.CancelGroupTransfer(p.Context, id, getJWTUserID(p)); err != nil {
+		writeGroupTransferLog("cancelGroupTransfer", "取消转让失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func getGroupTransfers(p graphql.ResolveParams) (interface{}, error) {
+	transfers, err := model.GetGroupTransfers(p.Context, getJWTUserID(p))
+	if err != nil {
+		writeGroupTransferLog("getGroupTransfers", "获取转让失败", err)
+		return nil, constant.ErrorBadGateway
+	}
+	return transfers, nil
+}
+
+func writeGroupTransferLog(funcName, errMsg string, err error) {
+	writeLog("group_transfer.go", funcName, errMsg, err)
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var jobRunsArgs = graphql.FieldConfigArgument{
+	"name": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "任务名, 为空时获取所有任务",
+	},
+	"page": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "页数, 从1开始",
+	},
+	"perPage": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "一页数量，限制范围: 1~50",
+	},
+}
+
+var jobRunStatusEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "jobRunStatusEnum",
+	Description: "定时任务执行状态",
+	Values: graphql.EnumValueConfigMap{
+		"running": &graphql.EnumValueConfig{
+			Value:       constant.JobRunRunningStatus,
+			Description: "执行中",
+		},
+		"success": &graphql.EnumValueConfig{
+			Value:       constant.JobRunSuccessStatus,
+			Description: "成功",
+		},
+		"fail": &graphql.EnumValueConfig{
+			Value:       constant.JobRunFailStatus,
+			Description: "失败",
+		},
+	},
+})
+
+var jobRunType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "jobRun",
+	Description: "定时任务执行记录",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if run, ok := p.Source.(model.JobRun); ok {
+					return run.ID.Hex(), nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"name": &graphql.Field{
+			Type:        graphql.String,
+			Description: "任务名",
+		},
+		"status": &graphql.Field{
+			Type:        jobRunStatusEnumType,
+			Description: "状态",
+		},
+		"owner": &graphql.Field{
+			Type:        graphql.String,
+			Description: "执行的实例",
+		},
+		"token": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "分布式锁的 fencing token, 越大越晚",
+		},
+		"startTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "开始时间",
+		},
+		"endTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "结束时间",
+		},
+		"count": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "处理数量",
+		},
+		"error": &graphql.Field{
+			Type:        graphql.String,
+			Description: "失败原因",
+		},
+	},
+})
+
+func getJobRuns(p graphql.ResolveParams) (interface{}, error) {
+	if !isAdmin(getJWTUserID(p)) {
+		return nil, constant.ErrorUnAuth
+	}
+	name, _ := p.Args["name"].(string)
+	page, _ := p.Args["page"].(int)
+	perPage, _ := p.Args["perPage"].(int)
+	if page <= 0 || perPage <= 0 || perPage > 50 {
+		writeJobLog("getJobRuns", constant.ErrorMsgParamWrong, nil)
+		return nil, constant.ErrorParamWrong
+	}
+
+	runs, err := model.GetJobRuns(p.Context, name, page, perPage)
+	if err != nil {
+		writeJobLog("getJobRuns", "获取定时任务执行记录失败", err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+func writeJobLog(funcName, errMsg string, err error) {
+	writeLog("job.go", funcName, errMsg, err)
+}
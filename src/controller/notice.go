@@ -97,7 +97,28 @@ var noticeType = graphql.NewObject(graphql.ObjectConfig{
 		},
 		"groupID": &graphql.Field{
 			Type:        graphql.ID,
-			Description: "群组 _id",
+			Description: "群组 _id, 多群组通知时为第一个群组",
+		},
+		"groupIDs": &graphql.Field{
+			Type:        graphql.NewList(graphql.ID),
+			Description: "所有接收群组 _id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if notice, ok := p.Source.(model.Notice); ok {
+					if len(notice.GroupIDs) > 0 {
+						return notice.GroupIDs, nil
+					}
+					return []string{notice.GroupID}, nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"targetUserIDs": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "定向通知指定的用户 unionid",
+		},
+		"subgroupIDs": &graphql.Field{
+			Type:        graphql.NewList(graphql.ID),
+			Description: "定向通知指定的分组id",
 		},
 		"title": &graphql.Field{
 			Type:        graphql.String,
@@ -109,7 +130,31 @@ var noticeType = graphql.NewObject(graphql.ObjectConfig{
 		},
 		"imgs": &graphql.Field{
 			Type:        graphql.NewList(imgType),
-			Description: "图片",
+			Description: "图片, 私有空间时只返回给可以查看通知的用户",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				notice, ok := p.Source.(model.Notice)
+				if !ok {
+					return nil, nil
+				}
+				if !model.CanViewNoticeFiles(p.Context, notice, getJWTUserID(p)) {
+					return []model.Img{}, nil
+				}
+				return notice.Imgs, nil
+			},
+		},
+		"attachments": &graphql.Field{
+			Type:        graphql.NewList(attachmentType),
+			Description: "附件, 私有空间时只返回给可以查看通知的用户",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				notice, ok := p.Source.(model.Notice)
+				if !ok {
+					return nil, nil
+				}
+				if !model.CanViewNoticeFiles(p.Context, notice, getJWTUserID(p)) {
+					return []model.Attachment{}, nil
+				}
+				return notice.Attachments, nil
+			},
 		},
 		"note": &graphql.Field{
 			Type:        graphql.String,
@@ -119,6 +164,10 @@ var noticeType = graphql.NewObject(graphql.ObjectConfig{
 			Type:        graphql.Int,
 			Description: "创建时间毫秒时间戳",
 		},
+		"deletedAt": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "删除时间毫秒时间戳, 仅回收站中有值",
+		},
 		"noticeTime": &graphql.Field{
 			Type:        graphql.Int,
 			Description: "提醒时间毫秒时间戳",
@@ -134,13 +183,47 @@ var noticeType = graphql.NewObject(graphql.ObjectConfig{
 	},
 })
 
+var noticeGroupStatType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "noticeGroupStat",
+	Description: "通知在一个接收群组中的查看统计",
+	Fields: graphql.Fields{
+		"groupID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "群组 _id",
+		},
+		"personNum": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "群组总人数",
+		},
+		"watchNum": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "群组中查看过的人数",
+		},
+	},
+})
+
 func init() {
+	noticeType.AddFieldConfig("groupStats", &graphql.Field{
+		Type:        graphql.NewList(noticeGroupStatType),
+		Description: "按接收群组的查看统计",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if notice, ok := p.Source.(model.Notice); ok {
+				stats, err := model.GetNoticeGroupStats(p.Context, notice.ID.Hex())
+				if err != nil {
+					writeNoticeLog("groupStats", "获取查看统计失败", err)
+					return nil, constant.ErrorBadGateway
+				}
+				return stats, nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
 	noticeType.AddFieldConfig("groupInfo", &graphql.Field{
 		Type:        groupType,
 		Description: "群组信息",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if notice, ok := p.Source.(model.Notice); ok {
-				groupInfos, err := model.GetRedisGroupInfos([]string{notice.GroupID})
+				groupInfos, err := model.GetRedisGroupInfos(p.Context, []string{notice.GroupID})
 				if len(groupInfos) == 1 {
 					return groupInfos[0], nil
 				}
@@ -156,7 +239,7 @@ func getNotice(p graphql.ResolveParams) (interface{}, error) {
 	if !ok || id == "" {
 		return nil, constant.ErrorParamWrong
 	}
-	return model.GetNotice(id)
+	return model.GetNotice(p.Context, id)
 }
 
 func getNotices(p graphql.ResolveParams) (interface{}, error) {
@@ -174,7 +257,7 @@ func getNotices(p graphql.ResolveParams) (interface{}, error) {
 	userID := getJWTUserID(p)
 	var groups []string
 	if data.Type == constant.ReqNoticeGetAllType {
-		ownGroups, manageGroups, joinGroups, err := model.FindGroupsByUserID(userID)
+		ownGroups, manageGroups, joinGroups, err := model.FindGroupsByUserID(p.Context, userID)
 		if err != nil {
 			writeGroupLog("getNotices", "查询用户群组", err)
 			return nil, err
@@ -188,7 +271,7 @@ func getNotices(p graphql.ResolveParams) (interface{}, error) {
 		groups = []string{data.Code}
 	}
 
-	return model.GetNotices(groups, data.Page, data.PerPage)
+	return model.GetNotices(p.Context, userID, groups, data.Page, data.PerPage)
 }
 
 var updateNoticeEnumType = graphql.NewEnum(graphql.EnumConfig{
@@ -223,6 +306,10 @@ var updateNoticeEnumType = graphql.NewEnum(graphql.EnumConfig{
 			Value:       constant.ReqNoticeUpdateGroupIDType,
 			Description: "更新groupID",
 		},
+		"UpdateAttachments": &graphql.EnumValueConfig{
+			Value:       constant.ReqNoticeUpdateAttachmentsType,
+			Description: "更新attachments",
+		},
 	},
 })
 
@@ -242,6 +329,18 @@ var noticeArgsType = graphql.NewInputObject(graphql.InputObjectConfig{
 			Description: "群组id",
 			Type:        graphql.String,
 		},
+		"groupIDs": &graphql.InputObjectFieldConfig{
+			Description: "多群组通知的接收群组id, 最多10个, 创建时使用",
+			Type:        graphql.NewList(graphql.ID),
+		},
+		"targetUserIDs": &graphql.InputObjectFieldConfig{
+			Description: "定向通知指定的用户 unionid, 须在接收群组中, 创建时使用",
+			Type:        graphql.NewList(graphql.String),
+		},
+		"subgroupIDs": &graphql.InputObjectFieldConfig{
+			Description: "定向通知指定的分组id, 须属于接收群组, 创建时使用",
+			Type:        graphql.NewList(graphql.ID),
+		},
 		"title": &graphql.InputObjectFieldConfig{
 			Description: "作业标题",
 			Type:        graphql.String,
@@ -254,6 +353,10 @@ var noticeArgsType = graphql.NewInputObject(graphql.InputObjectConfig{
 			Description: "图片",
 			Type:        graphql.NewList(imgArgsType),
 		},
+		"attachments": &graphql.InputObjectFieldConfig{
+			Description: "附件, 最多9个",
+			Type:        graphql.NewList(attachmentArgsType),
+		},
 		"note": &graphql.InputObjectFieldConfig{
 			Description: "注释",
 			Type:        graphql.String,
@@ -290,6 +393,10 @@ var noticeArgs = graphql.FieldConfigArgument{
 		Description: "图片",
 		Type:        graphql.NewList(imgArgsType),
 	},
+	"attachments": &graphql.ArgumentConfig{
+		Description: "附件, 最多9个",
+		Type:        graphql.NewList(attachmentArgsType),
+	},
 	"note": &graphql.ArgumentConfig{
 		Description: "注释",
 		Type:        graphql.String,
@@ -326,6 +433,9 @@ func updateNotice(p graphql.ResolveParams) (interface{}, error) {
 		if len(data.Imgs) > 0 {
 			updateData["imgs"] = data.Imgs
 		}
+		if len(data.Attachments) > 0 {
+			updateData["attachments"] = data.Attachments
+		}
 	case constant.ReqNoticeUpdateContentType:
 		if data.Content == "" {
 			err = constant.ErrorParamWrong
@@ -353,6 +463,11 @@ func updateNotice(p graphql.ResolveParams) (interface{}, error) {
 			err = constant.ErrorParamWrong
 		}
 		updateData["groupID"] = data.GroupID
+	case constant.ReqNoticeUpdateAttachmentsType:
+		if data.Attachments == nil {
+			data.Attachments = []model.Attachment{}
+		}
+		updateData["attachments"] = data.Attachments
 	default:
 		err = constant.ErrorParamWrong
 	}
@@ -363,7 +478,7 @@ func updateNotice(p graphql.ResolveParams) (interface{}, error) {
 	}
 
 	userID := getJWTUserID(p)
-	err = model.UpdateNotice(data.ID.Hex(), userID, updateData)
+	err = model.UpdateNotice(p.Context, data.ID.Hex(), userID, updateData)
 	if err != nil {
 		writeNoticeLog("updateNotice", "更新通知失败", err)
 		return false, err
@@ -393,7 +508,7 @@ func createNotices(p graphql.ResolveParams) (interface{}, error) {
 	}
 
 	userID := getJWTUserID(p)
-	err = model.CreateNotices(userID, data.Notices)
+	err = model.CreateNotices(p.Context, userID, data.Notices)
 	if err != nil {
 		writeNoticeLog("CreateNotices", constant.ErrorMsgParamWrong, err)
 		return false, err
@@ -401,14 +516,19 @@ func createNotices(p graphql.ResolveParams) (interface{}, error) {
 	return true, nil
 }
 
+func watchNotice(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if err := model.WatchNotice(p.Context, id, getJWTUserID(p)); err != nil {
+		writeNoticeLog("watchNotice", "记录查看失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
 func deleteNotice(p graphql.ResolveParams) (interface{}, error) {
 	id := p.Args["id"].(string)
 	userID := getJWTUserID(p)
-	updateData := map[string]interface{}{
-		"status": constant.NoticeDeleteStatus,
-	}
-
-	if err := model.UpdateNotice(id, userID, updateData); err != nil {
+	if err := model.DeleteNotice(p.Context, id, userID); err != nil {
 		writeNoticeLog("DeleteNotice", "删除通知失败", err)
 		return false, err
 	}
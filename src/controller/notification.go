@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"constant"
+	"model"
+	"util"
+
+	"github.com/graphql-go/graphql"
+)
+
+var notifyDigestEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "notifyDigestEnum",
+	Description: "提醒方式",
+	Values: graphql.EnumValueConfigMap{
+		"all": &graphql.EnumValueConfig{
+			Value:       constant.NotifyDigestAll,
+			Description: "每日和每周提醒",
+		},
+		"day": &graphql.EnumValueConfig{
+			Value:       constant.NotifyDigestDay,
+			Description: "仅每日提醒",
+		},
+		"week": &graphql.EnumValueConfig{
+			Value:       constant.NotifyDigestWeek,
+			Description: "仅每周提醒",
+		},
+	},
+})
+
+var notifyChannelEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "notifyChannelEnum",
+	Description: "提醒渠道",
+	Values: graphql.EnumValueConfigMap{
+		"officialAccount": &graphql.EnumValueConfig{
+			Value:       constant.NotifyChannelOfficialAccount,
+			Description: "公众号模板消息, 需关注公众号",
+		},
+		"subscribe": &graphql.EnumValueConfig{
+			Value:       constant.NotifyChannelSubscribe,
+			Description: "小程序订阅消息, 需在小程序中授权订阅, 未配置订阅消息模板时不可用",
+		},
+		"email": &graphql.EnumValueConfig{
+			Value:       constant.NotifyChannelEmail,
+			Description: "邮件, 需设置 email",
+		},
+		"webhook": &graphql.EnumValueConfig{
+			Value:       constant.NotifyChannelWebhook,
+			Description: "https 回调, 需设置 webhookUrl",
+		},
+	},
+})
+
+var notificationSettingsType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "notificationSettings",
+	Description: "提醒设置",
+	Fields: graphql.Fields{
+		"mutedGroupIDs": &graphql.Field{
+			Type:        graphql.NewList(graphql.ID),
+			Description: "不接收提醒的群组id",
+		},
+		"digest": &graphql.Field{
+			Type:        notifyDigestEnumType,
+			Description: "提醒方式",
+		},
+		"quietStart": &graphql.Field{
+			Type:        graphql.String,
+			Description: "免打扰开始时间 HH:MM",
+		},
+		"quietEnd": &graphql.Field{
+			Type:        graphql.String,
+			Description: "免打扰结束时间 HH:MM, 可跨零点",
+		},
+		"timezone": &graphql.Field{
+			Type:        graphql.String,
+			Description: "时区, 如 Asia/Shanghai",
+		},
+		"channels": &graphql.Field{
+			Type:        graphql.NewList(notifyChannelEnumType),
+			Description: "接收渠道, 为空时使用公众号模板消息",
+		},
+		"email": &graphql.Field{
+			Type:        graphql.String,
+			Description: "邮件渠道的邮箱",
+		},
+		"webhookUrl": &graphql.Field{
+			Type:        graphql.String,
+			Description: "webhook 渠道的地址",
+		},
+	},
+})
+
+var updateNotificationSettingsArgs = graphql.FieldConfigArgument{
+	"mutedGroupIDs": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.ID),
+		Description: "不接收提醒的群组id, 只能是自己所在的群组",
+	},
+	"digest": &graphql.ArgumentConfig{
+		Type:         notifyDigestEnumType,
+		Description:  "提醒方式",
+		DefaultValue: constant.NotifyDigestAll,
+	},
+	"quietStart": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "免打扰开始时间 HH:MM, 与 quietEnd 同时为空表示关闭免打扰",
+	},
+	"quietEnd": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "免打扰结束时间 HH:MM",
+	},
+	"timezone": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "时区, 如 Asia/Shanghai, 为空时使用默认时区",
+	},
+	"channels": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(notifyChannelEnumType),
+		Description: "接收渠道, 可多选",
+	},
+	"email": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "邮件渠道的邮箱",
+	},
+	"webhookUrl": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "webhook 渠道的地址, 必须为 https",
+	},
+}
+
+func init() {
+	userType.AddFieldConfig("notificationSettings", &graphql.Field{
+		Type:        notificationSettingsType,
+		Description: "提醒设置, 仅本人可见",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if user, ok := p.Source.(model.User); ok {
+				if user.Unionid != getJWTUserID(p) {
+					return nil, nil
+				}
+				return user.NotificationSettings, nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
+}
+
+func updateNotificationSettings(p graphql.ResolveParams) (interface{}, error) {
+	settings := model.NotificationSettings{}
+	err := util.MapToJSONStruct(p.Args, &settings)
+	if err != nil {
+		writeNotificationLog("updateNotificationSettings", constant.ErrorMsgParamWrong, err)
+		return nil, err
+	}
+
+	settings, err = model.UpdateNotificationSettings(p.Context, getJWTUserID(p), settings)
+	if err != nil {
+		writeNotificationLog("updateNotificationSettings", "更新提醒设置失败", err)
+		return nil, err
+	}
+	return settings, nil
+}
+
+func writeNotificationLog(funcName, errMsg string, err error) {
+	writeLog("notification.go", funcName, errMsg, err)
+}
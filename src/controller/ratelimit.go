@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"config"
+	"constant"
+	"context"
+	"fmt"
+	"math"
+	"model"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/graphql-go/graphql"
+)
+
+// rateLimitState 一次 graphql 请求中被限流的最长等待时间, 用于设置 Retry-After
+type rateLimitState struct {
+	mu         sync.Mutex
+	ip         string
+	retryAfter time.Duration
+}
+
+func (this *rateLimitState) setRetryAfter(d time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if d > this.retryAfter {
+		this.retryAfter = d
+	}
+}
+
+func (this *rateLimitState) getRetryAfter() time.Duration {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.retryAfter
+}
+
+// retryAfterWriter 在响应写出前加上 Retry-After
+type retryAfterWriter struct {
+	http.ResponseWriter
+	state       *rateLimitState
+	wroteHeader bool
+}
+
+func (this *retryAfterWriter) WriteHeader(code int) {
+	if !this.wroteHeader {
+		this.wroteHeader = true
+		if d := this.state.getRetryAfter(); d > 0 {
+			this.Header().Set("Retry-After", retryAfterSeconds(d))
+		}
+	}
+	this.ResponseWriter.WriteHeader(code)
+}
+
+func (this *retryAfterWriter) Write(b []byte) (int, error) {
+	if !this.wroteHeader {
+		this.WriteHeader(http.StatusOK)
+	}
+	return this.ResponseWriter.Write(b)
+}
+
+// RateLimit REST 接口按 IP 限流, 超出时返回 429
+func RateLimit(op string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowHTTPRequest(w, r, op) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowHTTPRequest 按 IP 限流, 不允许时写入 429 响应
+func allowHTTPRequest(w http.ResponseWriter, r *http.Request, op string) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), constant.RedisTimeout)
+	defer cancel()
+
+	ok, retryAfter, err := model.AllowRequest(ctx, op, fmt.Sprintf(constant.RateLimitSubjectIP, clientIP(r)))
+	if err != nil {
+		// redis 不可用时不限流, 避免影响正常请求
+		writeRateLimitLog("allowHTTPRequest", op, err)
+		return true
+	}
+	if !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		resJSONError(w, http.StatusTooManyRequests, fmt.Sprintf(constant.ErrorMsgTooManyRequests, retryAfterCeil(retryAfter)))
+		return false
+	}
+	return true
+}
+
+// rateLimited graphql 操作限流, 登录用户按 unionid, 未登录按 IP
+func rateLimited(op string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		state, _ := p.Context.Value(constant.RateLimitContextKey).(*rateLimitState)
+		subject := ""
+		if user, ok := p.Context.Value(constant.JWTContextKey).(jwt.MapClaims); ok {
+			if userID, ok := user["userID"].(string); ok && userID != "" {
+				subject = fmt.Sprintf(constant.RateLimitSubjectUser, userID)
+			}
+		}
+		if subject == "" && state != nil {
+			subject = fmt.Sprintf(constant.RateLimitSubjectIP, state.ip)
+		}
+		if subject == "" {
+			return resolve(p)
+		}
+
+		ok, retryAfter, err := model.AllowRequest(p.Context, op, subject)
+		if err != nil {
+			writeRateLimitLog("rateLimited", op, err)
+			return resolve(p)
+		}
+		if !ok {
+			if state != nil {
+				state.setRetryAfter(retryAfter)
+			}
+			return nil, fmt.Errorf(constant.ErrorMsgTooManyRequests, retryAfterCeil(retryAfter))
+		}
+		return resolve(p)
+	}
+}
+
+// clientIP 客户端地址, 只有来自 config.Security.TrustedProxies 的请求才使用代理设置的请求头, 否则可以伪造请求头绕过限流
+// 优先使用 nginx 设置的 X-Real-IP, 其次为 X-Forwarded-For 中从右往左第一个不是代理的地址
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !config.IsTrustedProxy(host) {
+		return host
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	ips := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if ip != "" && !config.IsTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return host
+}
+
+func retryAfterCeil(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
+
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(retryAfterCeil(d))
+}
+
+func writeRateLimitLog(funcName, errMsg string, err error) {
+	writeLog("ratelimit.go", funcName, errMsg, err)
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"config"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := config.Conf.Security.TrustedProxies
+	config.Conf.Security.TrustedProxies = []string{"127.0.0.1", "10.0.0.0/8"}
+	defer func() { config.Conf.Security.TrustedProxies = proxies }()
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIP       string
+		forwardedFor string
+		want         string
+	}{
+		{"direct", "1.2.3.4:5678", "", "", "1.2.3.4"},
+		{"direct with forged headers", "1.2.3.4:5678", "9.9.9.9", "8.8.8.8", "1.2.3.4"},
+		{"proxy with X-Real-IP", "127.0.0.1:5678", "9.9.9.9", "8.8.8.8", "9.9.9.9"},
+		{"proxy with X-Forwarded-For", "127.0.0.1:5678", "", "8.8.8.8, 9.9.9.9", "9.9.9.9"},
+		{"proxy chain", "10.0.0.2:5678", "", "8.8.8.8, 9.9.9.9, 10.0.0.1", "9.9.9.9"},
+		{"proxy without headers", "10.0.0.2:5678", "", "", "10.0.0.2"},
+		{"untrusted private address", "192.168.1.2:5678", "9.9.9.9", "", "192.168.1.2"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"constant"
+	"context"
 	"controller/param"
 	"model"
 	"net/http"
@@ -63,6 +64,9 @@ var (
  */
 
 func Login(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := newRequestContext(r)
+	defer cancel()
+
 	data := param.WeixinLoginData{}
 	err := loadJSONData(r, &data)
 	if err != nil {
@@ -71,7 +75,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	weixinSessRes, err := model.GetWeixinSession(data.Code)
+	weixinSessRes, err := model.GetWeixinSession(ctx, data.Code)
 	if err != nil {
 		writeRestLog("Login", constant.ErrorMsgParamWrong, err)
 		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
@@ -100,7 +104,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = model.CreateUser(userInfo)
+	err = model.CreateUser(ctx, userInfo)
 	if err != nil {
 		writeRestLog("Login", constant.ErrorMsgUserCreate, err)
 		resJSONError(w, http.StatusBadGateway, constant.ErrorMsgUserCreate)
@@ -119,7 +123,12 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 /**
  * @apiDefine JoinGroupFromOfficialAccounts JoinGroupFromOfficialAccounts
- * @apiDescription 加入群组(不对前端开放)
+ * @apiDescription 加入群组(不对前端开放), 需要服务间签名, 见 ServiceAuth
+ *
+ * @apiHeader {String} X-Phs-Key-Id 服务密钥 id
+ * @apiHeader {String} X-Phs-Timestamp 秒级时间戳, 与服务器时间相差不超过 5 分钟
+ * @apiHeader {String} X-Phs-Nonce 随机字符串, 至少 16 位, 不可重复使用
+ * @apiHeader {String} X-Phs-Signature sha256=hex(HMAC-SHA256(secret, "method\nuri\ntimestamp\nnonce\nhex(sha256(body))"))
  *
  * @apiParam {String} code 圈子code
  * @apiParam {String} id unionid
@@ -154,6 +163,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
  * @apiUse JoinGroupFromOfficialAccounts
  */
 func JoinGroupFromOfficialAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := newRequestContext(r)
+	defer cancel()
+
 	data := param.CodeUserInfo{}
 	err := loadJSONData(r, &data)
 	if err != nil {
@@ -168,8 +180,8 @@ func JoinGroupFromOfficialAccounts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	model.CreateUser(data.DecryptUserInfo)
-	err = model.JoinGroup(data.Code, data.UnionID)
+	model.CreateUser(ctx, data.DecryptUserInfo)
+	err = model.JoinGroup(ctx, data.Code, data.UnionID)
 	if err != nil {
 		writeRestLog("JoinGroupFromOfficialAccounts", "加入群组失败", err)
 		resJSONError(w, http.StatusBadGateway, "加入群组失败")
@@ -177,12 +189,17 @@ func JoinGroupFromOfficialAccounts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 发送模板消息
-	go model.SendGroupJoinTemplate(data.UnionID, data.Code)
+	util.GoBackground(func(ctx context.Context) {
+		model.SendGroupJoinTemplate(ctx, data.UnionID, data.Code)
+	})
 
 	resJSONData(w, nil)
 }
 
 func GetGroupInfo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := newRequestContext(r)
+	defer cancel()
+
 	codes := r.URL.Query()["code"]
 	if len(codes) == 0 || codes[0] == "" {
 		writeRestLog("GetGroupInfo", constant.ErrorMsgParamWrong, constant.ErrorParamWrong)
@@ -190,7 +207,7 @@ func GetGroupInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	code := codes[0]
-	group, _ := model.GetGroupByCode(code)
+	group, _ := model.GetGroupByCode(ctx, code)
 	resData := map[string]interface{}{
 		"nickname":  group.Nickname,
 		"avatarUrl": group.AvatarURL,
@@ -35,6 +35,11 @@ var (
 				Description: "获取用户信息",
 				Resolve:     getUserByUnionid,
 			},
+			"exportMyData": &graphql.Field{
+				Type:        graphql.String,
+				Description: "导出个人数据, JSON 格式: 个人信息、群组、创建的通知、反馈、查看和点赞记录",
+				Resolve:     rateLimited("exportMyData", exportMyData),
+			},
 			"notice": &graphql.Field{
 				Args:        idArgs,
 				Type:        noticeType,
@@ -51,7 +56,7 @@ var (
 				Args:        codeArgs,
 				Type:        groupType,
 				Description: "获取圈子信息",
-				Resolve:     getGroupByCode,
+				Resolve:     rateLimited("group", getGroupByCode),
 			},
 			"template": &graphql.Field{
 				Args:        idArgs,
@@ -59,6 +64,39 @@ var (
 				Description: "获取模板信息",
 				Resolve:     getTemplate,
 			},
+			"groupWebhooks": &graphql.Field{
+				Args:        groupIDArgs,
+				Type:        graphql.NewList(webhookType),
+				Description: "获取群组的 webhook, 仅创建者可用",
+				Resolve:     getGroupWebhooks,
+			},
+			"webhookDeliveries": &graphql.Field{
+				Args:        webhookDeliveriesArgs,
+				Type:        graphql.NewList(webhookDeliveryType),
+				Description: "获取 webhook 的投递记录, 仅群组创建者可用",
+				Resolve:     getWebhookDeliveries,
+			},
+			"groupTransfers": &graphql.Field{
+				Type:        graphql.NewList(groupTransferType),
+				Description: "自己发起或待自己确认的群组转让",
+				Resolve:     getGroupTransfers,
+			},
+			"trashGroups": &graphql.Field{
+				Type:        graphql.NewList(groupType),
+				Description: "回收站中自己解散的群组",
+				Resolve:     getTrashGroups,
+			},
+			"trashNotices": &graphql.Field{
+				Type:        graphql.NewList(noticeType),
+				Description: "回收站中自己删除的通知",
+				Resolve:     getTrashNotices,
+			},
+			"jobRuns": &graphql.Field{
+				Args:        jobRunsArgs,
+				Type:        graphql.NewList(jobRunType),
+				Description: "获取定时任务执行记录, 仅管理员可用",
+				Resolve:     getJobRuns,
+			},
 		},
 	})
 
@@ -74,19 +112,31 @@ var (
 				Args:        createFeedbackArgs,
 				Type:        graphql.Boolean,
 				Description: "创建反馈",
-				Resolve:     createFeedback,
+				Resolve:     rateLimited("createFeedback", createFeedback),
+			},
+			"updateNotificationSettings": &graphql.Field{
+				Args:        updateNotificationSettingsArgs,
+				Type:        notificationSettingsType,
+				Description: "更新提醒设置",
+				Resolve:     updateNotificationSettings,
+			},
+			"deleteMyAccount": &graphql.Field{
+				Args:        deleteMyAccountArgs,
+				Type:        graphql.Boolean,
+				Description: "注销账号, 个人信息被清空且无法恢复",
+				Resolve:     deleteMyAccount,
 			},
 			"createGroup": &graphql.Field{
 				Args:        createGroupArgs,
 				Type:        groupType,
 				Description: "创建群组",
-				Resolve:     createGroup,
+				Resolve:     rateLimited("createGroup", createGroup),
 			},
 			"joinGroup": &graphql.Field{
 				Args:        codeArgs,
 				Type:        graphql.Boolean,
 				Description: "加入群组",
-				Resolve:     joinGroup,
+				Resolve:     rateLimited("joinGroup", joinGroup),
 			},
 			"leaveGroup": &graphql.Field{
 				Args:        codeArgs,
@@ -97,14 +147,98 @@ var (
 			"updateGroupMembers": &graphql.Field{
 				Args:        updateGroupMembersArgs,
 				Type:        graphql.Boolean,
-				Description: "更新群组成员, 按照权限限制: 创建者 > 管理员 > 成员, 如：管理员可以删除成员",
+				Description: "更新群组成员, 按照群组权限限制, 如：有 manageMembers 权限的用户可以删除成员",
 				Resolve:     updateGroupMembers,
 			},
+			"createGroupRole": &graphql.Field{
+				Args:        groupRoleArgs,
+				Type:        groupRoleType,
+				Description: "创建群组自定义角色, 需要 manageRoles 权限",
+				Resolve:     createGroupRole,
+			},
+			"updateGroupRole": &graphql.Field{
+				Args:        groupRoleArgs,
+				Type:        groupRoleType,
+				Description: "更新群组自定义角色, 需要 manageRoles 权限",
+				Resolve:     updateGroupRole,
+			},
+			"deleteGroupRole": &graphql.Field{
+				Args:        deleteGroupRoleArgs,
+				Type:        graphql.Boolean,
+				Description: "删除群组自定义角色, 已指定的用户恢复为预设权限",
+				Resolve:     deleteGroupRole,
+			},
+			"setGroupUserRole": &graphql.Field{
+				Args:        setGroupUserRoleArgs,
+				Type:        graphql.Boolean,
+				Description: "为管理员或成员指定自定义角色, 需要 manageRoles 权限",
+				Resolve:     setGroupUserRole,
+			},
+			"createSubgroup": &graphql.Field{
+				Args:        subgroupArgs,
+				Type:        subgroupType,
+				Description: "创建群组分组, 需要 manageMembers 权限",
+				Resolve:     createSubgroup,
+			},
+			"updateSubgroup": &graphql.Field{
+				Args:        subgroupArgs,
+				Type:        subgroupType,
+				Description: "更新群组分组的名称和成员, 需要 manageMembers 权限",
+				Resolve:     updateSubgroup,
+			},
+			"deleteSubgroup": &graphql.Field{
+				Args:        deleteSubgroupArgs,
+				Type:        graphql.Boolean,
+				Description: "删除群组分组, 需要 manageMembers 权限",
+				Resolve:     deleteSubgroup,
+			},
+			"transferGroupOwnership": &graphql.Field{
+				Args:        transferGroupOwnershipArgs,
+				Type:        groupTransferType,
+				Description: "发起群组转让, 仅创建者可用, 接收人确认后生效",
+				Resolve:     transferGroupOwnership,
+			},
+			"respondGroupTransfer": &graphql.Field{
+				Args:        respondGroupTransferArgs,
+				Type:        groupTransferType,
+				Description: "接受或拒绝群组转让",
+				Resolve:     respondGroupTransfer,
+			},
+			"cancelGroupTransfer": &graphql.Field{
+				Args:        idArgs,
+				Type:        graphql.Boolean,
+				Description: "取消自己发起的群组转让",
+				Resolve:     cancelGroupTransfer,
+			},
+			"restoreGroup": &graphql.Field{
+				Args:        idArgs,
+				Type:        groupType,
+				Description: "恢复解散的群组, 仅创建者可用, 成员重新加入",
+				Resolve:     restoreGroup,
+			},
+			"createGroupWebhook": &graphql.Field{
+				Args:        createGroupWebhookArgs,
+				Type:        createdWebhookType,
+				Description: "创建群组 webhook, 仅创建者可用",
+				Resolve:     rateLimited("createGroupWebhook", createGroupWebhook),
+			},
+			"deleteGroupWebhook": &graphql.Field{
+				Args:        idArgs,
+				Type:        graphql.Boolean,
+				Description: "删除群组 webhook",
+				Resolve:     deleteGroupWebhook,
+			},
+			"redeliverWebhook": &graphql.Field{
+				Args:        idArgs,
+				Type:        webhookDeliveryType,
+				Description: "重新投递, id 为投递记录id",
+				Resolve:     rateLimited("redeliverWebhook", redeliverWebhook),
+			},
 			"createNotices": &graphql.Field{
 				Args:        noticesArgs,
 				Type:        graphql.Boolean,
-				Description: "创建提醒",
-				Resolve:     createNotices,
+				Description: "创建提醒, 指定 groupIDs 时一条提醒发送给多个群组",
+				Resolve:     rateLimited("createNotices", createNotices),
 			},
 			"updateNotice": &graphql.Field{
 				Args:        noticeArgs,
@@ -112,12 +246,54 @@ var (
 				Description: "更新提醒",
 				Resolve:     updateNotice,
 			},
+			"watchNotice": &graphql.Field{
+				Args:        idArgs,
+				Type:        graphql.Boolean,
+				Description: "记录查看了提醒, 用于按群组统计查看人数",
+				Resolve:     watchNotice,
+			},
+			"submitNotice": &graphql.Field{
+				Args:        submitNoticeArgs,
+				Type:        submissionType,
+				Description: "提交作业并标记完成, 每条提醒只能提交一次, 之后使用 updateSubmission 修改",
+				Resolve:     submitNotice,
+			},
+			"updateSubmission": &graphql.Field{
+				Args:        updateSubmissionArgs,
+				Type:        submissionType,
+				Description: "修改自己的作业提交, 内容和图片整体替换",
+				Resolve:     updateSubmission,
+			},
+			"addComment": &graphql.Field{
+				Args:        addCommentArgs,
+				Type:        commentType,
+				Description: "评论提醒或回复评论, 提醒创建者、被回复和被提到的用户",
+				Resolve:     rateLimited("addComment", addComment),
+			},
+			"updateComment": &graphql.Field{
+				Args:        updateCommentArgs,
+				Type:        commentType,
+				Description: "作者编辑评论",
+				Resolve:     updateComment,
+			},
+			"deleteComment": &graphql.Field{
+				Args:        idArgs,
+				Type:        graphql.Boolean,
+				Description: "删除评论, 作者、提醒的创建者和有 editOthersNotice 权限的用户可以删除",
+				Resolve:     deleteComment,
+			},
 			"deleteNotice": &graphql.Field{
 				Args:        idArgs,
 				Type:        graphql.Boolean,
-				Description: "删除提醒",
+				Description: "删除提醒, 放入回收站",
 				Resolve:     deleteNotice,
 			},
+			"restoreNotice": &graphql.Field{
+				Args:        idArgs,
+				Type:        noticeType,
+				Description: "恢复回收站中的提醒",
+				Resolve:     restoreNotice,
+			},
 		},
 	})
 )
@@ -149,6 +325,17 @@ func Graphql(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(context.Background(), constant.JWTContextKey, user)
-	handler.ContextHandler(ctx, w, r)
+	if !allowHTTPRequest(w, r, constant.RateLimitGraphql) {
+		return
+	}
+
+	// 客户端断开或超时后，resolver 中的 mongo、redis 和上游请求随之取消
+	ctx, cancel := context.WithTimeout(r.Context(), constant.RequestTimeout)
+	defer cancel()
+
+	// resolver 中被限流时通过 Retry-After 告知客户端
+	state := &rateLimitState{ip: clientIP(r)}
+	ctx = context.WithValue(ctx, constant.JWTContextKey, user)
+	ctx = context.WithValue(ctx, constant.RateLimitContextKey, state)
+	handler.ContextHandler(ctx, &retryAfterWriter{ResponseWriter: w, state: state}, r)
 }
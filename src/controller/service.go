@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"bytes"
+	"config"
+	"constant"
+	"errors"
+	"io/ioutil"
+	"model"
+	"net/http"
+	"strings"
+	"util"
+)
+
+var (
+	errServiceKeyUnknown    = errors.New("unknown service key")
+	errServiceTimestamp     = errors.New("service request timestamp out of range")
+	errServiceNonce         = errors.New("service request nonce invalid")
+	errServiceNonceReplayed = errors.New("service request nonce replayed")
+	errServiceSignature     = errors.New("service request signature wrong")
+)
+
+// ServiceAuth /api/unopen 接口的服务间认证
+// 调用方使用 config.Security.ServiceKeys 中的密钥对请求签名, 时间戳超出范围或 nonce 重复的请求会被拒绝
+func ServiceAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := newRequestContext(r)
+		defer cancel()
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, constant.ServiceAuthBodyMax))
+		if err != nil {
+			writeServiceLog("ServiceAuth", constant.ErrorMsgParamWrong, err)
+			resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+			return
+		}
+
+		keyID := r.Header.Get(constant.ServiceAuthHeaderKeyID)
+		if err = verifyServiceRequest(r, keyID, body); err != nil {
+			writeServiceLog("ServiceAuth", keyID, err)
+			resJSONError(w, http.StatusUnauthorized, constant.ErrorMsgUnAuth)
+			return
+		}
+
+		// 签名通过后再记录 nonce, 避免伪造请求占用 nonce
+		nonce := r.Header.Get(constant.ServiceAuthHeaderNonce)
+		ok, err := model.ClaimServiceNonce(ctx, keyID, nonce)
+		if err != nil {
+			writeServiceLog("ServiceAuth", "记录 nonce 失败", err)
+			resJSONError(w, http.StatusBadGateway, constant.ErrorBadGateway.Error())
+			return
+		}
+		if !ok {
+			writeServiceLog("ServiceAuth", keyID, errServiceNonceReplayed)
+			resJSONError(w, http.StatusUnauthorized, constant.ErrorMsgUnAuth)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+func verifyServiceRequest(r *http.Request, keyID string, body []byte) error {
+	secret, ok := config.ServiceKeySecret(keyID)
+	if !ok {
+		return errServiceKeyUnknown
+	}
+
+	timestamp := r.Header.Get(constant.ServiceAuthHeaderTimestamp)
+	if !util.TimestampWithin(timestamp, constant.ServiceAuthMaxSkew) {
+		return errServiceTimestamp
+	}
+
+	nonce := r.Header.Get(constant.ServiceAuthHeaderNonce)
+	if len(nonce) < constant.ServiceAuthNonceMinLen || strings.ContainsAny(nonce, ": \n") {
+		return errServiceNonce
+	}
+
+	signature := strings.TrimPrefix(r.Header.Get(constant.ServiceAuthHeaderSignature), "sha256=")
+	message := util.ServiceSignMessage(r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !util.VerifyHMACSHA256Hex(secret, message, signature) {
+		return errServiceSignature
+	}
+	return nil
+}
+
+func writeServiceLog(funcName, errMsg string, err error) {
+	writeLog("service.go", funcName, errMsg, err)
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var subgroupType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "subgroup",
+	Description: "群组分组, 用于定向通知",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "分组id",
+		},
+		"name": &graphql.Field{
+			Type:        graphql.String,
+			Description: "名称",
+		},
+		"userIDs": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "分组成员 unionid",
+		},
+	},
+})
+
+func init() {
+	groupType.AddFieldConfig("subgroups", &graphql.Field{
+		Type:        graphql.NewList(subgroupType),
+		Description: "分组",
+	})
+}
+
+var subgroupArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"subgroupID": &graphql.ArgumentConfig{
+		Type:        graphql.ID,
+		Description: "分组id, 更新时必填",
+	},
+	"name": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "名称, 最长20个字符",
+	},
+	"userIDs": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.String)),
+		Description: "分组成员 unionid, 须为群组中的用户",
+	},
+}
+
+var deleteSubgroupArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"subgroupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "分组id",
+	},
+}
+
+func createSubgroup(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	name, _ := p.Args["name"].(string)
+	subgroup, err := model.CreateSubgroup(p.Context, groupID, getJWTUserID(p), name, getUserIDsArg(p))
+	if err != nil {
+		writeSubgroupLog("createSubgroup", "创建分组失败", err)
+		return nil, err
+	}
+	return subgroup, nil
+}
+
+func updateSubgroup(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	subgroupID, _ := p.Args["subgroupID"].(string)
+	name, _ := p.Args["name"].(string)
+	if subgroupID == "" {
+		return nil, constant.ErrorParamWrong
+	}
+	subgroup, err := model.UpdateSubgroup(p.Context, groupID, getJWTUserID(p), subgroupID, name, getUserIDsArg(p))
+	if err != nil {
+		writeSubgroupLog("updateSubgroup", "更新分组失败", err)
+		return nil, err
+	}
+	return subgroup, nil
+}
+
+func deleteSubgroup(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	subgroupID, _ := p.Args["subgroupID"].(string)
+	if err := model.DeleteSubgroup(p.Context, groupID, getJWTUserID(p), subgroupID); err != nil {
+		writeSubgroupLog("deleteSubgroup", "删除分组失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func getUserIDsArg(p graphql.ResolveParams) []string {
+	userIDs := []string{}
+	if list, ok := p.Args["userIDs"].([]interface{}); ok {
+		for _, userID := range list {
+			if s, ok := userID.(string); ok {
+				userIDs = append(userIDs, s)
+			}
+		}
+	}
+	return userIDs
+}
+
+func writeSubgroupLog(funcName, errMsg string, err error) {
+	writeLog("subgroup.go", funcName, errMsg, err)
+}
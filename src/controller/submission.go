@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"constant"
+	"model"
+	"util"
+
+	"github.com/graphql-go/graphql"
+)
+
+var submissionStatusEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "submissionStatusEnum",
+	Description: "作业提交状态",
+	Values: graphql.EnumValueConfigMap{
+		"undone": &graphql.EnumValueConfig{
+			Value:       constant.SubmissionUndoneStatus,
+			Description: "未完成",
+		},
+		"done": &graphql.EnumValueConfig{
+			Value:       constant.SubmissionDoneStatus,
+			Description: "已完成",
+		},
+	},
+})
+
+var submissionType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "submission",
+	Description: "作业提交",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if submission, ok := p.Source.(model.Submission); ok {
+					return submission.ID.Hex(), nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"status": &graphql.Field{
+			Type:        submissionStatusEnumType,
+			Description: "状态",
+		},
+		"noticeID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "提醒id",
+		},
+		"userID": &graphql.Field{
+			Type:        graphql.String,
+			Description: "提交人 unionid",
+		},
+		"content": &graphql.Field{
+			Type:        graphql.String,
+			Description: "文字内容",
+		},
+		"imgs": &graphql.Field{
+			Type:        graphql.NewList(imgType),
+			Description: "图片",
+		},
+		"createTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "提交时间",
+		},
+		"updateTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "更新时间",
+		},
+	},
+})
+
+func init() {
+	noticeType.AddFieldConfig("submissions", &graphql.Field{
+		Type:        graphql.NewList(submissionType),
+		Description: "作业提交, 创建者和有 editOthersNotice 权限的用户可以看到所有人的, 其他人只能看到自己的",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if notice, ok := p.Source.(model.Notice); ok {
+				submissions, err := model.GetNoticeSubmissions(p.Context, notice, getJWTUserID(p))
+				if err != nil {
+					writeSubmissionLog("notice.submissions", "获取作业提交失败", err)
+					return nil, constant.ErrorBadGateway
+				}
+				return submissions, nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
+	noticeType.AddFieldConfig("completionRate", &graphql.Field{
+		Type:        graphql.Float,
+		Description: "完成率 0~1, 只统计仍在接收群组中、没有 postNotice 权限的用户",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if notice, ok := p.Source.(model.Notice); ok {
+				completion, err := model.GetNoticeCompletion(p.Context, notice)
+				if err != nil {
+					writeSubmissionLog("notice.completionRate", "统计完成情况失败", err)
+					return nil, constant.ErrorBadGateway
+				}
+				return completion.Rate(), nil
+			}
+			return nil, constant.ErrorEmpty
+		},
+	})
+	noticeType.AddFieldConfig("undoneUserIDs", &graphql.Field{
+		Type:        graphql.NewList(graphql.String),
+		Description: "还没有完成的用户 unionid, 创建者和有 editOthersNotice 权限的用户可以查看",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			notice, ok := p.Source.(model.Notice)
+			if !ok {
+				return nil, constant.ErrorEmpty
+			}
+			if !model.CanViewAllSubmissions(p.Context, notice, getJWTUserID(p)) {
+				return nil, nil
+			}
+			completion, err := model.GetNoticeCompletion(p.Context, notice)
+			if err != nil {
+				writeSubmissionLog("notice.undoneUserIDs", "统计完成情况失败", err)
+				return nil, constant.ErrorBadGateway
+			}
+			return completion.UndoneUserIDs, nil
+		},
+	})
+}
+
+var submitNoticeArgs = graphql.FieldConfigArgument{
+	"noticeID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "提醒id",
+	},
+	"content": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "文字内容, 最长1000个字符",
+	},
+	"imgs": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(imgArgsType),
+		Description: "图片, 最多9张, 须通过 submission 类型的 qiniuToken 上传",
+	},
+}
+
+var updateSubmissionArgs = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "提交id",
+	},
+	"status": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(submissionStatusEnumType),
+		Description: "状态, undone 为撤回完成",
+	},
+	"content": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "文字内容, 最长1000个字符",
+	},
+	"imgs": &graphql.ArgumentConfig{
+		Type:        graphql.NewList(imgArgsType),
+		Description: "图片, 最多9张, 须通过 submission 类型的 qiniuToken 上传",
+	},
+}
+
+func submitNotice(p graphql.ResolveParams) (interface{}, error) {
+	data := model.Submission{}
+	if err := util.MapToJSONStruct(p.Args, &data); err != nil {
+		writeSubmissionLog("submitNotice", constant.ErrorMsgParamWrong, err)
+		return nil, constant.ErrorParamWrong
+	}
+	submission, err := model.SubmitNotice(p.Context, getJWTUserID(p), data)
+	if err != nil {
+		writeSubmissionLog("submitNotice", "提交作业失败", err)
+		return nil, err
+	}
+	return submission, nil
+}
+
+func updateSubmission(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	// id 为 ObjectID, 不参与解析
+	args := map[string]interface{}{
+		"status":  p.Args["status"],
+		"content": p.Args["content"],
+		"imgs":    p.Args["imgs"],
+	}
+	data := model.Submission{}
+	if err := util.MapToJSONStruct(args, &data); err != nil {
+		writeSubmissionLog("updateSubmission", constant.ErrorMsgParamWrong, err)
+		return nil, constant.ErrorParamWrong
+	}
+	submission, err := model.UpdateSubmission(p.Context, id, getJWTUserID(p), data)
+	if err != nil {
+		writeSubmissionLog("updateSubmission", "修改作业提交失败", err)
+		return nil, err
+	}
+	return submission, nil
+}
+
+func writeSubmissionLog(funcName, errMsg string, err error) {
+	writeLog("submission.go", funcName, errMsg, err)
+}
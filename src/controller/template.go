@@ -46,7 +46,7 @@ var templateType = graphql.NewObject(graphql.ObjectConfig{
 
 func getTemplate(p graphql.ResolveParams) (interface{}, error) {
 	if id, ok := p.Args["id"].(string); ok {
-		return model.GetTemplate(id)
+		return model.GetTemplate(p.Context, id)
 	}
 	return nil, constant.ErrorParamWrong
 }
@@ -1,19 +1,46 @@
 package controller
 
 // 定时器
-import "model"
+//  任务通过 util.RunTask 执行, 退出时会等待其完成
+//  多实例部署时通过 model.RunJob 的分布式锁保证每次只有一个实例执行
+import (
+	"constant"
+	"context"
+	"model"
+	"util"
+)
 
 func StartHourTimer() {
 	if isProd {
-		model.UpdateRedisAccessToken()
+		runTimerJob("StartHourTimer", constant.JobUpdateAccessToken, func(ctx context.Context) (int, error) {
+			return 1, model.UpdateRedisAccessToken(ctx)
+		})
 	}
-	model.UpdateExpireNotice()
+	runTimerJob("StartHourTimer", constant.JobUpdateExpireNotice, model.UpdateExpireNotice)
+	runTimerJob("StartHourTimer", constant.JobSendSubmissionRemind, model.SendSubmissionRemind)
 }
 
 func StartDayTimer() {
-	model.SendDayNotice()
+	runTimerJob("StartDayTimer", constant.JobSendDayNotice, model.SendDayNotice)
 }
 
 func StartWeekTimer() {
-	model.SendWeekNotice()
+	runTimerJob("StartWeekTimer", constant.JobSendWeekNotice, model.SendWeekNotice)
+}
+
+func StartPurgeTimer() {
+	runTimerJob("StartPurgeTimer", constant.JobPurgeTrash, model.PurgeTrash)
+}
+
+func runTimerJob(funcName, jobName string, job func(ctx context.Context) (int, error)) {
+	util.RunTask(constant.TimerJobTimeout, func(ctx context.Context) {
+		err := model.RunJob(ctx, jobName, job)
+		if err != nil && err != constant.ErrorLockHeld {
+			writeTimerLog(funcName, "执行定时任务失败: "+jobName, err)
+		}
+	})
+}
+
+func writeTimerLog(funcName, errMsg string, err error) {
+	writeLog("timer.go", funcName, errMsg, err)
 }
@@ -1,14 +1,17 @@
 package controller
 
 import (
-	"config"
 	"constant"
+	"context"
+	"fmt"
 	"model"
+	"net/url"
+	"regexp"
+	"sort"
 	"strings"
-	"util/token"
+	"util/filestore"
 
 	"github.com/graphql-go/graphql"
-	"github.com/qiniu/api.v7/storage"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -28,6 +31,26 @@ var qiniuTokenTypeEnumType = graphql.NewEnum(graphql.EnumConfig{
 			Value:       constant.ImgTypeFeedback,
 			Description: "反馈图片",
 		},
+		"submission": &graphql.EnumValueConfig{
+			Value:       constant.ImgTypeSubmission,
+			Description: "作业提交图片",
+		},
+		"attachmentImage": &graphql.EnumValueConfig{
+			Value:       constant.UploadTypeAttachmentImage,
+			Description: "图片附件, 生成缩略图",
+		},
+		"attachmentAudio": &graphql.EnumValueConfig{
+			Value:       constant.UploadTypeAttachmentAudio,
+			Description: "音频附件, 转码为 mp3",
+		},
+		"attachmentVideo": &graphql.EnumValueConfig{
+			Value:       constant.UploadTypeAttachmentVideo,
+			Description: "视频附件, 截取封面",
+		},
+		"attachmentFile": &graphql.EnumValueConfig{
+			Value:       constant.UploadTypeAttachmentFile,
+			Description: "文档附件, pdf 或 office 文档, office 文档转换为 pdf 预览",
+		},
 	},
 })
 
@@ -49,11 +72,23 @@ var imgType = graphql.NewObject(graphql.ObjectConfig{
 	Fields: graphql.Fields{
 		"url": &graphql.Field{
 			Type:        graphql.String,
-			Description: "url",
+			Description: "url, 私有空间时为临时链接",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if img, ok := p.Source.(model.Img); ok {
+					return model.FileURL(img.URL), nil
+				}
+				return nil, nil
+			},
 		},
 		"microUrl": &graphql.Field{
 			Type:        graphql.String,
-			Description: "microUrl",
+			Description: "microUrl, 私有空间时为临时链接",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if img, ok := p.Source.(model.Img); ok {
+					return model.FileURL(img.MicroURL), nil
+				}
+				return nil, nil
+			},
 		},
 	},
 })
@@ -73,6 +108,138 @@ var imgArgsType = graphql.NewInputObject(graphql.InputObjectConfig{
 	},
 })
 
+var attachmentKindEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "attachmentKindEnum",
+	Description: "附件类型",
+	Values: graphql.EnumValueConfigMap{
+		"image": &graphql.EnumValueConfig{
+			Value:       constant.AttachmentKindImage,
+			Description: "图片",
+		},
+		"audio": &graphql.EnumValueConfig{
+			Value:       constant.AttachmentKindAudio,
+			Description: "音频",
+		},
+		"video": &graphql.EnumValueConfig{
+			Value:       constant.AttachmentKindVideo,
+			Description: "视频",
+		},
+		"file": &graphql.EnumValueConfig{
+			Value:       constant.AttachmentKindFile,
+			Description: "文档",
+		},
+	},
+})
+
+var attachmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "attachment",
+	Description: "附件",
+	Fields: graphql.Fields{
+		"kind": &graphql.Field{
+			Type:        attachmentKindEnumType,
+			Description: "类型",
+		},
+		"mime": &graphql.Field{
+			Type:        graphql.String,
+			Description: "MIME 类型",
+		},
+		"size": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "大小, 单位字节",
+		},
+		"duration": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "音频、视频的时长, 单位秒",
+		},
+		"name": &graphql.Field{
+			Type:        graphql.String,
+			Description: "原文件名",
+		},
+		"url": &graphql.Field{
+			Type:        graphql.String,
+			Description: "原文件, 私有空间时为临时链接",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if attachment, ok := p.Source.(model.Attachment); ok {
+					return model.FileURL(attachment.URL), nil
+				}
+				return nil, nil
+			},
+		},
+		"thumbnail": &graphql.Field{
+			Type:        graphql.String,
+			Description: "图片缩略图、视频封面",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if attachment, ok := p.Source.(model.Attachment); ok {
+					return model.FileURL(attachment.Thumbnail), nil
+				}
+				return nil, nil
+			},
+		},
+		"previewUrl": &graphql.Field{
+			Type:        graphql.String,
+			Description: "音频转码的 mp3、office 文档转换的 pdf, 上传后异步生成",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if attachment, ok := p.Source.(model.Attachment); ok {
+					return model.FileURL(attachment.PreviewURL), nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var attachmentArgsType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "attachmentArgs",
+	Description: "附件, 使用 qiniuToken 返回的 attachment 并补充 mime、size、duration、name",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"kind": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(attachmentKindEnumType),
+			Description: "类型",
+		},
+		"mime": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "MIME 类型",
+		},
+		"size": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Float,
+			Description: "大小, 单位字节",
+		},
+		"duration": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Float,
+			Description: "音频、视频的时长, 单位秒",
+		},
+		"name": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "原文件名, 最长100个字符",
+		},
+		"url": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "原文件",
+		},
+		"thumbnail": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "图片缩略图、视频封面",
+		},
+		"previewUrl": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "音频转码的 mp3、office 文档转换的 pdf",
+		},
+	},
+})
+
+var uploadFieldType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "uploadField",
+	Description: "上传表单字段",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"value": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
 var qiniuTokenType = graphql.NewObject(graphql.ObjectConfig{
 	Name:        "qiniuToken",
 	Description: "qiniuToken",
@@ -86,15 +253,57 @@ var qiniuTokenType = graphql.NewObject(graphql.ObjectConfig{
 			Description: "key",
 		},
 		"img": &graphql.Field{
-			Type:        graphql.NewNonNull(imgType),
-			Description: "img",
+			Type:        imgType,
+			Description: "图片类型的上传结果, 附件类型为空",
+		},
+		"attachment": &graphql.Field{
+			Type:        attachmentType,
+			Description: "附件类型的上传结果, 处理结果在上传后异步生成",
+		},
+		"fsizeLimit": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "文件大小上限, 单位字节",
+		},
+		"mimeLimit": &graphql.Field{
+			Type:        graphql.String,
+			Description: "允许的 MIME 类型, 多个用 ; 分隔",
+		},
+		"backend": &graphql.Field{
+			Type:        graphql.String,
+			Description: "存储类型: qiniu, s3, local",
+		},
+		"uploadUrl": &graphql.Field{
+			Type:        graphql.String,
+			Description: "上传地址, 七牛为空, 由客户端按区域选择",
+		},
+		"uploadFields": &graphql.Field{
+			Type:        graphql.NewList(uploadFieldType),
+			Description: "以 multipart 表单上传时需附带的字段, 文件字段名为 file",
 		},
 	},
 })
 
+var attachmentSuffixRegexp = regexp.MustCompile(constant.AttachmentSuffixExpr)
+
 func getQiniuToken(p graphql.ResolveParams) (interface{}, error) {
 	tokenType := p.Args["type"].(int)
 	suffix := p.Args["suffix"].(string)
+	if !attachmentSuffixRegexp.MatchString(suffix) {
+		writeTokenLog("GetQiniuImgUpToken", constant.ErrorMsgParamWrong, nil)
+		return nil, constant.ErrorParamWrong
+	}
+	// 上传者和用途写入回调内容, 上传成功后登记文件
+	userID := getJWTUserID(p)
+	callbackBody := fmt.Sprintf(constant.UploadCallbackBody, url.QueryEscape(userID), tokenType)
+	files := filestore.Default()
+	if kind, ok := constant.AttachmentUploadKinds[tokenType]; ok {
+		policy, attachment := attachmentUploadPolicy(files, kind, strings.ToLower(suffix))
+		policy.CallbackBody = callbackBody
+		if err := reserveUpload(p.Context, files, userID, tokenType, policy.Key); err != nil {
+			return nil, err
+		}
+		return uploadTokenData(files, policy, "attachment", attachment)
+	}
 
 	imgID := uuid.NewV4().String()
 
@@ -103,25 +312,110 @@ func getQiniuToken(p graphql.ResolveParams) (interface{}, error) {
 		writeTokenLog("GetQiniuImgUpToken", constant.ErrorMsgParamWrong, nil)
 		return nil, constant.ErrorParamWrong
 	}
-	microImgPrefix := constant.ImgPrefixMicro[tokenType]
 	keyToOverwrite := imgPrefix + imgID + suffix
-	saveAsKey := microImgPrefix + imgID + suffix
-
-	fop := constant.ImgOps + "|saveas/" + storage.EncodedEntry(config.Conf.Qiniu.Bucket, saveAsKey)
-	persistentOps := strings.Join([]string{fop}, ";")
-	upToken := token.GetCustomUpToken(keyToOverwrite, persistentOps, constant.TokenQiniuExpire)
+	policy := filestore.UploadPolicy{
+		Key:          keyToOverwrite,
+		FsizeLimit:   constant.ImgSizeLimit,
+		MimeLimit:    constant.ImgMimeLimit,
+		CallbackBody: callbackBody,
+		Expires:      constant.TokenQiniuExpire,
+	}
 
 	img := model.Img{
-		URL:      constant.ImgURIPrefix + keyToOverwrite,
-		MicroURL: constant.ImgURIPrefix + saveAsKey,
+		URL:      files.URL(keyToOverwrite),
+		MicroURL: files.URL(keyToOverwrite),
+	}
+	// 存储不支持生成缩略图时使用原图
+	if files.Supports(filestore.DeriveThumbnail) {
+		saveAsKey := constant.ImgPrefixMicro[tokenType] + imgID + suffix
+		policy.Derivatives = []filestore.Derivative{{Kind: filestore.DeriveThumbnail, Key: saveAsKey}}
+		img.MicroURL = files.URL(saveAsKey)
+	}
+	if err := reserveUpload(p.Context, files, userID, tokenType, keyToOverwrite); err != nil {
+		return nil, err
+	}
+	return uploadTokenData(files, policy, "img", img)
+}
+
+// reserveUpload 存储上传后不登记文件时, 生成凭证时登记上传者和用途, 保存通知等时据此校验
+func reserveUpload(ctx context.Context, files filestore.Storage, userID string, tokenType int, key string) error {
+	if files.Registers() {
+		return nil
+	}
+	if err := model.ReserveUpload(ctx, userID, tokenType, key); err != nil {
+		writeTokenLog("GetQiniuImgUpToken", "登记上传文件失败", err)
+		return err
+	}
+	return nil
+}
+
+// attachmentUploadPolicy 附件上传限制, 按类型生成衍生文件, 衍生文件保存到预先确定的文件名
+// 存储不支持的衍生文件不生成, 对应的链接为空
+func attachmentUploadPolicy(files filestore.Storage, kind, suffix string) (filestore.UploadPolicy, model.Attachment) {
+	fileID := uuid.NewV4().String()
+	key := constant.AttachmentPrefix + kind + "/" + fileID + suffix
+	policy := filestore.UploadPolicy{
+		Key:        key,
+		FsizeLimit: constant.AttachmentSizeLimit[kind],
+		MimeLimit:  constant.AttachmentMimeLimit[kind],
+		Expires:    constant.TokenQiniuExpire,
+	}
+	attachment := model.Attachment{
+		Kind: kind,
+		URL:  files.URL(key),
 	}
 
-	resData := map[string]interface{}{
-		"uploadToken": upToken,
-		"key":         keyToOverwrite,
-		"img":         img,
+	derive := func(deriveKind, deriveKey string) string {
+		if !files.Supports(deriveKind) {
+			return ""
+		}
+		policy.Derivatives = append(policy.Derivatives, filestore.Derivative{Kind: deriveKind, Key: deriveKey})
+		return files.URL(deriveKey)
+	}
+	// 处理结果的文件名与保存通知时的校验一致
+	thumbnail, preview := model.AttachmentDerivativeKeys(kind, key)
+	switch kind {
+	case constant.AttachmentKindImage:
+		attachment.Thumbnail = derive(filestore.DeriveThumbnail, thumbnail)
+	case constant.AttachmentKindAudio:
+		attachment.PreviewURL = derive(filestore.DeriveAudioMP3, preview)
+	case constant.AttachmentKindVideo:
+		attachment.Thumbnail = derive(filestore.DeriveVideoCover, thumbnail)
+	case constant.AttachmentKindFile:
+		if preview != "" {
+			attachment.PreviewURL = derive(filestore.DerivePDFPreview, preview)
+		}
 	}
-	return resData, nil
+	return policy, attachment
+}
+
+// uploadTokenData 生成上传凭证, resultField 为上传后文件的访问链接
+func uploadTokenData(files filestore.Storage, policy filestore.UploadPolicy, resultField string, result interface{}) (interface{}, error) {
+	credential, err := files.UploadCredential(policy)
+	if err != nil {
+		writeTokenLog("GetQiniuImgUpToken", "生成上传凭证失败", err)
+		return nil, err
+	}
+	names := []string{}
+	for name := range credential.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := []map[string]interface{}{}
+	for _, name := range names {
+		fields = append(fields, map[string]interface{}{"name": name, "value": credential.Fields[name]})
+	}
+
+	return map[string]interface{}{
+		"uploadToken":  credential.Token,
+		"key":          policy.Key,
+		resultField:    result,
+		"fsizeLimit":   policy.FsizeLimit,
+		"mimeLimit":    policy.MimeLimit,
+		"backend":      credential.Backend,
+		"uploadUrl":    credential.URL,
+		"uploadFields": fields,
+	}, nil
 }
 
 func writeTokenLog(funcName, errMsg string, err error) {
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+func getTrashGroups(p graphql.ResolveParams) (interface{}, error) {
+	userID := getJWTUserID(p)
+	groups, err := model.GetTrashGroups(p.Context, userID)
+	if err != nil {
+		writeTrashLog("getTrashGroups", "获取回收站群组失败", err)
+		return nil, constant.ErrorBadGateway
+	}
+	return groups, nil
+}
+
+func getTrashNotices(p graphql.ResolveParams) (interface{}, error) {
+	userID := getJWTUserID(p)
+	notices, err := model.GetTrashNotices(p.Context, userID)
+	if err != nil {
+		writeTrashLog("getTrashNotices", "获取回收站通知失败", err)
+		return nil, constant.ErrorBadGateway
+	}
+	return notices, nil
+}
+
+func restoreGroup(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if id == "" {
+		return nil, constant.ErrorParamWrong
+	}
+	userID := getJWTUserID(p)
+	group, err := model.RestoreGroup(p.Context, id, userID)
+	if err != nil {
+		writeTrashLog("restoreGroup", "恢复群组失败", err)
+		return nil, err
+	}
+	return group, nil
+}
+
+func restoreNotice(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if id == "" {
+		return nil, constant.ErrorParamWrong
+	}
+	userID := getJWTUserID(p)
+	notice, err := model.RestoreNotice(p.Context, id, userID)
+	if err != nil {
+		writeTrashLog("restoreNotice", "恢复通知失败", err)
+		return nil, err
+	}
+	return notice, nil
+}
+
+func writeTrashLog(funcName, errMsg string, err error) {
+	writeLog("trash.go", funcName, errMsg, err)
+}
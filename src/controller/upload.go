@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"bytes"
+	"config"
+	"constant"
+	"io/ioutil"
+	"model"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"util/filestore"
+	"util/token"
+)
+
+const (
+	// qiniuCallbackBodyMax 回调内容只有文件信息, 超出的直接拒绝
+	qiniuCallbackBodyMax = 4 << 10
+	// localUploadBodyMax 最大的附件加上表单字段, 文件大小由上传凭证限制
+	localUploadBodyMax = 201 << 20
+	// localUploadMemoryMax 表单中超出的部分写入临时文件, 避免上传的文件读入内存
+	localUploadMemoryMax = 1 << 20
+)
+
+/**
+ * @api {post} /api/v1/qiniu/callback QiniuCallback
+ * @apiVersion 1.0.0
+ * @apiName QiniuCallback
+ * @apiGroup Qiniu
+ * @apiDescription 七牛上传回调, 校验签名后登记上传的文件
+ * 回调内容见 constant.UploadCallbackBody, 返回的数据由七牛转发给上传的客户端
+ * 返回非 200 时七牛认为上传失败
+ *
+ * @apiSuccessExample Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *        "key": "mp/homework/<uuid>.jpg",
+ *        "hash": "七牛 etag"
+ *     }
+ */
+func QiniuCallback(w http.ResponseWriter, r *http.Request) {
+	if files := filestore.Default(); files.Backend() != constant.StorageBackendQiniu || !files.Registers() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		resJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, qiniuCallbackBodyMax))
+	if err != nil {
+		writeUploadLog("QiniuCallback", constant.ErrorMsgParamWrong, err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+	// 签名包括请求体, 校验时会再次读取
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if ok, err := token.VerifyQiniuCallback(r); !ok {
+		writeUploadLog("QiniuCallback", "签名校验失败", err)
+		resJSONError(w, http.StatusUnauthorized, constant.ErrorMsgUnAuth)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeUploadLog("QiniuCallback", constant.ErrorMsgParamWrong, err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+
+	ctx, cancel := newRequestContext(r)
+	defer cancel()
+	upload, err := model.RegisterUpload(ctx, form)
+	if err != nil {
+		writeUploadLog("QiniuCallback", "登记上传文件失败", err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+
+	resJSONData(w, map[string]interface{}{
+		"key":  upload.Key,
+		"hash": upload.Hash,
+	})
+}
+
+/**
+ * @api {post} /api/v1/files/upload LocalUpload
+ * @apiVersion 1.0.0
+ * @apiName LocalUpload
+ * @apiGroup Storage
+ * @apiDescription 本地存储接收上传, 仅在 Storage.Backend 为 local 时可用
+ * multipart 表单: qiniuToken 返回的 uploadFields 和名为 file 的文件, 返回同七牛回调
+ */
+func LocalUpload(w http.ResponseWriter, r *http.Request) {
+	local, ok := filestore.Default().(*filestore.LocalStorage)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		resJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, localUploadBodyMax)
+	if err := r.ParseMultipartForm(localUploadMemoryMax); err != nil {
+		writeUploadLog("LocalUpload", constant.ErrorMsgParamWrong, err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeUploadLog("LocalUpload", constant.ErrorMsgParamWrong, err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+	defer file.Close()
+	form, err := local.Receive(r.FormValue("token"), file)
+	if err != nil {
+		writeUploadLog("LocalUpload", "保存上传文件失败", err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+	if len(form) == 0 {
+		resJSONData(w, map[string]interface{}{"key": r.FormValue("key")})
+		return
+	}
+
+	ctx, cancel := newRequestContext(r)
+	defer cancel()
+	upload, err := model.RegisterUpload(ctx, form)
+	if err != nil {
+		writeUploadLog("LocalUpload", "登记上传文件失败", err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+	resJSONData(w, map[string]interface{}{
+		"key":  upload.Key,
+		"hash": upload.Hash,
+	})
+}
+
+/**
+ * @api {get} /files/:key LocalFiles
+ * @apiVersion 1.0.0
+ * @apiName LocalFiles
+ * @apiGroup Storage
+ * @apiDescription 本地存储的文件访问, 仅在 Storage.Backend 为 local 时可用
+ * 私有空间时作业、提交、反馈的文件需要 SignedURL 生成的临时链接
+ */
+func LocalFiles(w http.ResponseWriter, r *http.Request) {
+	local, ok := filestore.Default().(*filestore.LocalStorage)
+	if !ok || r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, constant.LocalFilesPath)
+	p, err := local.Path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if config.Conf.Storage.Private && model.IsPrivateFile(key) && !local.VerifySignedURL(key, r.URL.Query()) {
+		resJSONError(w, http.StatusForbidden, constant.ErrorNoPermission.Error())
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func writeUploadLog(funcName, errMsg string, err error) {
+	writeLog("upload.go", funcName, errMsg, err)
+}
@@ -2,7 +2,9 @@ package controller
 
 import (
 	"constant"
+	"context"
 	"model"
+	"util"
 
 	"github.com/graphql-go/graphql"
 )
@@ -101,7 +103,7 @@ func init() {
 		Description: "创建/拥有的群组",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if user, ok := p.Source.(model.User); ok {
-				return model.GetRedisGroupInfos(user.OwnGroupIDs)
+				return model.GetRedisGroupInfos(p.Context, user.OwnGroupIDs)
 			}
 			return nil, constant.ErrorEmpty
 		},
@@ -111,7 +113,7 @@ func init() {
 		Description: "管理的群组",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if user, ok := p.Source.(model.User); ok {
-				return model.GetRedisGroupInfos(user.ManageGroupIDs)
+				return model.GetRedisGroupInfos(p.Context, user.ManageGroupIDs)
 			}
 			return nil, constant.ErrorEmpty
 		},
@@ -121,7 +123,7 @@ func init() {
 		Description: "加入的群组",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			if user, ok := p.Source.(model.User); ok {
-				return model.GetRedisGroupInfos(user.JoinGroupIDs)
+				return model.GetRedisGroupInfos(p.Context, user.JoinGroupIDs)
 			}
 			return nil, constant.ErrorEmpty
 		},
@@ -130,9 +132,15 @@ func init() {
 
 func getUserFollowStatus(p graphql.ResolveParams) (interface{}, error) {
 	userID := getJWTUserID(p)
-	isFollow, _ := model.IsFollowOfficeAccount(userID)
+	isFollow, err := model.IsUserFollow(p.Context, userID)
+	if err != nil {
+		writeUserLog("getUserFollowStatus", "获取关注状态失败", err)
+		return false, nil
+	}
 
-	go model.SetUserFollowStatus(userID, isFollow)
+	util.GoBackground(func(ctx context.Context) {
+		model.SetUserFollowStatus(ctx, userID, isFollow)
+	})
 
 	return isFollow, nil
 }
@@ -143,7 +151,7 @@ func getUserByUnionid(p graphql.ResolveParams) (interface{}, error) {
 		userID = getJWTUserID(p)
 	}
 
-	return model.GetUserByUnionid(userID)
+	return model.GetUserByUnionid(p.Context, userID)
 }
 
 func writeUserLog(funcName, errMsg string, err error) {
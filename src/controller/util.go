@@ -3,6 +3,7 @@ package controller
 import (
 	"config"
 	"constant"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"util/token"
@@ -25,6 +26,16 @@ func getJWTUserID(p graphql.ResolveParams) string {
 	return p.Context.Value(constant.JWTContextKey).(jwt.MapClaims)["userID"].(string)
 }
 
+// isAdmin 是否为配置中的管理员
+func isAdmin(userID string) bool {
+	for _, id := range config.Conf.Security.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
 func getJWTToken(auth map[string]interface{}) string {
 	return token.GetJWTToken(auth, config.Conf.Security.Secret, constant.JWTExpire)
 }
@@ -33,6 +44,11 @@ func validateJWT(tokenStr string) (jwt.MapClaims, bool) {
 	return token.ValidateJWT(constant.JWTAuthScheme, tokenStr, config.Conf.Security.Secret)
 }
 
+// newRequestContext REST 请求的 ctx, 客户端断开或超时后取消
+func newRequestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), constant.RequestTimeout)
+}
+
 func loadJSONData(r *http.Request, to interface{}) error {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
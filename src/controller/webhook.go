@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"constant"
+	"model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var webhookEventEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "webhookEventEnum",
+	Description: "webhook 事件",
+	Values: graphql.EnumValueConfigMap{
+		"noticeCreated": &graphql.EnumValueConfig{
+			Value:       constant.WebhookEventNoticeCreated,
+			Description: "创建通知",
+		},
+		"noticeUpdated": &graphql.EnumValueConfig{
+			Value:       constant.WebhookEventNoticeUpdated,
+			Description: "更新通知",
+		},
+		"noticeDeleted": &graphql.EnumValueConfig{
+			Value:       constant.WebhookEventNoticeDeleted,
+			Description: "删除通知",
+		},
+		"noticeExpired": &graphql.EnumValueConfig{
+			Value:       constant.WebhookEventNoticeExpired,
+			Description: "通知过期",
+		},
+		"memberJoined": &graphql.EnumValueConfig{
+			Value:       constant.WebhookEventMemberJoined,
+			Description: "成员加入",
+		},
+		"memberLeft": &graphql.EnumValueConfig{
+			Value:       constant.WebhookEventMemberLeft,
+			Description: "成员离开或被移除",
+		},
+	},
+})
+
+var webhookDeliveryStatusEnumType = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "webhookDeliveryStatusEnum",
+	Description: "投递状态",
+	Values: graphql.EnumValueConfigMap{
+		"fail": &graphql.EnumValueConfig{
+			Value:       constant.WebhookDeliveryFailStatus,
+			Description: "失败",
+		},
+		"pending": &graphql.EnumValueConfig{
+			Value:       constant.WebhookDeliveryPendingStatus,
+			Description: "投递中",
+		},
+		"success": &graphql.EnumValueConfig{
+			Value:       constant.WebhookDeliverySuccessStatus,
+			Description: "成功",
+		},
+	},
+})
+
+var webhookType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "webhook",
+	Description: "群组 webhook, 请求头 X-Phs-Signature 为 sha256=hex(HMAC-SHA256(secret, \"<X-Phs-Timestamp>.<body>\"))",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if hook, ok := p.Source.(model.GroupWebhook); ok {
+					return hook.ID.Hex(), nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"groupID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "群组id",
+		},
+		"url": &graphql.Field{
+			Type:        graphql.String,
+			Description: "推送地址",
+		},
+		"events": &graphql.Field{
+			Type:        graphql.NewList(webhookEventEnumType),
+			Description: "订阅的事件",
+		},
+		"createTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "创建时间",
+		},
+	},
+})
+
+var createdWebhookType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "createdWebhook",
+	Description: "新建的 webhook, secret 仅在创建时返回",
+	Fields: graphql.Fields{
+		"webhook": &graphql.Field{
+			Type:        webhookType,
+			Description: "webhook",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if hook, ok := p.Source.(model.GroupWebhook); ok {
+					return hook, nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"secret": &graphql.Field{
+			Type:        graphql.String,
+			Description: "签名密钥",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if hook, ok := p.Source.(model.GroupWebhook); ok {
+					return hook.Secret, nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+	},
+})
+
+var webhookDeliveryType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "webhookDelivery",
+	Description: "webhook 投递记录",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "id",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if delivery, ok := p.Source.(model.WebhookDelivery); ok {
+					return delivery.ID.Hex(), nil
+				}
+				return nil, constant.ErrorEmpty
+			},
+		},
+		"status": &graphql.Field{
+			Type:        webhookDeliveryStatusEnumType,
+			Description: "状态",
+		},
+		"webhookID": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "webhook id",
+		},
+		"event": &graphql.Field{
+			Type:        webhookEventEnumType,
+			Description: "事件",
+		},
+		"payload": &graphql.Field{
+			Type:        graphql.String,
+			Description: "请求体",
+		},
+		"attempts": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "已尝试次数",
+		},
+		"responseCode": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "最后一次的响应码",
+		},
+		"error": &graphql.Field{
+			Type:        graphql.String,
+			Description: "最后一次的错误",
+		},
+		"createTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "创建时间",
+		},
+		"updateTime": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "更新时间",
+		},
+	},
+})
+
+var groupIDArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+}
+
+var createGroupWebhookArgs = graphql.FieldConfigArgument{
+	"groupID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "群组id",
+	},
+	"url": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "推送地址, 必须为 https",
+	},
+	"events": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.NewList(webhookEventEnumType)),
+		Description: "订阅的事件",
+	},
+	"secret": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "签名密钥, 为空时自动生成",
+	},
+}
+
+var webhookDeliveriesArgs = graphql.FieldConfigArgument{
+	"webhookID": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "webhook id",
+	},
+	"page": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "页数, 从1开始",
+	},
+	"perPage": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "一页数量，限制范围: 1~20",
+	},
+}
+
+func createGroupWebhook(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	url, _ := p.Args["url"].(string)
+	secret, _ := p.Args["secret"].(string)
+	events := []string{}
+	if list, ok := p.Args["events"].([]interface{}); ok {
+		for _, event := range list {
+			if e, ok := event.(string); ok {
+				events = append(events, e)
+			}
+		}
+	}
+
+	hook, err := model.CreateGroupWebhook(p.Context, getJWTUserID(p), groupID, url, events, secret)
+	if err != nil {
+		writeWebhookLog("createGroupWebhook", "创建webhook失败", err)
+		return nil, err
+	}
+	return hook, nil
+}
+
+func deleteGroupWebhook(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if err := model.DeleteGroupWebhook(p.Context, getJWTUserID(p), id); err != nil {
+		writeWebhookLog("deleteGroupWebhook", "删除webhook失败", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func getGroupWebhooks(p graphql.ResolveParams) (interface{}, error) {
+	groupID, _ := p.Args["groupID"].(string)
+	hooks, err := model.GetGroupWebhooks(p.Context, getJWTUserID(p), groupID)
+	if err != nil {
+		writeWebhookLog("getGroupWebhooks", "获取webhook失败", err)
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func getWebhookDeliveries(p graphql.ResolveParams) (interface{}, error) {
+	webhookID, _ := p.Args["webhookID"].(string)
+	page, _ := p.Args["page"].(int)
+	perPage, _ := p.Args["perPage"].(int)
+	if page <= 0 || perPage <= 0 || perPage > 20 {
+		writeWebhookLog("getWebhookDeliveries", constant.ErrorMsgParamWrong, nil)
+		return nil, constant.ErrorParamWrong
+	}
+
+	deliveries, err := model.GetWebhookDeliveries(p.Context, getJWTUserID(p), webhookID, page, perPage)
+	if err != nil {
+		writeWebhookLog("getWebhookDeliveries", "获取投递记录失败", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func redeliverWebhook(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	delivery, err := model.RedeliverWebhook(p.Context, getJWTUserID(p), id)
+	if err != nil {
+		writeWebhookLog("redeliverWebhook", "重新投递失败", err)
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func writeWebhookLog(funcName, errMsg string, err error) {
+	writeLog("webhook.go", funcName, errMsg, err)
+}
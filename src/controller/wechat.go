@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"config"
+	"constant"
+	"context"
+	"io/ioutil"
+	"model"
+	"net/http"
+	"util"
+)
+
+// wechatEventBodyMax 公众号推送的消息体很小, 超出的直接拒绝
+const wechatEventBodyMax = 64 << 10
+
+/**
+ * @api {get,post} /api/v1/wechat/event WechatEvent
+ * @apiVersion 1.0.0
+ * @apiName WechatEvent
+ * @apiGroup Wechat
+ * @apiDescription 公众号服务器配置的消息接收地址
+ * GET 用于验证服务器地址, 返回 echostr;
+ * POST 接收关注/取关和扫码事件, 支持明文和安全模式, 处理成功返回 success, 失败时返回 500 由微信重试
+ * timestamp 与服务器时间相差超过 5 分钟的请求会被拒绝, 重试或重放的同一事件只处理一次
+ */
+func WechatEvent(w http.ResponseWriter, r *http.Request) {
+	oa := config.Conf.OfficialAccount
+	if oa.Token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	timestamp, nonce := query.Get("timestamp"), query.Get("nonce")
+	if !util.CheckWeixinSignature(oa.Token, query.Get("signature"), timestamp, nonce) {
+		writeWechatLog("WechatEvent", "签名校验失败", constant.ErrorUnAuth)
+		resJSONError(w, http.StatusUnauthorized, constant.ErrorMsgUnAuth)
+		return
+	}
+
+	if !util.TimestampWithin(timestamp, constant.WechatEventMaxSkew) {
+		writeWechatLog("WechatEvent", "timestamp 超出范围", constant.ErrorExpired)
+		resJSONError(w, http.StatusUnauthorized, constant.ErrorMsgUnAuth)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Write([]byte(query.Get("echostr")))
+		return
+	case http.MethodPost:
+	default:
+		resJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, wechatEventBodyMax))
+	if err != nil {
+		writeWechatLog("WechatEvent", constant.ErrorMsgParamWrong, err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+
+	encrypted := query.Get("encrypt_type") == constant.WechatEncryptTypeAES
+	if encrypted {
+		envelope, err := model.ParseWechatEnvelope(body)
+		if err != nil || !util.CheckWeixinSignature(oa.Token, query.Get("msg_signature"), timestamp, nonce, envelope.Encrypt) {
+			writeWechatLog("WechatEvent", "消息签名校验失败", err)
+			resJSONError(w, http.StatusUnauthorized, constant.ErrorMsgUnAuth)
+			return
+		}
+	}
+
+	msg, err := model.ParseWechatEventMsg(body, encrypted)
+	if err != nil {
+		writeWechatLog("WechatEvent", "解析消息失败", err)
+		resJSONError(w, http.StatusBadRequest, constant.ErrorMsgParamWrong)
+		return
+	}
+
+	// 微信 5 秒内收不到回复会重试, 在此之前处理完并回复
+	ctx, cancel := context.WithTimeout(r.Context(), constant.WechatEventTimeout)
+	defer cancel()
+	if err := model.HandleWechatEvent(ctx, msg); err != nil {
+		writeWechatLog("WechatEvent", "处理公众号事件失败", err)
+		resJSONError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.Write([]byte(constant.WechatEventReplySuccess))
+}
+
+func writeWechatLog(funcName, errMsg string, err error) {
+	writeLog("wechat.go", funcName, errMsg, err)
+}
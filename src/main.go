@@ -3,35 +3,96 @@ package main
 import (
 	"config"
 	"constant"
+	"context"
 	"controller"
+	"log"
+	"model"
+	"model/db"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"util"
 
 	"github.com/robfig/cron"
 )
 
 func main() {
-	go startTimer()
-	startWeb()
+	ctx, cancel := context.WithTimeout(context.Background(), constant.RequestTimeout)
+	if err := model.EnsureIndexes(ctx); err != nil {
+		log.Println("main: ensure indexes error:", err)
+	}
+	cancel()
+
+	c := startTimer()
+	server := startWeb()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("receive signal %s, begin shutdown", <-quit)
+
+	shutdown(server, c)
 }
 
-func startWeb() {
-	// REST 部分：用于认证和未开放的API
-	http.HandleFunc("/api/v1/login", controller.Login)
-	http.HandleFunc("/api/unopen/group/action/join", controller.JoinGroupFromOfficialAccounts)
-	http.HandleFunc("/api/unopen/group", controller.GetGroupInfo)
+func startWeb() *http.Server {
+	mux := http.NewServeMux()
+
+	// REST 部分：用于认证和未开放的API, 未开放的API需要服务间签名
+	mux.HandleFunc("/api/v1/login", controller.RateLimit(constant.RateLimitLogin, controller.Login))
+	mux.HandleFunc("/api/unopen/group/action/join", controller.RateLimit(constant.RateLimitUnopen, controller.ServiceAuth(controller.JoinGroupFromOfficialAccounts)))
+	mux.HandleFunc("/api/unopen/group", controller.RateLimit(constant.RateLimitUnopen, controller.ServiceAuth(controller.GetGroupInfo)))
+	mux.HandleFunc("/api/v1/wechat/event", controller.WechatEvent)
+	mux.HandleFunc("/api/v1/qiniu/callback", controller.QiniuCallback)
+	mux.HandleFunc(constant.LocalUploadPath, controller.RateLimit(constant.RateLimitUpload, controller.LocalUpload))
+	mux.HandleFunc(constant.LocalFilesPath, controller.LocalFiles)
 
 	// Graphql 部分：后台主体部分
-	http.HandleFunc("/api/graphql", controller.Graphql)
+	mux.HandleFunc("/api/graphql", controller.Graphql)
 
-	http.ListenAndServe(config.Conf.AppInfo.Addr, nil)
+	server := &http.Server{
+		Addr:    config.Conf.AppInfo.Addr,
+		Handler: mux,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return server
 }
 
-func startTimer() {
+func startTimer() *cron.Cron {
 	c := cron.New()
 
 	c.AddFunc(constant.TimerEveryHour, controller.StartHourTimer)
 	c.AddFunc(constant.TimerSendDayNotice, controller.StartDayTimer)
 	c.AddFunc(constant.TimerSendWeekNotice, controller.StartWeekTimer)
+	c.AddFunc(constant.TimerPurgeTrash, controller.StartPurgeTimer)
 
 	c.Start()
+	return c
+}
+
+// shutdown 依次：停止接收新请求并等待处理中的请求、停止定时器、等待异步任务和定时任务、关闭数据库连接
+// 整个过程最长 constant.ShutdownTimeout, 超时后取消剩余任务
+func shutdown(server *http.Server, c *cron.Cron) {
+	ctx, cancel := context.WithTimeout(context.Background(), constant.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("shutdown: http server error:", err)
+	}
+	// cron.Stop 不等待运行中的任务, 定时任务通过 util.RunTask 追踪
+	c.Stop()
+	if err := util.WaitTasks(ctx); err != nil {
+		log.Println("shutdown: wait tasks error:", err)
+	}
+
+	if err := db.CloseDBClient(ctx); err != nil {
+		log.Println("shutdown: close mongo error:", err)
+	}
+	if err := db.CloseRedisPool(); err != nil {
+		log.Println("shutdown: close redis error:", err)
+	}
+	log.Println("shutdown over")
 }
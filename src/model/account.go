@@ -0,0 +1,247 @@
+package model
+
+/*
+   个人数据导出和注销账号
+*/
+import (
+	"constant"
+	"context"
+	"fmt"
+	"model/db"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserDataExport 导出的个人数据
+type UserDataExport struct {
+	ExportTime     int64            `json:"exportTime"`
+	Profile        User             `json:"profile"`
+	Groups         []UserDataGroup  `json:"groups"`
+	Notices        []Notice         `json:"notices"` // 创建的通知, 包括回收站中的
+	Feedbacks      []Feedback       `json:"feedbacks"`
+	WatchedNotices []UserDataNotice `json:"watchedNotices"` // 查看过的通知
+	LikedNotices   []UserDataNotice `json:"likedNotices"`   // 点赞过的通知
+	Submissions    []Submission     `json:"submissions"`    // 作业提交
+	Comments       []Comment        `json:"comments"`       // 发表的评论, 包括已删除的
+}
+
+type UserDataGroup struct {
+	ID         string `json:"id"`
+	Code       string `json:"code"`
+	Nickname   string `json:"nickname"`
+	Role       string `json:"role"` // owner, manager, member
+	CreateTime int64  `json:"createTime"`
+}
+
+type UserDataNotice struct {
+	ID         string `json:"id"`
+	GroupID    string `json:"groupID"`
+	Title      string `json:"title"`
+	NoticeTime int64  `json:"noticeTime"`
+}
+
+var groupRoleNames = map[int]string{
+	constant.GroupUserStatusOwner:   "owner",
+	constant.GroupUserStatusManager: "manager",
+	constant.GroupUserStatusMember:  "member",
+}
+
+// ExportUserData 导出用户的个人数据, 不包含其他用户的信息
+func ExportUserData(ctx context.Context, unionid string) (UserDataExport, error) {
+	data := UserDataExport{
+		ExportTime:     util.GetNowTimestamp(),
+		Groups:         []UserDataGroup{},
+		Notices:        []Notice{},
+		WatchedNotices: []UserDataNotice{},
+		LikedNotices:   []UserDataNotice{},
+	}
+	user, err := store.Users().FindByUnionid(ctx, unionid)
+	if err != nil {
+		return data, err
+	}
+	if user.Status == constant.UserDeleteStatus {
+		return data, constant.ErrorNotFound
+	}
+	data.Profile = user
+
+	roles := map[int][]string{
+		constant.GroupUserStatusOwner:   user.OwnGroupIDs,
+		constant.GroupUserStatusManager: user.ManageGroupIDs,
+		constant.GroupUserStatusMember:  user.JoinGroupIDs,
+	}
+	for _, role := range []int{constant.GroupUserStatusOwner, constant.GroupUserStatusManager, constant.GroupUserStatusMember} {
+		for _, groupID := range roles[role] {
+			group, err := store.Groups().FindByID(ctx, groupID)
+			if err != nil {
+				continue
+			}
+			data.Groups = append(data.Groups, UserDataGroup{
+				ID:         groupID,
+				Code:       group.Code,
+				Nickname:   group.Nickname,
+				Role:       groupRoleNames[role],
+				CreateTime: group.CreateTime,
+			})
+		}
+	}
+
+	notices, err := store.Notices().FindByUser(ctx, unionid)
+	if err != nil {
+		return data, err
+	}
+	for _, notice := range notices {
+		brief := UserDataNotice{
+			ID:         notice.ID.Hex(),
+			GroupID:    notice.GroupID,
+			Title:      notice.Title,
+			NoticeTime: notice.NoticeTime,
+		}
+		if containString(notice.WatchUserIDs, unionid) {
+			data.WatchedNotices = append(data.WatchedNotices, brief)
+		}
+		if containString(notice.LikeUserIDs, unionid) {
+			data.LikedNotices = append(data.LikedNotices, brief)
+		}
+		if notice.CreatorID == unionid {
+			// 查看和点赞用户属于其他用户的数据
+			notice.WatchUserIDs, notice.LikeUserIDs = nil, nil
+			notice.Imgs, notice.Attachments = signedImgs(notice.Imgs), signedAttachments(notice.Attachments)
+			data.Notices = append(data.Notices, notice)
+		}
+	}
+
+	if data.Feedbacks, err = store.Feedbacks().FindByUserID(ctx, unionid); err != nil {
+		return data, err
+	}
+	if data.Submissions, err = store.Submissions().FindByUser(ctx, unionid); err != nil {
+		return data, err
+	}
+	// 导出的文件在私有空间时为临时链接, 需在有效期内下载
+	for i := range data.Feedbacks {
+		data.Feedbacks[i].Imgs = signedImgs(data.Feedbacks[i].Imgs)
+	}
+	for i := range data.Submissions {
+		data.Submissions[i].Imgs = signedImgs(data.Submissions[i].Imgs)
+	}
+	if data.Comments, err = store.Comments().FindByUser(ctx, unionid); err != nil {
+		return data, err
+	}
+	for i := range data.Comments {
+		data.Comments[i].ReplyToUserID, data.Comments[i].MentionUserIDs, data.Comments[i].DeletedBy = "", nil, ""
+	}
+	return data, nil
+}
+
+// DeleteUserAccount 注销账号
+// 创建的群组按 policy 转让或解散, 退出管理和加入的群组, 其他数据中的 unionid 替换为匿名 id
+// 用户信息最后清空, 中途失败时可以重试
+func DeleteUserAccount(ctx context.Context, unionid, policy string) error {
+	if policy != constant.AccountGroupPolicyTransfer && policy != constant.AccountGroupPolicyDissolve {
+		return constant.ErrorParamWrong
+	}
+	user, err := store.Users().FindByUnionid(ctx, unionid)
+	if err != nil {
+		return err
+	}
+	if user.Status == constant.UserDeleteStatus {
+		return constant.ErrorNotFound
+	}
+
+	if err = cancelUserTransfers(ctx, unionid); err != nil {
+		return err
+	}
+	for _, groupID := range user.OwnGroupIDs {
+		if err = leaveOwnGroup(ctx, groupID, unionid, policy); err != nil && err != constant.ErrorNotFound {
+			return err
+		}
+	}
+	for _, groupID := range user.ManageGroupIDs {
+		if err = removeGroupUsers(ctx, groupID, constant.GroupUserStatusManager, []string{unionid}); err != nil && err != constant.ErrorNotFound {
+			return err
+		}
+	}
+	for _, groupID := range user.JoinGroupIDs {
+		if err = removeGroupUsers(ctx, groupID, constant.GroupUserStatusMember, []string{unionid}); err != nil && err != constant.ErrorNotFound {
+			return err
+		}
+	}
+
+	anonID := constant.UserAnonIDPrefix + primitive.NewObjectID().Hex()
+	if err = store.Groups().ReplaceUser(ctx, unionid, anonID); err != nil {
+		return err
+	}
+	if err = store.Notices().ReplaceUser(ctx, unionid, anonID); err != nil {
+		return err
+	}
+	if err = store.Feedbacks().ReplaceUser(ctx, unionid, anonID); err != nil {
+		return err
+	}
+	if err = store.Webhooks().ReplaceCreator(ctx, unionid, anonID); err != nil {
+		return err
+	}
+	if err = store.GroupTransfers().ReplaceUser(ctx, unionid, anonID); err != nil {
+		return err
+	}
+	// 提交的文字和图片属于个人数据, 直接删除
+	if err = deleteUserSubmissions(ctx, unionid); err != nil {
+		return err
+	}
+	if err = store.Comments().ReplaceUser(ctx, unionid, anonID); err != nil {
+		return err
+	}
+	if err = store.Uploads().DeleteByOwner(ctx, unionid); err != nil {
+		return err
+	}
+	if err = store.Users().Anonymize(ctx, unionid, anonID); err != nil {
+		return err
+	}
+
+	redisCntrl := db.NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
+	_, err = redisCntrl.DEL(fmt.Sprintf(constant.RedisUserInfo, unionid))
+	return err
+}
+
+// leaveOwnGroup 注销时处理创建的群组, 没有可以转让的人时解散
+func leaveOwnGroup(ctx context.Context, groupID, unionid, policy string) error {
+	group, err := store.Groups().FindByID(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	toUserID, role := "", 0
+	if policy == constant.AccountGroupPolicyTransfer {
+		if len(group.ManagerIDs) > 0 {
+			toUserID, role = group.ManagerIDs[0], constant.GroupUserStatusManager
+		} else if len(group.MemberIDs) > 0 {
+			toUserID, role = group.MemberIDs[0], constant.GroupUserStatusMember
+		}
+	}
+	if toUserID == "" {
+		return DelGroupOwner(ctx, groupID, unionid, nil)
+	}
+
+	err = store.RunInTransaction(ctx, func(ctx context.Context) error {
+		groups, users := store.Groups(), store.Users()
+		if err := groups.SetOwner(ctx, groupID, toUserID); err != nil {
+			return err
+		}
+		// 新创建者移出原身份列表, 人数减一即为原创建者离开后的人数
+		if err := groups.RemoveUsers(ctx, groupID, role, []string{toUserID}); err != nil {
+			return err
+		}
+		if err := users.RemoveGroup(ctx, []string{toUserID}, role, groupID); err != nil {
+			return err
+		}
+		if err := users.AddGroup(ctx, []string{toUserID}, constant.GroupUserStatusOwner, groupID); err != nil {
+			return err
+		}
+		return users.RemoveGroup(ctx, []string{unionid}, constant.GroupUserStatusOwner, groupID)
+	})
+	if err != nil {
+		return err
+	}
+	emitMemberEvent(groupID, constant.WebhookEventMemberLeft, constant.GroupUserStatusOwner, []string{unionid})
+	return nil
+}
@@ -0,0 +1,83 @@
+package model
+
+/*
+   通知的附件: 图片、音频、视频和文档, 通过 qiniuToken 的附件类型上传
+   上传时七牛按类型异步处理: 图片生成缩略图, 音频转码为 mp3, 视频截取封面, office 文档转换为 pdf
+*/
+import (
+	"constant"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+type Attachment struct {
+	Kind       string  `bson:"kind" json:"kind"`                                 // constant.AttachmentKind*
+	Mime       string  `bson:"mime" json:"mime"`                                 // 文件的 MIME 类型
+	Size       int64   `bson:"size" json:"size"`                                 // 文件大小, 单位字节
+	Duration   float64 `bson:"duration,omitempty" json:"duration,omitempty"`     // 音频、视频的时长, 单位秒
+	Name       string  `bson:"name" json:"name"`                                 // 原文件名
+	URL        string  `bson:"url" json:"url"`                                   // 原文件, 保存文件名, 见 FileURL
+	Thumbnail  string  `bson:"thumbnail,omitempty" json:"thumbnail,omitempty"`   // 图片缩略图、视频封面
+	PreviewURL string  `bson:"previewUrl,omitempty" json:"previewUrl,omitempty"` // 音频转码的 mp3、文档转换的 pdf
+}
+
+// checkAttachments 附件只能是通过 qiniuToken 的附件类型上传的, 大小不能超过上传时的限制
+func checkAttachments(attachments []Attachment) error {
+	if len(attachments) > constant.AttachmentMaxNum {
+		return constant.ErrorOutOfRange
+	}
+	for _, attachment := range attachments {
+		sizeLimit, ok := constant.AttachmentSizeLimit[attachment.Kind]
+		if !ok || attachment.Size < 0 || attachment.Size > sizeLimit || attachment.Duration < 0 {
+			return constant.ErrorParamWrong
+		}
+		if utf8.RuneCountInString(attachment.Name) > constant.AttachmentNameMaxLen {
+			return constant.ErrorParamWrong
+		}
+		key, ok := fileKey(attachment.URL, constant.AttachmentPrefix+attachment.Kind+"/")
+		if !ok {
+			return constant.ErrorParamWrong
+		}
+		// 缩略图和预览只能是该文件上传时生成的, 存储不支持处理时为空
+		thumbnail, preview := AttachmentDerivativeKeys(attachment.Kind, key)
+		if !isDerivativeFile(attachment.Thumbnail, thumbnail) || !isDerivativeFile(attachment.PreviewURL, preview) {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
+
+// AttachmentDerivativeKeys 附件上传时生成的缩略图和预览的文件名, 该类型没有时为空
+// key 为 <AttachmentPrefix><kind>/<uuid><suffix>, 处理结果使用相同的 uuid
+func AttachmentDerivativeKeys(kind, key string) (thumbnail, preview string) {
+	suffix := path.Ext(key)
+	fileID := strings.TrimSuffix(path.Base(key), suffix)
+	switch kind {
+	case constant.AttachmentKindImage, constant.AttachmentKindVideo:
+		thumbnail = constant.AttachmentThumbPrefix + fileID + constant.ImgSuffix
+	case constant.AttachmentKindAudio:
+		preview = constant.AttachmentPreviewPrefix + fileID + constant.AttachmentMP3Suffix
+	case constant.AttachmentKindFile:
+		if suffix != constant.AttachmentPDFSuffix {
+			preview = constant.AttachmentPreviewPrefix + fileID + constant.AttachmentPDFSuffix
+		}
+	}
+	return thumbnail, preview
+}
+
+// isDerivativeFile raw 为空, 或者是文件名为 key 的处理结果
+func isDerivativeFile(raw, key string) bool {
+	return raw == "" || (key != "" && storedFile(raw) == key)
+}
+
+// attachmentURLs 附件引用的所有七牛云文件
+func attachmentURLs(attachment Attachment) []string {
+	urls := []string{attachment.URL}
+	for _, u := range []string{attachment.Thumbnail, attachment.PreviewURL} {
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
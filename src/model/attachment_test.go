@@ -0,0 +1,58 @@
+package model
+
+import (
+	"constant"
+	"testing"
+)
+
+func TestCheckAttachments(t *testing.T) {
+	const id = "2c5ea4c0-4067-11e9-8bad-9b1deb4d3b7d"
+	image := Attachment{
+		Kind:      constant.AttachmentKindImage,
+		URL:       constant.AttachmentPrefix + "image/" + id + ".png",
+		Thumbnail: constant.AttachmentThumbPrefix + id + constant.ImgSuffix,
+	}
+	audio := Attachment{
+		Kind:       constant.AttachmentKindAudio,
+		URL:        constant.AttachmentPrefix + "audio/" + id + ".silk",
+		PreviewURL: constant.AttachmentPreviewPrefix + id + constant.AttachmentMP3Suffix,
+	}
+	doc := Attachment{
+		Kind:       constant.AttachmentKindFile,
+		URL:        constant.AttachmentPrefix + "file/" + id + ".docx",
+		PreviewURL: constant.AttachmentPreviewPrefix + id + constant.AttachmentPDFSuffix,
+	}
+	pdf := Attachment{Kind: constant.AttachmentKindFile, URL: constant.AttachmentPrefix + "file/" + id + constant.AttachmentPDFSuffix}
+
+	with := func(a Attachment, fn func(a *Attachment)) Attachment {
+		fn(&a)
+		return a
+	}
+	tests := []struct {
+		name       string
+		attachment Attachment
+		want       error
+	}{
+		{"image", image, nil},
+		{"audio", audio, nil},
+		{"document", doc, nil},
+		{"pdf", pdf, nil},
+		{"no thumbnail", with(image, func(a *Attachment) { a.Thumbnail = "" }), nil},
+		{"thumbnail of other file", with(image, func(a *Attachment) {
+			a.Thumbnail = constant.AttachmentThumbPrefix + "other" + constant.ImgSuffix
+		}), constant.ErrorParamWrong},
+		{"thumbnail is another attachment", with(image, func(a *Attachment) { a.Thumbnail = doc.URL }), constant.ErrorParamWrong},
+		{"preview of other file", with(audio, func(a *Attachment) {
+			a.PreviewURL = constant.AttachmentPreviewPrefix + "other" + constant.AttachmentMP3Suffix
+		}), constant.ErrorParamWrong},
+		{"preview on image", with(image, func(a *Attachment) { a.PreviewURL = audio.PreviewURL }), constant.ErrorParamWrong},
+		{"preview on pdf", with(pdf, func(a *Attachment) { a.PreviewURL = doc.PreviewURL }), constant.ErrorParamWrong},
+		{"kind mismatch", with(audio, func(a *Attachment) { a.Kind = constant.AttachmentKindVideo }), constant.ErrorParamWrong},
+		{"not an attachment", with(image, func(a *Attachment) { a.URL = constant.ImgPrefixHomework + id + ".png" }), constant.ErrorParamWrong},
+	}
+	for _, tt := range tests {
+		if err := checkAttachments([]Attachment{tt.attachment}); err != tt.want {
+			t.Errorf("%s: checkAttachments = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package model
+
+/*
+   通知的评论和讨论
+   - 通知的接收人、创建者和在接收群组中有 editOthersNotice 权限的用户可以查看和评论
+   - 评论只有两层, 回复的回复归到同一条一级评论下, 通过 ReplyToUserID 区分回复对象
+   - 作者可以编辑和删除自己的评论, 通知的创建者和有 editOthersNotice 权限的用户可以删除任何评论
+   - 新评论提醒通知的创建者、被回复和被提到的用户
+*/
+import (
+	"constant"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Comment struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Status int                `bson:"status" json:"status"` // 状态: -10 删除, 5 正常
+
+	NoticeID       string   `bson:"noticeID" json:"noticeID"`             // _id
+	ParentID       string   `bson:"parentID" json:"parentID"`             // 所属的一级评论 _id, 一级评论为空
+	ReplyToUserID  string   `bson:"replyToUserID" json:"replyToUserID"`   // 回复的用户 unionid
+	UserID         string   `bson:"userID" json:"userID"`                 // 作者 unionid
+	Content        string   `bson:"content" json:"content"`               // 内容
+	MentionUserIDs []string `bson:"mentionUserIDs" json:"mentionUserIDs"` // 提到的用户 unionid, 须为接收群组中的用户
+	CreateTime     int64    `bson:"createTime" json:"createTime"`
+	UpdateTime     int64    `bson:"updateTime" json:"updateTime"`
+	DeletedBy      string   `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"` // 删除人 unionid
+}
+
+// CommentConnection 分页的一级评论
+type CommentConnection struct {
+	TotalCount  int
+	Comments    []Comment
+	HasNextPage bool
+	EndCursor   string // 最后一条评论的 id, 作为下一页的 after
+}
+
+// AddComment 评论通知或回复评论
+func AddComment(ctx context.Context, userID string, comment Comment) (Comment, error) {
+	now := util.GetNowTimestamp()
+	comment.ID = primitive.NewObjectID()
+	comment.Status = constant.CommentCommonStatus
+	comment.UserID = userID
+	comment.ReplyToUserID = ""
+	comment.Content = strings.TrimSpace(comment.Content)
+	comment.MentionUserIDs = uniqueUserIDs(comment.MentionUserIDs)
+	comment.CreateTime = now
+	comment.UpdateTime = now
+	if err := checkCommentContent(comment); err != nil {
+		return comment, err
+	}
+
+	notice, err := findCommentNotice(ctx, comment.NoticeID, userID)
+	if err != nil {
+		return comment, err
+	}
+	if comment.ParentID != "" {
+		parent, err := store.Comments().FindByID(ctx, comment.ParentID)
+		if err != nil {
+			return comment, err
+		}
+		if parent.NoticeID != comment.NoticeID || parent.Status != constant.CommentCommonStatus {
+			return comment, constant.ErrorNotFound
+		}
+		if parent.ParentID != "" {
+			comment.ParentID = parent.ParentID
+		}
+		comment.ReplyToUserID = parent.UserID
+	}
+	if err = checkCommentMentions(ctx, notice, comment.MentionUserIDs); err != nil {
+		return comment, err
+	}
+	if err = store.Comments().Insert(ctx, comment); err != nil {
+		return comment, err
+	}
+
+	util.GoBackground(func(ctx context.Context) {
+		sendCommentNotify(ctx, notice, comment, commentNotifyUserIDs(notice, comment))
+	})
+	return comment, nil
+}
+
+// UpdateComment 作者编辑评论, 只提醒新增的被提到的用户
+func UpdateComment(ctx context.Context, id, userID, content string, mentionUserIDs []string) (Comment, error) {
+	comment, err := store.Comments().FindByID(ctx, id)
+	if err != nil {
+		return comment, err
+	}
+	if comment.UserID != userID || comment.Status != constant.CommentCommonStatus {
+		return comment, constant.ErrorNotFound
+	}
+	oldMentionUserIDs := comment.MentionUserIDs
+	comment.Content = strings.TrimSpace(content)
+	comment.MentionUserIDs = uniqueUserIDs(mentionUserIDs)
+	comment.UpdateTime = util.GetNowTimestamp()
+	if err = checkCommentContent(comment); err != nil {
+		return comment, err
+	}
+
+	notice, err := findCommentNotice(ctx, comment.NoticeID, userID)
+	if err != nil {
+		return comment, err
+	}
+	if err = checkCommentMentions(ctx, notice, comment.MentionUserIDs); err != nil {
+		return comment, err
+	}
+	updateData := map[string]interface{}{
+		"content":        comment.Content,
+		"mentionUserIDs": comment.MentionUserIDs,
+		"updateTime":     comment.UpdateTime,
+	}
+	if err = store.Comments().Update(ctx, id, updateData); err != nil {
+		return comment, err
+	}
+
+	newMentions := pullAll(comment.MentionUserIDs, oldMentionUserIDs...)
+	if len(newMentions) > 0 {
+		util.GoBackground(func(ctx context.Context) {
+			sendCommentNotify(ctx, notice, comment, newMentions)
+		})
+	}
+	return comment, nil
+}
+
+// DeleteComment 删除评论, 作者、通知的创建者和在接收群组中有 editOthersNotice 权限的用户可以删除
+// 一级评论删除后其回复不再显示
+func DeleteComment(ctx context.Context, id, userID string) error {
+	comment, err := store.Comments().FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if comment.Status != constant.CommentCommonStatus {
+		return constant.ErrorNotFound
+	}
+	if comment.UserID != userID {
+		notice, err := store.Notices().FindByID(ctx, comment.NoticeID)
+		if err != nil {
+			return err
+		}
+		if notice.CreatorID != userID {
+			if err = checkNoticePermission(ctx, notice, userID, constant.GroupPermEditOthersNotice); err != nil {
+				return err
+			}
+		}
+	}
+	updateData := map[string]interface{}{
+		"status":     constant.CommentDeleteStatus,
+		"deletedBy":  userID,
+		"updateTime": util.GetNowTimestamp(),
+	}
+	return store.Comments().Update(ctx, id, updateData)
+}
+
+// GetNoticeComments 分页获取通知的一级评论, after 为上一页的 EndCursor
+func GetNoticeComments(ctx context.Context, noticeID, userID string, first int, after string) (CommentConnection, error) {
+	connection := CommentConnection{Comments: []Comment{}}
+	if first <= 0 || first > constant.CommentPageMaxNum {
+		return connection, constant.ErrorParamWrong
+	}
+	if _, err := findCommentNotice(ctx, noticeID, userID); err != nil {
+		return connection, err
+	}
+
+	// 多取一条判断是否有下一页
+	comments, err := store.Comments().FindByParent(ctx, noticeID, "", after, first+1)
+	if err != nil {
+		return connection, err
+	}
+	if len(comments) > first {
+		comments, connection.HasNextPage = comments[:first], true
+	}
+	if len(comments) > 0 {
+		connection.EndCursor = comments[len(comments)-1].ID.Hex()
+	}
+	connection.Comments = comments
+	connection.TotalCount, err = store.Comments().CountByParent(ctx, noticeID, "")
+	return connection, err
+}
+
+// GetCommentReplies 获取一级评论的所有回复
+func GetCommentReplies(ctx context.Context, comment Comment) ([]Comment, error) {
+	if comment.ParentID != "" {
+		return []Comment{}, nil
+	}
+	return store.Comments().FindByParent(ctx, comment.NoticeID, comment.ID.Hex(), "", 0)
+}
+
+// findCommentNotice 获取通知并检查用户能否查看和评论, 已删除的通知不能评论
+func findCommentNotice(ctx context.Context, noticeID, userID string) (Notice, error) {
+	notice, err := store.Notices().FindByID(ctx, noticeID)
+	if err != nil {
+		return notice, err
+	}
+	if notice.Status < constant.NoticeExpireStatus {
+		return notice, constant.ErrorNotFound
+	}
+	if !CanViewNotice(ctx, notice, userID) {
+		return notice, constant.ErrorNoPermission
+	}
+	return notice, nil
+}
+
+func checkCommentContent(comment Comment) error {
+	if comment.Content == "" || utf8.RuneCountInString(comment.Content) > constant.CommentContentMaxLen {
+		return constant.ErrorParamWrong
+	}
+	if len(comment.MentionUserIDs) > constant.CommentMentionMaxNum {
+		return constant.ErrorOutOfRange
+	}
+	return nil
+}
+
+// checkCommentMentions 提到的用户须是通知的创建者或接收人
+func checkCommentMentions(ctx context.Context, notice Notice, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	// 定向通知只能提到接收人, 不能借评论提醒看不到通知的成员
+	memberGroups := noticeMemberGroups(ctx, notice)
+	for _, userID := range userIDs {
+		if _, ok := memberGroups[userID]; !ok && userID != notice.CreatorID {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
+
+// commentNotifyUserIDs 一级评论提醒通知的创建者, 回复提醒被回复的用户, 另外提醒被提到的用户
+func commentNotifyUserIDs(notice Notice, comment Comment) []string {
+	userIDs := []string{}
+	if comment.ParentID == "" {
+		userIDs = append(userIDs, notice.CreatorID)
+	} else {
+		userIDs = append(userIDs, comment.ReplyToUserID)
+	}
+	return uniqueUserIDs(append(userIDs, comment.MentionUserIDs...))
+}
+
+// sendCommentNotify 提醒 userIDs 有新评论, 不提醒作者自己, 处于免打扰时段或屏蔽了群组时不发送
+func sendCommentNotify(ctx context.Context, notice Notice, comment Comment, userIDs []string) error {
+	userIDs = pullAll(userIDs, comment.UserID)
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	author, err := store.Users().FindByUnionid(ctx, comment.UserID)
+	if err != nil {
+		return err
+	}
+	users, err := store.Users().FindByUnionids(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	year, month, day := now.Date()
+	deliveries := []Delivery{}
+	for _, user := range users {
+		settings := user.NotificationSettings
+		if settings.inQuietHours(now) || !settings.allowAnyGroup(noticeGroupIDs(notice)) {
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			To: userRecipient(user),
+			Msg: Message{
+				Event:   constant.NotifyEventNoticeComment,
+				Title:   fmt.Sprintf(constant.CommentNotifyTitle, notice.Title),
+				Content: fmt.Sprintf(constant.CommentNotifyContent, author.Nickname, comment.Content),
+				Time:    fmt.Sprintf(constant.TemplateTime, year, month, day),
+			},
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	_, err = dispatch(ctx, deliveries)
+	return err
+}
+
+func uniqueUserIDs(userIDs []string) []string {
+	res := []string{}
+	for _, userID := range userIDs {
+		res = addToSet(res, userID)
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"testing"
+)
+
+func TestCheckCommentMentions(t *testing.T) {
+	old := store
+	defer SetStore(old)
+	SetStore(NewMemoryStore())
+
+	ctx := context.Background()
+	group := newTestGroup("AAAA", "owner", []string{"manager"}, []string{"u1", "u2", "u3"})
+	group.Subgroups = []Subgroup{{ID: "s1", UserIDs: []string{"u3"}}}
+	if err := store.Groups().Insert(ctx, group); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	plain := Notice{CreatorID: "manager", GroupID: group.ID.Hex()}
+	targeted := Notice{CreatorID: "manager", GroupID: group.ID.Hex(), TargetUserIDs: []string{"u1"}, SubgroupIDs: []string{"s1"}}
+
+	tests := []struct {
+		name    string
+		notice  Notice
+		userIDs []string
+		want    error
+	}{
+		{"none", targeted, nil, nil},
+		{"member of plain notice", plain, []string{"u1", "u2", "owner"}, nil},
+		{"not a member", plain, []string{"u1", "other"}, constant.ErrorParamWrong},
+		{"target user", targeted, []string{"u1"}, nil},
+		{"subgroup user", targeted, []string{"u3"}, nil},
+		{"creator", targeted, []string{"manager"}, nil},
+		{"member not targeted", targeted, []string{"u1", "u2"}, constant.ErrorParamWrong},
+	}
+	for _, tt := range tests {
+		if err := checkCommentMentions(ctx, tt.notice, tt.userIDs); err != tt.want {
+			t.Errorf("%s: checkCommentMentions(%v) = %v, want %v", tt.name, tt.userIDs, err, tt.want)
+		}
+	}
+}
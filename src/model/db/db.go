@@ -2,27 +2,22 @@ package db
 
 import (
 	"config"
+	"context"
 	"fmt"
+	"reflect"
 	"time"
 
-	mgo "gopkg.in/mgo.v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// MgoDBCntlr mgo controller
-type MgoDBCntlr struct {
-	sess *mgo.Session
-	db   *mgo.Database
-}
-
 var (
-	DBNAME     = config.Conf.DB.DBName
-	globalSess *mgo.Session
-	mongoURL   string
-)
-
-const (
-	MongoCopyType  = "1"
-	MongoCloneType = "2"
+	DBNAME       = config.Conf.DB.DBName
+	globalClient *mongo.Client
+	mongoURL     string
 )
 
 func init() {
@@ -34,50 +29,70 @@ func init() {
 	}
 
 	var err error
-	globalSess, err = GetDBSession()
+	globalClient, err = GetDBClient()
 	if err != nil {
 		panic(err)
 	}
 }
 
-/****************************************** db session manage ****************************************/
+/****************************************** db client manage ****************************************/
 
-// GetSession get the db session
-func GetDBSession() (*mgo.Session, error) {
-	globalMgoSession, err := mgo.DialWithTimeout(mongoURL, 10*time.Second)
-	if err != nil {
-		return nil, err
-	}
-	globalMgoSession.SetMode(mgo.Monotonic, true)
-	//default is 4096
-	globalMgoSession.SetPoolLimit(1000)
-	return globalMgoSession, nil
+// GetDBClient get the db client, 连接池由驱动管理
+func GetDBClient() (*mongo.Client, error) {
+	opts := options.Client().
+		ApplyURI(mongoURL).
+		SetConnectTimeout(10 * time.Second).
+		SetMaxPoolSize(1000).
+		SetRegistry(newRegistry())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return mongo.Connect(ctx, opts)
 }
 
-func NewCloneMgoDBCntlr() *MgoDBCntlr {
-	sess := globalSess.Clone()
-	return &MgoDBCntlr{
-		sess: sess,
-		db:   sess.DB(DBNAME),
+// newRegistry nil 切片保存为空数组而不是 null, 与 mgo 一致
+// 否则新建文档中为 nil 的 memberIDs、watchUserIDs 等字段无法使用 $addToSet、$push
+func newRegistry() *bsoncodec.Registry {
+	encoders := bsoncodec.DefaultValueEncoders{}
+	sliceEncoder := func(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+		if val.Kind() == reflect.Slice && val.IsNil() {
+			val = reflect.MakeSlice(val.Type(), 0, 0)
+		}
+		return encoders.SliceEncodeValue(ec, vw, val)
 	}
+	return bson.NewRegistryBuilder().
+		RegisterDefaultEncoder(reflect.Slice, bsoncodec.ValueEncoderFunc(sliceEncoder)).
+		Build()
 }
 
-func NewCopyMgoDBCntlr() *MgoDBCntlr {
-	sess := globalSess.Copy()
-	return &MgoDBCntlr{
-		sess: sess,
-		db:   sess.DB(DBNAME),
-	}
+// CloseDBClient 断开 mongo 连接, 退出时调用
+func CloseDBClient(ctx context.Context) error {
+	return globalClient.Disconnect(ctx)
 }
 
-func (this *MgoDBCntlr) Close() {
-	this.sess.Close()
+func GetDB() *mongo.Database {
+	return globalClient.Database(DBNAME)
 }
 
-func (this *MgoDBCntlr) GetDB() *mgo.Database {
-	return this.db
+func GetTable(tableName string) *mongo.Collection {
+	return GetDB().Collection(tableName)
 }
 
-func (this *MgoDBCntlr) GetTable(tableName string) *mgo.Collection {
-	return this.db.C(tableName)
+// WithTransaction 在事务中执行 fn, fn 内的所有操作需使用传入的 ctx
+// 注：事务需要 mongo 副本集, 未开启 EnableTransaction 时直接执行 fn
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !config.Conf.DB.EnableTransaction {
+		return fn(ctx)
+	}
+
+	sess, err := globalClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
 }
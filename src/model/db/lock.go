@@ -0,0 +1,218 @@
+package db
+
+import (
+	"constant"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+/*
+   基于 redis 的分布式锁，用于多实例部署时保证定时任务只执行一次
+   - 加锁：SET key value NX PX ttl, value 为 <owner>:<token>
+   - fencing token：每次加锁前 INCR 获取单调递增的 token, 加锁成功时记录为该锁的最新 token
+   - 续期：持有期间每 ttl/3 续期一次, 续期失败说明锁已丢失, 取消 Context()
+   锁丢失后旧持有者可能仍在执行, Context() 中带有 token, 任务的写入通过 FencedSETEX、FencedSETNXEX
+   或先调用 CheckFence, 在 token 小于最新 token 时拒绝写入
+*/
+
+const (
+	// token 大于最新 token 时才加锁, 加锁成功后记录 token, 避免先取得 token 后加锁的实例覆盖更新的 token
+	lockAcquireScript = `if tonumber(ARGV[3]) <= tonumber(redis.call("GET", KEYS[2]) or "0") then return 0 end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	redis.call("SET", KEYS[2], ARGV[3])
+	return 1
+end
+return 0`
+	// token 不小于最新 token 时写入, 返回 -1 表示锁已被其他实例取得; ARGV[4] 为 1 时只在 key 不存在时写入, 未写入返回 0
+	fencedSetScript = `if tonumber(ARGV[1]) < tonumber(redis.call("GET", KEYS[1]) or "0") then return -1 end
+if ARGV[4] == "1" then
+	if redis.call("SET", KEYS[2], ARGV[2], "NX", "EX", ARGV[3]) then return 1 end
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[2], "EX", ARGV[3])
+return 1`
+	// 仅当锁仍由自己持有时续期/释放
+	lockRenewScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	lockDelScript   = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+// lockOwner 当前实例标识: <hostname>:<pid>
+var lockOwner string
+
+func init() {
+	hostname, _ := os.Hostname()
+	lockOwner = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// fence 持锁执行时 Context() 中的 token
+type fence struct {
+	key   string // 记录最新 token 的 key
+	token int64
+}
+
+type fenceCtxKey struct{}
+
+type RedisLock struct {
+	Name  string
+	Owner string
+	Token int64
+
+	key   string
+	value string
+	ttl   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// AcquireLock 尝试获取锁, 锁已被持有时返回 constant.ErrorLockHeld
+func AcquireLock(ctx context.Context, name string, ttl time.Duration) (*RedisLock, error) {
+	redisCntrl := NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
+
+	token, err := redis.Int64(redisCntrl.Do("INCR", fmt.Sprintf(constant.RedisLockToken, name)))
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf(constant.RedisLock, name)
+	value := fmt.Sprintf("%s:%d", lockOwner, token)
+	f := fence{key: fmt.Sprintf(constant.RedisLockFence, name), token: token}
+	ok, err := redis.Int(redisCntrl.Do("EVAL", lockAcquireScript, 2, key, f.key, value, int64(ttl/time.Millisecond), token))
+	if err != nil {
+		return nil, err
+	}
+	if ok != 1 {
+		return nil, constant.ErrorLockHeld
+	}
+
+	lockCtx, cancel := context.WithCancel(context.WithValue(ctx, fenceCtxKey{}, f))
+	lock := &RedisLock{
+		Name:   name,
+		Owner:  lockOwner,
+		Token:  token,
+		key:    key,
+		value:  value,
+		ttl:    ttl,
+		ctx:    lockCtx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lock.keepAlive()
+	return lock, nil
+}
+
+// Context 锁丢失或释放后被取消, 持锁执行的操作应使用该 ctx, 其中带有 fencing token
+func (this *RedisLock) Context() context.Context {
+	return this.ctx
+}
+
+// Release 停止续期并释放锁
+// hold > 0 时不立即删除, 而是将锁保留 hold 时长, 避免其他实例稍后触发的同一任务再次执行
+func (this *RedisLock) Release(hold time.Duration) error {
+	close(this.stop)
+	<-this.done
+	defer this.cancel()
+
+	// 任务 ctx 可能已取消, 释放锁使用独立的 ctx
+	redisCntrl := NewRedisDBCntlr(context.Background())
+	defer redisCntrl.Close()
+
+	var err error
+	if hold > 0 {
+		_, err = redisCntrl.Do("EVAL", lockRenewScript, 1, this.key, this.value, int64(hold/time.Millisecond))
+	} else {
+		_, err = redisCntrl.Do("EVAL", lockDelScript, 1, this.key, this.value)
+	}
+	return err
+}
+
+func (this *RedisLock) keepAlive() {
+	defer close(this.done)
+	ticker := time.NewTicker(this.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.stop:
+			return
+		case <-this.ctx.Done():
+			return
+		case <-ticker.C:
+			if !this.renew() {
+				this.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (this *RedisLock) renew() bool {
+	redisCntrl := NewRedisDBCntlr(this.ctx)
+	defer redisCntrl.Close()
+
+	ok, err := redis.Int(redisCntrl.Do("EVAL", lockRenewScript, 1, this.key, this.value, int64(this.ttl/time.Millisecond)))
+	return err == nil && ok == 1
+}
+
+/********************************************* fencing *******************************************/
+
+// CheckFence ctx 来自 RedisLock.Context() 时, 锁已被其他实例以更新的 token 取得则返回 constant.ErrorLockLost
+// 不在锁内执行时不校验, 用于无法与校验原子执行的写入(如 mongo)之前
+func CheckFence(ctx context.Context) error {
+	f, ok := ctx.Value(fenceCtxKey{}).(fence)
+	if !ok {
+		return nil
+	}
+	redisCntrl := NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
+
+	latest, err := redis.Int64(redisCntrl.Do("GET", f.key))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	if f.token < latest {
+		return constant.ErrorLockLost
+	}
+	return nil
+}
+
+// FencedSETEX 同 SETEX, 在锁内执行时 token 过期则不写入并返回 constant.ErrorLockLost
+func (this *RedisDBCntlr) FencedSETEX(key string, expire int64, value string) error {
+	_, err := this.fencedSet(key, expire, value, false)
+	return err
+}
+
+// FencedSETNXEX 同 SETNXEX, 在锁内执行时 token 过期则不写入并返回 constant.ErrorLockLost
+func (this *RedisDBCntlr) FencedSETNXEX(key string, expire int64, value string) (bool, error) {
+	return this.fencedSet(key, expire, value, true)
+}
+
+func (this *RedisDBCntlr) fencedSet(key string, expire int64, value string, nx bool) (bool, error) {
+	f, ok := this.ctx.Value(fenceCtxKey{}).(fence)
+	if !ok {
+		if nx {
+			return this.SETNXEX(key, expire, value)
+		}
+		_, err := this.SETEX(key, expire, value)
+		return err == nil, err
+	}
+	nxArg := "0"
+	if nx {
+		nxArg = "1"
+	}
+	res, err := redis.Int(this.Do("EVAL", fencedSetScript, 2, f.key, key, f.token, value, expire, nxArg))
+	if err != nil {
+		return false, err
+	}
+	if res < 0 {
+		return false, constant.ErrorLockLost
+	}
+	return res == 1, nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+/*
+   基于 redis 的令牌桶限流, 多实例共享同一个桶
+   - 桶中最多 burst 个令牌, 每分钟补充 rate 个, 每次请求消耗一个
+   - 桶以 hash 存储: tokens 剩余令牌数, ts 上次更新时间(毫秒), 桶补满后自动过期
+*/
+
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", math.max(now, ts))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate))
+return {allowed, wait}`
+
+// TakeToken 从 key 对应的令牌桶中取一个令牌, 没有令牌时返回需要等待的时长
+// rate 为每分钟补充的令牌数, burst 为桶容量
+func TakeToken(ctx context.Context, key string, rate, burst int) (bool, time.Duration, error) {
+	if rate <= 0 || burst <= 0 {
+		return true, 0, nil
+	}
+	redisCntrl := NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
+
+	ratePerMs := strconv.FormatFloat(float64(rate)/float64(time.Minute/time.Millisecond), 'f', -1, 64)
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	res, err := redis.Int64s(redisCntrl.Do("EVAL", tokenBucketScript, 1, key, ratePerMs, burst, now))
+	if err != nil {
+		return true, 0, err
+	}
+	if len(res) != 2 {
+		return true, 0, redis.ErrNil
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
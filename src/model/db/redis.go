@@ -2,14 +2,19 @@ package db
 
 import (
 	"config"
+	"constant"
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/garyburd/redigo/redis"
 )
 
-// redis controller
+// redis controller, 所有命令受 ctx 的取消和截止时间约束
 type RedisDBCntlr struct {
+	ctx  context.Context
 	conn redis.Conn
+	err  error
 }
 
 var globalRedisPool *redis.Pool
@@ -26,11 +31,15 @@ func init() {
 // GetRedisPool get the client pool of redis
 func GetRedisPool() *redis.Pool {
 	pool := &redis.Pool{ // 实例化一个连接池
-		MaxIdle:     30, // 最大的连接数量
-		MaxActive:   0,  // 连接池最大连接数量,不确定可以用0（0表示自动定义）
-		IdleTimeout: 60, // 连接关闭时间 60秒 （60秒不使用自动关闭）
+		MaxIdle:     30,               // 最大的连接数量
+		MaxActive:   0,                // 连接池最大连接数量,不确定可以用0（0表示自动定义）
+		IdleTimeout: 60 * time.Second, // 连接关闭时间 60秒 （60秒不使用自动关闭）
 		Dial: func() (redis.Conn, error) { // 要连接的redis数据库
-			conn, err := redis.Dial("tcp", redisURL)
+			conn, err := redis.Dial("tcp", redisURL,
+				redis.DialConnectTimeout(constant.RedisTimeout),
+				redis.DialReadTimeout(constant.RedisTimeout),
+				redis.DialWriteTimeout(constant.RedisTimeout),
+			)
 			if err != nil {
 				return nil, err
 			}
@@ -43,16 +52,27 @@ func GetRedisPool() *redis.Pool {
 	return pool
 }
 
+// CloseRedisPool 关闭 redis 连接池, 退出时调用
+func CloseRedisPool() error {
+	return globalRedisPool.Close()
+}
+
 /********************************************* RedisDBCntlr *******************************************/
 
-func NewRedisDBCntlr() *RedisDBCntlr {
+// NewRedisDBCntlr 从连接池获取连接, 连接池满时最多等待到 ctx 结束
+func NewRedisDBCntlr(ctx context.Context) *RedisDBCntlr {
+	conn, err := globalRedisPool.GetContext(ctx)
 	return &RedisDBCntlr{
-		conn: globalRedisPool.Get(),
+		ctx:  ctx,
+		conn: conn,
+		err:  err,
 	}
 }
 
 func (this *RedisDBCntlr) Close() {
-	this.conn.Close()
+	if this.conn != nil {
+		this.conn.Close()
+	}
 }
 
 func (this *RedisDBCntlr) GetConn() redis.Conn {
@@ -60,43 +80,68 @@ func (this *RedisDBCntlr) GetConn() redis.Conn {
 }
 
 func (this *RedisDBCntlr) Send(commandName string, args ...interface{}) error {
+	if this.err != nil {
+		return this.err
+	}
 	return this.conn.Send(commandName, args...)
 }
 
+// Do 执行命令, 超时时间取 ctx 剩余时间和 constant.RedisTimeout 中较小者
 func (this *RedisDBCntlr) Do(commandName string, args ...interface{}) (interface{}, error) {
-	return this.conn.Do(commandName, args...)
+	if this.err != nil {
+		return nil, this.err
+	}
+	if err := this.ctx.Err(); err != nil {
+		return nil, err
+	}
+	timeout := constant.RedisTimeout
+	if deadline, ok := this.ctx.Deadline(); ok {
+		if d := time.Until(deadline); d < timeout {
+			timeout = d
+		}
+	}
+	return redis.DoWithTimeout(this.conn, timeout, commandName, args...)
 }
 
 func (this *RedisDBCntlr) GET(key string) (string, error) {
-	return redis.String(this.conn.Do("GET", key))
+	return redis.String(this.Do("GET", key))
 }
 
 func (this *RedisDBCntlr) GETInt64(key string) (int64, error) {
-	return redis.Int64(this.conn.Do("GET", key))
+	return redis.Int64(this.Do("GET", key))
 }
 
 func (this *RedisDBCntlr) SET(key string, value interface{}) (interface{}, error) {
-	return this.conn.Do("SET", key, value)
+	return this.Do("SET", key, value)
 }
 
 func (this *RedisDBCntlr) SETEX(key string, expire int64, value string) (interface{}, error) {
-	return this.conn.Do("SETEX", key, expire, value)
+	return this.Do("SETEX", key, expire, value)
+}
+
+// SETNXEX key 不存在时设置并返回 true
+func (this *RedisDBCntlr) SETNXEX(key string, expire int64, value string) (bool, error) {
+	_, err := redis.String(this.Do("SET", key, value, "NX", "EX", expire))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 func (this *RedisDBCntlr) INCRBY(key string, num int) (interface{}, error) {
-	return this.conn.Do("INCRBY", key, num)
+	return this.Do("INCRBY", key, num)
 }
 
 func (this *RedisDBCntlr) KEYS(keyPattern string) ([]string, error) {
-	return redis.Strings(this.conn.Do("KEYS", keyPattern))
+	return redis.Strings(this.Do("KEYS", keyPattern))
 }
 
 func (this *RedisDBCntlr) DEL(keys ...interface{}) (interface{}, error) {
-	return this.conn.Do("DEL", keys...)
+	return this.Do("DEL", keys...)
 }
 
 func (this *RedisDBCntlr) HGETALL(key string) (map[string]interface{}, error) {
-	d, err := redis.StringMap(this.conn.Do("HGETALL", key))
+	d, err := redis.StringMap(this.Do("HGETALL", key))
 	if err != nil {
 		return nil, err
 	}
@@ -110,33 +155,33 @@ func (this *RedisDBCntlr) HGETALL(key string) (map[string]interface{}, error) {
 func (this *RedisDBCntlr) HMGET(key string, fields ...interface{}) (map[string]string, error) {
 	args := []interface{}{key}
 	args = append(args, fields...)
-	return redis.StringMap(this.conn.Do("HMGET", args...))
+	return redis.StringMap(this.Do("HMGET", args...))
 }
 
 func (this *RedisDBCntlr) HMSET(key string, fields ...interface{}) (interface{}, error) {
 	args := []interface{}{key}
 	args = append(args, fields...)
-	return this.conn.Do("HMSET", args...)
+	return this.Do("HMSET", args...)
 }
 
 func (this *RedisDBCntlr) LRANGE(key string, start, end int) ([]string, error) {
-	return redis.Strings(this.conn.Do("LRANGE", key, start, end))
+	return redis.Strings(this.Do("LRANGE", key, start, end))
 }
 
 func (this *RedisDBCntlr) LLEN(key string) (int, error) {
-	return redis.Int(this.conn.Do("LLEN", key))
+	return redis.Int(this.Do("LLEN", key))
 }
 
 func (this *RedisDBCntlr) LPOP(key string) (string, error) {
-	return redis.String(this.conn.Do("LPOP", key))
+	return redis.String(this.Do("LPOP", key))
 }
 
 func (this *RedisDBCntlr) RPUSH(key string, params ...interface{}) (interface{}, error) {
 	args := []interface{}{key}
 	args = append(args, params...)
-	return this.conn.Do("RPUSH", args...)
+	return this.Do("RPUSH", args...)
 }
 
 func (this RedisDBCntlr) EXPIRE(key string, seconds int64) (interface{}, error) {
-	return this.conn.Do("EXPIRE", key, seconds)
+	return this.Do("EXPIRE", key, seconds)
 }
@@ -1,11 +1,18 @@
 package model
 
-import "gopkg.in/mgo.v2/bson"
+import (
+	"constant"
+	"context"
+	"fmt"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Feedback struct {
-	ID     bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty"`
-	Type   int           `bson:"type" json:"type"`     // 反馈类别
-	Status int           `bson:"status" json:"status"` // 状态：0 未查看，1 已经查看
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Type   int                `bson:"type" json:"type"`     // 反馈类别
+	Status int                `bson:"status" json:"status"` // 状态：0 未查看，1 已经查看
 
 	UserID     string `bson:"userID" json:"userID"`         // _id
 	CreateTime int64  `bson:"createTime" json:"createTime"` // 创建时间
@@ -13,3 +20,42 @@ type Feedback struct {
 	Content    string `bson:"content"  json:"content"`      // 内容
 	Imgs       []Img  `bson:"imgs" json:"imgs"`             // 图片
 }
+
+// NewFeedback 校验用户提交的反馈并补全字段
+func NewFeedback(ctx context.Context, userID string, feedback Feedback) (Feedback, error) {
+	feedback.ID = primitive.NewObjectID()
+	feedback.Status = constant.FeedbackUnReadStatus
+	feedback.UserID = userID
+	feedback.CreateTime = util.GetNowTimestamp()
+	feedback.Imgs = storedImgs(feedback.Imgs)
+	if err := checkImgUploads(ctx, userID, constant.ImgTypeFeedback, feedback.Imgs); err != nil {
+		return feedback, err
+	}
+	return feedback, nil
+}
+
+// SaveFeedback 保存反馈, 反馈以邮件提醒管理员为主, 保存失败不影响提交
+func SaveFeedback(ctx context.Context, feedback Feedback) error {
+	return store.Feedbacks().Insert(ctx, feedback)
+}
+
+// NotifyFeedback 提醒管理员有人反馈了
+func NotifyFeedback(ctx context.Context, feedback Feedback) error {
+	imgHTML := "<img src=\"%s\"  alt=\"反馈图片\" />"
+	content := fmt.Sprintf(constant.EmailFeedbackNotice, feedback.ContactWay, feedback.Content)
+	for _, img := range feedback.Imgs {
+		content += "<br />" + fmt.Sprintf(imgHTML, fileURL(img.URL, constant.FeedbackImgURLExpire))
+	}
+
+	msg := Message{
+		Event:   constant.NotifyEventFeedback,
+		Title:   constant.EmailFeedbackSubject,
+		Content: content,
+	}
+	deliveries := []Delivery{}
+	for _, to := range adminRecipients() {
+		deliveries = append(deliveries, Delivery{To: to, Msg: msg})
+	}
+	_, err := dispatch(ctx, deliveries)
+	return err
+}
@@ -4,18 +4,19 @@ package model
    圈子群体
 */
 import (
+	"config"
 	"constant"
-	"errors"
+	"context"
 	"fmt"
 	"model/db"
-	"sync"
 	"util"
 
-	"gopkg.in/mgo.v2/bson"
+	"github.com/garyburd/redigo/redis"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Group struct {
-	ID bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty"`
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	// 状态: -10 表示解散状态, 5 表示正常状态
 	Status int    `bson:"status" json:"status"`
 	Code   string `bson:"code" json:"code"` // 圈子code -> 邀请码, unique
@@ -27,589 +28,280 @@ type Group struct {
 	ManagerIDs []string `bson:"managerIDs" json:"managerIDs"` // 管理员
 	MemberIDs  []string `bson:"memberIDs" json:"memberIDs"`   // 成员
 	PersonNum  int      `bson:"personNum" json:"personNum"`   // 总人数：1 + 管理员人数 + 成员人数
-}
-
-var groupCodeNextNumMutex sync.Mutex
 
-func init() {
-	InitGroupCodeNextNum()
-}
+	// 自定义角色, 管理员和成员可以被指定一个, 未指定时使用 constant.GroupRolePresets 中的权限
+	Roles     []GroupRole       `bson:"roles,omitempty" json:"roles,omitempty"`
+	UserRoles map[string]string `bson:"userRoles,omitempty" json:"userRoles,omitempty"` // unionid -> 自定义角色id
 
-func InitGroupCodeNextNum() {
-	cntrl := db.NewRedisDBCntlr()
-	defer cntrl.Close()
+	// 分组, 通知可以只发送给部分分组
+	Subgroups []Subgroup `bson:"subgroups,omitempty" json:"subgroups,omitempty"`
 
-	nextNum, _ := cntrl.GETInt64(constant.RedisGroupCodeNextNum)
-	if nextNum == 0 {
-		cntrl.SET(constant.RedisGroupCodeNextNum, constant.RedisGroupInitNextNum)
-	}
+	// 解散后保留在回收站中, 成员列表不变, 用于恢复
+	DeletedAt int64  `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // 解散时间
+	DeletedBy string `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"` // 解散人 unionid
 }
 
-func CreateGroup(unionid, nickname, avatarURL string) (string, error) {
-	var code string
-	for i := 0; i < 5; i++ {
-		code, _ = getGroupCode()
-		if code != "" {
-			break
-		}
-	}
+// groupCodePopScript 从池中取一个 code, 池为空时预留一段序号, 由调用方生成 code 后放回池中
+// 多个实例同时补充时预留的序号段互不重叠
+const groupCodePopScript = `
+local code = redis.call("LPOP", KEYS[1])
+if code then
+	return {code, -1}
+end
+return {"", redis.call("INCRBY", KEYS[2], ARGV[1]) - ARGV[1]}`
 
+func CreateGroup(ctx context.Context, unionid, nickname, avatarURL string) (string, error) {
 	group := Group{
-		ID:         bson.NewObjectId(),
+		ID:         primitive.NewObjectID(),
 		Status:     constant.GroupCommonStatus,
 		CreateTime: util.GetNowTimestamp(),
-		Code:       code,
 		AvatarURL:  avatarURL,
 		Nickname:   nickname,
 		OwnerID:    unionid,
 		PersonNum:  1,
 	}
-	err := insertGroups(group)
+
+	// code 有唯一索引, 更换 GroupCodeKey 等情况下可能与已有的重复, 重新获取
+	var err error
+	for i := 0; i < 5; i++ {
+		group.Code, err = getGroupCode(ctx)
+		if err != nil {
+			continue
+		}
+		err = store.Groups().Insert(ctx, group)
+		if err != constant.ErrorHasExist {
+			break
+		}
+	}
 	if err != nil {
 		return "", err
 	}
-	go AddUserOwnGroup(unionid, group.ID.Hex())
-	return code, err
+	util.GoBackground(func(ctx context.Context) {
+		AddUserOwnGroup(ctx, unionid, group.ID.Hex())
+	})
+	return group.Code, nil
 }
 
-func GetGroupByCode(code string) (Group, error) {
-	query := bson.M{
-		"code": code,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
+// findGroupByCode 校验位不正确的 code 直接返回 constant.ErrorNotFound, 不查询数据库
+func findGroupByCode(ctx context.Context, code string) (Group, error) {
+	code, ok := util.NormalizeGroupCode(code)
+	if !ok {
+		return Group{}, constant.ErrorNotFound
 	}
-	return findGroup(query, DefaultSelector)
+	return store.Groups().FindByCode(ctx, code)
 }
 
-func JoinGroup(code, unionid string) error {
-	return groupAction(code, unionid, true)
+func GetGroupByCode(ctx context.Context, code string) (Group, error) {
+	return findGroupByCode(ctx, code)
 }
 
-func LeaveGroup(code, unionid string) error {
-	return groupAction(code, unionid, false)
+func JoinGroup(ctx context.Context, code, unionid string) error {
+	return groupAction(ctx, code, unionid, true)
 }
 
-func groupAction(code, unionid string, isJoin bool) error {
-	query := bson.M{
-		"code": code,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-		"ownerID": bson.M{
-			"$ne": unionid,
-		},
-		"managerIDs": bson.M{
-			"$nin": []string{unionid},
-		},
-	}
+func LeaveGroup(ctx context.Context, code, unionid string) error {
+	return groupAction(ctx, code, unionid, false)
+}
 
-	group, err := findGroup(query, bson.M{"code": 1})
+func groupAction(ctx context.Context, code, unionid string, isJoin bool) error {
+	group, err := findGroupByCode(ctx, code)
 	if err != nil {
 		return err
 	}
-	var update bson.M
-	if isJoin {
-		update = bson.M{
-			"$addToSet": bson.M{
-				"memberIDs": unionid,
-			},
-			"$inc": bson.M{
-				"personNum": 1,
-			},
-		}
-	} else {
-		update = bson.M{
-			"$pull": bson.M{
-				"memberIDs": unionid,
-			},
-			"$inc": bson.M{
-				"personNum": -1,
-			},
-		}
+	// 创建者和管理员不能以成员身份加入或离开
+	if group.OwnerID == unionid || containString(group.ManagerIDs, unionid) {
+		return constant.ErrorParamWrong
 	}
 
-	err = updateGroup(query, update)
+	groupID := group.ID.Hex()
+	unionids := []string{unionid}
+	err = store.RunInTransaction(ctx, func(ctx context.Context) error {
+		if isJoin {
+			if err := store.Groups().AddUsers(ctx, groupID, constant.GroupUserStatusMember, unionids); err != nil {
+				return err
+			}
+			return store.Users().AddGroup(ctx, unionids, constant.GroupUserStatusMember, groupID)
+		}
+		if err := store.Groups().RemoveUsers(ctx, groupID, constant.GroupUserStatusMember, unionids); err != nil {
+			return err
+		}
+		return store.Users().RemoveGroup(ctx, unionids, constant.GroupUserStatusMember, groupID)
+	})
 	if err != nil {
 		return err
 	}
-	query = bson.M{
-		"unionid": unionid,
-	}
 
+	event := constant.WebhookEventMemberLeft
 	if isJoin {
-		update = bson.M{
-			"$addToSet": bson.M{
-				"joinGroups": group.ID.Hex(),
-			},
-		}
-	} else {
-		update = bson.M{
-			"$pull": bson.M{
-				"joinGroups": group.ID.Hex(),
-			},
-		}
+		event = constant.WebhookEventMemberJoined
 	}
-	return updateUser(query, update)
+	emitMemberEvent(groupID, event, constant.GroupUserStatusMember, unionids)
+	return nil
 }
 
-// UpdateGroupOwner 转让群组, toUserIDs 为 转给的人的id, len = 1, 且只能转给管理员
-func UpdateGroupOwner(groupID, ownerID string, toUserIDs []string) error {
+// UpdateGroupOwner 发起群组转让, toUserIDs 为 转给的人的id, len = 1, 接收人确认后原拥有者成为成员
+func UpdateGroupOwner(ctx context.Context, groupID, ownerID string, toUserIDs []string) error {
 	if len(toUserIDs) < 1 {
 		return constant.ErrorParamWrong
 	}
-
-	if !bson.IsObjectIdHex(groupID) {
-		return constant.ErrorIDFormatWrong
-	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-
-	query := bson.M{
-		"_id":     bson.ObjectIdHex(groupID),
-		"ownerID": ownerID,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-		"managerIDs": toUserIDs[0],
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"ownerID": toUserIDs[0],
-		},
-		"$pull": bson.M{
-			"managerIDs": toUserIDs[0],
-		},
-		"$addToSet": bson.M{
-			"memberIDs": ownerID,
-		},
-	}
-
-	err := groupTable.Update(query, update)
-	if err != nil {
-		return err
-	}
-
-	query = bson.M{
-		"unionid": ownerID,
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"ownGroups": groupID,
-		},
-	}
-	userTable := cntrl.GetTable(constant.TableUser)
-	err = userTable.Update(query, update)
-	if err != nil {
-		return err
-	}
-
-	query = bson.M{
-		"unionid": toUserIDs[0],
-	}
-	update = bson.M{
-		"$addToSet": bson.M{
-			"ownGroups": groupID,
-		},
-	}
-	return userTable.Update(query, update)
-
+	_, err := TransferGroupOwnership(ctx, groupID, ownerID, toUserIDs[0], constant.GroupUserStatusMember)
+	return err
 }
 
 // DelGroupOwner 解散群组
-func DelGroupOwner(groupID, ownerID string, toUserIDs []string) error {
-	if !bson.IsObjectIdHex(groupID) {
-		return constant.ErrorIDFormatWrong
-	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-
-	query := bson.M{
-		"_id":     bson.ObjectIdHex(groupID),
-		"ownerID": ownerID,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-	}
-
-	group := Group{}
-	selector := bson.M{
-		"ownerID":    1,
-		"managerIDs": 1,
-		"memberIDs":  1,
-	}
-	err := groupTable.FindId(bson.ObjectIdHex(groupID)).Select(selector).One(&group)
-	if err != nil {
-		return err
-	}
-
-	update := bson.M{
-		"$set": bson.M{
-			"status": constant.GroupDelStatus,
-		},
-	}
-
-	err = groupTable.Update(query, update)
+func DelGroupOwner(ctx context.Context, groupID, ownerID string, toUserIDs []string) error {
+	group, err := store.Groups().FindByID(ctx, groupID)
 	if err != nil {
 		return err
 	}
-
-	// 创建者、管理员、成员 更新
-	userTable := cntrl.GetTable(constant.TableUser)
-	query = bson.M{
-		"unionid": ownerID,
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"ownGroups": groupID,
-		},
-	}
-	userTable.Update(query, update)
-
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": group.ManagerIDs,
-		},
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"manageGroups": groupID,
-		},
+	if group.OwnerID != ownerID {
+		return constant.ErrorParamWrong
 	}
-	userTable.UpdateAll(query, update)
 
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": group.MemberIDs,
-		},
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"joinGroups": groupID,
-		},
-	}
-	userTable.UpdateAll(query, update)
-	return nil
+	// 创建者、管理员、成员 更新, 群组的成员列表保留, 可在回收站中恢复
+	return store.RunInTransaction(ctx, func(ctx context.Context) error {
+		users := store.Users()
+		if err := store.Groups().SoftDelete(ctx, groupID, ownerID, util.GetNowTimestamp()); err != nil {
+			return err
+		}
+		if err := users.RemoveGroup(ctx, []string{ownerID}, constant.GroupUserStatusOwner, groupID); err != nil {
+			return err
+		}
+		if err := users.RemoveGroup(ctx, group.ManagerIDs, constant.GroupUserStatusManager, groupID); err != nil {
+			return err
+		}
+		return users.RemoveGroup(ctx, group.MemberIDs, constant.GroupUserStatusMember, groupID)
+	})
 }
 
-// SetGroupManager 设置群组管理员
-func SetGroupManager(groupID, ownerID string, toUserIDs []string) error {
-	if !bson.IsObjectIdHex(groupID) {
-		return constant.ErrorIDFormatWrong
-	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-
-	query := bson.M{
-		"_id":     bson.ObjectIdHex(groupID),
-		"ownerID": ownerID,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-		"memberIDs": bson.M{
-			"$all": toUserIDs,
-		},
-	}
-	update := bson.M{
-		"$addToSet": bson.M{
-			"managerIDs": bson.M{
-				"$each": toUserIDs,
-			},
-		},
-		"$pullAll": bson.M{
-			"memberIDs": toUserIDs,
-		},
-	}
-
-	err := groupTable.Update(query, update)
-	if err != nil {
-		return err
-	}
-
-	userTable := cntrl.GetTable(constant.TableUser)
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": toUserIDs,
-		},
-	}
-	update = bson.M{
-		"$addToSet": bson.M{
-			"manageGroups": groupID,
-		},
-	}
-	userTable.UpdateAll(query, update)
-
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": toUserIDs,
-		},
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"joinGroups": groupID,
-		},
-	}
-	_, err = userTable.UpdateAll(query, update)
-	return err
+// SetGroupManager 设置群组管理员, 需要 manageRoles 权限
+func SetGroupManager(ctx context.Context, groupID, ownerID string, toUserIDs []string) error {
+	return changeGroupUserRole(ctx, groupID, ownerID, toUserIDs, constant.GroupUserStatusMember, constant.GroupUserStatusManager)
 }
 
 // UnSetGroupManager 取消群组管理员权限
-func UnSetGroupManager(groupID, ownerID string, toUserIDs []string) error {
-	if !bson.IsObjectIdHex(groupID) {
-		return constant.ErrorIDFormatWrong
-	}
+func UnSetGroupManager(ctx context.Context, groupID, ownerID string, toUserIDs []string) error {
+	return changeGroupUserRole(ctx, groupID, ownerID, toUserIDs, constant.GroupUserStatusManager, constant.GroupUserStatusMember)
+}
 
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-
-	query := bson.M{
-		"_id":     bson.ObjectIdHex(groupID),
-		"ownerID": ownerID,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-		"managerIDs": bson.M{
-			"$all": toUserIDs,
-		},
-	}
-	update := bson.M{
-		"$pullAll": bson.M{
-			"managerIDs": toUserIDs,
-		},
-		"$addToSet": bson.M{
-			"memberIDs": bson.M{
-				"$each": toUserIDs,
-			},
-		},
+// changeGroupUserRole 有 manageRoles 权限的用户将用户从 from 身份变更为 to 身份, 自定义角色随之清除
+func changeGroupUserRole(ctx context.Context, groupID, userID string, toUserIDs []string, from, to int) error {
+	if len(toUserIDs) == 0 {
+		return constant.ErrorParamWrong
 	}
 
-	err := groupTable.Update(query, update)
-	if err != nil {
+	if _, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageRoles); err != nil {
 		return err
 	}
 
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": toUserIDs,
-		},
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"manageGroups": groupID,
-		},
-		"$addToSet": bson.M{
-			"joinGroups": groupID,
-		},
-	}
-	userTable := cntrl.GetTable(constant.TableUser)
-	_, err = userTable.UpdateAll(query, update)
-	return err
+	return store.RunInTransaction(ctx, func(ctx context.Context) error {
+		groups, users := store.Groups(), store.Users()
+		if err := groups.RemoveUsers(ctx, groupID, from, toUserIDs); err != nil {
+			return err
+		}
+		if err := groups.AddUsers(ctx, groupID, to, toUserIDs); err != nil {
+			return err
+		}
+		if err := users.RemoveGroup(ctx, toUserIDs, from, groupID); err != nil {
+			return err
+		}
+		return users.AddGroup(ctx, toUserIDs, to, groupID)
+	})
 }
 
-// DelGroupManager 删除群组管理员
-func DelGroupManager(groupID, ownerID string, toUserIDs []string) error {
-	if !bson.IsObjectIdHex(groupID) {
-		return constant.ErrorIDFormatWrong
-	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-
-	group := Group{}
-	query := bson.M{
-		"_id": bson.ObjectIdHex(groupID),
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-	}
-	selector := bson.M{
-		"ownerID":    1,
-		"managerIDs": 1,
-	}
-	err := groupTable.Find(query).Select(selector).One(&group)
+// DelGroupManager 删除群组管理员, 需要 manageRoles 权限, 管理员可以删除自己
+func DelGroupManager(ctx context.Context, groupID, ownerID string, toUserIDs []string) error {
+	group, err := store.Groups().FindByID(ctx, groupID)
 	if err != nil {
 		return err
 	}
 
-	if !(ownerID == group.OwnerID || (len(toUserIDs) == 1 && toUserIDs[0] == ownerID)) {
-		return constant.ErrorParamWrong
-	}
-
-	query = bson.M{
-		"_id": bson.ObjectIdHex(groupID),
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-		"managerIDs": bson.M{
-			"$all": toUserIDs,
-		},
-	}
-	update := bson.M{
-		"$pullAll": bson.M{
-			"managerIDs": toUserIDs,
-		},
-		"$inc": bson.M{
-			"personNum": -len(toUserIDs),
-		},
+	if !(HasGroupPermission(group, ownerID, constant.GroupPermManageRoles) || (len(toUserIDs) == 1 && toUserIDs[0] == ownerID)) {
+		return constant.ErrorNoPermission
 	}
+	return removeGroupUsers(ctx, groupID, constant.GroupUserStatusManager, toUserIDs)
+}
 
-	err = groupTable.Update(query, update)
+// DelGroupMember 删除群组成员, 需要 manageMembers 权限, 成员可以删除自己
+func DelGroupMember(ctx context.Context, groupID, userID string, toUserIDs []string) error {
+	group, err := store.Groups().FindByID(ctx, groupID)
 	if err != nil {
 		return err
 	}
 
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": toUserIDs,
-		},
-	}
-	update = bson.M{
-		"$pull": bson.M{
-			"manageGroupIDs": groupID,
-		},
+	ok := HasGroupPermission(group, userID, constant.GroupPermManageMembers) ||
+		(len(toUserIDs) == 1 && toUserIDs[0] == userID)
+	if !ok {
+		return constant.ErrorNoPermission
 	}
-	userTable := cntrl.GetTable(constant.TableUser)
-	_, err = userTable.UpdateAll(query, update)
-	return err
+	return removeGroupUsers(ctx, groupID, constant.GroupUserStatusMember, toUserIDs)
 }
 
-// DelGroupMember 删除群组成员, 管理员和创建者均可删除成员
-func DelGroupMember(groupID, userID string, toUserIDs []string) error {
-	if !bson.IsObjectIdHex(groupID) {
-		return constant.ErrorIDFormatWrong
-	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-
-	query := bson.M{
-		"_id": bson.ObjectIdHex(groupID),
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-		"memberIDs": bson.M{
-			"$all": toUserIDs,
-		},
-	}
-	selector := bson.M{
-		"ownerID":    1,
-		"managerIDs": 1,
+func removeGroupUsers(ctx context.Context, groupID string, role int, toUserIDs []string) error {
+	if len(toUserIDs) == 0 {
+		return constant.ErrorParamWrong
 	}
-	group := Group{}
-	err := groupTable.Find(query).Select(selector).One(&group)
+	err := store.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Groups().RemoveUsers(ctx, groupID, role, toUserIDs); err != nil {
+			return err
+		}
+		return store.Users().RemoveGroup(ctx, toUserIDs, role, groupID)
+	})
 	if err != nil {
 		return err
 	}
+	emitMemberEvent(groupID, constant.WebhookEventMemberLeft, role, toUserIDs)
+	return nil
+}
 
-	ok := false
-
-	if userID == group.OwnerID || (len(toUserIDs) == 1 && toUserIDs[0] == userID) {
-		ok = true
-	}
-
-	for _, id := range group.ManagerIDs {
-		if id == userID {
-			ok = true
-		}
-	}
-
-	if !ok {
-		return constant.ErrorParamWrong
-	}
+/****************************************** group redis action ****************************************/
 
-	update := bson.M{
-		"$pullAll": bson.M{
-			"memberIDs": toUserIDs,
-		},
-		"$inc": bson.M{
-			"personNum": -len(toUserIDs),
-		},
-	}
+func getGroupCode(ctx context.Context) (string, error) {
+	cntrl := db.NewRedisDBCntlr(ctx)
+	defer cntrl.Close()
 
-	err = groupTable.Update(query, update)
+	res, err := redis.Values(cntrl.Do("EVAL", groupCodePopScript, 2, constant.RedisGroupCodePool, constant.RedisGroupCodeSeq, constant.RedisGroupCodePoolNum))
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	query = bson.M{
-		"unionid": bson.M{
-			"$in": toUserIDs,
-		},
+	var code string
+	var seq int64
+	if _, err = redis.Scan(res, &code, &seq); err != nil {
+		return "", err
 	}
-	update = bson.M{
-		"$pull": bson.M{
-			"joinGroupIDs": groupID,
-		},
+	if seq < 0 {
+		return code, nil
 	}
-	userTable := cntrl.GetTable(constant.TableUser)
-	_, err = userTable.UpdateAll(query, update)
-	return err
-}
-
-/****************************************** group basic action ****************************************/
-
-func findGroup(query, selectField interface{}) (Group, error) {
-	data := Group{}
-	cntrl := db.NewCopyMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableGroup)
-	err := table.Find(query).Select(selectField).One(&data)
-	return data, err
-}
-
-func updateGroup(query, update interface{}) error {
-	return updateDoc(constant.TableGroup, query, update)
-}
-
-func insertGroups(docs ...interface{}) error {
-	return insertDocs(constant.TableGroup, docs...)
-}
 
-/****************************************** group redis action ****************************************/
-
-func getGroupCode() (string, error) {
-	cntrl := db.NewRedisDBCntlr()
-	defer cntrl.Close()
-
-	len, _ := cntrl.LLEN(constant.RedisGroupCodePool)
-	if len == 0 {
-		groupCodeNextNumMutex.Lock()
-		nextNum, _ := cntrl.GETInt64(constant.RedisGroupCodeNextNum)
-		if nextNum == 0 {
-			return "", errors.New("next_num wrong")
-		}
-		codePool := make([]interface{}, constant.RedisGroupCodePoolNum)
-		for i := 0; i < constant.RedisGroupCodePoolNum; i++ {
-			nextNum++
-			codePool[i] = string(util.Base34(uint64(nextNum)))
+	key := config.Conf.Security.GroupCodeKey
+	if key == "" {
+		key = config.Conf.Security.Secret
+	}
+	codePool := make([]interface{}, 0, constant.RedisGroupCodePoolNum)
+	for i := 0; i < constant.RedisGroupCodePoolNum; i++ {
+		c, err := util.GroupCodeFromSeq(uint64(seq)+uint64(i), key)
+		if err != nil {
+			return "", err
 		}
-		cntrl.RPUSH(constant.RedisGroupCodePool, codePool...)
-		cntrl.INCRBY(constant.RedisGroupCodeNextNum, constant.RedisGroupCodePoolNum)
-		groupCodeNextNumMutex.Unlock()
+		codePool = append(codePool, c)
 	}
-
-	return cntrl.LPOP(constant.RedisGroupCodePool)
+	// 第一个直接使用, 其余放入池中
+	if len(codePool) > 1 {
+		cntrl.RPUSH(constant.RedisGroupCodePool, codePool[1:]...)
+	}
+	return codePool[0].(string), nil
 }
 
-func GetRedisGroupInfos(ids []string) ([]map[string]interface{}, error) {
-	cntrl := db.NewRedisDBCntlr()
+func GetRedisGroupInfos(ctx context.Context, ids []string) ([]map[string]interface{}, error) {
+	cntrl := db.NewRedisDBCntlr(ctx)
 	defer cntrl.Close()
 
 	res := make([]map[string]interface{}, len(ids))
 	for i, id := range ids {
-		key := fmt.Sprint(constant.RedisGroupInfo, id)
+		key := fmt.Sprintf(constant.RedisGroupInfo, id)
 		data, err := cntrl.HGETALL(key)
 		if len(data) == 0 || err != nil {
-			group, err := setRedisGroupInfo(id)
+			group, err := setRedisGroupInfo(ctx, id)
 			if err != nil {
 				return res, err
 			}
@@ -623,23 +315,12 @@ func GetRedisGroupInfos(ids []string) ([]map[string]interface{}, error) {
 	return res, nil
 }
 
-func setRedisGroupInfo(id string) (group Group, err error) {
-	query := bson.M{
-		"_id": bson.ObjectIdHex(id),
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
-	}
-	selector := bson.M{
-		"nickname":  1,
-		"avatarUrl": 1,
-		"code":      1,
-	}
-	group, err = findGroup(query, selector)
+func setRedisGroupInfo(ctx context.Context, id string) (group Group, err error) {
+	group, err = store.Groups().FindByID(ctx, id)
 	if err != nil {
 		return
 	}
-	key := fmt.Sprint(constant.RedisGroupInfo, group.ID.Hex())
+	key := fmt.Sprintf(constant.RedisGroupInfo, group.ID.Hex())
 	args := []interface{}{
 		"nickname",
 		group.Nickname,
@@ -648,7 +329,7 @@ func setRedisGroupInfo(id string) (group Group, err error) {
 		"code",
 		group.Code,
 	}
-	cntrl := db.NewRedisDBCntlr()
+	cntrl := db.NewRedisDBCntlr(ctx)
 	defer cntrl.Close()
 	_, err = cntrl.HMSET(key, args...)
 	cntrl.EXPIRE(key, getRedisDefaultExpire())
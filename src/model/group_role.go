@@ -0,0 +1,185 @@
+package model
+
+/*
+   群组角色和权限
+   - 创建者拥有全部权限, 管理员和成员默认使用 constant.GroupRolePresets 中的预设权限
+   - 拥有 manageRoles 权限的用户可以创建自定义角色并指定给管理员或成员, 指定后使用角色的权限
+*/
+import (
+	"constant"
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GroupRole struct {
+	ID          string   `bson:"id" json:"id"`
+	Name        string   `bson:"name" json:"name"`
+	Permissions []string `bson:"permissions" json:"permissions"` // constant.GroupPerm*
+}
+
+// groupUserRole 用户在群组中的身份, 不在群组中时返回 0
+func groupUserRole(group Group, userID string) int {
+	switch {
+	case group.OwnerID == userID:
+		return constant.GroupUserStatusOwner
+	case containString(group.ManagerIDs, userID):
+		return constant.GroupUserStatusManager
+	case containString(group.MemberIDs, userID):
+		return constant.GroupUserStatusMember
+	}
+	return 0
+}
+
+// GroupUserPermissions 用户在群组中的权限, 不在群组中时为空
+func GroupUserPermissions(group Group, userID string) []string {
+	role := groupUserRole(group, userID)
+	switch role {
+	case 0:
+		return []string{}
+	case constant.GroupUserStatusOwner:
+		return constant.GroupPermissions
+	}
+	if roleID, ok := group.UserRoles[userID]; ok {
+		for _, r := range group.Roles {
+			if r.ID == roleID {
+				return r.Permissions
+			}
+		}
+	}
+	return constant.GroupRolePresets[role]
+}
+
+// HasGroupPermission 用户在群组中是否有 permission 权限
+func HasGroupPermission(group Group, userID, permission string) bool {
+	return containString(GroupUserPermissions(group, userID), permission)
+}
+
+// checkGroupPermission 获取群组并检查权限, 没有权限时返回 constant.ErrorNoPermission
+func checkGroupPermission(ctx context.Context, groupID, userID, permission string) (Group, error) {
+	group, err := store.Groups().FindByID(ctx, groupID)
+	if err != nil {
+		return group, err
+	}
+	if !HasGroupPermission(group, userID, permission) {
+		return group, constant.ErrorNoPermission
+	}
+	return group, nil
+}
+
+// CreateGroupRole 创建自定义角色
+func CreateGroupRole(ctx context.Context, groupID, userID, name string, permissions []string) (GroupRole, error) {
+	role := GroupRole{
+		ID:          primitive.NewObjectID().Hex(),
+		Name:        strings.TrimSpace(name),
+		Permissions: permissions,
+	}
+	if err := checkGroupRole(role); err != nil {
+		return role, err
+	}
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageRoles)
+	if err != nil {
+		return role, err
+	}
+	if len(group.Roles) >= constant.GroupRoleMaxNum {
+		return role, constant.ErrorOutOfRange
+	}
+
+	roles := append(append([]GroupRole{}, group.Roles...), role)
+	return role, store.Groups().SetRoles(ctx, groupID, roles, group.UserRoles)
+}
+
+// UpdateGroupRole 更新自定义角色的名称和权限, 已指定该角色的用户随之变化
+func UpdateGroupRole(ctx context.Context, groupID, userID, roleID, name string, permissions []string) (GroupRole, error) {
+	role := GroupRole{
+		ID:          roleID,
+		Name:        strings.TrimSpace(name),
+		Permissions: permissions,
+	}
+	if err := checkGroupRole(role); err != nil {
+		return role, err
+	}
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageRoles)
+	if err != nil {
+		return role, err
+	}
+
+	roles := append([]GroupRole{}, group.Roles...)
+	for i := range roles {
+		if roles[i].ID == roleID {
+			roles[i] = role
+			return role, store.Groups().SetRoles(ctx, groupID, roles, group.UserRoles)
+		}
+	}
+	return role, constant.ErrorNotFound
+}
+
+// DeleteGroupRole 删除自定义角色, 已指定该角色的用户恢复为预设权限
+func DeleteGroupRole(ctx context.Context, groupID, userID, roleID string) error {
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageRoles)
+	if err != nil {
+		return err
+	}
+
+	roles := []GroupRole{}
+	for _, role := range group.Roles {
+		if role.ID != roleID {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == len(group.Roles) {
+		return constant.ErrorNotFound
+	}
+	userRoles := map[string]string{}
+	for unionid, id := range group.UserRoles {
+		if id != roleID {
+			userRoles[unionid] = id
+		}
+	}
+	return store.Groups().SetRoles(ctx, groupID, roles, userRoles)
+}
+
+// SetGroupUserRole 为管理员或成员指定自定义角色, roleID 为空时取消指定, 不能给自己指定
+func SetGroupUserRole(ctx context.Context, groupID, userID, toUserID, roleID string) error {
+	if toUserID == userID {
+		return constant.ErrorParamWrong
+	}
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageRoles)
+	if err != nil {
+		return err
+	}
+	role := groupUserRole(group, toUserID)
+	if role != constant.GroupUserStatusManager && role != constant.GroupUserStatusMember {
+		return constant.ErrorParamWrong
+	}
+
+	userRoles := map[string]string{}
+	for unionid, id := range group.UserRoles {
+		userRoles[unionid] = id
+	}
+	if roleID == "" {
+		delete(userRoles, toUserID)
+		return store.Groups().SetRoles(ctx, groupID, group.Roles, userRoles)
+	}
+	for _, r := range group.Roles {
+		if r.ID == roleID {
+			userRoles[toUserID] = roleID
+			return store.Groups().SetRoles(ctx, groupID, group.Roles, userRoles)
+		}
+	}
+	return constant.ErrorNotFound
+}
+
+func checkGroupRole(role GroupRole) error {
+	if role.Name == "" || utf8.RuneCountInString(role.Name) > constant.GroupRoleNameMaxLen {
+		return constant.ErrorParamWrong
+	}
+	for _, permission := range role.Permissions {
+		if !containString(constant.GroupPermissions, permission) {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package model
+
+/*
+   群组转让: 拥有者发起, 接收人在有效期内接受或拒绝, 接受后才更换拥有者
+   接收人可以是管理员或普通成员, 原拥有者在发起时选择转让后成为管理员、成员或退出群组
+*/
+import (
+	"constant"
+	"context"
+	"fmt"
+	"time"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GroupTransfer struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	// 状态: -10 取消, -5 拒绝, -1 过期, 0 待处理, 5 已接受
+	Status int `bson:"status" json:"status"`
+
+	GroupID      string `bson:"groupID" json:"groupID"`
+	FromUserID   string `bson:"fromUserID" json:"fromUserID"`     // 原拥有者 unionid
+	ToUserID     string `bson:"toUserID" json:"toUserID"`         // 接收人 unionid
+	OldOwnerRole int    `bson:"oldOwnerRole" json:"oldOwnerRole"` // 原拥有者转让后的身份, constant.GroupTransferOldOwnerLeave 表示退出
+	CreateTime   int64  `bson:"createTime" json:"createTime"`
+	ExpireTime   int64  `bson:"expireTime" json:"expireTime"` // 过期时间, 过期后不能再接受
+	UpdateTime   int64  `bson:"updateTime" json:"updateTime"`
+}
+
+// TransferGroupOwnership 发起群组转让, 同一群组同时只能有一个待处理的转让
+func TransferGroupOwnership(ctx context.Context, groupID, ownerID, toUserID string, oldOwnerRole int) (GroupTransfer, error) {
+	transfer := GroupTransfer{}
+	if oldOwnerRole != constant.GroupTransferOldOwnerLeave &&
+		oldOwnerRole != constant.GroupUserStatusManager &&
+		oldOwnerRole != constant.GroupUserStatusMember {
+		return transfer, constant.ErrorParamWrong
+	}
+	if toUserID == "" || toUserID == ownerID {
+		return transfer, constant.ErrorParamWrong
+	}
+
+	group, err := store.Groups().FindByID(ctx, groupID)
+	if err != nil {
+		return transfer, err
+	}
+	if group.OwnerID != ownerID || groupUserRole(group, toUserID) == 0 {
+		return transfer, constant.ErrorParamWrong
+	}
+
+	// 过期的转让在这里更新状态, 否则会占用群组唯一的待处理名额
+	if _, err = filterPendingTransfers(ctx, groupID, ""); err != nil {
+		return transfer, err
+	}
+
+	now := util.GetNowTimestamp()
+	transfer = GroupTransfer{
+		ID:           primitive.NewObjectID(),
+		Status:       constant.GroupTransferPendingStatus,
+		GroupID:      groupID,
+		FromUserID:   ownerID,
+		ToUserID:     toUserID,
+		OldOwnerRole: oldOwnerRole,
+		CreateTime:   now,
+		ExpireTime:   now + int64(constant.GroupTransferExpire/time.Millisecond),
+		UpdateTime:   now,
+	}
+	if err = store.GroupTransfers().Insert(ctx, transfer); err != nil {
+		return transfer, err
+	}
+
+	util.GoBackground(func(ctx context.Context) {
+		sendGroupTransferNotify(ctx, toUserID, ownerID, group.Nickname, constant.GroupTransferRequestContent, transfer.ExpireTime)
+	})
+	return transfer, nil
+}
+
+// RespondGroupTransfer 接收人接受或拒绝转让, 接受后更换拥有者并按发起时的选择处理原拥有者
+func RespondGroupTransfer(ctx context.Context, id, userID string, accept bool) (GroupTransfer, error) {
+	transfer, err := store.GroupTransfers().FindByID(ctx, id)
+	if err != nil {
+		return transfer, err
+	}
+	if transfer.ToUserID != userID || transfer.Status != constant.GroupTransferPendingStatus {
+		return transfer, constant.ErrorNotFound
+	}
+
+	now := util.GetNowTimestamp()
+	if transfer.ExpireTime <= now {
+		if err = store.GroupTransfers().UpdateStatus(ctx, id, constant.GroupTransferPendingStatus, constant.GroupTransferExpireStatus, now); err != nil {
+			return transfer, err
+		}
+		return transfer, constant.ErrorExpired
+	}
+
+	group, err := store.Groups().FindByID(ctx, transfer.GroupID)
+	if err != nil && err != constant.ErrorNotFound {
+		return transfer, err
+	}
+	// 群组已解散、拥有者已变更或接收人已退出时转让失效
+	role := groupUserRole(group, userID)
+	if err == constant.ErrorNotFound || group.OwnerID != transfer.FromUserID || role == 0 {
+		if err = store.GroupTransfers().UpdateStatus(ctx, id, constant.GroupTransferPendingStatus, constant.GroupTransferCancelStatus, now); err != nil {
+			return transfer, err
+		}
+		return transfer, constant.ErrorNotFound
+	}
+
+	content := constant.GroupTransferDeclineContent
+	if !accept {
+		err = store.GroupTransfers().UpdateStatus(ctx, id, constant.GroupTransferPendingStatus, constant.GroupTransferDeclineStatus, now)
+		transfer.Status = constant.GroupTransferDeclineStatus
+	} else {
+		content = constant.GroupTransferAcceptContent
+		err = store.RunInTransaction(ctx, func(ctx context.Context) error {
+			return acceptGroupTransfer(ctx, transfer, role, now)
+		})
+		transfer.Status = constant.GroupTransferAcceptStatus
+	}
+	if err != nil {
+		return transfer, err
+	}
+	transfer.UpdateTime = now
+
+	util.GoBackground(func(ctx context.Context) {
+		sendGroupTransferNotify(ctx, transfer.FromUserID, userID, group.Nickname, content, now)
+	})
+	return transfer, nil
+}
+
+// acceptGroupTransfer 先更新转让状态, 防止重复接受; role 为接收人当前的身份
+func acceptGroupTransfer(ctx context.Context, transfer GroupTransfer, role int, now int64) error {
+	groups, users := store.Groups(), store.Users()
+	groupID, fromUserID, toUserID := transfer.GroupID, transfer.FromUserID, transfer.ToUserID
+
+	if err := store.GroupTransfers().UpdateStatus(ctx, transfer.ID.Hex(), constant.GroupTransferPendingStatus, constant.GroupTransferAcceptStatus, now); err != nil {
+		return err
+	}
+	if err := groups.SetOwner(ctx, groupID, toUserID); err != nil {
+		return err
+	}
+	if err := groups.RemoveUsers(ctx, groupID, role, []string{toUserID}); err != nil {
+		return err
+	}
+	if err := users.RemoveGroup(ctx, []string{toUserID}, role, groupID); err != nil {
+		return err
+	}
+	if err := users.AddGroup(ctx, []string{toUserID}, constant.GroupUserStatusOwner, groupID); err != nil {
+		return err
+	}
+	if err := users.RemoveGroup(ctx, []string{fromUserID}, constant.GroupUserStatusOwner, groupID); err != nil {
+		return err
+	}
+
+	// 原拥有者退出时总人数减一, 即接收人原身份的计数
+	if transfer.OldOwnerRole == constant.GroupTransferOldOwnerLeave {
+		return nil
+	}
+	if err := groups.AddUsers(ctx, groupID, transfer.OldOwnerRole, []string{fromUserID}); err != nil {
+		return err
+	}
+	return users.AddGroup(ctx, []string{fromUserID}, transfer.OldOwnerRole, groupID)
+}
+
+// CancelGroupTransfer 发起人取消待处理的转让
+func CancelGroupTransfer(ctx context.Context, id, userID string) error {
+	transfer, err := store.GroupTransfers().FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if transfer.FromUserID != userID {
+		return constant.ErrorNotFound
+	}
+	return store.GroupTransfers().UpdateStatus(ctx, id, constant.GroupTransferPendingStatus, constant.GroupTransferCancelStatus, util.GetNowTimestamp())
+}
+
+// GetGroupTransfers 获取用户发起或待确认的转让
+func GetGroupTransfers(ctx context.Context, userID string) ([]GroupTransfer, error) {
+	return filterPendingTransfers(ctx, "", userID)
+}
+
+// cancelUserTransfers 注销时取消用户发起或待确认的转让
+func cancelUserTransfers(ctx context.Context, userID string) error {
+	transfers, err := store.GroupTransfers().FindPending(ctx, "", userID)
+	if err != nil {
+		return err
+	}
+	now := util.GetNowTimestamp()
+	for _, transfer := range transfers {
+		err = store.GroupTransfers().UpdateStatus(ctx, transfer.ID.Hex(), constant.GroupTransferPendingStatus, constant.GroupTransferCancelStatus, now)
+		if err != nil && err != constant.ErrorNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterPendingTransfers 获取待处理的转让, 已过期的更新为过期状态后过滤掉
+func filterPendingTransfers(ctx context.Context, groupID, userID string) ([]GroupTransfer, error) {
+	transfers, err := store.GroupTransfers().FindPending(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := util.GetNowTimestamp()
+	res := []GroupTransfer{}
+	for _, transfer := range transfers {
+		if transfer.ExpireTime > now {
+			res = append(res, transfer)
+			continue
+		}
+		err = store.GroupTransfers().UpdateStatus(ctx, transfer.ID.Hex(), constant.GroupTransferPendingStatus, constant.GroupTransferExpireStatus, now)
+		if err != nil && err != constant.ErrorNotFound {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// sendGroupTransferNotify 通知 unionid 转让的进展, content 中填入另一方 otherID 的昵称, 处于免打扰时段时不发送
+func sendGroupTransferNotify(ctx context.Context, unionid, otherID, groupNickname, content string, timestamp int64) error {
+	user, err := store.Users().FindByUnionid(ctx, unionid)
+	if err != nil {
+		return err
+	}
+	if user.NotificationSettings.inQuietHours(time.Now()) {
+		return nil
+	}
+	other, err := store.Users().FindByUnionid(ctx, otherID)
+	if err != nil {
+		return err
+	}
+	year, month, day := time.Unix(timestamp/1000, 0).Date()
+	delivery := Delivery{
+		To: userRecipient(user),
+		Msg: Message{
+			Event:   constant.NotifyEventGroupTransfer,
+			Title:   fmt.Sprintf(constant.GroupTransferNotifyTitle, groupNickname),
+			Content: fmt.Sprintf(content, other.Nickname),
+			Time:    fmt.Sprintf(constant.TemplateTime, year, month, day),
+		},
+	}
+	_, err = dispatch(ctx, []Delivery{delivery})
+	return err
+}
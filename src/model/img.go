@@ -1,6 +1,109 @@
 package model
 
+/*
+   图片和附件在数据库中只保存文件名, 不保存链接, 更换存储或访问域名时不需要迁移数据
+   返回给客户端时由 FileURL 生成链接, 私有空间(config.Conf.Storage.Private)时作业、提交、反馈的文件为临时链接
+   客户端提交的链接(包括临时链接)保存前由 storedImgs 等转换为文件名, 旧数据中的完整链接仍可以正常访问和删除
+*/
+import (
+	"config"
+	"constant"
+	"strings"
+	"time"
+	"util/filestore"
+)
+
 type Img struct {
-	URL      string `bson:"url" json:"url"`           // 图片URL
-	MicroURL string `bson:"microUrl" json:"microUrl"` // 缩略图URL
+	URL      string `bson:"url" json:"url"`           // 图片文件名, 旧数据为图片URL
+	MicroURL string `bson:"microUrl" json:"microUrl"` // 缩略图文件名, 旧数据为缩略图URL
+}
+
+// FileURL 文件的访问链接, 私有空间时为有效期 constant.FileURLExpire 的临时链接
+// 不是本存储的链接原样返回
+func FileURL(raw string) string {
+	return fileURL(raw, constant.FileURLExpire)
+}
+
+func fileURL(raw string, expires time.Duration) string {
+	key, ok := fileKey(raw, constant.FileKeyPrefix)
+	if !ok {
+		return raw
+	}
+	files := filestore.Default()
+	if config.Conf.Storage.Private && IsPrivateFile(key) {
+		return files.SignedURL(key, expires)
+	}
+	return files.URL(key)
+}
+
+// IsPrivateFile 私有空间时需要临时链接才能访问的文件, 头像等仍使用公开链接
+func IsPrivateFile(key string) bool {
+	return hasAnyPrefix(key, constant.PrivateFilePrefixes...)
+}
+
+// fileKey 文件名或本存储的链接对应的文件名, 只处理 prefixes 下的文件
+func fileKey(raw string, prefixes ...string) (string, bool) {
+	if strings.Contains(raw, "://") {
+		return filestore.Default().KeyFromURL(raw, prefixes...)
+	}
+	if raw != "" && hasAnyPrefix(raw, prefixes...) {
+		return raw, true
+	}
+	return "", false
+}
+
+// storedFile 保存到数据库的值, 本存储的链接转换为文件名, 其他的原样保存, 由各自的校验拒绝
+func storedFile(raw string) string {
+	if key, ok := fileKey(raw, constant.FileKeyPrefix); ok {
+		return key
+	}
+	return raw
+}
+
+func storedImgs(imgs []Img) []Img {
+	res := make([]Img, 0, len(imgs))
+	for _, img := range imgs {
+		res = append(res, Img{URL: storedFile(img.URL), MicroURL: storedFile(img.MicroURL)})
+	}
+	return res
+}
+
+func storedAttachments(attachments []Attachment) []Attachment {
+	res := make([]Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		attachment.URL = storedFile(attachment.URL)
+		attachment.Thumbnail = storedFile(attachment.Thumbnail)
+		attachment.PreviewURL = storedFile(attachment.PreviewURL)
+		res = append(res, attachment)
+	}
+	return res
+}
+
+// signedImgs 转换为访问链接, 用于不经过 GraphQL 解析的数据, 如 webhook 和数据导出
+func signedImgs(imgs []Img) []Img {
+	res := make([]Img, 0, len(imgs))
+	for _, img := range imgs {
+		res = append(res, Img{URL: FileURL(img.URL), MicroURL: FileURL(img.MicroURL)})
+	}
+	return res
+}
+
+func signedAttachments(attachments []Attachment) []Attachment {
+	res := make([]Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		attachment.URL = FileURL(attachment.URL)
+		attachment.Thumbnail = FileURL(attachment.Thumbnail)
+		attachment.PreviewURL = FileURL(attachment.PreviewURL)
+		res = append(res, attachment)
+	}
+	return res
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
 }
@@ -2,15 +2,9 @@ package model
 
 import (
 	"constant"
+	"context"
 	"math/rand"
-	"model/db"
 	"time"
-
-	"gopkg.in/mgo.v2/bson"
-)
-
-var (
-	DefaultSelector bson.M = bson.M{}
 )
 
 func getRedisDefaultExpire() int64 {
@@ -18,25 +12,7 @@ func getRedisDefaultExpire() int64 {
 	return constant.RedisDefaultExpire + rand.Int63n(constant.RedisDefaultRandExpire)
 }
 
-/****************************************** db basic action ****************************************/
-
-func updateDoc(tableName string, query, update interface{}) error {
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(tableName)
-	return table.Update(query, update)
-}
-
-func updateDocs(tableName string, query, update interface{}) (interface{}, error) {
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(tableName)
-	return table.UpdateAll(query, update)
-}
-
-func insertDocs(tableName string, docs ...interface{}) error {
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(tableName)
-	return table.Insert(docs...)
+// EnsureIndexes 创建数据库索引并补全旧数据, 已存在时不做处理
+func EnsureIndexes(ctx context.Context) error {
+	return store.EnsureIndexes(ctx)
 }
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"model/db"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobRun 定时任务的执行记录
+type JobRun struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name   string             `bson:"name" json:"name"`     // 任务名
+	Status int                `bson:"status" json:"status"` // 状态：执行中、成功、失败
+
+	Owner     string `bson:"owner" json:"owner"`         // 执行的实例
+	Token     int64  `bson:"token" json:"token"`         // 分布式锁的 fencing token
+	StartTime int64  `bson:"startTime" json:"startTime"` // 开始时间
+	EndTime   int64  `bson:"endTime" json:"endTime"`     // 结束时间
+	Count     int    `bson:"count" json:"count"`         // 处理数量, 如发送的提醒条数
+	Error     string `bson:"error" json:"error"`         // 失败原因
+}
+
+// RunJob 在分布式锁内执行定时任务并记录执行情况
+// job 的 ctx 带有 fencing token, 锁被其他实例取得后 job 的写入会被拒绝
+// 其他实例正在或刚刚执行过该任务时返回 constant.ErrorLockHeld
+func RunJob(ctx context.Context, name string, job func(ctx context.Context) (int, error)) error {
+	lock, err := db.AcquireLock(ctx, name, constant.JobLockTTL)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(constant.JobLockHold)
+
+	run := JobRun{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Status:    constant.JobRunRunningStatus,
+		Owner:     lock.Owner,
+		Token:     lock.Token,
+		StartTime: util.GetNowTimestamp(),
+	}
+	if err = store.JobRuns().Insert(ctx, run); err != nil {
+		return err
+	}
+
+	count, err := job(lock.Context())
+	if err == nil && lock.Context().Err() != nil && ctx.Err() == nil {
+		// 执行期间锁丢失, 结果可能与其他实例重复
+		err = constant.ErrorLockLost
+	}
+
+	updateData := map[string]interface{}{
+		"status":  constant.JobRunSuccessStatus,
+		"endTime": util.GetNowTimestamp(),
+		"count":   count,
+	}
+	if err != nil {
+		updateData["status"] = constant.JobRunFailStatus
+		updateData["error"] = err.Error()
+	}
+	// ctx 可能已超时, 记录结果使用独立的 ctx
+	recordCtx, cancel := context.WithTimeout(context.Background(), constant.RequestTimeout)
+	defer cancel()
+	if recordErr := store.JobRuns().Update(recordCtx, run.ID.Hex(), updateData); err == nil {
+		err = recordErr
+	}
+	return err
+}
+
+// GetJobRuns 分页获取执行记录, name 为空时获取所有任务
+func GetJobRuns(ctx context.Context, name string, page, perPage int) ([]JobRun, error) {
+	return store.JobRuns().Find(ctx, name, page, perPage)
+}
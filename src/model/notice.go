@@ -1,23 +1,31 @@
 package model
 
 import (
+	"config"
 	"constant"
+	"context"
 	"fmt"
 	"model/db"
 	"sort"
 	"time"
 	"util"
 
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Notice struct {
-	ID     bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty"`
-	Type   int           `bson:"type" json:"type"`     // 类型：1表示前一天发送通知，2表示前两天发送通知
-	Status int           `bson:"status" json:"status"` // 状态: -10 删除状态, -1表示过期状态，5表示发布状态
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Type   int                `bson:"type" json:"type"`     // 类型：1表示前一天发送通知，2表示前两天发送通知
+	Status int                `bson:"status" json:"status"` // 状态: -10 删除状态, -1表示过期状态，5表示发布状态
 
 	CreatorID string `bson:"creatorID" json:"creatorID"` // unionid
-	GroupID   string `bson:"groupID" json:"groupID"`     // _id
+	GroupID   string `bson:"groupID" json:"groupID"`     // _id, 多群组通知时为第一个群组
+	// 多群组通知的所有接收群组, 包含 GroupID; 为空时只发送给 GroupID
+	GroupIDs []string `bson:"groupIDs,omitempty" json:"groupIDs,omitempty"`
+
+	// 定向通知的接收人, 都为空时发送给接收群组的所有人; 只包括仍在接收群组中的用户
+	TargetUserIDs []string `bson:"targetUserIDs,omitempty" json:"targetUserIDs,omitempty"` // 指定的用户 unionid
+	SubgroupIDs   []string `bson:"subgroupIDs,omitempty" json:"subgroupIDs,omitempty"`     // 指定的分组 id
 
 	Title      string `bson:"title" json:"title"` // 标题
 	Content    string `bson:"content" json:"content"`
@@ -26,79 +34,182 @@ type Notice struct {
 	CreateTime int64  `bson:"createTime" json:"createTime"` // 创建时间
 	NoticeTime int64  `bson:"noticeTime" json:"noticeTime"` // 提醒时间
 
+	// 图片以外的附件: 音频、视频、文档, 也可以是不需要兼容旧版本的图片
+	Attachments []Attachment `bson:"attachments,omitempty" json:"attachments,omitempty"`
+
 	WatchUserIDs []string `bson:"watchUserIDs" json:"watchUserIDs"` // 查看用户
 	WatchNum     int      `bson:"watchNum" json:"watchNum"`         // 查看人数
 	LikeUserIDs  []string `bson:"likeUserIDs" json:"likeUserIDs"`   // 点赞用户
 	LikeNum      int      `bson:"likeNum" json:"likeNum"`           // 点赞人数
+
+	DeletedAt int64  `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // 删除时间, 删除后保留在回收站中
+	DeletedBy string `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"` // 删除人 unionid
 }
 
-func CreateNotices(userID string, notices []Notice) error {
-	docs := make([]interface{}, len(notices))
+// CreateNotices 创建通知, 需要在每个群组中都有 postNotice 权限
+// 指定 GroupIDs 时为多群组通知, 只保存一份, 每个用户只看到和收到一次
+// 指定 TargetUserIDs 或 SubgroupIDs 时为定向通知, 只发送给指定的用户和分组
+func CreateNotices(ctx context.Context, userID string, notices []Notice) error {
 	now := util.GetNowTimestamp()
+	groupIDs := []string{}
 	for i := 0; i < len(notices); i++ {
-		if notices[i].Title == "" || notices[i].NoticeTime <= now || notices[i].GroupID == "" {
+		if notices[i].Title == "" || notices[i].NoticeTime <= now {
 			return constant.ErrorParamWrong
 		}
-		notices[i].ID = bson.NewObjectId()
+		if err := setNoticeGroupIDs(&notices[i]); err != nil {
+			return err
+		}
+		notices[i].Imgs = storedImgs(notices[i].Imgs)
+		notices[i].Attachments = storedAttachments(notices[i].Attachments)
+		if err := checkAttachments(notices[i].Attachments); err != nil {
+			return err
+		}
+		if err := checkNoticeUploads(ctx, userID, notices[i], Notice{}); err != nil {
+			return err
+		}
+		if err := checkNoticeAudience(ctx, notices[i]); err != nil {
+			return err
+		}
+		notices[i].ID = primitive.NewObjectID()
 		notices[i].Status = constant.NoticePubStatus
 		notices[i].CreatorID = userID
 		notices[i].CreateTime = now
-		docs[i] = notices[i]
+		for _, groupID := range noticeGroupIDs(notices[i]) {
+			groupIDs = addToSet(groupIDs, groupID)
+		}
 	}
-	err := insertNotices(docs...)
-	if err != nil {
+	for _, groupID := range groupIDs {
+		if _, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermPostNotice); err != nil {
+			return err
+		}
+	}
+	if err := store.Notices().Insert(ctx, notices...); err != nil {
 		return err
 	}
-	go setRedisUserWeekNotice(notices)
+	emitNoticeEvent(constant.WebhookEventNoticeCreated, notices...)
 	return nil
 }
 
-func setRedisUserWeekNotice(notices []Notice) error {
-	mgoCntrl := db.NewCopyMgoDBCntlr()
-	defer mgoCntrl.Close()
-	groupTable := mgoCntrl.GetTable(constant.TableGroup)
-
-	redisCntrl := db.NewRedisDBCntlr()
-	defer redisCntrl.Close()
+// setNoticeGroupIDs 整理通知的接收群组, GroupID 为空时使用 GroupIDs 中的第一个
+func setNoticeGroupIDs(notice *Notice) error {
+	groupIDs := []string{}
+	if notice.GroupID != "" {
+		groupIDs = append(groupIDs, notice.GroupID)
+	}
+	for _, groupID := range notice.GroupIDs {
+		if groupID != "" {
+			groupIDs = addToSet(groupIDs, groupID)
+		}
+	}
+	if len(groupIDs) == 0 || len(groupIDs) > constant.NoticeMaxGroupNum {
+		return constant.ErrorParamWrong
+	}
+	notice.GroupID = groupIDs[0]
+	notice.GroupIDs = nil
+	if len(groupIDs) > 1 {
+		notice.GroupIDs = groupIDs
+	}
+	return nil
+}
 
-	selector := bson.M{
-		"ownerID":    1,
-		"managerIDs": 1,
-		"memberIDs":  1,
+// noticeGroupIDs 通知的所有接收群组
+func noticeGroupIDs(notice Notice) []string {
+	if len(notice.GroupIDs) > 0 {
+		return notice.GroupIDs
 	}
+	return []string{notice.GroupID}
+}
 
-	for _, notice := range notices {
-		group := Group{}
-		err := groupTable.FindId(bson.ObjectIdHex(notice.GroupID)).Select(selector).One(&group)
-		if err != nil {
-			break
+// clearNoticeAudience 移动到其他群组时清空多群组和指定接收人, 改为发送给新群组的所有成员
+// 保存为空数组而不是 null, 与新建的通知一致
+func clearNoticeAudience(updateData map[string]interface{}) {
+	updateData["groupIDs"] = []string{}
+	updateData["targetUserIDs"] = []string{}
+	updateData["subgroupIDs"] = []string{}
+}
+
+// checkNoticePermission 用户在通知的任一接收群组中有 permission 权限即可
+func checkNoticePermission(ctx context.Context, notice Notice, userID, permission string) error {
+	err := constant.ErrorNoPermission
+	for _, groupID := range noticeGroupIDs(notice) {
+		if _, err = checkGroupPermission(ctx, groupID, userID, permission); err == nil {
+			return nil
 		}
+	}
+	return err
+}
 
-		memberIDs := append(append([]string{group.OwnerID}, group.ManagerIDs...), group.MemberIDs...)
+// CanViewNotice 创建者、接收群组的成员和可以编辑他人通知的管理员可以查看通知的内容和评论
+func CanViewNotice(ctx context.Context, notice Notice, userID string) bool {
+	if notice.CreatorID == userID {
+		return true
+	}
+	if _, ok := noticeMemberGroups(ctx, notice)[userID]; ok {
+		return true
+	}
+	return checkNoticePermission(ctx, notice, userID, constant.GroupPermEditOthersNotice) == nil
+}
 
-		t := time.Unix(notice.NoticeTime/1000, 0)
-		now := util.GetNowTimestamp()
-		weekStart := util.GetWeekStartTimestamp(t)
-		weekEnd := util.GetWeekEndTimestamp(t)
-		expire := (weekEnd - now) / 1000
+// CanViewNoticeFiles 私有空间时只有可以查看通知的用户能获取图片和附件的临时链接
+// 公开空间的链接本身可以直接访问, 不检查
+func CanViewNoticeFiles(ctx context.Context, notice Notice, userID string) bool {
+	return !config.Conf.Storage.Private || CanViewNotice(ctx, notice, userID)
+}
 
-		for _, member := range memberIDs {
-			key := fmt.Sprintf(constant.RedisUserWeekNotice, weekStart, member)
-			redisCntrl.RPUSH(key, notice.ID.Hex())
-			redisCntrl.EXPIRE(key, expire)
-		}
+func GetNotice(ctx context.Context, id string) (Notice, error) {
+	return store.Notices().FindByID(ctx, id)
+}
+
+// NoticeGroupStat 通知在一个接收群组中的查看统计
+type NoticeGroupStat struct {
+	GroupID   string `json:"groupID"`
+	PersonNum int    `json:"personNum"` // 群组中的接收人数
+	WatchNum  int    `json:"watchNum"`  // 群组中查看过的人数
+}
+
+// WatchNotice 记录用户查看了通知, 只记录接收群组中的用户
+func WatchNotice(ctx context.Context, id, userID string) error {
+	notice, err := store.Notices().FindByID(ctx, id)
+	if err != nil {
+		return err
 	}
-	return nil
+	if notice.Status < constant.NoticeExpireStatus {
+		return constant.ErrorNotFound
+	}
+	if _, ok := noticeMemberGroups(ctx, notice)[userID]; !ok {
+		return constant.ErrorNoPermission
+	}
+	return store.Notices().AddWatchUser(ctx, id, userID)
 }
 
-func GetNotice(id string) (Notice, error) {
-	if !bson.IsObjectIdHex(id) {
-		return Notice{}, constant.ErrorIDFormatWrong
+// GetNoticeGroupStats 按接收群组统计查看人数, 已解散的群组跳过
+func GetNoticeGroupStats(ctx context.Context, id string) ([]NoticeGroupStat, error) {
+	notice, err := store.Notices().FindByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	query := bson.M{
-		"_id": bson.ObjectIdHex(id),
+	stats := []NoticeGroupStat{}
+	for _, groupID := range noticeGroupIDs(notice) {
+		group, err := store.Groups().FindByID(ctx, groupID)
+		if err == constant.ErrorNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		memberIDs := noticeGroupAudience(notice, group)
+		stat := NoticeGroupStat{
+			GroupID:   groupID,
+			PersonNum: len(memberIDs),
+		}
+		for _, memberID := range memberIDs {
+			if containString(notice.WatchUserIDs, memberID) {
+				stat.WatchNum++
+			}
+		}
+		stats = append(stats, stat)
 	}
-	return findNotice(query, DefaultSelector)
+	return stats, nil
 }
 
 type NoticeSlice []Notice
@@ -107,24 +218,10 @@ func (s NoticeSlice) Len() int           { return len(s) }
 func (s NoticeSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s NoticeSlice) Less(i, j int) bool { return s[i].NoticeTime < s[j].NoticeTime }
 
-func GetNotices(groups []string, page, perPage int) ([]Notice, error) {
-	query := bson.M{
-		"group_id": bson.M{
-			"$in": groups,
-		},
-		"status": bson.M{
-			"$gte": constant.NoticeExpireStatus,
-		},
-	}
-	selector := bson.M{
-		"watch_users": 0,
-		"like_users":  0,
-	}
-	fields := []string{
-		"-status",
-		"notice_time",
-	}
-	notices, err := findNotices(query, selector, page, perPage, fields...)
+// GetNotices 获取群组的通知, 定向通知只返回给接收人、创建者和有 editOthersNotice 权限的用户
+func GetNotices(ctx context.Context, userID string, groups []string, page, perPage int) ([]Notice, error) {
+	audience := getNoticeAudience(ctx, userID, groups)
+	notices, err := store.Notices().FindByGroupIDs(ctx, groups, audience, page, perPage)
 	if err != nil {
 		return notices, err
 	}
@@ -161,202 +258,264 @@ func GetNotices(groups []string, page, perPage int) ([]Notice, error) {
 	return append(notices[:mid], sortNotices...), err
 }
 
-func UpdateNotice(noticeID, userID string, updateData map[string]interface{}) error {
-	if !bson.IsObjectIdHex(noticeID) {
-		return constant.ErrorIDFormatWrong
+// UpdateNotice 更新通知, 创建者需要 postNotice 权限, 其他人需要 editOthersNotice 权限, 多群组通知在任一群组中有权限即可
+// 管理员预设有 editOthersNotice 权限, 可以编辑、删除同一群组中其他管理员发布的通知
+// 移动群组后多群组通知变为只发送给该群组, 定向通知变为发送给该群组的所有人
+func UpdateNotice(ctx context.Context, noticeID, userID string, updateData map[string]interface{}) error {
+	notice, err := store.Notices().FindByID(ctx, noticeID)
+	if err != nil {
+		return err
+	}
+	if notice.Status < constant.NoticePubStatus {
+		return constant.ErrorNotFound
+	}
+	permission := constant.GroupPermPostNotice
+	if notice.CreatorID != userID {
+		permission = constant.GroupPermEditOthersNotice
 	}
-	query := bson.M{
-		"_id":       bson.ObjectIdHex(noticeID),
-		"creatorID": userID,
-		"status": bson.M{
-			"$gte": constant.NoticePubStatus,
-		},
+	if err = checkNoticePermission(ctx, notice, userID, permission); err != nil {
+		return err
+	}
+	uploaded := Notice{}
+	if imgs, ok := updateData["imgs"].([]Img); ok {
+		uploaded.Imgs = storedImgs(imgs)
+		updateData["imgs"] = uploaded.Imgs
+	}
+	if attachments, ok := updateData["attachments"].([]Attachment); ok {
+		attachments = storedAttachments(attachments)
+		updateData["attachments"] = attachments
+		if err = checkAttachments(attachments); err != nil {
+			return err
+		}
+		uploaded.Attachments = attachments
 	}
-	update := bson.M{
-		"$set": updateData,
+	if err = checkNoticeUploads(ctx, userID, uploaded, notice); err != nil {
+		return err
+	}
+	// 移动到其他群组后会推送给该群组的成员, 需要在该群组中有发布权限
+	groupID, moved := updateData["groupID"].(string)
+	moved = moved && (groupID != notice.GroupID || len(notice.GroupIDs) > 0)
+	if moved {
+		if _, err = checkGroupPermission(ctx, groupID, userID, constant.GroupPermPostNotice); err != nil {
+			return err
+		}
+		clearNoticeAudience(updateData)
 	}
-	return updateNotice(query, update)
+	if err = store.Notices().Update(ctx, noticeID, updateData); err != nil {
+		return err
+	}
+	if moved {
+		emitNoticeEvent(constant.WebhookEventNoticeDeleted, notice)
+	}
+
+	event := constant.WebhookEventNoticeUpdated
+	if status, ok := updateData["status"].(int); ok && status == constant.NoticeDeleteStatus {
+		event = constant.WebhookEventNoticeDeleted
+	}
+	if updated, err := store.Notices().FindByID(ctx, noticeID); err == nil {
+		notice = updated
+	}
+	emitNoticeEvent(event, notice)
+	return nil
 }
 
-func SendDayNotice() error {
-	now := util.GetNowTimestamp()
-	nextDayEnd := util.GetNextDayEndTimestamp()
-
-	cntrl := db.NewCopyMgoDBCntlr()
-	defer cntrl.Close()
-	noticeTable := cntrl.GetTable(constant.TableNotice)
-	query := bson.M{
-		"noticeTime": bson.M{
-			"$gt": now,
-			"$lt": nextDayEnd,
-		},
-	}
-
-	selector := bson.M{
-		"watchUserIDs": 0,
-		"watchNum":     0,
-		"likeUserIDs":  0,
-		"likeNum":      0,
-	}
-	notices := []Notice{}
-	noticeTable.Find(query).Select(selector).All(&notices)
+// SendDayNotice 发送每日提醒, 返回发送的消息数量
+// 每小时执行一次, 按用户的提醒设置过滤, 每个用户每天只发送一次
+func SendDayNotice(ctx context.Context) (int, error) {
+	now := time.Now()
+	notices, _ := store.Notices().FindPubByNoticeTime(ctx, util.GetNowTimestamp(), util.GetNextDayEndTimestamp())
 	if len(notices) == 0 {
-		return nil
+		return 0, nil
 	}
+	sort.Sort(NoticeSlice(notices))
 
-	groupTable := cntrl.GetTable(constant.TableGroup)
-	userTable := cntrl.GetTable(constant.TableUser)
+	redisCntrl := db.NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
 
-	templates := []WechatTemplate{}
+	// unionid -> 本次是否发送
+	sendUsers := map[string]bool{}
+	sentKeys := []interface{}{}
+	deliveries := []Delivery{}
 	for _, notice := range notices {
-		selector = bson.M{
-			"ownerID":    1,
-			"managerIDs": 1,
-			"memberIDs":  1,
+		memberGroups := noticeMemberGroups(ctx, notice)
+		if len(memberGroups) == 0 {
+			continue
 		}
-		group := Group{}
-		err := groupTable.FindId(bson.ObjectIdHex(notice.GroupID)).Select(selector).One(&group)
-		if err != nil {
-			break
-		}
-
-		memberIDs := append(append([]string{group.OwnerID}, group.ManagerIDs...), group.MemberIDs...)
-		query = bson.M{
-			"unionid": bson.M{
-				"$in": memberIDs,
-			},
-			"status": bson.M{
-				"$gte": constant.UserFollowStatus,
-			},
+		memberIDs := make([]string, 0, len(memberGroups))
+		for memberID := range memberGroups {
+			memberIDs = append(memberIDs, memberID)
 		}
-		selector = bson.M{
-			"unionid":  1,
-			"nickname": 1,
-		}
-		users := []User{}
-		userTable.Find(query).Select(selector).All(&users)
+		users, _ := store.Users().FindByUnionids(ctx, memberIDs)
 
 		for _, user := range users {
+			if !user.NotificationSettings.allowAnyGroup(memberGroups[user.Unionid]) {
+				continue
+			}
+			send, ok := sendUsers[user.Unionid]
+			if !ok {
+				send = canSendDayNotice(user, now)
+				if send {
+					key := dayNoticeSentKey(user, now)
+					if send = claimNoticeSent(redisCntrl, key); send {
+						sentKeys = append(sentKeys, key)
+					}
+				}
+				sendUsers[user.Unionid] = send
+			}
+			if !send {
+				continue
+			}
 			year, month, day := time.Unix(notice.NoticeTime/1000, 0).Date()
-			timeStr := fmt.Sprintf(constant.TemplateTime, year, month, day)
-			template := getNoticeTemplate(user.Unionid, notice.Title, notice.Content, timeStr)
-			templates = append(templates, template)
+			deliveries = append(deliveries, Delivery{
+				To: userRecipient(user),
+				Msg: Message{
+					Event:   constant.NotifyEventDayNotice,
+					Title:   notice.Title,
+					Content: notice.Content,
+					Time:    fmt.Sprintf(constant.TemplateTime, year, month, day),
+				},
+			})
 		}
 	}
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
 
-	_, err := sendOfficeAccountTemplate(templates)
-	return err
+	count, err := dispatch(ctx, deliveries)
+	if count == 0 && err != nil {
+		// 全部发送失败, 下次检查时重新发送
+		redisCntrl.DEL(sentKeys...)
+	}
+	return count, err
 }
 
-func SendWeekNotice() error {
-	now := time.Now().AddDate(0, 0, 7)
-	timestamp := util.GetWeekStartTimestamp(now)
-	p := fmt.Sprintf(constant.RedisUserWeek, timestamp)
-
-	redisCntrl := db.NewRedisDBCntlr()
-	defer redisCntrl.Close()
-
-	mgoCntrl := db.NewCopyMgoDBCntlr()
-	defer mgoCntrl.Close()
-	noticeTable := mgoCntrl.GetTable(constant.TableNotice)
+// SendWeekNotice 发送下周提醒, 返回发送的消息数量
+// 每次由下周的已发布通知和当前的群组成员重新生成,
+// 通知的修改、删除、移动群组以及成员的加入和离开都会体现在提醒中
+// 周五、周六每小时执行一次, 按用户的提醒设置过滤, 每个用户每周只发送一次
+func SendWeekNotice(ctx context.Context) (int, error) {
+	now := time.Now()
+	nextWeek := now.AddDate(0, 0, 7)
+	weekStart := util.GetWeekStartTimestamp(nextWeek)
+	weekEnd := util.GetWeekEndTimestamp(nextWeek)
+
+	notices, err := store.Notices().FindPubByNoticeTime(ctx, weekStart-1, weekEnd+1)
+	if err != nil || len(notices) == 0 {
+		return 0, err
+	}
 
-	keys, _ := redisCntrl.KEYS(p)
-	if len(keys) == 0 {
-		return nil
+	// unionid -> 下周的通知及用户所在的接收群组, 多群组通知对每个用户只出现一次
+	userNotices := map[string][]userNotice{}
+	userIDs := []string{}
+	for _, notice := range notices {
+		for memberID, groupIDs := range noticeMemberGroups(ctx, notice) {
+			if _, ok := userNotices[memberID]; !ok {
+				userIDs = append(userIDs, memberID)
+			}
+			userNotices[memberID] = append(userNotices[memberID], userNotice{notice, groupIDs})
+		}
+	}
+	if len(userIDs) == 0 {
+		return 0, nil
 	}
-	templates := []WechatTemplate{}
-	prefixLen := len(p) - 1
 
-	selector := bson.M{
-		"title":      1,
-		"content":    1,
-		"noticeTime": 1,
+	users, err := store.Users().FindByUnionids(ctx, userIDs)
+	if err != nil {
+		return 0, err
 	}
 
-	for _, key := range keys {
-		unionid := key[prefixLen:]
-		noticeIDs, _ := redisCntrl.LRANGE(key, 0, -1)
-		noticeBsonIDs := make([]bson.ObjectId, len(noticeIDs))
-		for i, id := range noticeIDs {
-			noticeBsonIDs[i] = bson.ObjectIdHex(id)
-		}
-		query := bson.M{
-			"_id": bson.M{
-				"$in": noticeBsonIDs,
-			},
+	redisCntrl := db.NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
+
+	sentKeys := []interface{}{}
+	deliveries := []Delivery{}
+	for _, user := range users {
+		if !canSendWeekNotice(user, now) {
+			continue
 		}
 		notices := []Notice{}
-		noticeTable.Find(query).Select(selector).All(&notices)
-		timeStr := "下周"
+		for _, n := range userNotices[user.Unionid] {
+			if user.NotificationSettings.allowAnyGroup(n.groupIDs) {
+				notices = append(notices, n.notice)
+			}
+		}
+		if len(notices) == 0 {
+			continue
+		}
+		key := weekNoticeSentKey(user, weekStart)
+		if !claimNoticeSent(redisCntrl, key) {
+			continue
+		}
+		sentKeys = append(sentKeys, key)
+
+		sort.Sort(NoticeSlice(notices))
 		var title string
 		var content string
 		for _, notice := range notices {
 			title += notice.Title + "\n"
 			content += notice.Content + "\n"
 		}
-		template := getNoticeTemplate(unionid, title, content, timeStr)
-		templates = append(templates, template)
+		deliveries = append(deliveries, Delivery{
+			To: userRecipient(user),
+			Msg: Message{
+				Event:   constant.NotifyEventWeekNotice,
+				Title:   title,
+				Content: content,
+				Time:    "下周",
+			},
+		})
+	}
+	if len(deliveries) == 0 {
+		return 0, nil
 	}
-	_, err := sendOfficeAccountTemplate(templates)
-	return err
-}
-
-func UpdateExpireNotice() error {
-	now := util.GetNowTimestamp()
-	query := bson.M{
-		"status": bson.M{
-			"$gte": constant.NoticePubStatus,
-		},
-		"noticeTime": bson.M{
-			"$lt": now,
-		},
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"status": constant.NoticeExpireStatus,
-		},
-	}
-	_, err := updateNotices(query, update)
-	return err
-}
-
-/****************************************** notice basic action ****************************************/
-
-func findNotice(query, selector interface{}) (Notice, error) {
-	data := Notice{}
-	cntrl := db.NewCopyMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableNotice)
-	err := table.Find(query).Select(selector).One(&data)
-	return data, err
-}
-
-func findNotices(query, selector interface{}, page, perPage int, fields ...string) ([]Notice, error) {
-	data := []Notice{}
-	cntrl := db.NewCopyMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableNotice)
-	err := table.Find(query).Sort(fields...).Select(selector).Skip((page - 1) * perPage).Limit(perPage).All(&data)
-	return data, err
-}
 
-func findNoticesByRaw(query, selector interface{}) ([]Notice, error) {
-	data := []Notice{}
-	cntrl := db.NewCopyMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableNotice)
-	err := table.Find(query).Select(selector).All(&data)
-	return data, err
+	count, err := dispatch(ctx, deliveries)
+	if count == 0 && err != nil {
+		// 全部发送失败, 下次检查时重新发送
+		redisCntrl.DEL(sentKeys...)
+	}
+	return count, err
 }
 
-func insertNotices(docs ...interface{}) error {
-	return insertDocs(constant.TableNotice, docs...)
+// userNotice 用户的一条通知及用户所在的接收群组
+type userNotice struct {
+	notice   Notice
+	groupIDs []string
 }
 
-func updateNotice(query, update interface{}) error {
-	return updateDoc(constant.TableNotice, query, update)
+// noticeMemberGroups 通知所有接收群组中的接收人, unionid -> 用户所在的接收群组, 已解散的群组跳过
+func noticeMemberGroups(ctx context.Context, notice Notice) map[string][]string {
+	memberGroups := map[string][]string{}
+	for _, groupID := range noticeGroupIDs(notice) {
+		group, err := store.Groups().FindByID(ctx, groupID)
+		if err != nil {
+			continue
+		}
+		for _, memberID := range noticeGroupAudience(notice, group) {
+			memberGroups[memberID] = append(memberGroups[memberID], groupID)
+		}
+	}
+	return memberGroups
 }
 
-func updateNotices(query, update interface{}) (interface{}, error) {
-	return updateDocs(constant.TableNotice, query, update)
+// UpdateExpireNotice 将已过提醒时间的通知设置为过期, 返回过期的数量
+func UpdateExpireNotice(ctx context.Context) (int, error) {
+	now := util.GetNowTimestamp()
+	// 先查出将要过期的通知, 用于推送 webhook 事件
+	notices, err := store.Notices().FindPubByNoticeTime(ctx, 0, now)
+	if err != nil {
+		return 0, err
+	}
+	if err = db.CheckFence(ctx); err != nil {
+		return 0, err
+	}
+	count, err := store.Notices().ExpireBefore(ctx, now)
+	if err != nil {
+		return count, err
+	}
+	for i := range notices {
+		notices[i].Status = constant.NoticeExpireStatus
+	}
+	emitNoticeEvent(constant.WebhookEventNoticeExpired, notices...)
+	return count, nil
 }
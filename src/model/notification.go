@@ -0,0 +1,200 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"fmt"
+	"model/db"
+	"net/mail"
+	"time"
+	"util"
+)
+
+// NotificationSettings 用户的提醒设置, 零值表示默认设置: 接收所有群组的每日和每周提醒, 不开启免打扰
+type NotificationSettings struct {
+	MutedGroupIDs []string `bson:"mutedGroupIDs" json:"mutedGroupIDs"` // 不接收提醒的群组
+	Digest        int      `bson:"digest" json:"digest"`               // 提醒方式: 0 每日和每周, 1 仅每日, 2 仅每周
+	QuietStart    string   `bson:"quietStart" json:"quietStart"`       // 免打扰开始时间 HH:MM, 为空表示不开启
+	QuietEnd      string   `bson:"quietEnd" json:"quietEnd"`           // 免打扰结束时间 HH:MM, 可跨零点
+	Timezone      string   `bson:"timezone" json:"timezone"`           // 时区, 如 Asia/Shanghai, 为空时使用默认时区
+	Channels      []string `bson:"channels" json:"channels"`           // 接收渠道, 为空时使用公众号模板消息
+	Email         string   `bson:"email" json:"email"`                 // 邮件渠道的邮箱
+	WebhookURL    string   `bson:"webhookUrl" json:"webhookUrl"`       // webhook 渠道的地址, 必须为 https 的公网地址
+}
+
+var notifyChannels = []string{
+	constant.NotifyChannelOfficialAccount,
+	constant.NotifyChannelSubscribe,
+	constant.NotifyChannelEmail,
+	constant.NotifyChannelWebhook,
+}
+
+// UpdateNotificationSettings 更新提醒设置, 只能屏蔽自己所在的群组
+func UpdateNotificationSettings(ctx context.Context, unionid string, settings NotificationSettings) (NotificationSettings, error) {
+	if err := settings.validate(); err != nil {
+		return settings, err
+	}
+	if settings.WebhookURL != "" {
+		if err := util.CheckPublicURL(ctx, settings.WebhookURL); err != nil {
+			return settings, err
+		}
+	}
+	user, err := store.Users().FindByUnionid(ctx, unionid)
+	if err != nil {
+		return settings, err
+	}
+	groupIDs := append(append(append([]string{}, user.OwnGroupIDs...), user.ManageGroupIDs...), user.JoinGroupIDs...)
+	for _, groupID := range settings.MutedGroupIDs {
+		if !containString(groupIDs, groupID) {
+			return settings, constant.ErrorParamWrong
+		}
+	}
+	if settings.MutedGroupIDs == nil {
+		settings.MutedGroupIDs = []string{}
+	}
+	if settings.Channels == nil {
+		settings.Channels = []string{}
+	}
+
+	updateData := map[string]interface{}{
+		"notificationSettings": settings,
+	}
+	return settings, store.Users().Update(ctx, unionid, updateData)
+}
+
+func (s NotificationSettings) validate() error {
+	if s.Digest < constant.NotifyDigestAll || s.Digest > constant.NotifyDigestWeek {
+		return constant.ErrorParamWrong
+	}
+	if (s.QuietStart == "") != (s.QuietEnd == "") {
+		return constant.ErrorParamWrong
+	}
+	if s.QuietStart != "" {
+		if _, err := parseQuietTime(s.QuietStart); err != nil {
+			return constant.ErrorParamWrong
+		}
+		if _, err := parseQuietTime(s.QuietEnd); err != nil {
+			return constant.ErrorParamWrong
+		}
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return constant.ErrorParamWrong
+		}
+	}
+	for _, channel := range s.Channels {
+		if !containString(notifyChannels, channel) || !channelEnabled(channel) {
+			return constant.ErrorParamWrong
+		}
+	}
+	if s.Email != "" {
+		if _, err := mail.ParseAddress(s.Email); err != nil {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
+
+// location 用户所在时区, 未设置或无效时使用默认时区
+func (s NotificationSettings) location() *time.Location {
+	name := s.Timezone
+	if name == "" {
+		name = constant.UserDefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// localTime 用户所在时区的时间
+func (s NotificationSettings) localTime(t time.Time) time.Time {
+	return t.In(s.location())
+}
+
+// inQuietHours t 是否处于免打扰时段
+func (s NotificationSettings) inQuietHours(t time.Time) bool {
+	if s.QuietStart == "" || s.QuietEnd == "" {
+		return false
+	}
+	start, err := parseQuietTime(s.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseQuietTime(s.QuietEnd)
+	if err != nil {
+		return false
+	}
+	local := s.localTime(t)
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// 跨零点, 如 22:00 ~ 07:00
+	return minute >= start || minute < end
+}
+
+func (s NotificationSettings) allowDigest(digest int) bool {
+	return s.Digest == constant.NotifyDigestAll || s.Digest == digest
+}
+
+func (s NotificationSettings) allowGroup(groupID string) bool {
+	return !containString(s.MutedGroupIDs, groupID)
+}
+
+// allowAnyGroup 多群组通知中用户所在的群组有一个未屏蔽即可
+func (s NotificationSettings) allowAnyGroup(groupIDs []string) bool {
+	for _, groupID := range groupIDs {
+		if s.allowGroup(groupID) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQuietTime 解析 HH:MM, 返回距零点的分钟数
+func parseQuietTime(s string) (int, error) {
+	t, err := time.Parse(constant.UserQuietTimeLayout, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// canSendDayNotice 用户本地时间已过每日提醒时间, 且不在免打扰时段
+func canSendDayNotice(user User, now time.Time) bool {
+	settings := user.NotificationSettings
+	return settings.allowDigest(constant.NotifyDigestDay) &&
+		canNotify(userRecipient(user), constant.NotifyEventDayNotice) &&
+		settings.localTime(now).Hour() >= constant.DayNoticeHour &&
+		!settings.inQuietHours(now)
+}
+
+// canSendWeekNotice 用户本地时间已过周五的每周提醒时间, 且不在免打扰时段
+func canSendWeekNotice(user User, now time.Time) bool {
+	settings := user.NotificationSettings
+	local := settings.localTime(now)
+	isTime := local.Weekday() == time.Saturday ||
+		(local.Weekday() == time.Friday && local.Hour() >= constant.WeekNoticeHour)
+	return settings.allowDigest(constant.NotifyDigestWeek) &&
+		canNotify(userRecipient(user), constant.NotifyEventWeekNotice) &&
+		isTime &&
+		!settings.inQuietHours(now)
+}
+
+/****************************************** notice sent redis action ****************************************/
+
+// claimNoticeSent 标记提醒已发送, 已标记过或任务的锁已被其他实例取得时返回 false
+func claimNoticeSent(redisCntrl *db.RedisDBCntlr, key string) bool {
+	ok, err := redisCntrl.FencedSETNXEX(key, constant.RedisNoticeSentExpire, "1")
+	return err == nil && ok
+}
+
+func dayNoticeSentKey(user User, now time.Time) string {
+	return fmt.Sprintf(constant.RedisUserDayNoticeSent, user.NotificationSettings.localTime(now).Format("20060102"), user.Unionid)
+}
+
+func weekNoticeSentKey(user User, weekStart int64) string {
+	return fmt.Sprintf(constant.RedisUserWeekNoticeSent, weekStart, user.Unionid)
+}
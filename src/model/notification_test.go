@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotificationSettingsInQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2019, 5, 1, hour, minute, 0, 0, time.UTC)
+	}
+	overnight := NotificationSettings{QuietStart: "22:00", QuietEnd: "07:00", Timezone: "UTC"}
+	daytime := NotificationSettings{QuietStart: "12:00", QuietEnd: "14:30", Timezone: "UTC"}
+
+	tests := []struct {
+		name     string
+		settings NotificationSettings
+		t        time.Time
+		want     bool
+	}{
+		{"overnight before start", overnight, at(21, 59), false},
+		{"overnight at start", overnight, at(22, 0), true},
+		{"overnight before midnight", overnight, at(23, 59), true},
+		{"overnight at midnight", overnight, at(0, 0), true},
+		{"overnight after midnight", overnight, at(6, 59), true},
+		{"overnight at end", overnight, at(7, 0), false},
+		{"overnight daytime", overnight, at(12, 0), false},
+		{"daytime before start", daytime, at(11, 59), false},
+		{"daytime inside", daytime, at(14, 29), true},
+		{"daytime at end", daytime, at(14, 30), false},
+		{"daytime at night", daytime, at(23, 0), false},
+		{"not set", NotificationSettings{Timezone: "UTC"}, at(23, 0), false},
+		{"invalid time", NotificationSettings{QuietStart: "25:00", QuietEnd: "07:00", Timezone: "UTC"}, at(23, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.settings.inQuietHours(tt.t); got != tt.want {
+			t.Errorf("%s: inQuietHours(%s) = %v, want %v", tt.name, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+// 免打扰时段按用户所在时区判断
+func TestNotificationSettingsInQuietHoursTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Shanghai"); err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	settings := NotificationSettings{QuietStart: "22:00", QuietEnd: "07:00", Timezone: "Asia/Shanghai"}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2019, 5, 1, 15, 0, 0, 0, time.UTC), true},  // 北京时间 23:00
+		{time.Date(2019, 5, 1, 22, 59, 0, 0, time.UTC), true}, // 北京时间次日 06:59
+		{time.Date(2019, 5, 1, 23, 0, 0, 0, time.UTC), false}, // 北京时间次日 07:00
+		{time.Date(2019, 5, 1, 13, 0, 0, 0, time.UTC), false}, // 北京时间 21:00
+	}
+	for _, tt := range tests {
+		if got := settings.inQuietHours(tt.t); got != tt.want {
+			t.Errorf("inQuietHours(%s) = %v, want %v", tt.t.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
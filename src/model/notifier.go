@@ -0,0 +1,196 @@
+package model
+
+import (
+	"config"
+	"constant"
+	"context"
+	"errors"
+	"strings"
+)
+
+/*
+   多渠道提醒
+   - Notifier: 一个发送渠道, 如公众号模板消息、小程序订阅消息、邮件、webhook
+   - dispatch: 按事件类型和用户的提醒设置为每条消息选择渠道, 再按渠道批量发送
+*/
+
+// Message 一条提醒消息, 各渠道按事件类型选择需要的字段
+type Message struct {
+	Event   string // 事件类型: constant.NotifyEvent*
+	Title   string // 标题, 如通知标题
+	Content string // 正文
+	Time    string // 展示的时间, 如 2018年5月1日、下周
+
+	UserNickname  string // 加入群组时的用户昵称
+	GroupNickname string // 加入群组时的群组昵称
+}
+
+// Recipient 接收者及其可用的渠道
+type Recipient struct {
+	Unionid    string
+	Openid     string // 小程序 openid, 用于订阅消息
+	Email      string
+	WebhookURL string
+	Channels   []string
+}
+
+// Delivery 发送给某个接收者的一条消息
+type Delivery struct {
+	To  Recipient
+	Msg Message
+}
+
+type Notifier interface {
+	Channel() string
+	// Send 批量发送, 返回成功发送的数量
+	Send(ctx context.Context, deliveries []Delivery) (int, error)
+}
+
+// eventChannels 各事件允许使用的渠道
+var eventChannels = map[string][]string{
+	constant.NotifyEventDayNotice: {
+		constant.NotifyChannelOfficialAccount,
+		constant.NotifyChannelSubscribe,
+		constant.NotifyChannelEmail,
+		constant.NotifyChannelWebhook,
+	},
+	constant.NotifyEventWeekNotice: {
+		constant.NotifyChannelOfficialAccount,
+		constant.NotifyChannelEmail,
+		constant.NotifyChannelWebhook,
+	},
+	constant.NotifyEventGroupJoin: {
+		constant.NotifyChannelOfficialAccount,
+		constant.NotifyChannelSubscribe,
+	},
+	constant.NotifyEventFeedback: {
+		constant.NotifyChannelEmail,
+	},
+	constant.NotifyEventGroupTransfer: {
+		constant.NotifyChannelOfficialAccount,
+		constant.NotifyChannelSubscribe,
+	},
+	constant.NotifyEventNoticeComment: {
+		constant.NotifyChannelOfficialAccount,
+		constant.NotifyChannelSubscribe,
+	},
+	constant.NotifyEventSubmissionRemind: {
+		constant.NotifyChannelOfficialAccount,
+		constant.NotifyChannelSubscribe,
+		constant.NotifyChannelEmail,
+		constant.NotifyChannelWebhook,
+	},
+}
+
+var notifiers = map[string]Notifier{
+	constant.NotifyChannelOfficialAccount: officialAccountNotifier{},
+	constant.NotifyChannelSubscribe:       subscribeNotifier{},
+	constant.NotifyChannelEmail:           emailNotifier{},
+	constant.NotifyChannelWebhook:         webhookNotifier{},
+}
+
+// SetNotifier 替换某个渠道的实现
+func SetNotifier(n Notifier) {
+	notifiers[n.Channel()] = n
+}
+
+// channelEnabled 渠道是否可用, 未配置订阅消息模板时不使用订阅消息
+func channelEnabled(channel string) bool {
+	if channel == constant.NotifyChannelSubscribe {
+		return config.Conf.Wechat.SubscribeTemplateID != ""
+	}
+	return true
+}
+
+// userRecipient 根据用户的提醒设置得到接收者, 只保留用户信息完整的渠道
+func userRecipient(user User) Recipient {
+	settings := user.NotificationSettings
+	recipient := Recipient{
+		Unionid:    user.Unionid,
+		Openid:     user.Openid,
+		Email:      settings.Email,
+		WebhookURL: settings.WebhookURL,
+	}
+	channels := settings.Channels
+	if len(channels) == 0 {
+		channels = []string{constant.NotifyChannelOfficialAccount}
+	}
+	for _, channel := range channels {
+		switch channel {
+		case constant.NotifyChannelOfficialAccount:
+			if user.Status < constant.UserFollowStatus {
+				continue
+			}
+		case constant.NotifyChannelSubscribe:
+			if user.Openid == "" || !channelEnabled(channel) {
+				continue
+			}
+		case constant.NotifyChannelEmail:
+			if settings.Email == "" {
+				continue
+			}
+		case constant.NotifyChannelWebhook:
+			if settings.WebhookURL == "" {
+				continue
+			}
+		}
+		recipient.Channels = append(recipient.Channels, channel)
+	}
+	return recipient
+}
+
+// adminRecipients 管理员通过邮件接收反馈等消息
+func adminRecipients() []Recipient {
+	recipients := []Recipient{}
+	for _, email := range config.Conf.EmailInfo.To {
+		recipients = append(recipients, Recipient{
+			Email:    email,
+			Channels: []string{constant.NotifyChannelEmail},
+		})
+	}
+	return recipients
+}
+
+// routeChannels 接收者在该事件下使用的渠道
+func routeChannels(to Recipient, event string) []string {
+	channels := []string{}
+	for _, channel := range to.Channels {
+		if containString(eventChannels[event], channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// canNotify 接收者在该事件下是否有可用的渠道
+func canNotify(to Recipient, event string) bool {
+	return len(routeChannels(to, event)) > 0
+}
+
+// dispatch 按渠道分组后批量发送, 返回成功发送的数量, 某个渠道失败不影响其他渠道
+func dispatch(ctx context.Context, deliveries []Delivery) (int, error) {
+	channelDeliveries := map[string][]Delivery{}
+	for _, delivery := range deliveries {
+		for _, channel := range routeChannels(delivery.To, delivery.Msg.Event) {
+			channelDeliveries[channel] = append(channelDeliveries[channel], delivery)
+		}
+	}
+
+	count := 0
+	errMsgs := []string{}
+	for channel, deliveries := range channelDeliveries {
+		notifier, ok := notifiers[channel]
+		if !ok {
+			continue
+		}
+		n, err := notifier.Send(ctx, deliveries)
+		count += n
+		if err != nil {
+			errMsgs = append(errMsgs, channel+": "+err.Error())
+		}
+	}
+	if len(errMsgs) > 0 {
+		return count, errors.New(strings.Join(errMsgs, "; "))
+	}
+	return count, nil
+}
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"config"
+	"constant"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"util"
+
+	"github.com/imroc/req"
+)
+
+/****************************************** official account ****************************************/
+
+// officialAccountNotifier 通过冰岩的服务发送公众号模板消息
+type officialAccountNotifier struct{}
+
+func (officialAccountNotifier) Channel() string {
+	return constant.NotifyChannelOfficialAccount
+}
+
+func (officialAccountNotifier) Send(ctx context.Context, deliveries []Delivery) (int, error) {
+	templates := []WechatTemplate{}
+	for _, delivery := range deliveries {
+		msg := delivery.Msg
+		var template WechatTemplate
+		switch msg.Event {
+		case constant.NotifyEventGroupJoin:
+			template = getGroupTemplate(delivery.To.Unionid, msg.UserNickname, msg.GroupNickname)
+		default:
+			template = getNoticeTemplate(delivery.To.Unionid, msg.Title, msg.Content, msg.Time)
+		}
+		templates = append(templates, template)
+	}
+	if len(templates) == 0 {
+		return 0, nil
+	}
+	_, err := sendOfficeAccountTemplate(ctx, templates)
+	if err != nil {
+		return 0, err
+	}
+	return len(templates), nil
+}
+
+/****************************************** mini program subscribe message ****************************************/
+
+// subscribeNotifier 小程序订阅消息, 用户需在小程序中授权订阅
+type subscribeNotifier struct{}
+
+type subscribeMessage struct {
+	ToUser     string                       `json:"touser"`      // 小程序 openid
+	TemplateID string                       `json:"template_id"` // 订阅消息模板id
+	Page       string                       `json:"page,omitempty"`
+	Data       map[string]map[string]string `json:"data"`
+}
+
+func (subscribeNotifier) Channel() string {
+	return constant.NotifyChannelSubscribe
+}
+
+func (subscribeNotifier) Send(ctx context.Context, deliveries []Delivery) (int, error) {
+	accessToken, err := getRedisAccessToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	uri := constant.WechatSubscribeSendURIPrefix + "?access_token=" + url.QueryEscape(accessToken)
+
+	count := 0
+	var lastErr error
+	for _, delivery := range deliveries {
+		msg := delivery.Msg
+		title, content := msg.Title, msg.Content
+		if msg.Event == constant.NotifyEventGroupJoin {
+			title, content = msg.GroupNickname, fmt.Sprintf(constant.TemplateGroupJoinFirst, msg.UserNickname)
+		}
+		reqData := subscribeMessage{
+			ToUser:     delivery.To.Openid,
+			TemplateID: config.Conf.Wechat.SubscribeTemplateID,
+			Page:       constant.MPPagePath,
+			Data: map[string]map[string]string{
+				"thing1": {"value": truncateRunes(title, constant.SubscribeThingMaxLen)},
+				"thing2": {"value": truncateRunes(content, constant.SubscribeThingMaxLen)},
+				"thing3": {"value": truncateRunes(msg.Time, constant.SubscribeThingMaxLen)},
+			},
+		}
+		resp, err := util.HTTPPost(ctx, uri, req.BodyJSON(&reqData))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resData := Error{}
+		if err = resp.ToJSON(&resData); err != nil {
+			lastErr = err
+			continue
+		}
+		if resData.ErrCode != 0 {
+			lastErr = errors.New(resData.ErrMsg)
+			continue
+		}
+		count++
+	}
+	return count, lastErr
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+/****************************************** email ****************************************/
+
+type emailNotifier struct{}
+
+func (emailNotifier) Channel() string {
+	return constant.NotifyChannelEmail
+}
+
+func (emailNotifier) Send(ctx context.Context, deliveries []Delivery) (int, error) {
+	name := config.Conf.EmailInfo.UserName
+	count := 0
+	var lastErr error
+	for _, delivery := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		msg := delivery.Msg
+		subject := fmt.Sprintf(constant.EmailNoticeSubject, msg.Title)
+		content := fmt.Sprintf(constant.EmailNoticeContent, msg.Title, msg.Content, msg.Time)
+		if msg.Event == constant.NotifyEventFeedback {
+			subject, content = constant.EmailFeedbackSubject, msg.Content
+		}
+		if err := util.SendEmail(name, subject, content, []string{delivery.To.Email}); err != nil {
+			lastErr = err
+			continue
+		}
+		count++
+	}
+	return count, lastErr
+}
+
+/****************************************** webhook ****************************************/
+
+// webhookNotifier 向用户设置的 https 地址 POST JSON, 只会连接公网地址
+type webhookNotifier struct{}
+
+type webhookPayload struct {
+	Event         string `json:"event"`
+	UserID        string `json:"userID"`
+	Title         string `json:"title"`
+	Content       string `json:"content"`
+	Time          string `json:"time"`
+	GroupNickname string `json:"groupNickname,omitempty"`
+}
+
+func (webhookNotifier) Channel() string {
+	return constant.NotifyChannelWebhook
+}
+
+func (webhookNotifier) Send(ctx context.Context, deliveries []Delivery) (int, error) {
+	count := 0
+	var lastErr error
+	for _, delivery := range deliveries {
+		msg := delivery.Msg
+		payload := webhookPayload{
+			Event:         msg.Event,
+			UserID:        delivery.To.Unionid,
+			Title:         msg.Title,
+			Content:       msg.Content,
+			Time:          msg.Time,
+			GroupNickname: msg.GroupNickname,
+		}
+		resp, err := util.HTTPPostPublic(ctx, delivery.To.WebhookURL, req.BodyJSON(&payload))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if code := resp.Response().StatusCode; code < 200 || code >= 300 {
+			lastErr = fmt.Errorf("webhook response status %d", code)
+			continue
+		}
+		count++
+	}
+	return count, lastErr
+}
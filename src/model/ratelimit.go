@@ -0,0 +1,21 @@
+package model
+
+import (
+	"config"
+	"constant"
+	"context"
+	"fmt"
+	"model/db"
+	"time"
+)
+
+// AllowRequest 按 config.RateLimit 中 op 的规则限流, subject 见 constant.RateLimitSubject*
+// 未配置规则时不限流; 不允许时返回需要等待的时长
+func AllowRequest(ctx context.Context, op, subject string) (bool, time.Duration, error) {
+	rate, burst, ok := config.RateLimitRule(op)
+	if !ok {
+		return true, 0, nil
+	}
+	key := fmt.Sprintf(constant.RedisRateLimit, op, subject)
+	return db.TakeToken(ctx, key, rate, burst)
+}
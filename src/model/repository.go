@@ -0,0 +1,188 @@
+package model
+
+/*
+   持久化接口：model 层只通过 repository 访问数据库
+   默认使用 mongo 实现，测试时可通过 SetStore(NewMemoryStore()) 替换为内存实现
+*/
+import "context"
+
+type UserRepository interface {
+	FindByUnionid(ctx context.Context, unionid string) (User, error)
+	FindByUnionids(ctx context.Context, unionids []string) ([]User, error)
+	FindByOfficialOpenid(ctx context.Context, openid string) (User, error)
+	Insert(ctx context.Context, user User) error
+	// Update 按字段名($set)更新用户
+	Update(ctx context.Context, unionid string, fields map[string]interface{}) error
+	// SetStatus 仅当用户当前状态为 from 时更新为 to
+	SetStatus(ctx context.Context, unionid string, from, to int) error
+	// AddGroup/RemoveGroup 维护用户的群组列表, role: constant.GroupUserStatus*
+	AddGroup(ctx context.Context, unionids []string, role int, groupID string) error
+	RemoveGroup(ctx context.Context, unionids []string, role int, groupID string) error
+	// Anonymize 注销用户: unionid 替换为 anonID, 清空个人信息和群组列表
+	Anonymize(ctx context.Context, unionid, anonID string) error
+}
+
+type GroupRepository interface {
+	// Insert code 与已有群组重复时返回 constant.ErrorHasExist
+	Insert(ctx context.Context, group Group) error
+	// FindByID/FindByCode 只返回正常状态的群组
+	FindByID(ctx context.Context, id string) (Group, error)
+	FindByCode(ctx context.Context, code string) (Group, error)
+	// SoftDelete 解散群组, 保留成员列表; Restore 恢复为正常状态
+	SoftDelete(ctx context.Context, id, deletedBy string, deletedAt int64) error
+	Restore(ctx context.Context, id string) error
+	// FindDeletedByID 获取已解散的群组
+	FindDeletedByID(ctx context.Context, id string) (Group, error)
+	// FindDeletedByOwner 获取 ownerID 在 after 之后解散的群组, 按解散时间倒序
+	FindDeletedByOwner(ctx context.Context, ownerID string, after int64) ([]Group, error)
+	// FindDeletedBefore 获取在 t 之前解散的群组
+	FindDeletedBefore(ctx context.Context, t int64) ([]Group, error)
+	// Delete 彻底删除群组
+	Delete(ctx context.Context, id string) error
+	SetOwner(ctx context.Context, id, ownerID string) error
+	// AddUsers 将用户加入管理员/成员列表并更新 personNum, 任一用户已存在时返回 constant.ErrorNotFound
+	AddUsers(ctx context.Context, id string, role int, unionids []string) error
+	// RemoveUsers 将用户移出管理员/成员列表并更新 personNum, 同时清除其自定义角色, 任一用户不存在时返回 constant.ErrorNotFound
+	RemoveUsers(ctx context.Context, id string, role int, unionids []string) error
+	// SetRoles 更新自定义角色及用户的角色指定
+	SetRoles(ctx context.Context, id string, roles []GroupRole, userRoles map[string]string) error
+	SetSubgroups(ctx context.Context, id string, subgroups []Subgroup) error
+	// ReplaceUser 将已解散群组中的 unionid 替换为 anonID, 并移出管理员/成员列表; 同时移出所有群组的分组
+	ReplaceUser(ctx context.Context, unionid, anonID string) error
+}
+
+type NoticeRepository interface {
+	Insert(ctx context.Context, notices ...Notice) error
+	FindByID(ctx context.Context, id string) (Notice, error)
+	FindByIDs(ctx context.Context, ids []string) ([]Notice, error)
+	// FindByGroupIDs 分页获取未删除的通知, 包括接收群组中有 groupIDs 的多群组通知, 按 -status, noticeTime 排序
+	// 定向通知只返回 audience 可以查看的
+	FindByGroupIDs(ctx context.Context, groupIDs []string, audience NoticeAudience, page, perPage int) ([]Notice, error)
+	// FindPubByNoticeTime 获取提醒时间在 (start, end) 之间的已发布通知
+	FindPubByNoticeTime(ctx context.Context, start, end int64) ([]Notice, error)
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+	// AddWatchUser 记录查看用户并增加查看人数, 已查看过时不更新
+	AddWatchUser(ctx context.Context, id, unionid string) error
+	// ExpireBefore 将提醒时间早于 t 的已发布通知设置为过期, 返回过期的数量
+	ExpireBefore(ctx context.Context, t int64) (int, error)
+	// FindDeletedByCreator 获取 creatorID 在 after 之后删除的通知, 按删除时间倒序
+	FindDeletedByCreator(ctx context.Context, creatorID string, after int64) ([]Notice, error)
+	// FindDeletedBefore 获取在 t 之前删除的通知
+	FindDeletedBefore(ctx context.Context, t int64) ([]Notice, error)
+	// FindAllByGroupID 获取群组的所有通知, 包括已删除的和以该群组为接收群组的多群组通知
+	FindAllByGroupID(ctx context.Context, groupID string) ([]Notice, error)
+	// DeleteByIDs 彻底删除通知, 返回删除的数量
+	DeleteByIDs(ctx context.Context, ids []string) (int, error)
+	// FindByUser 获取用户创建、查看或点赞过的通知, 包括已删除的
+	FindByUser(ctx context.Context, unionid string) ([]Notice, error)
+	// ReplaceUser 将创建者、删除人、定向接收人中的 unionid 替换为 anonID, 并移出查看和点赞用户
+	ReplaceUser(ctx context.Context, unionid, anonID string) error
+}
+
+type TemplateRepository interface {
+	FindByID(ctx context.Context, id string) (Template, error)
+	Insert(ctx context.Context, template Template) error
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+}
+
+type FeedbackRepository interface {
+	Insert(ctx context.Context, feedback Feedback) error
+	FindByUserID(ctx context.Context, userID string) ([]Feedback, error)
+	ReplaceUser(ctx context.Context, userID, anonID string) error
+}
+
+type JobRunRepository interface {
+	Insert(ctx context.Context, run JobRun) error
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+	// Find 分页获取执行记录, 按开始时间倒序, name 为空时不过滤
+	Find(ctx context.Context, name string, page, perPage int) ([]JobRun, error)
+}
+
+type WebhookRepository interface {
+	Insert(ctx context.Context, hook GroupWebhook) error
+	// FindByID/FindByGroupID 只返回正常状态的 webhook
+	FindByID(ctx context.Context, id string) (GroupWebhook, error)
+	FindByGroupID(ctx context.Context, groupID string) ([]GroupWebhook, error)
+	SetStatus(ctx context.Context, id string, status int) error
+	ReplaceCreator(ctx context.Context, unionid, anonID string) error
+}
+
+type WebhookDeliveryRepository interface {
+	Insert(ctx context.Context, delivery WebhookDelivery) error
+	FindByID(ctx context.Context, id string) (WebhookDelivery, error)
+	// FindByWebhookID 分页获取投递记录, 按创建时间倒序
+	FindByWebhookID(ctx context.Context, webhookID string, page, perPage int) ([]WebhookDelivery, error)
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+}
+
+type GroupTransferRepository interface {
+	// Insert 同一群组只能有一个待处理的转让, 已存在时返回 constant.ErrorHasExist
+	Insert(ctx context.Context, transfer GroupTransfer) error
+	FindByID(ctx context.Context, id string) (GroupTransfer, error)
+	// FindPending 获取待处理的转让(包括已过期但未更新状态的), groupID、userID 为空时不过滤, userID 匹配转出人或接收人
+	FindPending(ctx context.Context, groupID, userID string) ([]GroupTransfer, error)
+	// UpdateStatus 仅当状态为 from 时更新, 否则返回 constant.ErrorNotFound
+	UpdateStatus(ctx context.Context, id string, from, to int, updateTime int64) error
+	ReplaceUser(ctx context.Context, unionid, anonID string) error
+}
+
+type SubmissionRepository interface {
+	// Insert 每个用户对每条通知只能有一个提交, 已存在时返回 constant.ErrorHasExist
+	Insert(ctx context.Context, submission Submission) error
+	FindByID(ctx context.Context, id string) (Submission, error)
+	// FindByNoticeID 获取通知的所有提交, 按更新时间倒序
+	FindByNoticeID(ctx context.Context, noticeID string) ([]Submission, error)
+	FindByUser(ctx context.Context, userID string) ([]Submission, error)
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+	DeleteByNoticeIDs(ctx context.Context, noticeIDs []string) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+type CommentRepository interface {
+	Insert(ctx context.Context, comment Comment) error
+	FindByID(ctx context.Context, id string) (Comment, error)
+	// FindByParent 获取未删除的评论, parentID 为空时为一级评论, 否则为该评论的回复
+	// 按创建顺序, 只返回 id 在 after 之后的, after 为空时从头开始, limit 为 0 时不限制数量
+	FindByParent(ctx context.Context, noticeID, parentID, after string, limit int) ([]Comment, error)
+	CountByParent(ctx context.Context, noticeID, parentID string) (int, error)
+	FindByUser(ctx context.Context, userID string) ([]Comment, error)
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+	DeleteByNoticeIDs(ctx context.Context, noticeIDs []string) error
+	// ReplaceUser 删除用户的评论并清空内容, 回复对象和提到的用户中的 unionid 替换为 anonID
+	ReplaceUser(ctx context.Context, unionid, anonID string) error
+}
+
+type UploadRepository interface {
+	// Upsert 按文件名登记, 已存在时覆盖
+	Upsert(ctx context.Context, upload Upload) error
+	// FindByKeys 获取已登记的文件, 未登记的跳过
+	FindByKeys(ctx context.Context, keys []string) ([]Upload, error)
+	DeleteByOwner(ctx context.Context, ownerID string) error
+}
+
+// Store 所有 repository 的集合
+type Store interface {
+	Users() UserRepository
+	Groups() GroupRepository
+	Notices() NoticeRepository
+	Templates() TemplateRepository
+	Feedbacks() FeedbackRepository
+	JobRuns() JobRunRepository
+	Webhooks() WebhookRepository
+	WebhookDeliveries() WebhookDeliveryRepository
+	GroupTransfers() GroupTransferRepository
+	Submissions() SubmissionRepository
+	Comments() CommentRepository
+	Uploads() UploadRepository
+	// EnsureIndexes 创建查询所需的索引并补全旧数据, 启动时调用
+	EnsureIndexes(ctx context.Context) error
+	// RunInTransaction 在事务中执行 fn, fn 内的操作需使用传入的 ctx
+	RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+var store Store = NewMongoStore()
+
+// SetStore 替换持久化实现
+func SetStore(s Store) {
+	store = s
+}
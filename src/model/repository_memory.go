@@ -0,0 +1,1261 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// memoryStore 内存实现, 用于测试和本地调试, 所有 repository 共用一把锁
+type memoryStore struct {
+	mu         sync.RWMutex
+	users      map[string]User // key: unionid
+	groups     map[string]Group
+	notices    map[string]Notice
+	templates  map[string]Template
+	feedbacks  []Feedback
+	jobRuns    map[string]JobRun
+	webhooks   map[string]GroupWebhook
+	deliveries map[string]WebhookDelivery // webhook 投递记录
+	transfers  map[string]GroupTransfer
+	submits    map[string]Submission // 作业提交
+	comments   map[string]Comment
+	uploads    map[string]Upload // key: 七牛文件名
+}
+
+// NewMemoryStore 内存持久化实现
+func NewMemoryStore() Store {
+	return &memoryStore{
+		users:      map[string]User{},
+		groups:     map[string]Group{},
+		notices:    map[string]Notice{},
+		templates:  map[string]Template{},
+		jobRuns:    map[string]JobRun{},
+		webhooks:   map[string]GroupWebhook{},
+		deliveries: map[string]WebhookDelivery{},
+		transfers:  map[string]GroupTransfer{},
+		submits:    map[string]Submission{},
+		comments:   map[string]Comment{},
+		uploads:    map[string]Upload{},
+	}
+}
+
+func (s *memoryStore) Users() UserRepository {
+	return memoryUserRepository{s}
+}
+
+func (s *memoryStore) Groups() GroupRepository {
+	return memoryGroupRepository{s}
+}
+
+func (s *memoryStore) Notices() NoticeRepository {
+	return memoryNoticeRepository{s}
+}
+
+func (s *memoryStore) Templates() TemplateRepository {
+	return memoryTemplateRepository{s}
+}
+
+func (s *memoryStore) Feedbacks() FeedbackRepository {
+	return memoryFeedbackRepository{s}
+}
+
+func (s *memoryStore) JobRuns() JobRunRepository {
+	return memoryJobRunRepository{s}
+}
+
+func (s *memoryStore) Webhooks() WebhookRepository {
+	return memoryWebhookRepository{s}
+}
+
+func (s *memoryStore) WebhookDeliveries() WebhookDeliveryRepository {
+	return memoryWebhookDeliveryRepository{s}
+}
+
+func (s *memoryStore) GroupTransfers() GroupTransferRepository {
+	return memoryGroupTransferRepository{s}
+}
+
+func (s *memoryStore) Submissions() SubmissionRepository {
+	return memorySubmissionRepository{s}
+}
+
+func (s *memoryStore) Comments() CommentRepository {
+	return memoryCommentRepository{s}
+}
+
+func (s *memoryStore) Uploads() UploadRepository {
+	return memoryUploadRepository{s}
+}
+
+func (s *memoryStore) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+// RunInTransaction 内存实现每个操作都是原子的, 不支持回滚
+func (s *memoryStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+/****************************************** user ****************************************/
+
+type memoryUserRepository struct {
+	s *memoryStore
+}
+
+func (r memoryUserRepository) FindByUnionid(ctx context.Context, unionid string) (User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	user, ok := r.s.users[unionid]
+	if !ok {
+		return User{}, constant.ErrorNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUserRepository) FindByUnionids(ctx context.Context, unionids []string) ([]User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []User{}
+	for _, unionid := range unionids {
+		if user, ok := r.s.users[unionid]; ok {
+			data = append(data, user)
+		}
+	}
+	return data, nil
+}
+
+func (r memoryUserRepository) FindByOfficialOpenid(ctx context.Context, openid string) (User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, user := range r.s.users {
+		if openid != "" && user.OfficialOpenid == openid {
+			return user, nil
+		}
+	}
+	return User{}, constant.ErrorNotFound
+}
+
+func (r memoryUserRepository) Insert(ctx context.Context, user User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.users[user.Unionid]; ok {
+		return constant.ErrorHasExist
+	}
+	r.s.users[user.Unionid] = user
+	return nil
+}
+
+func (r memoryUserRepository) Update(ctx context.Context, unionid string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	user, ok := r.s.users[unionid]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&user, fields); err != nil {
+		return err
+	}
+	r.s.users[unionid] = user
+	return nil
+}
+
+func (r memoryUserRepository) SetStatus(ctx context.Context, unionid string, from, to int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	user, ok := r.s.users[unionid]
+	if !ok || user.Status != from {
+		return constant.ErrorNotFound
+	}
+	user.Status = to
+	r.s.users[unionid] = user
+	return nil
+}
+
+func (r memoryUserRepository) AddGroup(ctx context.Context, unionids []string, role int, groupID string) error {
+	return r.updateGroup(unionids, role, func(ids []string) []string {
+		return addToSet(ids, groupID)
+	})
+}
+
+func (r memoryUserRepository) RemoveGroup(ctx context.Context, unionids []string, role int, groupID string) error {
+	return r.updateGroup(unionids, role, func(ids []string) []string {
+		return pullAll(ids, groupID)
+	})
+}
+
+func (r memoryUserRepository) updateGroup(unionids []string, role int, update func([]string) []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, unionid := range unionids {
+		user, ok := r.s.users[unionid]
+		if !ok {
+			continue
+		}
+		switch role {
+		case constant.GroupUserStatusOwner:
+			user.OwnGroupIDs = update(user.OwnGroupIDs)
+		case constant.GroupUserStatusManager:
+			user.ManageGroupIDs = update(user.ManageGroupIDs)
+		case constant.GroupUserStatusMember:
+			user.JoinGroupIDs = update(user.JoinGroupIDs)
+		default:
+			return constant.ErrorParamWrong
+		}
+		r.s.users[unionid] = user
+	}
+	return nil
+}
+
+func (r memoryUserRepository) Anonymize(ctx context.Context, unionid, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	user, ok := r.s.users[unionid]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	delete(r.s.users, unionid)
+	r.s.users[anonID] = User{
+		ID:             user.ID,
+		Status:         constant.UserDeleteStatus,
+		Unionid:        anonID,
+		OwnGroupIDs:    []string{},
+		ManageGroupIDs: []string{},
+		JoinGroupIDs:   []string{},
+	}
+	return nil
+}
+
+/****************************************** group ****************************************/
+
+type memoryGroupRepository struct {
+	s *memoryStore
+}
+
+func (r memoryGroupRepository) Insert(ctx context.Context, group Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, g := range r.s.groups {
+		if g.Code == group.Code {
+			return constant.ErrorHasExist
+		}
+	}
+	r.s.groups[group.ID.Hex()] = group
+	return nil
+}
+
+func (r memoryGroupRepository) FindByID(ctx context.Context, id string) (Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	group, ok := r.s.groups[id]
+	if !ok || group.Status < constant.GroupCommonStatus {
+		return Group{}, constant.ErrorNotFound
+	}
+	return group, nil
+}
+
+func (r memoryGroupRepository) FindByCode(ctx context.Context, code string) (Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, group := range r.s.groups {
+		if group.Code == code && group.Status >= constant.GroupCommonStatus {
+			return group, nil
+		}
+	}
+	return Group{}, constant.ErrorNotFound
+}
+
+func (r memoryGroupRepository) SoftDelete(ctx context.Context, id, deletedBy string, deletedAt int64) error {
+	return r.update(id, func(group *Group) error {
+		group.Status = constant.GroupDelStatus
+		group.DeletedAt = deletedAt
+		group.DeletedBy = deletedBy
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) Restore(ctx context.Context, id string) error {
+	return r.update(id, func(group *Group) error {
+		if group.Status != constant.GroupDelStatus {
+			return constant.ErrorNotFound
+		}
+		group.Status = constant.GroupCommonStatus
+		group.DeletedAt = 0
+		group.DeletedBy = ""
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) FindDeletedByID(ctx context.Context, id string) (Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	group, ok := r.s.groups[id]
+	if !ok || group.Status != constant.GroupDelStatus {
+		return Group{}, constant.ErrorNotFound
+	}
+	return group, nil
+}
+
+func (r memoryGroupRepository) FindDeletedByOwner(ctx context.Context, ownerID string, after int64) ([]Group, error) {
+	data := r.filter(func(group Group) bool {
+		return group.OwnerID == ownerID && group.Status == constant.GroupDelStatus && group.DeletedAt >= after
+	})
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].DeletedAt > data[j].DeletedAt
+	})
+	return data, nil
+}
+
+func (r memoryGroupRepository) FindDeletedBefore(ctx context.Context, t int64) ([]Group, error) {
+	return r.filter(func(group Group) bool {
+		return group.Status == constant.GroupDelStatus && group.DeletedAt > 0 && group.DeletedAt < t
+	}), nil
+}
+
+func (r memoryGroupRepository) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delete(r.s.groups, id)
+	return nil
+}
+
+func (r memoryGroupRepository) SetOwner(ctx context.Context, id, ownerID string) error {
+	return r.update(id, func(group *Group) error {
+		group.OwnerID = ownerID
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) AddUsers(ctx context.Context, id string, role int, unionids []string) error {
+	return r.update(id, func(group *Group) error {
+		ids, err := groupUserIDs(group, role)
+		if err != nil {
+			return err
+		}
+		for _, unionid := range unionids {
+			if containString(*ids, unionid) {
+				return constant.ErrorNotFound
+			}
+		}
+		for _, unionid := range unionids {
+			*ids = addToSet(*ids, unionid)
+		}
+		group.PersonNum += len(unionids)
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) RemoveUsers(ctx context.Context, id string, role int, unionids []string) error {
+	return r.update(id, func(group *Group) error {
+		ids, err := groupUserIDs(group, role)
+		if err != nil {
+			return err
+		}
+		for _, unionid := range unionids {
+			if !containString(*ids, unionid) {
+				return constant.ErrorNotFound
+			}
+		}
+		*ids = pullAll(*ids, unionids...)
+		group.PersonNum -= len(unionids)
+		for _, unionid := range unionids {
+			delete(group.UserRoles, unionid)
+		}
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) SetSubgroups(ctx context.Context, id string, subgroups []Subgroup) error {
+	return r.update(id, func(group *Group) error {
+		group.Subgroups = subgroups
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) SetRoles(ctx context.Context, id string, roles []GroupRole, userRoles map[string]string) error {
+	return r.update(id, func(group *Group) error {
+		group.Roles, group.UserRoles = roles, userRoles
+		return nil
+	})
+}
+
+func (r memoryGroupRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, group := range r.s.groups {
+		if group.OwnerID == unionid {
+			group.OwnerID = anonID
+		}
+		if group.DeletedBy == unionid {
+			group.DeletedBy = anonID
+		}
+		if group.Status == constant.GroupDelStatus {
+			group.ManagerIDs = pullAll(group.ManagerIDs, unionid)
+			group.MemberIDs = pullAll(group.MemberIDs, unionid)
+			group.UserRoles = copyUserRoles(group.UserRoles)
+			delete(group.UserRoles, unionid)
+		}
+		subgroups := make([]Subgroup, len(group.Subgroups))
+		for i, subgroup := range group.Subgroups {
+			subgroup.UserIDs = pullAll(subgroup.UserIDs, unionid)
+			subgroups[i] = subgroup
+		}
+		group.Subgroups = subgroups
+		r.s.groups[id] = group
+	}
+	return nil
+}
+
+func (r memoryGroupRepository) update(id string, fn func(group *Group) error) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	group, ok := r.s.groups[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	group.ManagerIDs = append([]string{}, group.ManagerIDs...)
+	group.MemberIDs = append([]string{}, group.MemberIDs...)
+	group.UserRoles = copyUserRoles(group.UserRoles)
+	if err := fn(&group); err != nil {
+		return err
+	}
+	r.s.groups[id] = group
+	return nil
+}
+
+func (r memoryGroupRepository) filter(fn func(group Group) bool) []Group {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Group{}
+	for _, group := range r.s.groups {
+		if fn(group) {
+			data = append(data, group)
+		}
+	}
+	return data
+}
+
+func groupUserIDs(group *Group, role int) (*[]string, error) {
+	switch role {
+	case constant.GroupUserStatusManager:
+		return &group.ManagerIDs, nil
+	case constant.GroupUserStatusMember:
+		return &group.MemberIDs, nil
+	}
+	return nil, constant.ErrorParamWrong
+}
+
+/****************************************** notice ****************************************/
+
+type memoryNoticeRepository struct {
+	s *memoryStore
+}
+
+func (r memoryNoticeRepository) Insert(ctx context.Context, notices ...Notice) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, notice := range notices {
+		r.s.notices[notice.ID.Hex()] = notice
+	}
+	return nil
+}
+
+func (r memoryNoticeRepository) FindByID(ctx context.Context, id string) (Notice, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	notice, ok := r.s.notices[id]
+	if !ok {
+		return Notice{}, constant.ErrorNotFound
+	}
+	return notice, nil
+}
+
+func (r memoryNoticeRepository) FindByIDs(ctx context.Context, ids []string) ([]Notice, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Notice{}
+	for _, id := range ids {
+		if notice, ok := r.s.notices[id]; ok {
+			data = append(data, notice)
+		}
+	}
+	return data, nil
+}
+
+func (r memoryNoticeRepository) FindByGroupIDs(ctx context.Context, groupIDs []string, audience NoticeAudience, page, perPage int) ([]Notice, error) {
+	data := r.filter(func(notice Notice) bool {
+		if notice.Status < constant.NoticeExpireStatus || !audience.canView(notice) {
+			return false
+		}
+		for _, groupID := range noticeGroupIDs(notice) {
+			if containString(groupIDs, groupID) {
+				return true
+			}
+		}
+		return false
+	})
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Status != data[j].Status {
+			return data[i].Status > data[j].Status
+		}
+		return data[i].NoticeTime < data[j].NoticeTime
+	})
+
+	start := (page - 1) * perPage
+	if start < 0 || start >= len(data) {
+		return []Notice{}, nil
+	}
+	end := start + perPage
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[start:end], nil
+}
+
+func (r memoryNoticeRepository) FindPubByNoticeTime(ctx context.Context, start, end int64) ([]Notice, error) {
+	return r.filter(func(notice Notice) bool {
+		return notice.Status >= constant.NoticePubStatus && notice.NoticeTime > start && notice.NoticeTime < end
+	}), nil
+}
+
+func (r memoryNoticeRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	notice, ok := r.s.notices[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&notice, fields); err != nil {
+		return err
+	}
+	r.s.notices[id] = notice
+	return nil
+}
+
+func (r memoryNoticeRepository) AddWatchUser(ctx context.Context, id, unionid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	notice, ok := r.s.notices[id]
+	if !ok || containString(notice.WatchUserIDs, unionid) {
+		return nil
+	}
+	notice.WatchUserIDs = append(append([]string{}, notice.WatchUserIDs...), unionid)
+	notice.WatchNum++
+	r.s.notices[id] = notice
+	return nil
+}
+
+func (r memoryNoticeRepository) ExpireBefore(ctx context.Context, t int64) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	count := 0
+	for id, notice := range r.s.notices {
+		if notice.Status >= constant.NoticePubStatus && notice.NoticeTime < t {
+			notice.Status = constant.NoticeExpireStatus
+			r.s.notices[id] = notice
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r memoryNoticeRepository) FindDeletedByCreator(ctx context.Context, creatorID string, after int64) ([]Notice, error) {
+	data := r.filter(func(notice Notice) bool {
+		return notice.CreatorID == creatorID && notice.Status == constant.NoticeDeleteStatus && notice.DeletedAt >= after
+	})
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].DeletedAt > data[j].DeletedAt
+	})
+	return data, nil
+}
+
+func (r memoryNoticeRepository) FindDeletedBefore(ctx context.Context, t int64) ([]Notice, error) {
+	return r.filter(func(notice Notice) bool {
+		return notice.Status == constant.NoticeDeleteStatus && notice.DeletedAt > 0 && notice.DeletedAt < t
+	}), nil
+}
+
+func (r memoryNoticeRepository) FindAllByGroupID(ctx context.Context, groupID string) ([]Notice, error) {
+	return r.filter(func(notice Notice) bool {
+		return containString(noticeGroupIDs(notice), groupID)
+	}), nil
+}
+
+func (r memoryNoticeRepository) DeleteByIDs(ctx context.Context, ids []string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	count := 0
+	for _, id := range ids {
+		if _, ok := r.s.notices[id]; ok {
+			delete(r.s.notices, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r memoryNoticeRepository) FindByUser(ctx context.Context, unionid string) ([]Notice, error) {
+	return r.filter(func(notice Notice) bool {
+		return notice.CreatorID == unionid || containString(notice.WatchUserIDs, unionid) || containString(notice.LikeUserIDs, unionid)
+	}), nil
+}
+
+func (r memoryNoticeRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, notice := range r.s.notices {
+		if notice.CreatorID == unionid {
+			notice.CreatorID = anonID
+		}
+		if notice.DeletedBy == unionid {
+			notice.DeletedBy = anonID
+		}
+		// 定向通知替换而非移除, 避免接收人清空后变为全员可见
+		targetUserIDs := make([]string, len(notice.TargetUserIDs))
+		for i, targetUserID := range notice.TargetUserIDs {
+			if targetUserID == unionid {
+				targetUserID = anonID
+			}
+			targetUserIDs[i] = targetUserID
+		}
+		notice.TargetUserIDs = targetUserIDs
+		notice.WatchUserIDs = pullAll(notice.WatchUserIDs, unionid)
+		notice.LikeUserIDs = pullAll(notice.LikeUserIDs, unionid)
+		r.s.notices[id] = notice
+	}
+	return nil
+}
+
+func (r memoryNoticeRepository) filter(fn func(notice Notice) bool) []Notice {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Notice{}
+	for _, notice := range r.s.notices {
+		if fn(notice) {
+			data = append(data, notice)
+		}
+	}
+	return data
+}
+
+/****************************************** template ****************************************/
+
+type memoryTemplateRepository struct {
+	s *memoryStore
+}
+
+func (r memoryTemplateRepository) FindByID(ctx context.Context, id string) (Template, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	template, ok := r.s.templates[id]
+	if !ok {
+		return Template{}, constant.ErrorNotFound
+	}
+	return template, nil
+}
+
+func (r memoryTemplateRepository) Insert(ctx context.Context, template Template) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.templates[template.ID.Hex()] = template
+	return nil
+}
+
+func (r memoryTemplateRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	template, ok := r.s.templates[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&template, fields); err != nil {
+		return err
+	}
+	r.s.templates[id] = template
+	return nil
+}
+
+/****************************************** feedback ****************************************/
+
+type memoryFeedbackRepository struct {
+	s *memoryStore
+}
+
+func (r memoryFeedbackRepository) Insert(ctx context.Context, feedback Feedback) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.feedbacks = append(r.s.feedbacks, feedback)
+	return nil
+}
+
+func (r memoryFeedbackRepository) FindByUserID(ctx context.Context, userID string) ([]Feedback, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Feedback{}
+	for i := len(r.s.feedbacks) - 1; i >= 0; i-- {
+		if r.s.feedbacks[i].UserID == userID {
+			data = append(data, r.s.feedbacks[i])
+		}
+	}
+	return data, nil
+}
+
+func (r memoryFeedbackRepository) ReplaceUser(ctx context.Context, userID, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, feedback := range r.s.feedbacks {
+		if feedback.UserID == userID {
+			r.s.feedbacks[i].UserID = anonID
+			r.s.feedbacks[i].ContactWay = ""
+		}
+	}
+	return nil
+}
+
+/****************************************** job run ****************************************/
+
+type memoryJobRunRepository struct {
+	s *memoryStore
+}
+
+func (r memoryJobRunRepository) Insert(ctx context.Context, run JobRun) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.jobRuns[run.ID.Hex()] = run
+	return nil
+}
+
+func (r memoryJobRunRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	run, ok := r.s.jobRuns[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&run, fields); err != nil {
+		return err
+	}
+	r.s.jobRuns[id] = run
+	return nil
+}
+
+func (r memoryJobRunRepository) Find(ctx context.Context, name string, page, perPage int) ([]JobRun, error) {
+	r.s.mu.RLock()
+	data := []JobRun{}
+	for _, run := range r.s.jobRuns {
+		if name == "" || run.Name == name {
+			data = append(data, run)
+		}
+	}
+	r.s.mu.RUnlock()
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].StartTime > data[j].StartTime
+	})
+
+	start := (page - 1) * perPage
+	if start < 0 || start >= len(data) {
+		return []JobRun{}, nil
+	}
+	end := start + perPage
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[start:end], nil
+}
+
+/****************************************** webhook ****************************************/
+
+type memoryWebhookRepository struct {
+	s *memoryStore
+}
+
+func (r memoryWebhookRepository) Insert(ctx context.Context, hook GroupWebhook) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.webhooks[hook.ID.Hex()] = hook
+	return nil
+}
+
+func (r memoryWebhookRepository) FindByID(ctx context.Context, id string) (GroupWebhook, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	hook, ok := r.s.webhooks[id]
+	if !ok || hook.Status != constant.GroupWebhookCommonStatus {
+		return GroupWebhook{}, constant.ErrorNotFound
+	}
+	return hook, nil
+}
+
+func (r memoryWebhookRepository) FindByGroupID(ctx context.Context, groupID string) ([]GroupWebhook, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []GroupWebhook{}
+	for _, hook := range r.s.webhooks {
+		if hook.GroupID == groupID && hook.Status == constant.GroupWebhookCommonStatus {
+			data = append(data, hook)
+		}
+	}
+	return data, nil
+}
+
+func (r memoryWebhookRepository) SetStatus(ctx context.Context, id string, status int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	hook, ok := r.s.webhooks[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	hook.Status = status
+	r.s.webhooks[id] = hook
+	return nil
+}
+
+func (r memoryWebhookRepository) ReplaceCreator(ctx context.Context, unionid, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, hook := range r.s.webhooks {
+		if hook.CreatorID == unionid {
+			hook.CreatorID = anonID
+			r.s.webhooks[id] = hook
+		}
+	}
+	return nil
+}
+
+type memoryWebhookDeliveryRepository struct {
+	s *memoryStore
+}
+
+func (r memoryWebhookDeliveryRepository) Insert(ctx context.Context, delivery WebhookDelivery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.deliveries[delivery.ID.Hex()] = delivery
+	return nil
+}
+
+func (r memoryWebhookDeliveryRepository) FindByID(ctx context.Context, id string) (WebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	delivery, ok := r.s.deliveries[id]
+	if !ok {
+		return WebhookDelivery{}, constant.ErrorNotFound
+	}
+	return delivery, nil
+}
+
+func (r memoryWebhookDeliveryRepository) FindByWebhookID(ctx context.Context, webhookID string, page, perPage int) ([]WebhookDelivery, error) {
+	r.s.mu.RLock()
+	data := []WebhookDelivery{}
+	for _, delivery := range r.s.deliveries {
+		if delivery.WebhookID == webhookID {
+			data = append(data, delivery)
+		}
+	}
+	r.s.mu.RUnlock()
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].CreateTime > data[j].CreateTime
+	})
+
+	start := (page - 1) * perPage
+	if start < 0 || start >= len(data) {
+		return []WebhookDelivery{}, nil
+	}
+	end := start + perPage
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[start:end], nil
+}
+
+func (r memoryWebhookDeliveryRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delivery, ok := r.s.deliveries[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&delivery, fields); err != nil {
+		return err
+	}
+	r.s.deliveries[id] = delivery
+	return nil
+}
+
+/****************************************** group transfer ****************************************/
+
+type memoryGroupTransferRepository struct {
+	s *memoryStore
+}
+
+func (r memoryGroupTransferRepository) Insert(ctx context.Context, transfer GroupTransfer) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if transfer.Status == constant.GroupTransferPendingStatus {
+		for _, t := range r.s.transfers {
+			if t.GroupID == transfer.GroupID && t.Status == constant.GroupTransferPendingStatus {
+				return constant.ErrorHasExist
+			}
+		}
+	}
+	r.s.transfers[transfer.ID.Hex()] = transfer
+	return nil
+}
+
+func (r memoryGroupTransferRepository) FindByID(ctx context.Context, id string) (GroupTransfer, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	transfer, ok := r.s.transfers[id]
+	if !ok {
+		return GroupTransfer{}, constant.ErrorNotFound
+	}
+	return transfer, nil
+}
+
+func (r memoryGroupTransferRepository) FindPending(ctx context.Context, groupID, userID string) ([]GroupTransfer, error) {
+	r.s.mu.RLock()
+	data := []GroupTransfer{}
+	for _, t := range r.s.transfers {
+		if t.Status != constant.GroupTransferPendingStatus {
+			continue
+		}
+		if groupID != "" && t.GroupID != groupID {
+			continue
+		}
+		if userID != "" && t.FromUserID != userID && t.ToUserID != userID {
+			continue
+		}
+		data = append(data, t)
+	}
+	r.s.mu.RUnlock()
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].CreateTime > data[j].CreateTime
+	})
+	return data, nil
+}
+
+func (r memoryGroupTransferRepository) UpdateStatus(ctx context.Context, id string, from, to int, updateTime int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	transfer, ok := r.s.transfers[id]
+	if !ok || transfer.Status != from {
+		return constant.ErrorNotFound
+	}
+	transfer.Status, transfer.UpdateTime = to, updateTime
+	r.s.transfers[id] = transfer
+	return nil
+}
+
+func (r memoryGroupTransferRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, transfer := range r.s.transfers {
+		if transfer.FromUserID == unionid {
+			transfer.FromUserID = anonID
+		}
+		if transfer.ToUserID == unionid {
+			transfer.ToUserID = anonID
+		}
+		r.s.transfers[id] = transfer
+	}
+	return nil
+}
+
+/****************************************** submission ****************************************/
+
+type memorySubmissionRepository struct {
+	s *memoryStore
+}
+
+func (r memorySubmissionRepository) Insert(ctx context.Context, submission Submission) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, sub := range r.s.submits {
+		if sub.NoticeID == submission.NoticeID && sub.UserID == submission.UserID {
+			return constant.ErrorHasExist
+		}
+	}
+	r.s.submits[submission.ID.Hex()] = submission
+	return nil
+}
+
+func (r memorySubmissionRepository) FindByID(ctx context.Context, id string) (Submission, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	submission, ok := r.s.submits[id]
+	if !ok {
+		return Submission{}, constant.ErrorNotFound
+	}
+	return submission, nil
+}
+
+func (r memorySubmissionRepository) FindByNoticeID(ctx context.Context, noticeID string) ([]Submission, error) {
+	data := r.filter(func(submission Submission) bool {
+		return submission.NoticeID == noticeID
+	})
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].UpdateTime > data[j].UpdateTime
+	})
+	return data, nil
+}
+
+func (r memorySubmissionRepository) FindByUser(ctx context.Context, userID string) ([]Submission, error) {
+	return r.filter(func(submission Submission) bool {
+		return submission.UserID == userID
+	}), nil
+}
+
+func (r memorySubmissionRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	submission, ok := r.s.submits[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&submission, fields); err != nil {
+		return err
+	}
+	r.s.submits[id] = submission
+	return nil
+}
+
+func (r memorySubmissionRepository) DeleteByNoticeIDs(ctx context.Context, noticeIDs []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, submission := range r.s.submits {
+		if containString(noticeIDs, submission.NoticeID) {
+			delete(r.s.submits, id)
+		}
+	}
+	return nil
+}
+
+func (r memorySubmissionRepository) DeleteByUser(ctx context.Context, userID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, submission := range r.s.submits {
+		if submission.UserID == userID {
+			delete(r.s.submits, id)
+		}
+	}
+	return nil
+}
+
+func (r memorySubmissionRepository) filter(fn func(submission Submission) bool) []Submission {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Submission{}
+	for _, submission := range r.s.submits {
+		if fn(submission) {
+			data = append(data, submission)
+		}
+	}
+	return data
+}
+
+/****************************************** comment ****************************************/
+
+type memoryCommentRepository struct {
+	s *memoryStore
+}
+
+func (r memoryCommentRepository) Insert(ctx context.Context, comment Comment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.comments[comment.ID.Hex()] = comment
+	return nil
+}
+
+func (r memoryCommentRepository) FindByID(ctx context.Context, id string) (Comment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	comment, ok := r.s.comments[id]
+	if !ok {
+		return Comment{}, constant.ErrorNotFound
+	}
+	return comment, nil
+}
+
+func (r memoryCommentRepository) FindByParent(ctx context.Context, noticeID, parentID, after string, limit int) ([]Comment, error) {
+	// ObjectID 的十六进制字符串与其字节序一致
+	data := r.filter(func(comment Comment) bool {
+		return comment.NoticeID == noticeID && comment.ParentID == parentID &&
+			comment.Status == constant.CommentCommonStatus && comment.ID.Hex() > after
+	})
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].ID.Hex() < data[j].ID.Hex()
+	})
+	if limit > 0 && len(data) > limit {
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+func (r memoryCommentRepository) CountByParent(ctx context.Context, noticeID, parentID string) (int, error) {
+	data := r.filter(func(comment Comment) bool {
+		return comment.NoticeID == noticeID && comment.ParentID == parentID && comment.Status == constant.CommentCommonStatus
+	})
+	return len(data), nil
+}
+
+func (r memoryCommentRepository) FindByUser(ctx context.Context, userID string) ([]Comment, error) {
+	return r.filter(func(comment Comment) bool {
+		return comment.UserID == userID
+	}), nil
+}
+
+func (r memoryCommentRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	comment, ok := r.s.comments[id]
+	if !ok {
+		return constant.ErrorNotFound
+	}
+	if err := applyFields(&comment, fields); err != nil {
+		return err
+	}
+	r.s.comments[id] = comment
+	return nil
+}
+
+func (r memoryCommentRepository) DeleteByNoticeIDs(ctx context.Context, noticeIDs []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, comment := range r.s.comments {
+		if containString(noticeIDs, comment.NoticeID) {
+			delete(r.s.comments, id)
+		}
+	}
+	return nil
+}
+
+func (r memoryCommentRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, comment := range r.s.comments {
+		if comment.UserID == unionid {
+			comment.UserID, comment.Status, comment.Content = anonID, constant.CommentDeleteStatus, ""
+		}
+		if comment.ReplyToUserID == unionid {
+			comment.ReplyToUserID = anonID
+		}
+		mentionUserIDs := make([]string, len(comment.MentionUserIDs))
+		for i, mentionUserID := range comment.MentionUserIDs {
+			if mentionUserID == unionid {
+				mentionUserID = anonID
+			}
+			mentionUserIDs[i] = mentionUserID
+		}
+		comment.MentionUserIDs = mentionUserIDs
+		r.s.comments[id] = comment
+	}
+	return nil
+}
+
+func (r memoryCommentRepository) filter(fn func(comment Comment) bool) []Comment {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Comment{}
+	for _, comment := range r.s.comments {
+		if fn(comment) {
+			data = append(data, comment)
+		}
+	}
+	return data
+}
+
+/****************************************** memory basic action ****************************************/
+
+// applyFields 按 bson 字段名将 fields 写入 doc, 与 mongo 的 $set 语义一致
+func applyFields(doc interface{}, fields map[string]interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	data := bson.M{}
+	if err = bson.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		data[key] = value
+	}
+	if raw, err = bson.Marshal(data); err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, doc)
+}
+
+func copyUserRoles(userRoles map[string]string) map[string]string {
+	if userRoles == nil {
+		return nil
+	}
+	res := make(map[string]string, len(userRoles))
+	for k, v := range userRoles {
+		res[k] = v
+	}
+	return res
+}
+
+func containString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func addToSet(list []string, s string) []string {
+	if containString(list, s) {
+		return list
+	}
+	return append(append([]string{}, list...), s)
+}
+
+func pullAll(list []string, values ...string) []string {
+	res := []string{}
+	for _, v := range list {
+		if !containString(values, v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+/****************************************** upload ****************************************/
+
+type memoryUploadRepository struct {
+	s *memoryStore
+}
+
+func (r memoryUploadRepository) Upsert(ctx context.Context, upload Upload) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.uploads[upload.Key] = upload
+	return nil
+}
+
+func (r memoryUploadRepository) FindByKeys(ctx context.Context, keys []string) ([]Upload, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	data := []Upload{}
+	for _, key := range keys {
+		if upload, ok := r.s.uploads[key]; ok {
+			data = append(data, upload)
+		}
+	}
+	return data, nil
+}
+
+func (r memoryUploadRepository) DeleteByOwner(ctx context.Context, ownerID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for key, upload := range r.s.uploads {
+		if upload.OwnerID == ownerID {
+			delete(r.s.uploads, key)
+		}
+	}
+	return nil
+}
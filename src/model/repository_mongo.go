@@ -0,0 +1,1280 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"model/db"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// 用户文档中各身份对应的群组字段
+	userGroupFields = map[int]string{
+		constant.GroupUserStatusOwner:   "ownGroupIDs",
+		constant.GroupUserStatusManager: "manageGroupIDs",
+		constant.GroupUserStatusMember:  "joinGroupIDs",
+	}
+	// 群组文档中各身份对应的用户字段, 创建者单独存储于 ownerID
+	groupUserFields = map[int]string{
+		constant.GroupUserStatusManager: "managerIDs",
+		constant.GroupUserStatusMember:  "memberIDs",
+	}
+)
+
+type mongoStore struct{}
+
+// NewMongoStore 基于官方 mongo-go-driver 的持久化实现
+func NewMongoStore() Store {
+	return mongoStore{}
+}
+
+func (mongoStore) Users() UserRepository {
+	return mongoUserRepository{table: db.GetTable(constant.TableUser)}
+}
+
+func (mongoStore) Groups() GroupRepository {
+	return mongoGroupRepository{table: db.GetTable(constant.TableGroup)}
+}
+
+func (mongoStore) Notices() NoticeRepository {
+	return mongoNoticeRepository{table: db.GetTable(constant.TableNotice)}
+}
+
+func (mongoStore) Templates() TemplateRepository {
+	return mongoTemplateRepository{table: db.GetTable(constant.TableTemplate)}
+}
+
+func (mongoStore) Feedbacks() FeedbackRepository {
+	return mongoFeedbackRepository{table: db.GetTable(constant.TableFeedback)}
+}
+
+func (mongoStore) JobRuns() JobRunRepository {
+	return mongoJobRunRepository{table: db.GetTable(constant.TableJobRun)}
+}
+
+func (mongoStore) Webhooks() WebhookRepository {
+	return mongoWebhookRepository{table: db.GetTable(constant.TableGroupWebhook)}
+}
+
+func (mongoStore) WebhookDeliveries() WebhookDeliveryRepository {
+	return mongoWebhookDeliveryRepository{table: db.GetTable(constant.TableWebhookDelivery)}
+}
+
+func (mongoStore) GroupTransfers() GroupTransferRepository {
+	return mongoGroupTransferRepository{table: db.GetTable(constant.TableGroupTransfer)}
+}
+
+func (mongoStore) Submissions() SubmissionRepository {
+	return mongoSubmissionRepository{table: db.GetTable(constant.TableSubmission)}
+}
+
+func (mongoStore) Comments() CommentRepository {
+	return mongoCommentRepository{table: db.GetTable(constant.TableComment)}
+}
+
+func (mongoStore) Uploads() UploadRepository {
+	return mongoUploadRepository{table: db.GetTable(constant.TableUpload)}
+}
+
+func (mongoStore) EnsureIndexes(ctx context.Context) error {
+	indexes := map[string][]mongo.IndexModel{
+		constant.TableGroup: {
+			// 邀请码唯一, 重复时 CreateGroup 重新生成
+			{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		constant.TableUser: {
+			// 公众号取关事件只有 openid
+			{Keys: bson.D{{Key: "officialOpenid", Value: 1}}},
+		},
+		constant.TableNotice: {
+			// 每日、每周提醒和过期通知按状态和提醒时间查询
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "noticeTime", Value: 1}}},
+			{Keys: bson.D{{Key: "groupID", Value: 1}, {Key: "status", Value: -1}, {Key: "noticeTime", Value: 1}}},
+			{Keys: bson.D{{Key: "groupIDs", Value: 1}, {Key: "status", Value: -1}, {Key: "noticeTime", Value: 1}}},
+		},
+		constant.TableJobRun: {
+			{Keys: bson.D{{Key: "name", Value: 1}, {Key: "startTime", Value: -1}}},
+		},
+		constant.TableGroupWebhook: {
+			{Keys: bson.D{{Key: "groupID", Value: 1}, {Key: "status", Value: 1}}},
+		},
+		constant.TableWebhookDelivery: {
+			{Keys: bson.D{{Key: "webhookID", Value: 1}, {Key: "createTime", Value: -1}}},
+		},
+		constant.TableGroupTransfer: {
+			// 每个群组只能有一个待处理的转让
+			{
+				Keys: bson.D{{Key: "groupID", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"status": constant.GroupTransferPendingStatus}),
+			},
+			{Keys: bson.D{{Key: "fromUserID", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "toUserID", Value: 1}, {Key: "status", Value: 1}}},
+		},
+		constant.TableSubmission: {
+			// 每个用户对每条通知只能有一个提交
+			{Keys: bson.D{{Key: "noticeID", Value: 1}, {Key: "userID", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "userID", Value: 1}}},
+		},
+		constant.TableComment: {
+			// 评论按 _id 顺序分页
+			{Keys: bson.D{{Key: "noticeID", Value: 1}, {Key: "parentID", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "userID", Value: 1}}},
+		},
+		constant.TableUpload: {
+			{Keys: bson.D{{Key: "ownerID", Value: 1}}},
+		},
+	}
+	for table, models := range indexes {
+		if _, err := db.GetTable(table).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return backfillDeletedAt(ctx)
+}
+
+// backfillDeletedAt 回收站之前解散的群组和删除的通知没有 deletedAt, 以当前时间补全
+// 否则第一次清理回收站时会被直接彻底删除, 补全后同样保留 config.Trash.RetentionDays 天
+func backfillDeletedAt(ctx context.Context) error {
+	now := util.GetNowTimestamp()
+	statuses := map[string]int{
+		constant.TableGroup:  constant.GroupDelStatus,
+		constant.TableNotice: constant.NoticeDeleteStatus,
+	}
+	for table, status := range statuses {
+		query := bson.M{
+			"status":    status,
+			"deletedAt": bson.M{"$in": bson.A{nil, 0}},
+		}
+		update := bson.M{"$set": bson.M{"deletedAt": now}}
+		if _, err := db.GetTable(table).UpdateMany(ctx, query, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mongoStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.WithTransaction(ctx, fn)
+}
+
+/****************************************** user ****************************************/
+
+type mongoUserRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoUserRepository) FindByUnionid(ctx context.Context, unionid string) (User, error) {
+	data := User{}
+	err := findOne(ctx, r.table, bson.M{"unionid": unionid}, &data)
+	return data, err
+}
+
+func (r mongoUserRepository) FindByUnionids(ctx context.Context, unionids []string) ([]User, error) {
+	data := []User{}
+	query := bson.M{
+		"unionid": bson.M{
+			"$in": unionids,
+		},
+	}
+	err := findAll(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoUserRepository) FindByOfficialOpenid(ctx context.Context, openid string) (User, error) {
+	data := User{}
+	err := findOne(ctx, r.table, bson.M{"officialOpenid": openid}, &data)
+	return data, err
+}
+
+func (r mongoUserRepository) Insert(ctx context.Context, user User) error {
+	_, err := r.table.InsertOne(ctx, user)
+	return err
+}
+
+func (r mongoUserRepository) Update(ctx context.Context, unionid string, fields map[string]interface{}) error {
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"unionid": unionid}, update)
+}
+
+func (r mongoUserRepository) SetStatus(ctx context.Context, unionid string, from, to int) error {
+	query := bson.M{
+		"unionid": unionid,
+		"status":  from,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status": to,
+		},
+	}
+	return updateOne(ctx, r.table, query, update)
+}
+
+func (r mongoUserRepository) AddGroup(ctx context.Context, unionids []string, role int, groupID string) error {
+	return r.updateGroup(ctx, unionids, role, "$addToSet", groupID)
+}
+
+func (r mongoUserRepository) RemoveGroup(ctx context.Context, unionids []string, role int, groupID string) error {
+	return r.updateGroup(ctx, unionids, role, "$pull", groupID)
+}
+
+func (r mongoUserRepository) Anonymize(ctx context.Context, unionid, anonID string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":         constant.UserDeleteStatus,
+			"unionid":        anonID,
+			"openid":         "",
+			"officialOpenid": "",
+			"nickname":       "",
+			"gender":         0,
+			"province":       "",
+			"city":           "",
+			"country":        "",
+			"avatarUrl":      "",
+			"language":       "",
+			"ownGroupIDs":    []string{},
+			"manageGroupIDs": []string{},
+			"joinGroupIDs":   []string{},
+		},
+		"$unset": bson.M{
+			"notificationSettings": "",
+		},
+	}
+	return updateOne(ctx, r.table, bson.M{"unionid": unionid}, update)
+}
+
+func (r mongoUserRepository) updateGroup(ctx context.Context, unionids []string, role int, op, groupID string) error {
+	field, ok := userGroupFields[role]
+	if !ok {
+		return constant.ErrorParamWrong
+	}
+	if len(unionids) == 0 {
+		return nil
+	}
+	query := bson.M{
+		"unionid": bson.M{
+			"$in": unionids,
+		},
+	}
+	update := bson.M{
+		op: bson.M{
+			field: groupID,
+		},
+	}
+	_, err := r.table.UpdateMany(ctx, query, update)
+	return err
+}
+
+/****************************************** group ****************************************/
+
+type mongoGroupRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoGroupRepository) Insert(ctx context.Context, group Group) error {
+	_, err := r.table.InsertOne(ctx, group)
+	if isDuplicateKeyError(err) {
+		return constant.ErrorHasExist
+	}
+	return err
+}
+
+func (r mongoGroupRepository) FindByID(ctx context.Context, id string) (Group, error) {
+	data := Group{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	query := bson.M{
+		"_id": oid,
+		"status": bson.M{
+			"$gte": constant.GroupCommonStatus,
+		},
+	}
+	err = findOne(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoGroupRepository) FindByCode(ctx context.Context, code string) (Group, error) {
+	data := Group{}
+	query := bson.M{
+		"code": code,
+		"status": bson.M{
+			"$gte": constant.GroupCommonStatus,
+		},
+	}
+	err := findOne(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoGroupRepository) SoftDelete(ctx context.Context, id, deletedBy string, deletedAt int64) error {
+	return r.set(ctx, id, bson.M{
+		"status":    constant.GroupDelStatus,
+		"deletedAt": deletedAt,
+		"deletedBy": deletedBy,
+	})
+}
+
+func (r mongoGroupRepository) Restore(ctx context.Context, id string) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{
+		"_id":    oid,
+		"status": constant.GroupDelStatus,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status": constant.GroupCommonStatus,
+		},
+		"$unset": bson.M{
+			"deletedAt": "",
+			"deletedBy": "",
+		},
+	}
+	return updateOne(ctx, r.table, query, update)
+}
+
+func (r mongoGroupRepository) FindDeletedByID(ctx context.Context, id string) (Group, error) {
+	data := Group{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	query := bson.M{
+		"_id":    oid,
+		"status": constant.GroupDelStatus,
+	}
+	err = findOne(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoGroupRepository) FindDeletedByOwner(ctx context.Context, ownerID string, after int64) ([]Group, error) {
+	data := []Group{}
+	query := bson.M{
+		"ownerID": ownerID,
+		"status":  constant.GroupDelStatus,
+		"deletedAt": bson.M{
+			"$gte": after,
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoGroupRepository) FindDeletedBefore(ctx context.Context, t int64) ([]Group, error) {
+	data := []Group{}
+	// 回收站之前删除的数据由 backfillDeletedAt 补全 deletedAt, 从补全时开始计算保留时间
+	query := bson.M{
+		"status":    constant.GroupDelStatus,
+		"deletedAt": bson.M{"$gt": 0, "$lt": t},
+	}
+	err := findAll(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoGroupRepository) Delete(ctx context.Context, id string) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.table.DeleteOne(ctx, bson.M{"_id": oid})
+	return err
+}
+
+func (r mongoGroupRepository) SetOwner(ctx context.Context, id, ownerID string) error {
+	return r.set(ctx, id, bson.M{"ownerID": ownerID})
+}
+
+func (r mongoGroupRepository) AddUsers(ctx context.Context, id string, role int, unionids []string) error {
+	field, ok := groupUserFields[role]
+	if !ok {
+		return constant.ErrorParamWrong
+	}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{
+		"_id": oid,
+		field: bson.M{
+			"$nin": unionids,
+		},
+	}
+	update := bson.M{
+		"$addToSet": bson.M{
+			field: bson.M{
+				"$each": unionids,
+			},
+		},
+		"$inc": bson.M{
+			"personNum": len(unionids),
+		},
+	}
+	return updateOne(ctx, r.table, query, update)
+}
+
+func (r mongoGroupRepository) RemoveUsers(ctx context.Context, id string, role int, unionids []string) error {
+	field, ok := groupUserFields[role]
+	if !ok {
+		return constant.ErrorParamWrong
+	}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{
+		"_id": oid,
+		field: bson.M{
+			"$all": unionids,
+		},
+	}
+	update := bson.M{
+		"$pullAll": bson.M{
+			field: unionids,
+		},
+		"$inc": bson.M{
+			"personNum": -len(unionids),
+		},
+	}
+	if len(unionids) > 0 {
+		unset := bson.M{}
+		for _, unionid := range unionids {
+			unset["userRoles."+unionid] = ""
+		}
+		update["$unset"] = unset
+	}
+	return updateOne(ctx, r.table, query, update)
+}
+
+func (r mongoGroupRepository) SetSubgroups(ctx context.Context, id string, subgroups []Subgroup) error {
+	return r.set(ctx, id, bson.M{"subgroups": subgroups})
+}
+
+func (r mongoGroupRepository) SetRoles(ctx context.Context, id string, roles []GroupRole, userRoles map[string]string) error {
+	return r.set(ctx, id, bson.M{"roles": roles, "userRoles": userRoles})
+}
+
+func (r mongoGroupRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	replaces := []struct {
+		query  bson.M
+		update bson.M
+	}{
+		{bson.M{"ownerID": unionid}, bson.M{"$set": bson.M{"ownerID": anonID}}},
+		{bson.M{"deletedBy": unionid}, bson.M{"$set": bson.M{"deletedBy": anonID}}},
+		{
+			bson.M{"status": constant.GroupDelStatus, "$or": bson.A{bson.M{"managerIDs": unionid}, bson.M{"memberIDs": unionid}}},
+			bson.M{
+				"$pull":  bson.M{"managerIDs": unionid, "memberIDs": unionid},
+				"$unset": bson.M{"userRoles." + unionid: ""},
+			},
+		},
+		{bson.M{"subgroups.userIDs": unionid}, bson.M{"$pull": bson.M{"subgroups.$[].userIDs": unionid}}},
+	}
+	for _, replace := range replaces {
+		if _, err := r.table.UpdateMany(ctx, replace.query, replace.update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r mongoGroupRepository) set(ctx context.Context, id string, fields bson.M) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+/****************************************** notice ****************************************/
+
+type mongoNoticeRepository struct {
+	table *mongo.Collection
+}
+
+// 列表查询不返回查看和点赞用户
+var noticeListProjection = bson.M{
+	"watchUserIDs": 0,
+	"likeUserIDs":  0,
+}
+
+func (r mongoNoticeRepository) Insert(ctx context.Context, notices ...Notice) error {
+	if len(notices) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(notices))
+	for i, notice := range notices {
+		docs[i] = notice
+	}
+	_, err := r.table.InsertMany(ctx, docs)
+	return err
+}
+
+func (r mongoNoticeRepository) FindByID(ctx context.Context, id string) (Notice, error) {
+	data := Notice{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	err = findOne(ctx, r.table, bson.M{"_id": oid}, &data)
+	return data, err
+}
+
+func (r mongoNoticeRepository) FindByIDs(ctx context.Context, ids []string) ([]Notice, error) {
+	data := []Notice{}
+	oids, err := toObjectIDs(ids)
+	if err != nil {
+		return data, err
+	}
+	query := bson.M{
+		"_id": bson.M{
+			"$in": oids,
+		},
+	}
+	opts := options.Find().SetProjection(noticeListProjection)
+	err = findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoNoticeRepository) FindByGroupIDs(ctx context.Context, groupIDs []string, audience NoticeAudience, page, perPage int) ([]Notice, error) {
+	data := []Notice{}
+	query := bson.M{
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"groupID": bson.M{"$in": groupIDs}},
+				bson.M{"groupIDs": bson.M{"$in": groupIDs}},
+			}},
+			bson.M{"$or": bson.A{
+				// 没有指定接收人和分组: 字段不存在、为 null 或空数组
+				bson.M{"targetUserIDs.0": bson.M{"$exists": false}, "subgroupIDs.0": bson.M{"$exists": false}},
+				bson.M{"creatorID": audience.UserID},
+				bson.M{"targetUserIDs": audience.UserID},
+				bson.M{"subgroupIDs": bson.M{"$in": audience.SubgroupIDs}},
+				bson.M{"groupID": bson.M{"$in": audience.ManageGroupIDs}},
+				bson.M{"groupIDs": bson.M{"$in": audience.ManageGroupIDs}},
+			}},
+		},
+		"status": bson.M{
+			"$gte": constant.NoticeExpireStatus,
+		},
+	}
+	opts := options.Find().
+		SetProjection(noticeListProjection).
+		SetSort(bson.D{{Key: "status", Value: -1}, {Key: "noticeTime", Value: 1}}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoNoticeRepository) FindPubByNoticeTime(ctx context.Context, start, end int64) ([]Notice, error) {
+	data := []Notice{}
+	query := bson.M{
+		"status": bson.M{
+			"$gte": constant.NoticePubStatus,
+		},
+		"noticeTime": bson.M{
+			"$gt": start,
+			"$lt": end,
+		},
+	}
+	opts := options.Find().SetProjection(noticeListProjection)
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoNoticeRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+func (r mongoNoticeRepository) AddWatchUser(ctx context.Context, id, unionid string) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{
+		"_id": oid,
+		"watchUserIDs": bson.M{
+			"$ne": unionid,
+		},
+	}
+	update := bson.M{
+		"$addToSet": bson.M{
+			"watchUserIDs": unionid,
+		},
+		"$inc": bson.M{
+			"watchNum": 1,
+		},
+	}
+	_, err = r.table.UpdateOne(ctx, query, update)
+	return err
+}
+
+func (r mongoNoticeRepository) ExpireBefore(ctx context.Context, t int64) (int, error) {
+	query := bson.M{
+		"status": bson.M{
+			"$gte": constant.NoticePubStatus,
+		},
+		"noticeTime": bson.M{
+			"$lt": t,
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status": constant.NoticeExpireStatus,
+		},
+	}
+	res, err := r.table.UpdateMany(ctx, query, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (r mongoNoticeRepository) FindDeletedByCreator(ctx context.Context, creatorID string, after int64) ([]Notice, error) {
+	data := []Notice{}
+	query := bson.M{
+		"creatorID": creatorID,
+		"status":    constant.NoticeDeleteStatus,
+		"deletedAt": bson.M{
+			"$gte": after,
+		},
+	}
+	opts := options.Find().
+		SetProjection(noticeListProjection).
+		SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoNoticeRepository) FindDeletedBefore(ctx context.Context, t int64) ([]Notice, error) {
+	data := []Notice{}
+	// 回收站之前删除的数据由 backfillDeletedAt 补全 deletedAt, 从补全时开始计算保留时间
+	query := bson.M{
+		"status":    constant.NoticeDeleteStatus,
+		"deletedAt": bson.M{"$gt": 0, "$lt": t},
+	}
+	opts := options.Find().SetProjection(noticeListProjection)
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoNoticeRepository) FindAllByGroupID(ctx context.Context, groupID string) ([]Notice, error) {
+	data := []Notice{}
+	opts := options.Find().SetProjection(noticeListProjection)
+	query := bson.M{
+		"$or": bson.A{
+			bson.M{"groupID": groupID},
+			bson.M{"groupIDs": groupID},
+		},
+	}
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoNoticeRepository) DeleteByIDs(ctx context.Context, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	oids, err := toObjectIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+	query := bson.M{
+		"_id": bson.M{
+			"$in": oids,
+		},
+	}
+	res, err := r.table.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (r mongoNoticeRepository) FindByUser(ctx context.Context, unionid string) ([]Notice, error) {
+	data := []Notice{}
+	query := bson.M{
+		"$or": bson.A{
+			bson.M{"creatorID": unionid},
+			bson.M{"watchUserIDs": unionid},
+			bson.M{"likeUserIDs": unionid},
+		},
+	}
+	err := findAll(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoNoticeRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	replaces := []struct {
+		query  bson.M
+		update bson.M
+	}{
+		{bson.M{"creatorID": unionid}, bson.M{"$set": bson.M{"creatorID": anonID}}},
+		{bson.M{"deletedBy": unionid}, bson.M{"$set": bson.M{"deletedBy": anonID}}},
+		{bson.M{"targetUserIDs": unionid}, bson.M{"$set": bson.M{"targetUserIDs.$": anonID}}},
+		{
+			bson.M{"$or": bson.A{bson.M{"watchUserIDs": unionid}, bson.M{"likeUserIDs": unionid}}},
+			bson.M{"$pull": bson.M{"watchUserIDs": unionid, "likeUserIDs": unionid}},
+		},
+	}
+	for _, replace := range replaces {
+		if _, err := r.table.UpdateMany(ctx, replace.query, replace.update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/****************************************** template ****************************************/
+
+type mongoTemplateRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoTemplateRepository) FindByID(ctx context.Context, id string) (Template, error) {
+	data := Template{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	err = findOne(ctx, r.table, bson.M{"_id": oid}, &data)
+	return data, err
+}
+
+func (r mongoTemplateRepository) Insert(ctx context.Context, template Template) error {
+	_, err := r.table.InsertOne(ctx, template)
+	return err
+}
+
+func (r mongoTemplateRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+/****************************************** feedback ****************************************/
+
+type mongoFeedbackRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoFeedbackRepository) Insert(ctx context.Context, feedback Feedback) error {
+	_, err := r.table.InsertOne(ctx, feedback)
+	return err
+}
+
+func (r mongoFeedbackRepository) FindByUserID(ctx context.Context, userID string) ([]Feedback, error) {
+	data := []Feedback{}
+	opts := options.Find().SetSort(bson.D{{Key: "createTime", Value: -1}})
+	err := findAll(ctx, r.table, bson.M{"userID": userID}, &data, opts)
+	return data, err
+}
+
+func (r mongoFeedbackRepository) ReplaceUser(ctx context.Context, userID, anonID string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"userID":     anonID,
+			"contactWay": "",
+		},
+	}
+	_, err := r.table.UpdateMany(ctx, bson.M{"userID": userID}, update)
+	return err
+}
+
+/****************************************** job run ****************************************/
+
+type mongoJobRunRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoJobRunRepository) Insert(ctx context.Context, run JobRun) error {
+	_, err := r.table.InsertOne(ctx, run)
+	return err
+}
+
+func (r mongoJobRunRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+func (r mongoJobRunRepository) Find(ctx context.Context, name string, page, perPage int) ([]JobRun, error) {
+	data := []JobRun{}
+	query := bson.M{}
+	if name != "" {
+		query["name"] = name
+	}
+	opts := options.Find().
+		SetSort(bson.M{"startTime": -1}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+/****************************************** webhook ****************************************/
+
+type mongoWebhookRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoWebhookRepository) Insert(ctx context.Context, hook GroupWebhook) error {
+	_, err := r.table.InsertOne(ctx, hook)
+	return err
+}
+
+func (r mongoWebhookRepository) FindByID(ctx context.Context, id string) (GroupWebhook, error) {
+	data := GroupWebhook{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	query := bson.M{
+		"_id":    oid,
+		"status": constant.GroupWebhookCommonStatus,
+	}
+	err = findOne(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoWebhookRepository) FindByGroupID(ctx context.Context, groupID string) ([]GroupWebhook, error) {
+	data := []GroupWebhook{}
+	query := bson.M{
+		"groupID": groupID,
+		"status":  constant.GroupWebhookCommonStatus,
+	}
+	err := findAll(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoWebhookRepository) SetStatus(ctx context.Context, id string, status int) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status": status,
+		},
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+func (r mongoWebhookRepository) ReplaceCreator(ctx context.Context, unionid, anonID string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"creatorID": anonID,
+		},
+	}
+	_, err := r.table.UpdateMany(ctx, bson.M{"creatorID": unionid}, update)
+	return err
+}
+
+type mongoWebhookDeliveryRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoWebhookDeliveryRepository) Insert(ctx context.Context, delivery WebhookDelivery) error {
+	_, err := r.table.InsertOne(ctx, delivery)
+	return err
+}
+
+func (r mongoWebhookDeliveryRepository) FindByID(ctx context.Context, id string) (WebhookDelivery, error) {
+	data := WebhookDelivery{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	err = findOne(ctx, r.table, bson.M{"_id": oid}, &data)
+	return data, err
+}
+
+func (r mongoWebhookDeliveryRepository) FindByWebhookID(ctx context.Context, webhookID string, page, perPage int) ([]WebhookDelivery, error) {
+	data := []WebhookDelivery{}
+	opts := options.Find().
+		SetSort(bson.M{"createTime": -1}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+	err := findAll(ctx, r.table, bson.M{"webhookID": webhookID}, &data, opts)
+	return data, err
+}
+
+func (r mongoWebhookDeliveryRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+/****************************************** group transfer ****************************************/
+
+type mongoGroupTransferRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoGroupTransferRepository) Insert(ctx context.Context, transfer GroupTransfer) error {
+	_, err := r.table.InsertOne(ctx, transfer)
+	if isDuplicateKeyError(err) {
+		return constant.ErrorHasExist
+	}
+	return err
+}
+
+func (r mongoGroupTransferRepository) FindByID(ctx context.Context, id string) (GroupTransfer, error) {
+	data := GroupTransfer{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	err = findOne(ctx, r.table, bson.M{"_id": oid}, &data)
+	return data, err
+}
+
+func (r mongoGroupTransferRepository) FindPending(ctx context.Context, groupID, userID string) ([]GroupTransfer, error) {
+	data := []GroupTransfer{}
+	query := bson.M{
+		"status": constant.GroupTransferPendingStatus,
+	}
+	if groupID != "" {
+		query["groupID"] = groupID
+	}
+	if userID != "" {
+		query["$or"] = []bson.M{
+			{"fromUserID": userID},
+			{"toUserID": userID},
+		}
+	}
+	opts := options.Find().SetSort(bson.M{"createTime": -1})
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoGroupTransferRepository) UpdateStatus(ctx context.Context, id string, from, to int, updateTime int64) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{
+		"_id":    oid,
+		"status": from,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     to,
+			"updateTime": updateTime,
+		},
+	}
+	return updateOne(ctx, r.table, query, update)
+}
+
+func (r mongoGroupTransferRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	for _, field := range []string{"fromUserID", "toUserID"} {
+		update := bson.M{
+			"$set": bson.M{
+				field: anonID,
+			},
+		}
+		if _, err := r.table.UpdateMany(ctx, bson.M{field: unionid}, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/****************************************** submission ****************************************/
+
+type mongoSubmissionRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoSubmissionRepository) Insert(ctx context.Context, submission Submission) error {
+	_, err := r.table.InsertOne(ctx, submission)
+	if isDuplicateKeyError(err) {
+		return constant.ErrorHasExist
+	}
+	return err
+}
+
+func (r mongoSubmissionRepository) FindByID(ctx context.Context, id string) (Submission, error) {
+	data := Submission{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	err = findOne(ctx, r.table, bson.M{"_id": oid}, &data)
+	return data, err
+}
+
+func (r mongoSubmissionRepository) FindByNoticeID(ctx context.Context, noticeID string) ([]Submission, error) {
+	data := []Submission{}
+	opts := options.Find().SetSort(bson.M{"updateTime": -1})
+	err := findAll(ctx, r.table, bson.M{"noticeID": noticeID}, &data, opts)
+	return data, err
+}
+
+func (r mongoSubmissionRepository) FindByUser(ctx context.Context, userID string) ([]Submission, error) {
+	data := []Submission{}
+	err := findAll(ctx, r.table, bson.M{"userID": userID}, &data)
+	return data, err
+}
+
+func (r mongoSubmissionRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+func (r mongoSubmissionRepository) DeleteByNoticeIDs(ctx context.Context, noticeIDs []string) error {
+	if len(noticeIDs) == 0 {
+		return nil
+	}
+	query := bson.M{
+		"noticeID": bson.M{
+			"$in": noticeIDs,
+		},
+	}
+	_, err := r.table.DeleteMany(ctx, query)
+	return err
+}
+
+func (r mongoSubmissionRepository) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := r.table.DeleteMany(ctx, bson.M{"userID": userID})
+	return err
+}
+
+/****************************************** comment ****************************************/
+
+type mongoCommentRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoCommentRepository) Insert(ctx context.Context, comment Comment) error {
+	_, err := r.table.InsertOne(ctx, comment)
+	return err
+}
+
+func (r mongoCommentRepository) FindByID(ctx context.Context, id string) (Comment, error) {
+	data := Comment{}
+	oid, err := toObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	err = findOne(ctx, r.table, bson.M{"_id": oid}, &data)
+	return data, err
+}
+
+func (r mongoCommentRepository) FindByParent(ctx context.Context, noticeID, parentID, after string, limit int) ([]Comment, error) {
+	data := []Comment{}
+	query := bson.M{
+		"noticeID": noticeID,
+		"parentID": parentID,
+		"status":   constant.CommentCommonStatus,
+	}
+	if after != "" {
+		oid, err := toObjectID(after)
+		if err != nil {
+			return data, err
+		}
+		query["_id"] = bson.M{
+			"$gt": oid,
+		}
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	err := findAll(ctx, r.table, query, &data, opts)
+	return data, err
+}
+
+func (r mongoCommentRepository) CountByParent(ctx context.Context, noticeID, parentID string) (int, error) {
+	query := bson.M{
+		"noticeID": noticeID,
+		"parentID": parentID,
+		"status":   constant.CommentCommonStatus,
+	}
+	count, err := r.table.CountDocuments(ctx, query)
+	return int(count), err
+}
+
+func (r mongoCommentRepository) FindByUser(ctx context.Context, userID string) ([]Comment, error) {
+	data := []Comment{}
+	err := findAll(ctx, r.table, bson.M{"userID": userID}, &data)
+	return data, err
+}
+
+func (r mongoCommentRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	oid, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	return updateOne(ctx, r.table, bson.M{"_id": oid}, update)
+}
+
+func (r mongoCommentRepository) DeleteByNoticeIDs(ctx context.Context, noticeIDs []string) error {
+	if len(noticeIDs) == 0 {
+		return nil
+	}
+	query := bson.M{
+		"noticeID": bson.M{
+			"$in": noticeIDs,
+		},
+	}
+	_, err := r.table.DeleteMany(ctx, query)
+	return err
+}
+
+func (r mongoCommentRepository) ReplaceUser(ctx context.Context, unionid, anonID string) error {
+	replaces := []struct {
+		query  bson.M
+		update bson.M
+	}{
+		{
+			bson.M{"userID": unionid},
+			bson.M{"$set": bson.M{"userID": anonID, "status": constant.CommentDeleteStatus, "content": ""}},
+		},
+		{bson.M{"replyToUserID": unionid}, bson.M{"$set": bson.M{"replyToUserID": anonID}}},
+		{bson.M{"mentionUserIDs": unionid}, bson.M{"$set": bson.M{"mentionUserIDs.$": anonID}}},
+	}
+	for _, replace := range replaces {
+		if _, err := r.table.UpdateMany(ctx, replace.query, replace.update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/****************************************** mongo basic action ****************************************/
+
+func toObjectID(id string) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return oid, constant.ErrorIDFormatWrong
+	}
+	return oid, nil
+}
+
+func toObjectIDs(ids []string) ([]primitive.ObjectID, error) {
+	oids := make([]primitive.ObjectID, len(ids))
+	for i, id := range ids {
+		oid, err := toObjectID(id)
+		if err != nil {
+			return nil, err
+		}
+		oids[i] = oid
+	}
+	return oids, nil
+}
+
+func findOne(ctx context.Context, table *mongo.Collection, query, data interface{}, opts ...*options.FindOneOptions) error {
+	err := table.FindOne(ctx, query, opts...).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		return constant.ErrorNotFound
+	}
+	return err
+}
+
+func findAll(ctx context.Context, table *mongo.Collection, query, data interface{}, opts ...*options.FindOptions) error {
+	cur, err := table.Find(ctx, query, opts...)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	return cur.All(ctx, data)
+}
+
+// isDuplicateKeyError 违反唯一索引
+func isDuplicateKeyError(err error) bool {
+	if e, ok := err.(mongo.WriteException); ok {
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func updateOne(ctx context.Context, table *mongo.Collection, query, update interface{}) error {
+	res, err := table.UpdateOne(ctx, query, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return constant.ErrorNotFound
+	}
+	return nil
+}
+
+/****************************************** upload ****************************************/
+
+type mongoUploadRepository struct {
+	table *mongo.Collection
+}
+
+func (r mongoUploadRepository) Upsert(ctx context.Context, upload Upload) error {
+	_, err := r.table.ReplaceOne(ctx, bson.M{"_id": upload.Key}, upload, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r mongoUploadRepository) FindByKeys(ctx context.Context, keys []string) ([]Upload, error) {
+	data := []Upload{}
+	if len(keys) == 0 {
+		return data, nil
+	}
+	query := bson.M{
+		"_id": bson.M{
+			"$in": keys,
+		},
+	}
+	err := findAll(ctx, r.table, query, &data)
+	return data, err
+}
+
+func (r mongoUploadRepository) DeleteByOwner(ctx context.Context, ownerID string) error {
+	_, err := r.table.DeleteMany(ctx, bson.M{"ownerID": ownerID})
+	return err
+}
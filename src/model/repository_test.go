@@ -0,0 +1,292 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"model/db"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// forEachStore 在每个持久化实现上运行 fn, 每次使用空的数据
+// 默认只运行内存实现; 设置 TEST_MONGO_DB 时同时在该 mongo 数据库上运行, 运行后删除该数据库
+func forEachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryStore())
+	})
+	name := os.Getenv("TEST_MONGO_DB")
+	if name == "" {
+		return
+	}
+	t.Run("mongo", func(t *testing.T) {
+		ctx := context.Background()
+		dbName := db.DBNAME
+		db.DBNAME = name
+		defer func() {
+			if err := db.GetDB().Drop(ctx); err != nil {
+				t.Errorf("drop %s: %v", name, err)
+			}
+			db.DBNAME = dbName
+		}()
+		s := NewMongoStore()
+		if err := s.EnsureIndexes(ctx); err != nil {
+			t.Fatalf("EnsureIndexes: %v", err)
+		}
+		fn(t, s)
+	})
+}
+
+func newTestGroup(code, ownerID string, managerIDs, memberIDs []string) Group {
+	return Group{
+		ID:         primitive.NewObjectID(),
+		Status:     constant.GroupCommonStatus,
+		Code:       code,
+		OwnerID:    ownerID,
+		ManagerIDs: managerIDs,
+		MemberIDs:  memberIDs,
+		PersonNum:  1 + len(managerIDs) + len(memberIDs),
+	}
+}
+
+// testAudience 不在任何分组、没有管理权限的普通成员
+func testAudience(userID string) NoticeAudience {
+	return NoticeAudience{UserID: userID, SubgroupIDs: []string{}, ManageGroupIDs: []string{}}
+}
+
+func TestUserRepositoryGroups(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		users := s.Users()
+		for _, unionid := range []string{"u1", "u2"} {
+			user := User{Unionid: unionid, OwnGroupIDs: []string{}, ManageGroupIDs: []string{}, JoinGroupIDs: []string{}}
+			if err := users.Insert(ctx, user); err != nil {
+				t.Fatalf("Insert(%s): %v", unionid, err)
+			}
+		}
+
+		if err := users.AddGroup(ctx, []string{"u1", "u2"}, constant.GroupUserStatusMember, "g1"); err != nil {
+			t.Fatalf("AddGroup: %v", err)
+		}
+		// 重复加入不产生重复项
+		if err := users.AddGroup(ctx, []string{"u1"}, constant.GroupUserStatusMember, "g1"); err != nil {
+			t.Fatalf("AddGroup: %v", err)
+		}
+		if err := users.RemoveGroup(ctx, []string{"u2"}, constant.GroupUserStatusMember, "g1"); err != nil {
+			t.Fatalf("RemoveGroup: %v", err)
+		}
+
+		tests := []struct {
+			unionid string
+			want    int
+		}{
+			{"u1", 1},
+			{"u2", 0},
+		}
+		for _, tt := range tests {
+			user, err := users.FindByUnionid(ctx, tt.unionid)
+			if err != nil {
+				t.Fatalf("FindByUnionid(%s): %v", tt.unionid, err)
+			}
+			if len(user.JoinGroupIDs) != tt.want {
+				t.Errorf("%s JoinGroupIDs = %v, want %d groups", tt.unionid, user.JoinGroupIDs, tt.want)
+			}
+		}
+
+		if _, err := users.FindByUnionid(ctx, "missing"); err != constant.ErrorNotFound {
+			t.Errorf("FindByUnionid(missing) err = %v, want %v", err, constant.ErrorNotFound)
+		}
+	})
+}
+
+func TestGroupRepositoryMembers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		groups := s.Groups()
+		group := newTestGroup("AAAA", "owner", []string{}, []string{"m1"})
+		if err := groups.Insert(ctx, group); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		if err := groups.Insert(ctx, newTestGroup("AAAA", "other", []string{}, []string{})); err != constant.ErrorHasExist {
+			t.Errorf("Insert duplicate code err = %v, want %v", err, constant.ErrorHasExist)
+		}
+
+		id := group.ID.Hex()
+		tests := []struct {
+			name      string
+			op        func() error
+			wantErr   error
+			wantNum   int
+			wantMembs int
+		}{
+			{"add", func() error { return groups.AddUsers(ctx, id, constant.GroupUserStatusMember, []string{"m2", "m3"}) }, nil, 4, 3},
+			{"add existing", func() error { return groups.AddUsers(ctx, id, constant.GroupUserStatusMember, []string{"m3", "m4"}) }, constant.ErrorNotFound, 4, 3},
+			{"remove", func() error { return groups.RemoveUsers(ctx, id, constant.GroupUserStatusMember, []string{"m1"}) }, nil, 3, 2},
+			{"remove missing", func() error { return groups.RemoveUsers(ctx, id, constant.GroupUserStatusMember, []string{"m1"}) }, constant.ErrorNotFound, 3, 2},
+		}
+		for _, tt := range tests {
+			if err := tt.op(); err != tt.wantErr {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			got, err := groups.FindByID(ctx, id)
+			if err != nil {
+				t.Fatalf("%s: FindByID: %v", tt.name, err)
+			}
+			if got.PersonNum != tt.wantNum || len(got.MemberIDs) != tt.wantMembs {
+				t.Errorf("%s: personNum = %d, members = %v, want %d and %d members", tt.name, got.PersonNum, got.MemberIDs, tt.wantNum, tt.wantMembs)
+			}
+		}
+
+		if err := groups.SoftDelete(ctx, id, "owner", 100); err != nil {
+			t.Fatalf("SoftDelete: %v", err)
+		}
+		if _, err := groups.FindByCode(ctx, "AAAA"); err != constant.ErrorNotFound {
+			t.Errorf("FindByCode after SoftDelete err = %v, want %v", err, constant.ErrorNotFound)
+		}
+		if err := groups.Restore(ctx, id); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+		if got, err := groups.FindByCode(ctx, "AAAA"); err != nil || got.DeletedAt != 0 {
+			t.Errorf("FindByCode after Restore = %+v, %v", got, err)
+		}
+	})
+}
+
+func TestNoticeRepositoryWatchAndExpire(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		notices := s.Notices()
+		past := Notice{ID: primitive.NewObjectID(), Status: constant.NoticePubStatus, GroupID: "g1", Title: "past", NoticeTime: 100}
+		future := Notice{ID: primitive.NewObjectID(), Status: constant.NoticePubStatus, GroupID: "g1", Title: "future", NoticeTime: 300}
+		if err := notices.Insert(ctx, past, future); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+
+		// 同一用户多次查看只记录一次
+		for i := 0; i < 2; i++ {
+			if err := notices.AddWatchUser(ctx, future.ID.Hex(), "u1"); err != nil {
+				t.Fatalf("AddWatchUser: %v", err)
+			}
+		}
+		got, err := notices.FindByID(ctx, future.ID.Hex())
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if got.WatchNum != 1 || len(got.WatchUserIDs) != 1 {
+			t.Errorf("watchNum = %d, watchUserIDs = %v, want 1 watcher", got.WatchNum, got.WatchUserIDs)
+		}
+
+		count, err := notices.ExpireBefore(ctx, 200)
+		if err != nil || count != 1 {
+			t.Errorf("ExpireBefore = %d, %v, want 1", count, err)
+		}
+
+		// 发布的在前, 同状态按提醒时间
+		list, err := notices.FindByGroupIDs(ctx, []string{"g1"}, testAudience("u1"), 1, 10)
+		if err != nil {
+			t.Fatalf("FindByGroupIDs: %v", err)
+		}
+		wantTitles := []string{"future", "past"}
+		if len(list) != len(wantTitles) {
+			t.Fatalf("FindByGroupIDs returned %d notices, want %d", len(list), len(wantTitles))
+		}
+		for i, title := range wantTitles {
+			if list[i].Title != title {
+				t.Errorf("FindByGroupIDs[%d] = %s, want %s", i, list[i].Title, title)
+			}
+		}
+	})
+}
+
+func TestRepositoryFindDeletedBefore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		old := newTestGroup("AAAA", "owner", []string{}, []string{})
+		recent := newTestGroup("BBBB", "owner", []string{}, []string{})
+		// 回收站之前解散的群组没有 deletedAt, 补全后重新计算保留时间
+		legacy := newTestGroup("CCCC", "owner", []string{}, []string{})
+		legacy.Status = constant.GroupDelStatus
+		for _, group := range []Group{old, recent, legacy} {
+			if err := s.Groups().Insert(ctx, group); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+		}
+		if err := s.Groups().SoftDelete(ctx, old.ID.Hex(), "owner", 100); err != nil {
+			t.Fatalf("SoftDelete: %v", err)
+		}
+		if err := s.Groups().SoftDelete(ctx, recent.ID.Hex(), "owner", 300); err != nil {
+			t.Fatalf("SoftDelete: %v", err)
+		}
+		oldNotice := Notice{ID: primitive.NewObjectID(), Status: constant.NoticeDeleteStatus, GroupID: "g1", DeletedAt: 100}
+		legacyNotice := Notice{ID: primitive.NewObjectID(), Status: constant.NoticeDeleteStatus, GroupID: "g1"}
+		if err := s.Notices().Insert(ctx, oldNotice, legacyNotice); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		if err := s.EnsureIndexes(ctx); err != nil {
+			t.Fatalf("EnsureIndexes: %v", err)
+		}
+
+		groups, err := s.Groups().FindDeletedBefore(ctx, 200)
+		if err != nil {
+			t.Fatalf("Groups().FindDeletedBefore: %v", err)
+		}
+		if len(groups) != 1 || groups[0].ID != old.ID {
+			t.Errorf("Groups().FindDeletedBefore = %v, want only %s", groups, old.Code)
+		}
+		notices, err := s.Notices().FindDeletedBefore(ctx, 200)
+		if err != nil {
+			t.Fatalf("Notices().FindDeletedBefore: %v", err)
+		}
+		if len(notices) != 1 || notices[0].ID != oldNotice.ID {
+			t.Errorf("Notices().FindDeletedBefore = %v, want only %s", notices, oldNotice.ID.Hex())
+		}
+	})
+}
+
+// 指定接收人的通知移动到其他群组后, 新群组的普通成员可以看到
+func TestNoticeRepositoryMoveTargetedNotice(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		notices := s.Notices()
+		targeted := Notice{
+			ID:            primitive.NewObjectID(),
+			Status:        constant.NoticePubStatus,
+			CreatorID:     "owner",
+			GroupID:       "g1",
+			Title:         "targeted",
+			TargetUserIDs: []string{"u2"},
+			SubgroupIDs:   []string{"s1"},
+		}
+		// 未指定接收人的通知, 字段为 nil
+		plain := Notice{ID: primitive.NewObjectID(), Status: constant.NoticePubStatus, CreatorID: "owner", GroupID: "g2", Title: "plain"}
+		if err := notices.Insert(ctx, targeted, plain); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+
+		titles := func(groupID string) []string {
+			list, err := notices.FindByGroupIDs(ctx, []string{groupID}, testAudience("u1"), 1, 10)
+			if err != nil {
+				t.Fatalf("FindByGroupIDs(%s): %v", groupID, err)
+			}
+			res := []string{}
+			for _, notice := range list {
+				res = append(res, notice.Title)
+			}
+			return res
+		}
+		if got := titles("g1"); len(got) != 0 {
+			t.Errorf("before move g1 notices = %v, want none", got)
+		}
+
+		updateData := map[string]interface{}{"groupID": "g2"}
+		clearNoticeAudience(updateData)
+		if err := notices.Update(ctx, targeted.ID.Hex(), updateData); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got := titles("g2")
+		if len(got) != 2 || !containString(got, "targeted") || !containString(got, "plain") {
+			t.Errorf("after move g2 notices = %v, want targeted and plain", got)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"fmt"
+	"model/db"
+)
+
+// ClaimServiceNonce 记录服务间请求的 nonce, 已使用过时返回 false
+func ClaimServiceNonce(ctx context.Context, keyID, nonce string) (bool, error) {
+	cntlr := db.NewRedisDBCntlr(ctx)
+	defer cntlr.Close()
+
+	key := fmt.Sprintf(constant.RedisServiceNonce, keyID, nonce)
+	return cntlr.SETNXEX(key, constant.RedisServiceNonceExpire, "1")
+}
@@ -0,0 +1,202 @@
+package model
+
+/*
+   群组分组和定向通知
+   - 有 manageMembers 权限的用户可以把群组成员分为多个分组, 如 "A组"、"五年级数学"
+   - 通知可以指定接收的用户或分组, 只有仍在接收群组中的用户会看到和收到提醒
+   - 定向通知的创建者和在接收群组中有 editOthersNotice 权限的用户也可以看到
+*/
+import (
+	"constant"
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Subgroup struct {
+	ID      string   `bson:"id" json:"id"`
+	Name    string   `bson:"name" json:"name"`
+	UserIDs []string `bson:"userIDs" json:"userIDs"` // unionid, 只能是群组中的用户
+}
+
+// NoticeAudience 查询通知的用户, 用于过滤定向通知
+type NoticeAudience struct {
+	UserID         string
+	SubgroupIDs    []string // 用户所在的分组
+	ManageGroupIDs []string // 用户有 editOthersNotice 权限、可以查看所有通知的群组
+}
+
+func (a NoticeAudience) canView(notice Notice) bool {
+	if !isTargetedNotice(notice) || notice.CreatorID == a.UserID || containString(notice.TargetUserIDs, a.UserID) {
+		return true
+	}
+	for _, subgroupID := range notice.SubgroupIDs {
+		if containString(a.SubgroupIDs, subgroupID) {
+			return true
+		}
+	}
+	for _, groupID := range noticeGroupIDs(notice) {
+		if containString(a.ManageGroupIDs, groupID) {
+			return true
+		}
+	}
+	return false
+}
+
+// getNoticeAudience 根据用户在 groupIDs 中的分组和权限得到 NoticeAudience
+func getNoticeAudience(ctx context.Context, userID string, groupIDs []string) NoticeAudience {
+	audience := NoticeAudience{
+		UserID:         userID,
+		SubgroupIDs:    []string{},
+		ManageGroupIDs: []string{},
+	}
+	for _, groupID := range groupIDs {
+		group, err := store.Groups().FindByID(ctx, groupID)
+		if err != nil {
+			continue
+		}
+		if HasGroupPermission(group, userID, constant.GroupPermEditOthersNotice) {
+			audience.ManageGroupIDs = append(audience.ManageGroupIDs, groupID)
+		}
+		for _, subgroup := range group.Subgroups {
+			if containString(subgroup.UserIDs, userID) {
+				audience.SubgroupIDs = append(audience.SubgroupIDs, subgroup.ID)
+			}
+		}
+	}
+	return audience
+}
+
+func isTargetedNotice(notice Notice) bool {
+	return len(notice.TargetUserIDs) > 0 || len(notice.SubgroupIDs) > 0
+}
+
+// noticeGroupAudience 通知在群组中的接收人, 非定向通知为群组的所有人
+func noticeGroupAudience(notice Notice, group Group) []string {
+	memberIDs := append(append([]string{group.OwnerID}, group.ManagerIDs...), group.MemberIDs...)
+	if !isTargetedNotice(notice) {
+		return memberIDs
+	}
+	subgroupUserIDs := []string{}
+	for _, subgroup := range group.Subgroups {
+		if containString(notice.SubgroupIDs, subgroup.ID) {
+			subgroupUserIDs = append(subgroupUserIDs, subgroup.UserIDs...)
+		}
+	}
+	res := []string{}
+	for _, memberID := range memberIDs {
+		if containString(notice.TargetUserIDs, memberID) || containString(subgroupUserIDs, memberID) {
+			res = append(res, memberID)
+		}
+	}
+	return res
+}
+
+// checkNoticeAudience 定向通知指定的用户需在接收群组中, 分组需属于接收群组
+func checkNoticeAudience(ctx context.Context, notice Notice) error {
+	if !isTargetedNotice(notice) {
+		return nil
+	}
+	memberIDs, subgroupIDs := []string{}, []string{}
+	for _, groupID := range noticeGroupIDs(notice) {
+		group, err := store.Groups().FindByID(ctx, groupID)
+		if err != nil {
+			return err
+		}
+		memberIDs = append(append(append(memberIDs, group.OwnerID), group.ManagerIDs...), group.MemberIDs...)
+		for _, subgroup := range group.Subgroups {
+			subgroupIDs = append(subgroupIDs, subgroup.ID)
+		}
+	}
+	for _, userID := range notice.TargetUserIDs {
+		if !containString(memberIDs, userID) {
+			return constant.ErrorParamWrong
+		}
+	}
+	for _, subgroupID := range notice.SubgroupIDs {
+		if !containString(subgroupIDs, subgroupID) {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
+
+// CreateSubgroup 创建分组, 需要 manageMembers 权限
+func CreateSubgroup(ctx context.Context, groupID, userID, name string, userIDs []string) (Subgroup, error) {
+	subgroup := Subgroup{
+		ID:      primitive.NewObjectID().Hex(),
+		Name:    strings.TrimSpace(name),
+		UserIDs: userIDs,
+	}
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageMembers)
+	if err != nil {
+		return subgroup, err
+	}
+	if err = checkSubgroup(group, subgroup); err != nil {
+		return subgroup, err
+	}
+	if len(group.Subgroups) >= constant.SubgroupMaxNum {
+		return subgroup, constant.ErrorOutOfRange
+	}
+
+	subgroups := append(append([]Subgroup{}, group.Subgroups...), subgroup)
+	return subgroup, store.Groups().SetSubgroups(ctx, groupID, subgroups)
+}
+
+// UpdateSubgroup 更新分组的名称和成员, 已发布的定向通知的接收人随之变化
+func UpdateSubgroup(ctx context.Context, groupID, userID, subgroupID, name string, userIDs []string) (Subgroup, error) {
+	subgroup := Subgroup{
+		ID:      subgroupID,
+		Name:    strings.TrimSpace(name),
+		UserIDs: userIDs,
+	}
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageMembers)
+	if err != nil {
+		return subgroup, err
+	}
+	if err = checkSubgroup(group, subgroup); err != nil {
+		return subgroup, err
+	}
+
+	subgroups := append([]Subgroup{}, group.Subgroups...)
+	for i := range subgroups {
+		if subgroups[i].ID == subgroupID {
+			subgroups[i] = subgroup
+			return subgroup, store.Groups().SetSubgroups(ctx, groupID, subgroups)
+		}
+	}
+	return subgroup, constant.ErrorNotFound
+}
+
+// DeleteSubgroup 删除分组, 只指定了该分组的通知将没有接收人
+func DeleteSubgroup(ctx context.Context, groupID, userID, subgroupID string) error {
+	group, err := checkGroupPermission(ctx, groupID, userID, constant.GroupPermManageMembers)
+	if err != nil {
+		return err
+	}
+
+	subgroups := []Subgroup{}
+	for _, subgroup := range group.Subgroups {
+		if subgroup.ID != subgroupID {
+			subgroups = append(subgroups, subgroup)
+		}
+	}
+	if len(subgroups) == len(group.Subgroups) {
+		return constant.ErrorNotFound
+	}
+	return store.Groups().SetSubgroups(ctx, groupID, subgroups)
+}
+
+func checkSubgroup(group Group, subgroup Subgroup) error {
+	if subgroup.Name == "" || utf8.RuneCountInString(subgroup.Name) > constant.SubgroupNameMaxLen {
+		return constant.ErrorParamWrong
+	}
+	for _, userID := range subgroup.UserIDs {
+		if groupUserRole(group, userID) == 0 {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package model
+
+/*
+   作业提交和完成打卡
+   - 接收人中没有 postNotice 权限的用户需要提交, 即学生和家长, 可以只标记完成, 也可以附带文字和图片
+   - 图片通过 qiniuToken 的 submission 类型上传
+   - 提醒时间前 constant.SubmissionRemindBefore 内提醒还没有完成的用户
+*/
+import (
+	"constant"
+	"context"
+	"fmt"
+	"model/db"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"util"
+	"util/filestore"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Submission struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Status int                `bson:"status" json:"status"` // 状态: 0 未完成(撤回), 5 已完成
+
+	NoticeID   string `bson:"noticeID" json:"noticeID"` // _id
+	UserID     string `bson:"userID" json:"userID"`     // unionid
+	Content    string `bson:"content" json:"content"`
+	Imgs       []Img  `bson:"imgs" json:"imgs"`
+	CreateTime int64  `bson:"createTime" json:"createTime"`
+	UpdateTime int64  `bson:"updateTime" json:"updateTime"`
+}
+
+// NoticeCompletion 通知的完成情况, 只统计仍在接收群组中需要提交的用户
+type NoticeCompletion struct {
+	SubmitterNum  int      // 需要提交的人数
+	DoneNum       int      // 已完成的人数
+	UndoneUserIDs []string // 还没有完成的用户 unionid
+}
+
+// Rate 完成率, 没有需要提交的用户时为 0
+func (c NoticeCompletion) Rate() float64 {
+	if c.SubmitterNum == 0 {
+		return 0
+	}
+	return float64(c.DoneNum) / float64(c.SubmitterNum)
+}
+
+// SubmitNotice 提交作业并标记完成, 每条通知只能提交一次, 之后通过 UpdateSubmission 修改
+// 提醒时间过后仍可以提交
+func SubmitNotice(ctx context.Context, userID string, submission Submission) (Submission, error) {
+	now := util.GetNowTimestamp()
+	submission.ID = primitive.NewObjectID()
+	submission.Status = constant.SubmissionDoneStatus
+	submission.UserID = userID
+	submission.Content = strings.TrimSpace(submission.Content)
+	submission.CreateTime = now
+	submission.UpdateTime = now
+	submission.Imgs = storedImgs(submission.Imgs)
+	if err := checkSubmission(submission); err != nil {
+		return submission, err
+	}
+
+	notice, err := store.Notices().FindByID(ctx, submission.NoticeID)
+	if err != nil {
+		return submission, err
+	}
+	if notice.Status < constant.NoticeExpireStatus {
+		return submission, constant.ErrorNotFound
+	}
+	if _, ok := noticeSubmitters(ctx, notice)[userID]; !ok {
+		return submission, constant.ErrorNoPermission
+	}
+	if err = checkImgUploads(ctx, userID, constant.ImgTypeSubmission, submission.Imgs); err != nil {
+		return submission, err
+	}
+	return submission, store.Submissions().Insert(ctx, submission)
+}
+
+// UpdateSubmission 修改自己的提交, 内容和图片整体替换, status 为 constant.SubmissionUndoneStatus 时撤回完成
+// 不再是通知的接收人时不能修改, 修改后不再使用的图片从存储中删除
+func UpdateSubmission(ctx context.Context, id, userID string, data Submission) (Submission, error) {
+	submission, err := store.Submissions().FindByID(ctx, id)
+	if err != nil {
+		return submission, err
+	}
+	if submission.UserID != userID {
+		return submission, constant.ErrorNotFound
+	}
+	if data.Status != constant.SubmissionDoneStatus && data.Status != constant.SubmissionUndoneStatus {
+		return submission, constant.ErrorParamWrong
+	}
+
+	oldImgs := submission.Imgs
+	submission.Status = data.Status
+	submission.Content = strings.TrimSpace(data.Content)
+	submission.Imgs = storedImgs(data.Imgs)
+	submission.UpdateTime = util.GetNowTimestamp()
+	if err = checkSubmission(submission); err != nil {
+		return submission, err
+	}
+
+	notice, err := store.Notices().FindByID(ctx, submission.NoticeID)
+	if err != nil {
+		return submission, err
+	}
+	if notice.Status < constant.NoticeExpireStatus {
+		return submission, constant.ErrorNotFound
+	}
+	if _, ok := noticeSubmitters(ctx, notice)[userID]; !ok {
+		return submission, constant.ErrorNoPermission
+	}
+	added := []Img{}
+	for _, img := range submission.Imgs {
+		if !containImg(oldImgs, img) {
+			added = append(added, img)
+		}
+	}
+	if err = checkImgUploads(ctx, userID, constant.ImgTypeSubmission, added); err != nil {
+		return submission, err
+	}
+
+	updateData := map[string]interface{}{
+		"status":     submission.Status,
+		"content":    submission.Content,
+		"imgs":       submission.Imgs,
+		"updateTime": submission.UpdateTime,
+	}
+	if err = store.Submissions().Update(ctx, id, updateData); err != nil {
+		return submission, err
+	}
+
+	removed := []Img{}
+	for _, img := range oldImgs {
+		if !containImg(submission.Imgs, img) {
+			removed = append(removed, img)
+		}
+	}
+	if len(removed) > 0 {
+		util.GoBackground(func(ctx context.Context) {
+			deleteSubmissions([]Submission{{Imgs: removed}})
+		})
+	}
+	return submission, nil
+}
+
+// CanViewAllSubmissions 通知的创建者和在接收群组中有 editOthersNotice 权限的用户可以查看所有提交
+func CanViewAllSubmissions(ctx context.Context, notice Notice, userID string) bool {
+	return notice.CreatorID == userID ||
+		checkNoticePermission(ctx, notice, userID, constant.GroupPermEditOthersNotice) == nil
+}
+
+// GetNoticeSubmissions 获取通知的提交, 没有权限查看所有提交时只返回自己的
+func GetNoticeSubmissions(ctx context.Context, notice Notice, userID string) ([]Submission, error) {
+	submissions, err := store.Submissions().FindByNoticeID(ctx, notice.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if CanViewAllSubmissions(ctx, notice, userID) {
+		return submissions, nil
+	}
+	res := []Submission{}
+	for _, submission := range submissions {
+		if submission.UserID == userID {
+			res = append(res, submission)
+		}
+	}
+	return res, nil
+}
+
+// GetNoticeCompletion 统计通知的完成情况
+func GetNoticeCompletion(ctx context.Context, notice Notice) (NoticeCompletion, error) {
+	return noticeCompletion(ctx, notice, noticeSubmitters(ctx, notice))
+}
+
+func noticeCompletion(ctx context.Context, notice Notice, submitters map[string][]string) (NoticeCompletion, error) {
+	completion := NoticeCompletion{UndoneUserIDs: []string{}}
+	doneIDs, err := noticeDoneUserIDs(ctx, notice.ID.Hex())
+	if err != nil {
+		return completion, err
+	}
+	completion.SubmitterNum = len(submitters)
+	for userID := range submitters {
+		if containString(doneIDs, userID) {
+			completion.DoneNum++
+		} else {
+			completion.UndoneUserIDs = append(completion.UndoneUserIDs, userID)
+		}
+	}
+	return completion, nil
+}
+
+// SendSubmissionRemind 提醒还没有完成的用户, 返回发送的消息数量
+// 每小时执行一次, 只处理提醒时间在 constant.SubmissionRemindBefore 内的通知, 每条通知每人只提醒一次
+func SendSubmissionRemind(ctx context.Context) (int, error) {
+	now := time.Now()
+	start := util.GetNowTimestamp()
+	notices, err := store.Notices().FindPubByNoticeTime(ctx, start, start+int64(constant.SubmissionRemindBefore/time.Millisecond))
+	if err != nil || len(notices) == 0 {
+		return 0, err
+	}
+
+	redisCntrl := db.NewRedisDBCntlr(ctx)
+	defer redisCntrl.Close()
+
+	sentKeys := []interface{}{}
+	deliveries := []Delivery{}
+	for _, notice := range notices {
+		submitters := noticeSubmitters(ctx, notice)
+		completion, err := noticeCompletion(ctx, notice, submitters)
+		if err != nil || len(completion.UndoneUserIDs) == 0 {
+			continue
+		}
+		users, _ := store.Users().FindByUnionids(ctx, completion.UndoneUserIDs)
+
+		year, month, day := time.Unix(notice.NoticeTime/1000, 0).Date()
+		for _, user := range users {
+			settings := user.NotificationSettings
+			if !settings.allowAnyGroup(submitters[user.Unionid]) || settings.inQuietHours(now) ||
+				!canNotify(userRecipient(user), constant.NotifyEventSubmissionRemind) {
+				continue
+			}
+			key := fmt.Sprintf(constant.RedisSubmissionRemindSent, notice.ID.Hex(), user.Unionid)
+			if !claimNoticeSent(redisCntrl, key) {
+				continue
+			}
+			sentKeys = append(sentKeys, key)
+			deliveries = append(deliveries, Delivery{
+				To: userRecipient(user),
+				Msg: Message{
+					Event:   constant.NotifyEventSubmissionRemind,
+					Title:   fmt.Sprintf(constant.SubmissionRemindTitle, notice.Title),
+					Content: constant.SubmissionRemindContent,
+					Time:    fmt.Sprintf(constant.TemplateTime, year, month, day),
+				},
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+
+	count, err := dispatch(ctx, deliveries)
+	if count == 0 && err != nil {
+		// 全部发送失败, 下次检查时重新发送
+		redisCntrl.DEL(sentKeys...)
+	}
+	return count, err
+}
+
+// noticeSubmitters 通知的接收人中需要提交的用户, unionid -> 用户所在的接收群组, 已解散的群组跳过
+func noticeSubmitters(ctx context.Context, notice Notice) map[string][]string {
+	submitters := map[string][]string{}
+	for _, groupID := range noticeGroupIDs(notice) {
+		group, err := store.Groups().FindByID(ctx, groupID)
+		if err != nil {
+			continue
+		}
+		for _, memberID := range noticeGroupAudience(notice, group) {
+			if !HasGroupPermission(group, memberID, constant.GroupPermPostNotice) {
+				submitters[memberID] = append(submitters[memberID], groupID)
+			}
+		}
+	}
+	return submitters
+}
+
+func noticeDoneUserIDs(ctx context.Context, noticeID string) ([]string, error) {
+	submissions, err := store.Submissions().FindByNoticeID(ctx, noticeID)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []string{}
+	for _, submission := range submissions {
+		if submission.Status == constant.SubmissionDoneStatus {
+			userIDs = append(userIDs, submission.UserID)
+		}
+	}
+	return userIDs, nil
+}
+
+// checkSubmission 图片只能是通过 submission 类型上传的, 是否为调用者上传的由 checkImgUploads 检查
+func checkSubmission(submission Submission) error {
+	if submission.NoticeID == "" || utf8.RuneCountInString(submission.Content) > constant.SubmissionContentMaxLen {
+		return constant.ErrorParamWrong
+	}
+	if len(submission.Imgs) > constant.SubmissionImgMaxNum {
+		return constant.ErrorOutOfRange
+	}
+	for _, img := range submission.Imgs {
+		for _, u := range []string{img.URL, img.MicroURL} {
+			if _, ok := fileKey(u, constant.ImgPrefixSubmission); !ok {
+				return constant.ErrorParamWrong
+			}
+		}
+	}
+	return nil
+}
+
+// deleteSubmissions 删除提交及其引用的七牛云图片
+func deleteSubmissions(submissions []Submission) error {
+	for _, submission := range submissions {
+		for _, img := range submission.Imgs {
+			for _, u := range []string{img.URL, img.MicroURL} {
+				key, ok := fileKey(u, constant.ImgPrefixSubmission)
+				if !ok {
+					continue
+				}
+				if err := filestore.Default().Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// purgeNoticeSubmissions 彻底删除通知时删除其所有提交
+func purgeNoticeSubmissions(ctx context.Context, noticeID string) error {
+	submissions, err := store.Submissions().FindByNoticeID(ctx, noticeID)
+	if err != nil {
+		return err
+	}
+	if err = deleteSubmissions(submissions); err != nil {
+		return err
+	}
+	return store.Submissions().DeleteByNoticeIDs(ctx, []string{noticeID})
+}
+
+// deleteUserSubmissions 注销时删除用户的所有提交
+func deleteUserSubmissions(ctx context.Context, unionid string) error {
+	submissions, err := store.Submissions().FindByUser(ctx, unionid)
+	if err != nil {
+		return err
+	}
+	if err = deleteSubmissions(submissions); err != nil {
+		return err
+	}
+	return store.Submissions().DeleteByUser(ctx, unionid)
+}
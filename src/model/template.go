@@ -3,18 +3,19 @@ package model
 import (
 	"config"
 	"constant"
+	"context"
 	"fmt"
-	"model/db"
 	"time"
+	"util"
 
 	"github.com/imroc/req"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Template struct {
-	ID     bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty"`
-	Type   int           `bson:"type" json:"type"`     // 类型：
-	Status int           `bson:"status" json:"status"` // 状态:
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Type   int                `bson:"type" json:"type"`     // 类型：
+	Status int                `bson:"status" json:"status"` // 状态:
 
 	CreatorID string   `bson:"creatorID" json:"creatorID"` // 创建者 unionid
 	Notices   []Notice `bson:"notices" json:"notices"`     // 模板内容
@@ -48,52 +49,32 @@ type Error struct {
 
 // 模板草稿通过 redis 存储, 取出即删redis草稿
 
-func GetTemplate(id string) (Template, error) {
-	if !bson.IsObjectIdHex(id) {
-		return Template{}, constant.ErrorIDFormatWrong
-	}
-	query := bson.M{
-		"_id": bson.ObjectIdHex(id),
-	}
-	return findTemplate(query, DefaultSelector)
+func GetTemplate(ctx context.Context, id string) (Template, error) {
+	return store.Templates().FindByID(ctx, id)
 }
 
-func SendGroupJoinTemplate(unionid, groupCode string) error {
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	groupTable := cntrl.GetTable(constant.TableGroup)
-	userTable := cntrl.GetTable(constant.TableUser)
-
-	query := bson.M{
-		"unionid": unionid,
-	}
-	selector := bson.M{
-		"nickname": 1,
-	}
-
-	user := User{}
-	err := userTable.Find(query).Select(selector).One(&user)
+// SendGroupJoinTemplate 通知用户加群成功, 按用户的提醒设置选择渠道, 处于免打扰时段时不发送
+func SendGroupJoinTemplate(ctx context.Context, unionid, groupCode string) error {
+	user, err := store.Users().FindByUnionid(ctx, unionid)
 	if err != nil {
 		return err
 	}
-	query = bson.M{
-		"code": groupCode,
-		"status": bson.M{
-			"$gte": constant.GroupCommonStatus,
-		},
+	if user.NotificationSettings.inQuietHours(time.Now()) {
+		return nil
 	}
-
-	selector = bson.M{
-		"nickname": 1,
-	}
-
-	group := Group{}
-	err = groupTable.Find(query).Select(selector).One(&group)
+	group, err := findGroupByCode(ctx, groupCode)
 	if err != nil {
 		return err
 	}
-	template := getGroupTemplate(unionid, user.Nickname, group.Nickname)
-	_, err = sendOfficeAccountTemplate([]WechatTemplate{template})
+	delivery := Delivery{
+		To: userRecipient(user),
+		Msg: Message{
+			Event:         constant.NotifyEventGroupJoin,
+			UserNickname:  user.Nickname,
+			GroupNickname: group.Nickname,
+		},
+	}
+	_, err = dispatch(ctx, []Delivery{delivery})
 	return err
 }
 
@@ -158,11 +139,11 @@ func getTemplate(unionid, templateID string, data map[string]interface{}) Wechat
 	}
 }
 
-func sendOfficeAccountTemplate(templates []WechatTemplate) ([]TemplateResult, error) {
+func sendOfficeAccountTemplate(ctx context.Context, templates []WechatTemplate) ([]TemplateResult, error) {
 	data := map[string]interface{}{
 		"templates": templates,
 	}
-	resp, err := req.Post(constant.URLBingYanSendTemplate, req.BodyJSON(&data))
+	resp, err := util.HTTPPost(ctx, constant.URLBingYanSendTemplate, req.BodyJSON(&data))
 	if err != nil {
 		return nil, err
 	}
@@ -173,22 +154,3 @@ func sendOfficeAccountTemplate(templates []WechatTemplate) ([]TemplateResult, er
 	err = resp.ToJSON(&resData)
 	return resData.Data, err
 }
-
-/****************************************** template basic action ****************************************/
-
-func findTemplate(query, selectField interface{}) (Template, error) {
-	data := Template{}
-	cntrl := db.NewCopyMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableTemplate)
-	err := table.Find(query).Select(selectField).One(&data)
-	return data, err
-}
-
-func updateTemplate(query, update interface{}) error {
-	return updateDoc(constant.TableTemplate, query, update)
-}
-
-func insertTemplates(docs ...interface{}) error {
-	return insertDocs(constant.TableTemplate, docs...)
-}
@@ -0,0 +1,227 @@
+package model
+
+/*
+   回收站: 解散的群组和删除的通知保留 config.Trash.RetentionDays 天, 期间可以恢复
+   超过保留时间后由定时任务彻底删除, 同时删除通知引用的七牛云图片和附件、作业提交和评论
+*/
+import (
+	"config"
+	"constant"
+	"context"
+	"model/db"
+	"util"
+	"util/filestore"
+)
+
+// DeleteNotice 删除通知, 放入回收站
+func DeleteNotice(ctx context.Context, noticeID, userID string) error {
+	updateData := map[string]interface{}{
+		"status":    constant.NoticeDeleteStatus,
+		"deletedAt": util.GetNowTimestamp(),
+		"deletedBy": userID,
+	}
+	return UpdateNotice(ctx, noticeID, userID, updateData)
+}
+
+// RestoreNotice 恢复通知, 只有创建者可以恢复, 且需仍有每个接收群组的发布权限, 接收群组已解散时不能恢复
+func RestoreNotice(ctx context.Context, noticeID, userID string) (Notice, error) {
+	notice, err := store.Notices().FindByID(ctx, noticeID)
+	if err != nil {
+		return notice, err
+	}
+	if notice.CreatorID != userID || notice.Status != constant.NoticeDeleteStatus || notice.DeletedAt < trashRetentionStart() {
+		return notice, constant.ErrorNotFound
+	}
+	for _, groupID := range noticeGroupIDs(notice) {
+		if _, err = checkGroupPermission(ctx, groupID, userID, constant.GroupPermPostNotice); err != nil {
+			return notice, err
+		}
+	}
+
+	status := constant.NoticePubStatus
+	if notice.NoticeTime <= util.GetNowTimestamp() {
+		status = constant.NoticeExpireStatus
+	}
+	updateData := map[string]interface{}{
+		"status":    status,
+		"deletedAt": int64(0),
+		"deletedBy": "",
+	}
+	if err = store.Notices().Update(ctx, noticeID, updateData); err != nil {
+		return notice, err
+	}
+	notice.Status, notice.DeletedAt, notice.DeletedBy = status, 0, ""
+	// 删除时已推送 notice.deleted, 对接收方来说恢复相当于重新发布
+	emitNoticeEvent(constant.WebhookEventNoticeCreated, notice)
+	return notice, nil
+}
+
+// RestoreGroup 恢复解散的群组, 只有创建者可以恢复, 所有成员重新加入
+func RestoreGroup(ctx context.Context, groupID, userID string) (Group, error) {
+	group, err := store.Groups().FindDeletedByID(ctx, groupID)
+	if err != nil {
+		return group, err
+	}
+	if group.OwnerID != userID || group.DeletedAt < trashRetentionStart() {
+		return group, constant.ErrorNotFound
+	}
+
+	err = store.RunInTransaction(ctx, func(ctx context.Context) error {
+		users := store.Users()
+		if err := store.Groups().Restore(ctx, groupID); err != nil {
+			return err
+		}
+		if err := users.AddGroup(ctx, []string{group.OwnerID}, constant.GroupUserStatusOwner, groupID); err != nil {
+			return err
+		}
+		if err := users.AddGroup(ctx, group.ManagerIDs, constant.GroupUserStatusManager, groupID); err != nil {
+			return err
+		}
+		return users.AddGroup(ctx, group.MemberIDs, constant.GroupUserStatusMember, groupID)
+	})
+	if err != nil {
+		return group, err
+	}
+	group.Status, group.DeletedAt, group.DeletedBy = constant.GroupCommonStatus, 0, ""
+	return group, nil
+}
+
+// GetTrashGroups 获取用户解散的、仍可恢复的群组
+func GetTrashGroups(ctx context.Context, userID string) ([]Group, error) {
+	return store.Groups().FindDeletedByOwner(ctx, userID, trashRetentionStart())
+}
+
+// GetTrashNotices 获取用户删除的、仍可恢复的通知
+func GetTrashNotices(ctx context.Context, userID string) ([]Notice, error) {
+	return store.Notices().FindDeletedByCreator(ctx, userID, trashRetentionStart())
+}
+
+// PurgeTrash 彻底删除超过保留时间的群组和通知, 返回删除的通知数量
+// 图片删除失败的通知保留到下次执行时重试
+func PurgeTrash(ctx context.Context) (int, error) {
+	before := trashRetentionStart()
+	count := 0
+	var lastErr error
+
+	groups, err := store.Groups().FindDeletedBefore(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	for _, group := range groups {
+		if err = db.CheckFence(ctx); err != nil {
+			return count, err
+		}
+		groupID := group.ID.Hex()
+		notices, err := store.Notices().FindAllByGroupID(ctx, groupID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		notices, err = detachGroupNotices(ctx, groupID, notices)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		n, err := purgeNotices(ctx, notices)
+		count += n
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err = store.Groups().Delete(ctx, groupID); err != nil {
+			lastErr = err
+		}
+	}
+
+	notices, err := store.Notices().FindDeletedBefore(ctx, before)
+	if err != nil {
+		return count, err
+	}
+	if err = db.CheckFence(ctx); err != nil {
+		return count, err
+	}
+	n, err := purgeNotices(ctx, notices)
+	count += n
+	if err != nil {
+		lastErr = err
+	}
+	return count, lastErr
+}
+
+// detachGroupNotices 将群组从多群组通知的接收群组中移除, 返回只属于该群组、需要删除的通知
+func detachGroupNotices(ctx context.Context, groupID string, notices []Notice) ([]Notice, error) {
+	res := []Notice{}
+	for _, notice := range notices {
+		groupIDs := pullAll(noticeGroupIDs(notice), groupID)
+		if len(groupIDs) == 0 {
+			res = append(res, notice)
+			continue
+		}
+		updateData := map[string]interface{}{
+			"groupID":  groupIDs[0],
+			"groupIDs": groupIDs,
+		}
+		if len(groupIDs) == 1 {
+			updateData["groupIDs"] = nil
+		}
+		if err := store.Notices().Update(ctx, notice.ID.Hex(), updateData); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// purgeNotices 删除通知的图片后删除通知, 有图片删除失败时返回错误
+func purgeNotices(ctx context.Context, notices []Notice) (int, error) {
+	ids := make([]string, 0, len(notices))
+	var lastErr error
+	for _, notice := range notices {
+		if err := deleteNoticeImgs(notice); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := purgeNoticeSubmissions(ctx, notice.ID.Hex()); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := store.Comments().DeleteByNoticeIDs(ctx, []string{notice.ID.Hex()}); err != nil {
+			lastErr = err
+			continue
+		}
+		ids = append(ids, notice.ID.Hex())
+	}
+	count, err := store.Notices().DeleteByIDs(ctx, ids)
+	if err != nil {
+		return count, err
+	}
+	return count, lastErr
+}
+
+func deleteNoticeImgs(notice Notice) error {
+	urls := []string{}
+	for _, img := range notice.Imgs {
+		urls = append(urls, img.URL, img.MicroURL)
+	}
+	for _, attachment := range notice.Attachments {
+		urls = append(urls, attachmentURLs(attachment)...)
+	}
+	for _, u := range urls {
+		key, ok := fileKey(u, constant.ImgPrefixHomework, constant.AttachmentPrefix)
+		if !ok {
+			continue
+		}
+		if err := filestore.Default().Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashRetentionStart 回收站中可恢复的最早删除时间
+func trashRetentionStart() int64 {
+	days := config.Conf.Trash.RetentionDays
+	if days <= 0 {
+		days = constant.TrashDefaultRetentionDays
+	}
+	return util.GetNowTimestamp() - int64(days)*24*3600*1000
+}
@@ -0,0 +1,191 @@
+package model
+
+/*
+   上传文件登记: qiniuToken 返回的凭证带有回调内容, 上传成功后登记文件
+   七牛回调 /api/v1/qiniu/callback, 本地存储在接收文件时登记
+   存储不登记文件时(七牛没有配置 CallbackURL、S3), 生成上传凭证时即登记文件名, 文件名由服务端生成
+   通知和反馈只接受调用者自己上传且用途相符的文件, 防止引用任意链接或其他用户的文件
+*/
+import (
+	"constant"
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"util"
+	"util/filestore"
+)
+
+type Upload struct {
+	Key        string `bson:"_id" json:"key"`               // 文件名
+	Hash       string `bson:"hash" json:"hash"`             // 七牛 etag
+	Size       int64  `bson:"size" json:"size"`             // 文件大小, 单位字节
+	Mime       string `bson:"mime" json:"mime"`             // 七牛检测的 MIME 类型
+	OwnerID    string `bson:"ownerID" json:"ownerID"`       // 上传者 unionid
+	Purpose    int    `bson:"purpose" json:"purpose"`       // 用途, 即 qiniuToken 的 type
+	CreateTime int64  `bson:"createTime" json:"createTime"` // 登记时间
+}
+
+// RegisterUpload 登记七牛回调的文件, 调用前需校验回调签名
+// 七牛回调失败会重试, 重复登记时覆盖
+func RegisterUpload(ctx context.Context, form url.Values) (Upload, error) {
+	upload := Upload{
+		Key:        form.Get("key"),
+		Hash:       form.Get("hash"),
+		Mime:       form.Get("mimeType"),
+		OwnerID:    form.Get("owner"),
+		CreateTime: util.GetNowTimestamp(),
+	}
+	size, err := strconv.ParseInt(form.Get("fsize"), 10, 64)
+	if err != nil {
+		return upload, constant.ErrorParamWrong
+	}
+	upload.Size = size
+	if upload.Purpose, err = strconv.Atoi(form.Get("purpose")); err != nil {
+		return upload, constant.ErrorParamWrong
+	}
+	prefix, ok := uploadPrefix(upload.Purpose)
+	if !ok || upload.OwnerID == "" || !strings.HasPrefix(upload.Key, prefix) {
+		return upload, constant.ErrorParamWrong
+	}
+	return upload, store.Uploads().Upsert(ctx, upload)
+}
+
+// ReserveUpload 生成上传凭证时登记文件名, 用于上传后不登记文件的存储
+func ReserveUpload(ctx context.Context, ownerID string, purpose int, key string) error {
+	prefix, ok := uploadPrefix(purpose)
+	if !ok || ownerID == "" || !strings.HasPrefix(key, prefix) {
+		return constant.ErrorParamWrong
+	}
+	return store.Uploads().Upsert(ctx, Upload{
+		Key:        key,
+		OwnerID:    ownerID,
+		Purpose:    purpose,
+		CreateTime: util.GetNowTimestamp(),
+	})
+}
+
+// uploadPrefix 用途对应的文件名前缀
+func uploadPrefix(purpose int) (string, bool) {
+	if kind, ok := constant.AttachmentUploadKinds[purpose]; ok {
+		return constant.AttachmentPrefix + kind + "/", true
+	}
+	prefix, ok := constant.ImgPrefix[purpose]
+	return prefix, ok
+}
+
+// attachmentUploadType 附件类型对应的 qiniuToken 的 type
+func attachmentUploadType(kind string) int {
+	for uploadType, k := range constant.AttachmentUploadKinds {
+		if k == kind {
+			return uploadType
+		}
+	}
+	return 0
+}
+
+// checkUploads files 须为 userID 以 purpose 用途上传并已登记的文件, 为文件名或本存储的链接
+func checkUploads(ctx context.Context, userID string, purpose int, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	prefix, ok := uploadPrefix(purpose)
+	if !ok {
+		return constant.ErrorParamWrong
+	}
+	keys := []string{}
+	for _, f := range files {
+		key, ok := fileKey(f, prefix)
+		if !ok {
+			return constant.ErrorParamWrong
+		}
+		keys = addToSet(keys, key)
+	}
+	uploads, err := store.Uploads().FindByKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	if len(uploads) != len(keys) {
+		return constant.ErrorParamWrong
+	}
+	for _, upload := range uploads {
+		if upload.OwnerID != userID || upload.Purpose != purpose {
+			return constant.ErrorNoPermission
+		}
+	}
+	return nil
+}
+
+// checkImgUploads 图片须为调用者上传的, 缩略图须为上传时生成的, 存储不支持生成缩略图时为原图
+func checkImgUploads(ctx context.Context, userID string, purpose int, imgs []Img) error {
+	files := filestore.Default()
+	keys := []string{}
+	for _, img := range imgs {
+		key, ok := fileKey(img.URL, constant.ImgPrefix[purpose])
+		if !ok {
+			return constant.ErrorParamWrong
+		}
+		microKey := key
+		if files.Supports(filestore.DeriveThumbnail) {
+			microKey = constant.ImgPrefixMicro[purpose] + strings.TrimPrefix(key, constant.ImgPrefix[purpose])
+		}
+		if storedFile(img.MicroURL) != microKey {
+			return constant.ErrorParamWrong
+		}
+		keys = append(keys, key)
+	}
+	return checkUploads(ctx, userID, purpose, keys)
+}
+
+// checkAttachmentUploads 附件须为调用者上传的, 缩略图和预览在 checkAttachments 中校验
+func checkAttachmentUploads(ctx context.Context, userID string, attachments []Attachment) error {
+	files := map[string][]string{}
+	for _, attachment := range attachments {
+		files[attachment.Kind] = append(files[attachment.Kind], attachment.URL)
+	}
+	for kind, kindFiles := range files {
+		if err := checkUploads(ctx, userID, attachmentUploadType(kind), kindFiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNoticeUploads 检查通知新增的图片和附件, old 中已有的不检查, 编辑他人的通知时保留原有的文件
+func checkNoticeUploads(ctx context.Context, userID string, notice, old Notice) error {
+	imgs := []Img{}
+	for _, img := range notice.Imgs {
+		if !containImg(old.Imgs, img) {
+			imgs = append(imgs, img)
+		}
+	}
+	if err := checkImgUploads(ctx, userID, constant.ImgTypeHomework, imgs); err != nil {
+		return err
+	}
+	attachments := []Attachment{}
+	for _, attachment := range notice.Attachments {
+		if !containAttachment(old.Attachments, attachment) {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return checkAttachmentUploads(ctx, userID, attachments)
+}
+
+// containImg 旧数据保存的是链接, 按文件名比较
+func containImg(imgs []Img, img Img) bool {
+	for _, i := range imgs {
+		if storedFile(i.URL) == storedFile(img.URL) && storedFile(i.MicroURL) == storedFile(img.MicroURL) {
+			return true
+		}
+	}
+	return false
+}
+
+func containAttachment(attachments []Attachment, attachment Attachment) bool {
+	for _, a := range attachments {
+		if storedFile(a.URL) == storedFile(attachment.URL) {
+			return true
+		}
+	}
+	return false
+}
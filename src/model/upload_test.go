@@ -0,0 +1,53 @@
+package model
+
+import (
+	"constant"
+	"context"
+	"testing"
+	"util/filestore"
+)
+
+func TestCheckImgUploadsReserved(t *testing.T) {
+	old := store
+	defer SetStore(old)
+	SetStore(NewMemoryStore())
+
+	ctx := context.Background()
+	const id = "2c5ea4c0-4067-11e9-8bad-9b1deb4d3b7d"
+	purpose := constant.ImgTypeFeedback
+	key := constant.ImgPrefix[purpose] + id + constant.ImgSuffix
+	img := Img{URL: key, MicroURL: key}
+	if filestore.Default().Supports(filestore.DeriveThumbnail) {
+		img.MicroURL = constant.ImgPrefixMicro[purpose] + id + constant.ImgSuffix
+	}
+
+	// 未登记的文件不接受
+	if err := checkImgUploads(ctx, "u1", purpose, []Img{img}); err != constant.ErrorParamWrong {
+		t.Errorf("unregistered: err = %v, want %v", err, constant.ErrorParamWrong)
+	}
+	if err := ReserveUpload(ctx, "u1", purpose, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReserveUpload(ctx, "u1", purpose, constant.ImgPrefixHead+id+constant.ImgSuffix); err != constant.ErrorParamWrong {
+		t.Errorf("reserve other prefix: err = %v, want %v", err, constant.ErrorParamWrong)
+	}
+
+	tests := []struct {
+		name    string
+		userID  string
+		purpose int
+		img     Img
+		want    error
+	}{
+		{"owner", "u1", purpose, img, nil},
+		{"other user", "u2", purpose, img, constant.ErrorNoPermission},
+		{"other purpose", "u1", constant.ImgTypeHomework, img, constant.ErrorParamWrong},
+		{"external url", "u1", purpose, Img{URL: "https://example.com/a.jpg", MicroURL: "https://example.com/a.jpg"}, constant.ErrorParamWrong},
+		{"wrong thumbnail", "u1", purpose, Img{URL: key, MicroURL: constant.ImgPrefixMicroHead + id + constant.ImgSuffix}, constant.ErrorParamWrong},
+	}
+	for _, tt := range tests {
+		if err := checkImgUploads(ctx, tt.userID, tt.purpose, []Img{tt.img}); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"constant"
+	"context"
 	"fmt"
 	"model/db"
 	"strconv"
@@ -9,11 +10,11 @@ import (
 
 	"github.com/imroc/req"
 
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type User struct {
-	ID bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty"`
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	// 状态:  -10表示被删除，0 表示没有关注公众号，5 表示已经关注公众号的普通用户
 	Status int `bson:"status" json:"status"`
 
@@ -28,12 +29,16 @@ type User struct {
 	AvatarURL string `bson:"avatarUrl" json:"avatarUrl"` // 用户头像
 	Language  string `bson:"language" json:"language"`   // 语言
 
+	OfficialOpenid string `bson:"officialOpenid" json:"-"` // 公众号下的 openid, 由公众号事件记录
+
 	OwnGroupIDs    []string `bson:"ownGroupIDs" json:"ownGroupIDs"`
 	ManageGroupIDs []string `bson:"manageGroupIDs" json:"manageGroupIDs"`
 	JoinGroupIDs   []string `bson:"joinGroupIDs" json:"joinGroupIDs"`
+
+	NotificationSettings NotificationSettings `bson:"notificationSettings" json:"notificationSettings"`
 }
 
-func CreateUser(userInfo *util.DecryptUserInfo) error {
+func CreateUser(ctx context.Context, userInfo *util.DecryptUserInfo) error {
 	if userInfo.UnionID == "" {
 		return constant.ErrorIDFormatWrong
 	}
@@ -41,28 +46,23 @@ func CreateUser(userInfo *util.DecryptUserInfo) error {
 		userInfo.AvatarURL = constant.WechatDefaultHeadImgURL
 	}
 
-	query := bson.M{
-		"unionid": userInfo.UnionID,
-	}
-	user := User{}
-	selector := bson.M{
-		"unionid":    1,
-		"nickname":   1,
-		"avatar_url": 1,
-	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableUser)
+	users := store.Users()
 
-	err := table.Find(query).Select(selector).One(&user)
-	status := constant.UserFollowStatus
-	if ok, _ := IsFollowOfficeAccount(userInfo.UnionID); !ok {
-		status = constant.UserUnFollowStatus
+	user, err := users.FindByUnionid(ctx, userInfo.UnionID)
+	if err != nil && err != constant.ErrorNotFound {
+		return err
 	}
-	if err != nil {
+	// 接收公众号事件时关注状态以事件为准, 否则登录时向微信查询
+	checkFollow := !IsOfficialAccountEventEnabled()
+	status := constant.UserUnFollowStatus
+	if checkFollow {
+		if ok, _ := IsFollowOfficeAccount(ctx, userInfo.UnionID); ok {
+			status = constant.UserFollowStatus
+		}
+	}
+	if err == constant.ErrorNotFound {
 		user = User{
-			ID:        bson.NewObjectId(),
+			ID:        primitive.NewObjectID(),
 			Status:    status,
 			Openid:    userInfo.OpenID,
 			Unionid:   userInfo.UnionID,
@@ -74,154 +74,102 @@ func CreateUser(userInfo *util.DecryptUserInfo) error {
 			City:      userInfo.City,
 			Province:  userInfo.Province,
 		}
-		return table.Insert(user)
+		return users.Insert(ctx, user)
 	}
 
 	// update
+	updateMap := map[string]interface{}{}
 	if userInfo.NickName != user.Nickname || userInfo.AvatarURL != user.AvatarURL {
-		updateMap := map[string]interface{}{
-			"status":     status,
-			"nickname":   userInfo.NickName,
-			"avatar_url": userInfo.AvatarURL,
-			"gender":     userInfo.Gender,
-			"language":   userInfo.Language,
-			"country":    userInfo.Country,
-			"city":       userInfo.City,
-			"province":   userInfo.Province,
+		updateMap = map[string]interface{}{
+			"nickname":  userInfo.NickName,
+			"avatarUrl": userInfo.AvatarURL,
+			"gender":    userInfo.Gender,
+			"language":  userInfo.Language,
+			"country":   userInfo.Country,
+			"city":      userInfo.City,
+			"province":  userInfo.Province,
 		}
-		if userInfo.OpenID != "" {
-			updateMap["openid"] = userInfo.OpenID
+		if checkFollow {
+			updateMap["status"] = status
 		}
-		update := bson.M{
-			"$set": updateMap,
-		}
-		return table.Update(query, update)
 	}
-	return nil
+	// 由公众号事件创建的用户没有小程序 openid
+	if userInfo.OpenID != "" && userInfo.OpenID != user.Openid {
+		updateMap["openid"] = userInfo.OpenID
+	}
+	if len(updateMap) == 0 {
+		return nil
+	}
+	return users.Update(ctx, userInfo.UnionID, updateMap)
 }
 
-func GetUserByUnionid(unionid string) (User, error) {
-	query := bson.M{
-		"unionid": unionid,
-	}
-	return findUser(query, DefaultSelector)
+func GetUserByUnionid(ctx context.Context, unionid string) (User, error) {
+	return store.Users().FindByUnionid(ctx, unionid)
 }
 
-func GetUserStatus(unionid string) (int, error) {
-	query := bson.M{
-		"unionid": unionid,
-	}
-	selector := bson.M{
-		"status": 1,
-	}
-	user, err := findUser(query, selector)
+func GetUserStatus(ctx context.Context, unionid string) (int, error) {
+	user, err := store.Users().FindByUnionid(ctx, unionid)
 	return user.Status, err
 }
 
-func SetUserFollowStatus(unionid string, isFollow bool) error {
+func SetUserFollowStatus(ctx context.Context, unionid string, isFollow bool) error {
 	oldStatus := constant.UserFollowStatus
 	if isFollow {
 		oldStatus = constant.UserUnFollowStatus
 	}
-	query := bson.M{
-		"unionid": unionid,
-		"status":  oldStatus,
-	}
 	status := constant.UserFollowStatus
 	if !isFollow {
 		status = constant.UserUnFollowStatus
 	}
-	update := bson.M{
-		"$set": bson.M{
-			"status": status,
-		},
-	}
-	return updateUser(query, update)
+	return store.Users().SetStatus(ctx, unionid, oldStatus, status)
 }
 
-func FindGroupsByUserID(unionid string) (ownGroupIDs, manageGroupIDs, joinGroupIDs []string, err error) {
+func FindGroupsByUserID(ctx context.Context, unionid string) (ownGroupIDs, manageGroupIDs, joinGroupIDs []string, err error) {
 	if unionid == "" {
 		err = constant.ErrorIDFormatWrong
 		return
 	}
 
-	query := bson.M{
-		"unionid": unionid,
-	}
-	selector := bson.M{
-		"ownGroupIDs":    1,
-		"manageGroupIDs": 1,
-		"joinGroupIDs":   1,
-	}
-
-	user, err := findUser(query, selector)
+	user, err := store.Users().FindByUnionid(ctx, unionid)
 	ownGroupIDs, manageGroupIDs, joinGroupIDs = user.OwnGroupIDs, user.ManageGroupIDs, user.JoinGroupIDs
 	return
 }
 
-func IsFollowOfficeAccount(unionid string) (bool, error) {
+func IsFollowOfficeAccount(ctx context.Context, unionid string) (bool, error) {
 	param := req.Param{
 		"unionid": unionid,
 	}
-	r, _ := req.Get(constant.URLBingYanIsFollow, param)
 	resData := struct {
 		IsFollow bool `json:"is_follow"`
 	}{}
-	err := r.ToJSON(&resData)
+	r, err := util.HTTPGet(ctx, constant.URLBingYanIsFollow, param)
+	if err != nil {
+		return false, err
+	}
+	err = r.ToJSON(&resData)
 	return resData.IsFollow, err
 }
 
-func AddUserOwnGroup(unionid, id string) error {
-	if !bson.IsObjectIdHex(id) {
+func AddUserOwnGroup(ctx context.Context, unionid, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
 		return constant.ErrorIDFormatWrong
 	}
-
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableUser)
-	query := bson.M{
-		"unionid": unionid,
-	}
-	update := bson.M{
-		"$addToSet": bson.M{
-			"ownGroupIDs": id,
-		},
-	}
-	return table.Update(query, update)
-}
-
-/****************************************** user basic action ****************************************/
-
-func findUser(query, selector interface{}) (User, error) {
-	data := User{}
-	cntrl := db.NewCloneMgoDBCntlr()
-	defer cntrl.Close()
-	table := cntrl.GetTable(constant.TableUser)
-	err := table.Find(query).Select(selector).One(&data)
-	return data, err
-}
-
-func updateUser(query, update interface{}) error {
-	return updateDoc(constant.TableUser, query, update)
-}
-
-func insertUsers(docs ...interface{}) error {
-	return insertDocs(constant.TableUser, docs...)
+	return store.Users().AddGroup(ctx, []string{unionid}, constant.GroupUserStatusOwner, id)
 }
 
 /****************************************** user redis action ****************************************/
 
-func GetRedisUserInfo(unionid string) (map[string]interface{}, error) {
+func GetRedisUserInfo(ctx context.Context, unionid string) (map[string]interface{}, error) {
 	ids := []string{unionid}
-	userInfos, err := GetRedisUserInfos(ids)
+	userInfos, err := GetRedisUserInfos(ctx, ids)
 	if len(userInfos) > 0 {
 		return userInfos[0], err
 	}
 	return nil, err
 }
 
-func GetRedisUserInfos(unionids []string) ([]map[string]interface{}, error) {
-	redisConn := db.NewRedisDBCntlr()
+func GetRedisUserInfos(ctx context.Context, unionids []string) ([]map[string]interface{}, error) {
+	redisConn := db.NewRedisDBCntlr(ctx)
 	defer redisConn.Close()
 
 	resData := make([]map[string]interface{}, len(unionids))
@@ -229,7 +177,7 @@ func GetRedisUserInfos(unionids []string) ([]map[string]interface{}, error) {
 		key := fmt.Sprintf(constant.RedisUserInfo, unionid)
 		userInfo, err := redisConn.HGETALL(key)
 		if len(userInfo) == 0 || err != nil {
-			user, _ := setRedisUserInfo(unionid)
+			user, _ := setRedisUserInfo(ctx, unionid)
 			userInfo = map[string]interface{}{
 				"nickname":  user.Nickname,
 				"gender":    strconv.Itoa(user.Gender),
@@ -246,25 +194,13 @@ func GetRedisUserInfos(unionids []string) ([]map[string]interface{}, error) {
 	return resData, nil
 }
 
-func setRedisUserInfo(unionid string) (User, error) {
-	query := bson.M{
-		"unionid": unionid,
-	}
-	selector := bson.M{
-		"nickname":  1,
-		"gender":    1,
-		"province":  1,
-		"city":      1,
-		"country":   1,
-		"avatarUrl": 1,
-		"language":  1,
-	}
-	user, err := findUser(query, selector)
+func setRedisUserInfo(ctx context.Context, unionid string) (User, error) {
+	user, err := store.Users().FindByUnionid(ctx, unionid)
 	if err != nil || user.Nickname == "" || user.AvatarURL == "" {
 		return user, err
 	}
 
-	cntrl := db.NewRedisDBCntlr()
+	cntrl := db.NewRedisDBCntlr(ctx)
 	defer cntrl.Close()
 
 	key := fmt.Sprintf(constant.RedisUserInfo, unionid)
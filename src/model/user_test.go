@@ -0,0 +1,58 @@
+package model
+
+import (
+	"config"
+	"constant"
+	"context"
+	"testing"
+	"util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateUserKeepsEventFollowStatus(t *testing.T) {
+	old := store
+	defer SetStore(old)
+	SetStore(NewMemoryStore())
+	oldToken := config.Conf.OfficialAccount.Token
+	defer func() { config.Conf.OfficialAccount.Token = oldToken }()
+	config.Conf.OfficialAccount.Token = "token"
+
+	ctx := context.Background()
+	// 由公众号关注事件创建的用户: 已关注, 没有小程序 openid
+	err := store.Users().Insert(ctx, User{
+		ID:             primitive.NewObjectID(),
+		Status:         constant.UserFollowStatus,
+		Unionid:        "u1",
+		OfficialOpenid: "oa-openid",
+		Nickname:       "nick",
+		AvatarURL:      "avatar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &util.DecryptUserInfo{UnionID: "u1", OpenID: "mp-openid", NickName: "new nick", AvatarURL: "avatar"}
+	if err := CreateUser(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.Users().FindByUnionid(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Status != constant.UserFollowStatus {
+		t.Errorf("status = %d, want %d", user.Status, constant.UserFollowStatus)
+	}
+	if user.Openid != "mp-openid" || user.Nickname != "new nick" {
+		t.Errorf("openid = %q, nickname = %q", user.Openid, user.Nickname)
+	}
+
+	// 资料未变时 openid 变化也要更新
+	info = &util.DecryptUserInfo{UnionID: "u1", OpenID: "mp-openid-2", NickName: "new nick", AvatarURL: "avatar"}
+	if err := CreateUser(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ = store.Users().FindByUnionid(ctx, "u1"); user.Openid != "mp-openid-2" {
+		t.Errorf("openid = %q, want mp-openid-2", user.Openid)
+	}
+}
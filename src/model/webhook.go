@@ -0,0 +1,350 @@
+package model
+
+/*
+   群组 webhook: 群组创建者注册地址后, 通知和成员变动以签名的 JSON 事件推送给学校自己的系统
+*/
+import (
+	"constant"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	"util"
+
+	"github.com/imroc/req"
+	jsoniter "github.com/json-iterator/go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GroupWebhook struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Status int                `bson:"status" json:"status"` // 状态: -10 删除状态, 5 正常状态
+
+	GroupID    string   `bson:"groupID" json:"groupID"`
+	CreatorID  string   `bson:"creatorID" json:"creatorID"`   // unionid
+	URL        string   `bson:"url" json:"url"`               // 推送地址, 必须为 https 的公网地址
+	Events     []string `bson:"events" json:"events"`         // 订阅的事件
+	Secret     string   `bson:"secret" json:"-"`              // 签名密钥, 不对外返回
+	CreateTime int64    `bson:"createTime" json:"createTime"` // 创建时间
+}
+
+// WebhookDelivery 一次事件投递及其结果
+type WebhookDelivery struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Status int                `bson:"status" json:"status"` // 状态: -5 失败, 0 投递中, 5 成功
+
+	WebhookID    string `bson:"webhookID" json:"webhookID"`
+	GroupID      string `bson:"groupID" json:"groupID"`
+	Event        string `bson:"event" json:"event"`
+	Payload      string `bson:"payload" json:"payload"`           // 请求体
+	Attempts     int    `bson:"attempts" json:"attempts"`         // 已尝试次数
+	ResponseCode int    `bson:"responseCode" json:"responseCode"` // 最后一次的响应码
+	Error        string `bson:"error" json:"error"`               // 最后一次的错误
+	CreateTime   int64  `bson:"createTime" json:"createTime"`
+	UpdateTime   int64  `bson:"updateTime" json:"updateTime"`
+}
+
+// webhookEvent 推送的请求体
+type webhookEvent struct {
+	ID         string      `json:"id"` // 投递id, 重新投递时会变化
+	Event      string      `json:"event"`
+	GroupID    string      `json:"groupID"`
+	CreateTime int64       `json:"createTime"`
+	Data       interface{} `json:"data"`
+}
+
+// noticeEventData 通知事件的数据
+type noticeEventData struct {
+	ID         string `json:"id"`
+	Status     int    `json:"status"`
+	CreatorID  string `json:"creatorID"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Imgs       []Img  `json:"imgs"` // 投递记录中为文件名, 发送时转换为访问链接
+	Note       string `json:"note"`
+	CreateTime int64  `json:"createTime"`
+	NoticeTime int64  `json:"noticeTime"`
+}
+
+// memberEventData 成员事件的数据
+type memberEventData struct {
+	UserIDs []string `json:"userIDs"`
+	Role    int      `json:"role"` // constant.GroupUserStatus*
+}
+
+var noticeWebhookEvents = []string{
+	constant.WebhookEventNoticeCreated,
+	constant.WebhookEventNoticeUpdated,
+	constant.WebhookEventNoticeDeleted,
+	constant.WebhookEventNoticeExpired,
+}
+
+var webhookEvents = append([]string{
+	constant.WebhookEventMemberJoined,
+	constant.WebhookEventMemberLeft,
+}, noticeWebhookEvents...)
+
+// CreateGroupWebhook 群组创建者注册 webhook, secret 为空时自动生成
+func CreateGroupWebhook(ctx context.Context, userID, groupID, rawURL string, events []string, secret string) (GroupWebhook, error) {
+	hook := GroupWebhook{}
+	if _, err := getOwnGroup(ctx, userID, groupID); err != nil {
+		return hook, err
+	}
+
+	if len(events) == 0 {
+		return hook, constant.ErrorParamWrong
+	}
+	if err := util.CheckPublicURL(ctx, rawURL); err != nil {
+		return hook, err
+	}
+	for _, event := range events {
+		if !containString(webhookEvents, event) {
+			return hook, constant.ErrorParamWrong
+		}
+	}
+	hooks, err := store.Webhooks().FindByGroupID(ctx, groupID)
+	if err != nil {
+		return hook, err
+	}
+	if len(hooks) >= constant.GroupWebhookMaxNum {
+		return hook, constant.ErrorOutOfRange
+	}
+	if secret == "" {
+		if secret, err = util.RandomHex(constant.WebhookSecretLen); err != nil {
+			return hook, err
+		}
+	}
+
+	hook = GroupWebhook{
+		ID:         primitive.NewObjectID(),
+		Status:     constant.GroupWebhookCommonStatus,
+		GroupID:    groupID,
+		CreatorID:  userID,
+		URL:        rawURL,
+		Events:     events,
+		Secret:     secret,
+		CreateTime: util.GetNowTimestamp(),
+	}
+	return hook, store.Webhooks().Insert(ctx, hook)
+}
+
+// DeleteGroupWebhook 删除 webhook
+func DeleteGroupWebhook(ctx context.Context, userID, id string) error {
+	hook, err := getOwnWebhook(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return store.Webhooks().SetStatus(ctx, hook.ID.Hex(), constant.GroupWebhookDelStatus)
+}
+
+// GetGroupWebhooks 获取群组的 webhook, 仅创建者可见
+func GetGroupWebhooks(ctx context.Context, userID, groupID string) ([]GroupWebhook, error) {
+	if _, err := getOwnGroup(ctx, userID, groupID); err != nil {
+		return nil, err
+	}
+	return store.Webhooks().FindByGroupID(ctx, groupID)
+}
+
+// GetWebhookDeliveries 分页获取投递记录, 仅创建者可见
+func GetWebhookDeliveries(ctx context.Context, userID, webhookID string, page, perPage int) ([]WebhookDelivery, error) {
+	if _, err := getOwnWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+	return store.WebhookDeliveries().FindByWebhookID(ctx, webhookID, page, perPage)
+}
+
+// RedeliverWebhook 以新的投递重新发送某次投递的事件, 在后台执行
+func RedeliverWebhook(ctx context.Context, userID, deliveryID string) (WebhookDelivery, error) {
+	old, err := store.WebhookDeliveries().FindByID(ctx, deliveryID)
+	if err != nil {
+		return old, err
+	}
+	hook, err := getOwnWebhook(ctx, userID, old.WebhookID)
+	if err != nil {
+		return old, err
+	}
+
+	event := webhookEvent{}
+	if err = jsoniter.UnmarshalFromString(old.Payload, &event); err != nil {
+		return old, err
+	}
+	delivery, err := newWebhookDelivery(ctx, hook, event.Event, event.Data)
+	if err != nil {
+		return delivery, err
+	}
+	util.GoBackground(func(ctx context.Context) {
+		deliverWebhook(ctx, hook, delivery)
+	})
+	return delivery, nil
+}
+
+func getOwnGroup(ctx context.Context, userID, groupID string) (Group, error) {
+	group, err := store.Groups().FindByID(ctx, groupID)
+	if err != nil {
+		return group, err
+	}
+	if group.OwnerID != userID {
+		return group, constant.ErrorUnAuth
+	}
+	return group, nil
+}
+
+func getOwnWebhook(ctx context.Context, userID, id string) (GroupWebhook, error) {
+	hook, err := store.Webhooks().FindByID(ctx, id)
+	if err != nil {
+		return hook, err
+	}
+	if _, err = getOwnGroup(ctx, userID, hook.GroupID); err != nil {
+		return hook, err
+	}
+	return hook, nil
+}
+
+/****************************************** emit ****************************************/
+
+func emitNoticeEvent(event string, notices ...Notice) {
+	for _, notice := range notices {
+		data := noticeEventData{
+			ID:         notice.ID.Hex(),
+			Status:     notice.Status,
+			CreatorID:  notice.CreatorID,
+			Title:      notice.Title,
+			Content:    notice.Content,
+			Imgs:       notice.Imgs,
+			Note:       notice.Note,
+			CreateTime: notice.CreateTime,
+			NoticeTime: notice.NoticeTime,
+		}
+		for _, groupID := range noticeGroupIDs(notice) {
+			emitGroupEvent(groupID, event, data)
+		}
+	}
+}
+
+func emitMemberEvent(groupID, event string, role int, userIDs []string) {
+	emitGroupEvent(groupID, event, memberEventData{UserIDs: userIDs, Role: role})
+}
+
+// emitGroupEvent 在后台将事件推送给群组中订阅了该事件的 webhook
+func emitGroupEvent(groupID, event string, data interface{}) {
+	util.GoBackground(func(ctx context.Context) {
+		hooks, err := store.Webhooks().FindByGroupID(ctx, groupID)
+		if err != nil {
+			return
+		}
+		for _, hook := range hooks {
+			if !containString(hook.Events, event) {
+				continue
+			}
+			delivery, err := newWebhookDelivery(ctx, hook, event, data)
+			if err != nil {
+				continue
+			}
+			deliverWebhook(ctx, hook, delivery)
+		}
+	})
+}
+
+func newWebhookDelivery(ctx context.Context, hook GroupWebhook, event string, data interface{}) (WebhookDelivery, error) {
+	now := util.GetNowTimestamp()
+	id := primitive.NewObjectID()
+	payload, err := jsoniter.MarshalToString(webhookEvent{
+		ID:         id.Hex(),
+		Event:      event,
+		GroupID:    hook.GroupID,
+		CreateTime: now,
+		Data:       data,
+	})
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	delivery := WebhookDelivery{
+		ID:         id,
+		Status:     constant.WebhookDeliveryPendingStatus,
+		WebhookID:  hook.ID.Hex(),
+		GroupID:    hook.GroupID,
+		Event:      event,
+		Payload:    payload,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	return delivery, store.WebhookDeliveries().Insert(ctx, delivery)
+}
+
+// deliverWebhook 投递事件, 失败时按 WebhookRetryInterval 指数退避重试, 每次尝试都会更新投递记录
+func deliverWebhook(ctx context.Context, hook GroupWebhook, delivery WebhookDelivery) {
+	interval := constant.WebhookRetryInterval
+	for attempt := 1; attempt <= constant.WebhookMaxAttempts; attempt++ {
+		code, err := postWebhook(ctx, hook, delivery)
+
+		updateData := map[string]interface{}{
+			"status":       constant.WebhookDeliverySuccessStatus,
+			"attempts":     attempt,
+			"responseCode": code,
+			"error":        "",
+			"updateTime":   util.GetNowTimestamp(),
+		}
+		if err != nil {
+			updateData["error"] = err.Error()
+			updateData["status"] = constant.WebhookDeliveryPendingStatus
+			if attempt == constant.WebhookMaxAttempts {
+				updateData["status"] = constant.WebhookDeliveryFailStatus
+			}
+		}
+		store.WebhookDeliveries().Update(ctx, delivery.ID.Hex(), updateData)
+		if err == nil || attempt == constant.WebhookMaxAttempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			// 后台任务超时或服务退出, 记录为失败, 可通过 redeliverWebhook 重新投递
+			recordCtx, cancel := context.WithTimeout(context.Background(), constant.RequestTimeout)
+			defer cancel()
+			store.WebhookDeliveries().Update(recordCtx, delivery.ID.Hex(), map[string]interface{}{
+				"status": constant.WebhookDeliveryFailStatus,
+			})
+			return
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+func postWebhook(ctx context.Context, hook GroupWebhook, delivery WebhookDelivery) (int, error) {
+	body, err := webhookBody(delivery)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header := req.Header{
+		"Content-Type":                  "application/json",
+		constant.WebhookHeaderEvent:     delivery.Event,
+		constant.WebhookHeaderDelivery:  delivery.ID.Hex(),
+		constant.WebhookHeaderTimestamp: timestamp,
+		constant.WebhookHeaderSignature: "sha256=" + util.HMACSHA256Hex(hook.Secret, timestamp+"."+body),
+	}
+	resp, err := util.HTTPPostPublic(ctx, hook.URL, header, []byte(body))
+	if err != nil {
+		return 0, err
+	}
+	code := resp.Response().StatusCode
+	if code < 200 || code >= 300 {
+		return code, fmt.Errorf("webhook response status %d", code)
+	}
+	return code, nil
+}
+
+// webhookBody 发送的请求体, 通知事件的图片在每次发送时生成访问链接, 重试和重新投递时临时链接不会过期
+func webhookBody(delivery WebhookDelivery) (string, error) {
+	if !containString(noticeWebhookEvents, delivery.Event) {
+		return delivery.Payload, nil
+	}
+	data := noticeEventData{}
+	event := webhookEvent{Data: &data}
+	if err := jsoniter.UnmarshalFromString(delivery.Payload, &event); err != nil {
+		return "", err
+	}
+	data.Imgs = signedImgs(data.Imgs)
+	return jsoniter.MarshalToString(event)
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"config"
 	"constant"
+	"context"
 	"errors"
 	"fmt"
 	"model/db"
@@ -46,7 +47,7 @@ type QrcodeRes struct {
 	URL           string `json:"url"`
 }
 
-func GetWeixinSession(code string) (WeixinSessRes, error) {
+func GetWeixinSession(ctx context.Context, code string) (WeixinSessRes, error) {
 	data := WeixinSessRes{}
 	appInfo := config.Conf.Wechat
 	param := req.Param{
@@ -56,7 +57,7 @@ func GetWeixinSession(code string) (WeixinSessRes, error) {
 		"grant_type": "authorization_code",
 	}
 	url := constant.WechatSessionURIPrefix
-	err := util.BindGetJSONData(url, param, &data)
+	err := util.BindGetJSONData(ctx, url, param, &data)
 	return data, err
 }
 
@@ -65,7 +66,7 @@ func DecryptWeixinEncryptedData(sessionKey, encryptedData, iv string) (*util.Dec
 	return pc.Decrypt(encryptedData, iv)
 }
 
-func getAccessToken() (WeixinTokenRes, error) {
+func getAccessToken(ctx context.Context) (WeixinTokenRes, error) {
 	data := WeixinTokenRes{}
 	appInfo := config.Conf.Wechat
 	param := req.Param{
@@ -74,12 +75,12 @@ func getAccessToken() (WeixinTokenRes, error) {
 		"grant_type": "client_credential",
 	}
 	url := constant.WechatTokenURIPrefix
-	err := util.BindGetJSONData(url, param, &data)
+	err := util.BindGetJSONData(ctx, url, param, &data)
 	return data, err
 }
 
 // CreateQrcodeByGroupCode 创建二维码
-func CreateQrcodeByGroupCode(code string) (QrcodeRes, error) {
+func CreateQrcodeByGroupCode(ctx context.Context, code string) (QrcodeRes, error) {
 	str := fmt.Sprintf(constant.WechatScanCodeJoinPhsMPGroup, code)
 	reqData := QrcodeParam{
 		ExpireSeconds: 3600 * 24 * 10,
@@ -92,7 +93,7 @@ func CreateQrcodeByGroupCode(code string) (QrcodeRes, error) {
 	}
 	resData := QrcodeRes{}
 
-	r, err := req.Post(constant.URLCreateQrcode, req.BodyJSON(&reqData))
+	r, err := util.HTTPPost(ctx, constant.URLCreateQrcode, req.BodyJSON(&reqData))
 	if err != nil {
 		return resData, err
 	}
@@ -102,25 +103,27 @@ func CreateQrcodeByGroupCode(code string) (QrcodeRes, error) {
 
 /****************************************** weixin redis action ****************************************/
 
-func UpdateRedisAccessToken() error {
-	data, err := getAccessToken()
-	if err != nil || data.Errcode != 0 {
+func UpdateRedisAccessToken(ctx context.Context) error {
+	data, err := getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	if data.Errcode != 0 {
 		return errors.New(data.Errmsg)
 	}
-	return updateRedisAccessToken(data.AccessToken, data.ExpiresIn)
+	return updateRedisAccessToken(ctx, data.AccessToken, data.ExpiresIn)
 }
 
-func updateRedisAccessToken(accessToken string, expire int64) error {
-	cntlr := db.NewRedisDBCntlr()
+func updateRedisAccessToken(ctx context.Context, accessToken string, expire int64) error {
+	cntlr := db.NewRedisDBCntlr(ctx)
 	defer cntlr.Close()
 
 	key := constant.RedisWeixinAccessToken
-	_, err := cntlr.SETEX(key, expire, accessToken)
-	return err
+	return cntlr.FencedSETEX(key, expire, accessToken)
 }
 
-func getRedisAccessToken() (string, error) {
-	cntlr := db.NewRedisDBCntlr()
+func getRedisAccessToken(ctx context.Context) (string, error) {
+	cntlr := db.NewRedisDBCntlr(ctx)
 	defer cntlr.Close()
 
 	key := constant.RedisWeixinAccessToken
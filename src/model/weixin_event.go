@@ -0,0 +1,294 @@
+package model
+
+/*
+   公众号消息与事件: 关注/取关更新用户的关注状态, 扫描带参二维码加入群组
+*/
+import (
+	"config"
+	"constant"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"model/db"
+	"strings"
+	"util"
+
+	"github.com/imroc/req"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WechatEnvelope 公众号推送的消息体, 安全模式下只有 Encrypt 字段有内容
+type WechatEnvelope struct {
+	XMLName    xml.Name `xml:"xml"`
+	ToUserName string   `xml:"ToUserName"`
+	Encrypt    string   `xml:"Encrypt"`
+}
+
+type WechatEventMsg struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   string   `xml:"ToUserName"`   // 公众号原始id
+	FromUserName string   `xml:"FromUserName"` // 用户在公众号下的 openid
+	CreateTime   int64    `xml:"CreateTime"`
+	MsgType      string   `xml:"MsgType"`
+	Event        string   `xml:"Event"`
+	EventKey     string   `xml:"EventKey"` // 扫码事件的场景值, 未关注时带 qrscene_ 前缀
+	Ticket       string   `xml:"Ticket"`
+}
+
+// OfficialAccountUserInfo 公众号用户基本信息
+type OfficialAccountUserInfo struct {
+	Subscribe  int    `json:"subscribe"` // 0 未关注
+	Openid     string `json:"openid"`
+	Unionid    string `json:"unionid"`
+	Nickname   string `json:"nickname"`
+	Sex        int    `json:"sex"`
+	City       string `json:"city"`
+	Province   string `json:"province"`
+	Country    string `json:"country"`
+	Language   string `json:"language"`
+	HeadImgURL string `json:"headimgurl"`
+	Errcode    int    `json:"errcode"`
+	Errmsg     string `json:"errmsg"`
+}
+
+// IsOfficialAccountEventEnabled 是否直接接收公众号事件, 开启后关注状态以事件为准, 不再轮询
+func IsOfficialAccountEventEnabled() bool {
+	return config.Conf.OfficialAccount.Token != ""
+}
+
+// IsUserFollow 用户是否关注了公众号
+func IsUserFollow(ctx context.Context, unionid string) (bool, error) {
+	if !IsOfficialAccountEventEnabled() {
+		return IsFollowOfficeAccount(ctx, unionid)
+	}
+	status, err := GetUserStatus(ctx, unionid)
+	if err == constant.ErrorNotFound {
+		return false, nil
+	}
+	return status >= constant.UserFollowStatus, err
+}
+
+// ParseWechatEnvelope 解析安全模式的消息外层, 用于校验 msg_signature
+func ParseWechatEnvelope(body []byte) (WechatEnvelope, error) {
+	envelope := WechatEnvelope{}
+	err := xml.Unmarshal(body, &envelope)
+	return envelope, err
+}
+
+// ParseWechatEventMsg 解析公众号推送的消息, encrypted 为安全模式下的 Encrypt 字段
+func ParseWechatEventMsg(body []byte, encrypted bool) (WechatEventMsg, error) {
+	msg := WechatEventMsg{}
+	if encrypted {
+		envelope, err := ParseWechatEnvelope(body)
+		if err != nil {
+			return msg, err
+		}
+		oa := config.Conf.OfficialAccount
+		crypt, err := util.NewWXMsgCrypt(oa.AppID, oa.EncodingAESKey)
+		if err != nil {
+			return msg, err
+		}
+		if body, err = crypt.Decrypt(envelope.Encrypt); err != nil {
+			return msg, err
+		}
+	}
+	err := xml.Unmarshal(body, &msg)
+	return msg, err
+}
+
+// HandleWechatEvent 处理公众号事件, 处理成功后记录事件, 微信重试或重放的同一事件只处理一次
+func HandleWechatEvent(ctx context.Context, msg WechatEventMsg) error {
+	if msg.MsgType != constant.WechatMsgTypeEvent || msg.FromUserName == "" {
+		return nil
+	}
+	if isWechatEventHandled(ctx, msg) {
+		return nil
+	}
+	if err := handleWechatEvent(ctx, msg); err != nil {
+		return err
+	}
+	markWechatEventHandled(ctx, msg)
+	return nil
+}
+
+func handleWechatEvent(ctx context.Context, msg WechatEventMsg) error {
+	switch msg.Event {
+	case constant.WechatEventSubscribe:
+		info, err := getOfficialAccountUserInfo(ctx, msg.FromUserName)
+		if err != nil {
+			return err
+		}
+		if err = ensureOfficialAccountUser(ctx, info); err != nil {
+			return err
+		}
+		if err = SetUserFollowStatus(ctx, info.Unionid, true); err != nil && err != constant.ErrorNotFound {
+			return err
+		}
+		// 未关注用户扫码: 先关注, 再加入群组
+		if strings.HasPrefix(msg.EventKey, constant.WechatSubscribeScenePrefix) {
+			return joinGroupByScene(ctx, info.Unionid, strings.TrimPrefix(msg.EventKey, constant.WechatSubscribeScenePrefix))
+		}
+		return nil
+
+	case constant.WechatEventUnsubscribe:
+		user, err := store.Users().FindByOfficialOpenid(ctx, msg.FromUserName)
+		if err == constant.ErrorNotFound {
+			// 取关后无法再获取 unionid, 没有记录过的用户无需处理
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = SetUserFollowStatus(ctx, user.Unionid, false)
+		if err == constant.ErrorNotFound {
+			return nil
+		}
+		return err
+
+	case constant.WechatEventScan:
+		info, err := getOfficialAccountUserInfo(ctx, msg.FromUserName)
+		if err != nil {
+			return err
+		}
+		if err = ensureOfficialAccountUser(ctx, info); err != nil {
+			return err
+		}
+		return joinGroupByScene(ctx, info.Unionid, msg.EventKey)
+	}
+	return nil
+}
+
+// joinGroupByScene 场景值为 constant.WechatScanCodeJoinPhsMPGroup 时加入群组
+func joinGroupByScene(ctx context.Context, unionid, scene string) error {
+	prefix := strings.TrimSuffix(constant.WechatScanCodeJoinPhsMPGroup, "%s")
+	if !strings.HasPrefix(scene, prefix) {
+		return nil
+	}
+	code := strings.TrimPrefix(scene, prefix)
+	if code == "" {
+		return constant.ErrorParamWrong
+	}
+	if err := JoinGroup(ctx, code, unionid); err != nil {
+		return err
+	}
+	util.GoBackground(func(ctx context.Context) {
+		SendGroupJoinTemplate(ctx, unionid, code)
+	})
+	return nil
+}
+
+// ensureOfficialAccountUser 用户不存在时由公众号信息创建, 并记录公众号 openid 用于处理取关事件
+func ensureOfficialAccountUser(ctx context.Context, info OfficialAccountUserInfo) error {
+	if info.Unionid == "" {
+		return constant.ErrorIDFormatWrong
+	}
+	status := constant.UserUnFollowStatus
+	if info.Subscribe == 1 {
+		status = constant.UserFollowStatus
+	}
+
+	user, err := store.Users().FindByUnionid(ctx, info.Unionid)
+	if err == constant.ErrorNotFound {
+		avatarURL := info.HeadImgURL
+		if avatarURL == "" {
+			avatarURL = constant.WechatDefaultHeadImgURL
+		}
+		user = User{
+			ID:             primitive.NewObjectID(),
+			Status:         status,
+			Unionid:        info.Unionid,
+			OfficialOpenid: info.Openid,
+			Nickname:       info.Nickname,
+			AvatarURL:      avatarURL,
+			Gender:         info.Sex,
+			Language:       info.Language,
+			Country:        info.Country,
+			City:           info.City,
+			Province:       info.Province,
+		}
+		return store.Users().Insert(ctx, user)
+	}
+	if err != nil {
+		return err
+	}
+	if user.OfficialOpenid != info.Openid {
+		return store.Users().Update(ctx, info.Unionid, map[string]interface{}{
+			"officialOpenid": info.Openid,
+		})
+	}
+	return nil
+}
+
+func getOfficialAccountUserInfo(ctx context.Context, openid string) (OfficialAccountUserInfo, error) {
+	data := OfficialAccountUserInfo{}
+	accessToken, err := getOfficialAccountAccessToken(ctx)
+	if err != nil {
+		return data, err
+	}
+	param := req.Param{
+		"access_token": accessToken,
+		"openid":       openid,
+		"lang":         "zh_CN",
+	}
+	if err = util.BindGetJSONData(ctx, constant.WechatUserInfoURIPrefix, param, &data); err != nil {
+		return data, err
+	}
+	if data.Errcode != 0 {
+		return data, errors.New(data.Errmsg)
+	}
+	return data, nil
+}
+
+/****************************************** official account redis action ****************************************/
+
+// getOfficialAccountAccessToken 公众号 access token, 缓存于 redis, 过期前 5 分钟刷新
+func getOfficialAccountAccessToken(ctx context.Context) (string, error) {
+	cntlr := db.NewRedisDBCntlr(ctx)
+	defer cntlr.Close()
+
+	key := constant.RedisOfficialAccountAccessToken
+	if token, err := cntlr.GET(key); err == nil && token != "" {
+		return token, nil
+	}
+
+	data := WeixinTokenRes{}
+	oa := config.Conf.OfficialAccount
+	param := req.Param{
+		"appid":      oa.AppID,
+		"secret":     oa.AppSecret,
+		"grant_type": "client_credential",
+	}
+	if err := util.BindGetJSONData(ctx, constant.WechatTokenURIPrefix, param, &data); err != nil {
+		return "", err
+	}
+	if data.Errcode != 0 {
+		return "", errors.New(data.Errmsg)
+	}
+	expire := data.ExpiresIn - 300
+	if expire <= 0 {
+		expire = data.ExpiresIn
+	}
+	cntlr.SETEX(key, expire, data.AccessToken)
+	return data.AccessToken, nil
+}
+
+// isWechatEventHandled 事件是否已经处理过, redis 出错时按未处理, 关注状态和加入群组都是幂等的
+func isWechatEventHandled(ctx context.Context, msg WechatEventMsg) bool {
+	cntlr := db.NewRedisDBCntlr(ctx)
+	defer cntlr.Close()
+
+	handled, err := cntlr.GET(wechatEventKey(msg))
+	return err == nil && handled != ""
+}
+
+func markWechatEventHandled(ctx context.Context, msg WechatEventMsg) {
+	cntlr := db.NewRedisDBCntlr(ctx)
+	defer cntlr.Close()
+
+	cntlr.SETEX(wechatEventKey(msg), constant.RedisWechatEventDedupExpire, "1")
+}
+
+func wechatEventKey(msg WechatEventMsg) string {
+	return fmt.Sprintf(constant.RedisWechatEventDedup, msg.FromUserName, msg.CreateTime, msg.Event)
+}
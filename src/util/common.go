@@ -2,6 +2,8 @@ package util
 
 import (
 	"config"
+	"constant"
+	"context"
 	"errors"
 	"time"
 
@@ -19,11 +21,14 @@ var (
 	base       []byte = []byte(baseStr)
 	baseMap    map[byte]int
 	BaseLen    int = 4 // 生成的基础长度
+
+	httpReq = req.New() // 调用上游服务的 http client
 )
 
 func init() {
 	InitBaseMap()
 	timeUtil.WeekStartDay = time.Monday
+	httpReq.SetTimeout(constant.UpstreamTimeout)
 }
 
 // MapToJSONStruct convert map to struct
@@ -40,10 +45,20 @@ func JSONStructToMap(obj interface{}) map[string]interface{} {
 	return data
 }
 
+// HTTPGet GET 请求上游服务, ctx 取消时请求随之中断
+func HTTPGet(ctx context.Context, url string, v ...interface{}) (*req.Resp, error) {
+	return httpReq.Get(url, append(v, ctx)...)
+}
+
+// HTTPPost POST 请求上游服务, ctx 取消时请求随之中断
+func HTTPPost(ctx context.Context, url string, v ...interface{}) (*req.Resp, error) {
+	return httpReq.Post(url, append(v, ctx)...)
+}
+
 // BindGetJSONData bind the json data of method GET
 // body must be a point
-func BindGetJSONData(url string, param req.Param, body interface{}) error {
-	r, err := req.Get(url, param)
+func BindGetJSONData(ctx context.Context, url string, param req.Param, body interface{}) error {
+	r, err := HTTPGet(ctx, url, param)
 	if err != nil {
 		return err
 	}
@@ -54,7 +69,7 @@ func BindGetJSONData(url string, param req.Param, body interface{}) error {
 	return nil
 }
 
-func SendEmail(name, subject, content string, emailTos []string) {
+func SendEmail(name, subject, content string, emailTos []string) error {
 	m := gomail.NewMessage()
 	emailInfo := config.Conf.EmailInfo
 	m.SetAddressHeader("From", emailInfo.From, name) // 发件人
@@ -67,7 +82,7 @@ func SendEmail(name, subject, content string, emailTos []string) {
 	m.SetBody("text/html", content) // 正文
 
 	d := gomail.NewPlainDialer(emailInfo.Host, 465, emailInfo.From, emailInfo.AuthCode) // 发送邮件服务器、端口、发件人账号、发件人密码
-	d.DialAndSend(m)
+	return d.DialAndSend(m)
 }
 
 func GetNowTimestamp() int64 {
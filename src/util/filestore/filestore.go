@@ -0,0 +1,123 @@
+package filestore
+
+/*
+   文件存储: 上传凭证、访问链接、衍生文件和删除, 按 config.Conf.Storage.Backend 选择实现
+   - qiniu: 客户端直传七牛, 衍生文件由七牛在上传后异步处理
+   - s3: 客户端通过 POST policy 直传 MinIO 等 S3 兼容存储, 不支持衍生文件
+   - local: 客户端上传到本服务并保存在本地磁盘, 上传时生成图片缩略图, 用于开发和测试, 不需要七牛账号
+   所有实现的上传方式相同: 以 multipart 表单向 UploadCredential.URL 提交 Fields 和名为 file 的文件
+*/
+import (
+	"config"
+	"constant"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 衍生文件类型
+const (
+	DeriveThumbnail  = "thumbnail"  // 图片缩略图, 边长不超过 constant.ImgMicroSize
+	DeriveAudioMP3   = "audioMP3"   // 音频转码为 mp3
+	DeriveVideoCover = "videoCover" // 视频封面
+	DerivePDFPreview = "pdfPreview" // office 文档转换为 pdf
+)
+
+var ErrUnsupported = errors.New("filestore: unsupported derivative")
+
+// Derivative 上传后生成的衍生文件
+type Derivative struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"` // 保存的文件名
+}
+
+// UploadPolicy 上传限制和上传后的处理
+type UploadPolicy struct {
+	Key          string       // 上传的文件名, 只能上传到该文件名
+	FsizeLimit   int64        // 大小上限, 单位字节
+	MimeLimit    string       // 允许的 MIME 类型, 如 "image/*", 多个用 ; 分隔
+	Derivatives  []Derivative // 衍生文件, 需先用 Storage.Supports 过滤
+	CallbackBody string       // 上传成功后登记文件的表单内容, 见 constant.UploadCallbackBody, 为空时不登记
+	Expires      uint32       // 凭证有效期, 单位秒
+}
+
+// UploadCredential 客户端上传使用的凭证
+type UploadCredential struct {
+	Backend string            // constant.StorageBackend*
+	Token   string            // 七牛和本地存储的上传凭证, 同时包含在 Fields 中
+	URL     string            // 上传地址, 七牛为空, 由客户端按空间所在区域选择
+	Fields  map[string]string // 上传时需附带的表单字段
+}
+
+type Storage interface {
+	Backend() string
+	UploadCredential(policy UploadPolicy) (UploadCredential, error)
+	// Supports 是否支持生成该类衍生文件
+	Supports(kind string) bool
+	// URL 文件的访问链接, key 为空时为链接前缀
+	URL(key string) string
+	// SignedURL 带签名的临时访问链接
+	SignedURL(key string, expires time.Duration) string
+	// KeyFromURL 从访问链接中解析文件名, 只处理 prefixes 下的文件, 避免误删默认头像等公共图片
+	KeyFromURL(rawURL string, prefixes ...string) (string, bool)
+	// Delete 删除文件, 文件不存在时不返回错误
+	Delete(key string) error
+	// Registers 上传成功后是否登记文件, 七牛需要配置回调地址
+	Registers() bool
+}
+
+var (
+	defaultStorage Storage
+	defaultOnce    sync.Once
+)
+
+// Default 配置选择的存储
+func Default() Storage {
+	defaultOnce.Do(func() {
+		defaultStorage = New(config.Conf.Storage.Backend)
+	})
+	return defaultStorage
+}
+
+// New 按类型创建存储, 未知类型使用七牛
+func New(backend string) Storage {
+	switch backend {
+	case constant.StorageBackendS3:
+		return newS3Storage()
+	case constant.StorageBackendLocal:
+		return NewLocalStorage(config.Conf.Storage.Local.Dir, config.Conf.Storage.Local.BaseURL, config.Conf.Security.Secret)
+	default:
+		return qiniuStorage{}
+	}
+}
+
+// mimeAllowed limit 为空时不限制, 支持 image/* 形式的通配
+func mimeAllowed(limit, mime string) bool {
+	if limit == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(limit, ";") {
+		if allowed == mime || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mime, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyFromURL 链接须以 baseURL 开头
+func keyFromURL(baseURL, rawURL string, prefixes ...string) (string, bool) {
+	if !strings.HasPrefix(rawURL, baseURL) {
+		return "", false
+	}
+	key := strings.TrimPrefix(rawURL, baseURL)
+	if i := strings.IndexAny(key, "?#"); i >= 0 {
+		key = key[:i]
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return key, true
+		}
+	}
+	return "", false
+}
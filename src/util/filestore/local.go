@@ -0,0 +1,348 @@
+package filestore
+
+import (
+	"bytes"
+	"constant"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册解码器
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"util"
+)
+
+const (
+	localThumbQuality   = 85
+	localThumbMaxPixels = 5000 * 5000 // 生成缩略图的图片的最大像素数, 解码后约占 100MB 内存
+	localSniffLen       = 512         // http.DetectContentType 读取的长度
+	localTempPattern    = ".upload-"  // 上传中的临时文件名前缀
+)
+
+var (
+	ErrInvalidToken   = errors.New("filestore: invalid upload token")
+	ErrTooLarge       = errors.New("filestore: file too large")
+	ErrMimeNotAllowed = errors.New("filestore: mime type not allowed")
+	ErrInvalidKey     = errors.New("filestore: invalid key")
+
+	errImageTooLarge = errors.New("filestore: image too large to decode")
+)
+
+// localGenericMimes http.DetectContentType 无法细分的类型, 如 office 文档为 zip
+var localGenericMimes = []string{"application/octet-stream", "application/zip"}
+
+// LocalStorage 本地磁盘存储, 上传和访问分别由 constant.LocalUploadPath 和 constant.LocalFilesPath 处理
+// 图片缩略图在上传时生成, 不支持音视频和文档的衍生文件
+type LocalStorage struct {
+	dir     string
+	baseURL string // 不以 / 结尾
+	secret  string // 上传凭证和临时链接的签名密钥
+}
+
+// localUploadToken 本地上传凭证的内容, 签名后交给客户端, 上传时原样带回
+type localUploadToken struct {
+	Key          string       `json:"key"`
+	FsizeLimit   int64        `json:"fsizeLimit"`
+	MimeLimit    string       `json:"mimeLimit"`
+	Derivatives  []Derivative `json:"derivatives"`
+	CallbackBody string       `json:"callbackBody"`
+	Deadline     int64        `json:"deadline"` // 秒级时间戳
+}
+
+func NewLocalStorage(dir, baseURL, secret string) *LocalStorage {
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}
+}
+
+func (s *LocalStorage) Backend() string {
+	return constant.StorageBackendLocal
+}
+
+func (s *LocalStorage) UploadCredential(policy UploadPolicy) (UploadCredential, error) {
+	for _, derivative := range policy.Derivatives {
+		if !s.Supports(derivative.Kind) {
+			return UploadCredential{}, ErrUnsupported
+		}
+	}
+	payload, err := json.Marshal(localUploadToken{
+		Key:          policy.Key,
+		FsizeLimit:   policy.FsizeLimit,
+		MimeLimit:    policy.MimeLimit,
+		Derivatives:  policy.Derivatives,
+		CallbackBody: policy.CallbackBody,
+		Deadline:     time.Now().Unix() + int64(policy.Expires),
+	})
+	if err != nil {
+		return UploadCredential{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	upToken := encoded + "." + util.HMACSHA256Hex(s.secret, encoded)
+	return UploadCredential{
+		Backend: constant.StorageBackendLocal,
+		Token:   upToken,
+		URL:     s.baseURL + constant.LocalUploadPath,
+		Fields: map[string]string{
+			"token": upToken,
+			"key":   policy.Key,
+		},
+	}, nil
+}
+
+func (s *LocalStorage) Supports(kind string) bool {
+	return kind == DeriveThumbnail
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + constant.LocalFilesPath + key
+}
+
+// SignedURL 链接附带过期时间和签名, 由 VerifySignedURL 校验
+func (s *LocalStorage) SignedURL(key string, expires time.Duration) string {
+	deadline := time.Now().Add(expires).Unix()
+	return fmt.Sprintf("%s?e=%d&token=%s", s.URL(key), deadline, util.HMACSHA256Hex(s.secret, localURLSignMessage(key, deadline)))
+}
+
+// VerifySignedURL 校验 SignedURL 生成的链接的 query
+func (s *LocalStorage) VerifySignedURL(key string, query url.Values) bool {
+	deadline, err := strconv.ParseInt(query.Get("e"), 10, 64)
+	if err != nil || deadline < time.Now().Unix() {
+		return false
+	}
+	return util.VerifyHMACSHA256Hex(s.secret, localURLSignMessage(key, deadline), query.Get("token"))
+}
+
+func (s *LocalStorage) KeyFromURL(rawURL string, prefixes ...string) (string, bool) {
+	return keyFromURL(s.URL(""), rawURL, prefixes...)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	p, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Registers() bool {
+	return true
+}
+
+// Path 文件在磁盘上的路径, 不允许访问 dir 之外的文件
+// key 须为规范的相对路径: 不含 . 和 .. 路径段、连续的 /、反斜杠(Windows 下为路径分隔符)和空字符
+func (s *LocalStorage) Path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || strings.HasSuffix(key, "/") || strings.ContainsAny(key, "\\\x00") || cleaned != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
+
+// Receive 校验上传凭证并保存文件, 生成衍生文件
+// 返回替换了魔法变量的回调内容, 格式同七牛回调, 凭证中没有回调内容时返回空
+func (s *LocalStorage) Receive(uploadToken string, file io.Reader) (url.Values, error) {
+	policy, err := s.parseUploadToken(uploadToken)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.Path(policy.Key)
+	if err != nil {
+		return nil, err
+	}
+	// 先写入同目录下的临时文件, 校验通过后再改名, 避免大文件读入内存
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(target), localTempPattern)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// 按开头的内容检测 MIME 类型, 不允许的类型不写入磁盘
+	head := make([]byte, localSniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	mimeType := detectMime(policy.Key, head)
+	if !mimeAllowed(policy.MimeLimit, mimeType) {
+		return nil, ErrMimeNotAllowed
+	}
+
+	reader := io.MultiReader(bytes.NewReader(head), file)
+	if policy.FsizeLimit > 0 {
+		reader = io.LimitReader(reader, policy.FsizeLimit+1)
+	}
+	hash := sha1.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if err != nil {
+		return nil, err
+	}
+	if policy.FsizeLimit > 0 && size > policy.FsizeLimit {
+		return nil, ErrTooLarge
+	}
+
+	for _, derivative := range policy.Derivatives {
+		if derivative.Kind != DeriveThumbnail {
+			continue
+		}
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		// 无法解码或尺寸过大的图片(如 heic)使用原图作为缩略图
+		thumb, err := thumbnail(tmp, constant.ImgMicroSize)
+		if err == nil {
+			err = s.write(derivative.Key, bytes.NewReader(thumb))
+		} else if _, err = tmp.Seek(0, io.SeekStart); err == nil {
+			err = s.write(derivative.Key, tmp)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return nil, err
+	}
+
+	if policy.CallbackBody == "" {
+		return url.Values{}, nil
+	}
+	body := strings.NewReplacer(
+		"$(key)", url.QueryEscape(policy.Key),
+		"$(etag)", hex.EncodeToString(hash.Sum(nil)),
+		"$(fsize)", strconv.FormatInt(size, 10),
+		"$(mimeType)", url.QueryEscape(mimeType),
+	).Replace(policy.CallbackBody)
+	return url.ParseQuery(body)
+}
+
+func (s *LocalStorage) parseUploadToken(uploadToken string) (localUploadToken, error) {
+	policy := localUploadToken{}
+	parts := strings.Split(uploadToken, ".")
+	if len(parts) != 2 || !util.VerifyHMACSHA256Hex(s.secret, parts[0], parts[1]) {
+		return policy, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return policy, ErrInvalidToken
+	}
+	if err = json.Unmarshal(payload, &policy); err != nil || policy.Deadline < time.Now().Unix() {
+		return policy, ErrInvalidToken
+	}
+	return policy, nil
+}
+
+func localURLSignMessage(key string, deadline int64) string {
+	return key + "\n" + strconv.FormatInt(deadline, 10)
+}
+
+func (s *LocalStorage) write(key string, r io.Reader) error {
+	p, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// detectMime 按内容检测, 无法细分时(如 office 文档)按扩展名, 扩展名只能细分为 application 类型
+func detectMime(key string, data []byte) string {
+	detected := http.DetectContentType(data)
+	for _, generic := range localGenericMimes {
+		if detected != generic {
+			continue
+		}
+		if byExt := mime.TypeByExtension(path.Ext(key)); strings.HasPrefix(byExt, "application/") {
+			detected = byExt
+		}
+		break
+	}
+	if i := strings.Index(detected, ";"); i >= 0 {
+		detected = detected[:i]
+	}
+	return detected
+}
+
+// thumbnail 等比缩小到边长不超过 size 的 jpeg, 同七牛的 imageView2/2
+// 解码前先读取尺寸, 像素数超过 localThumbMaxPixels 的不解码, 避免占用过多内存
+func thumbnail(r io.ReadSeeker, size int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > localThumbMaxPixels {
+		return nil, errImageTooLarge
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+		if tw == 0 {
+			tw = 1
+		}
+		if th == 0 {
+			th = 1
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x*w/tw, bounds.Min.Y+y*h/th))
+		}
+	}
+	buf := bytes.Buffer{}
+	if err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: localThumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
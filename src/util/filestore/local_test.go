@@ -0,0 +1,140 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoragePath(t *testing.T) {
+	dir := filepath.FromSlash("/data/files")
+	s := NewLocalStorage(dir, "https://example.com/files", "secret")
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr error
+	}{
+		{"mp/homework/a.jpg", filepath.Join(dir, "mp", "homework", "a.jpg"), nil},
+		{"a..b.jpg", filepath.Join(dir, "a..b.jpg"), nil},
+		{"", "", ErrInvalidKey},
+		{"/", "", ErrInvalidKey},
+		{"mp/", "", ErrInvalidKey},
+		{"..", "", ErrInvalidKey},
+		{"../x", "", ErrInvalidKey},
+		{"a/../../x", "", ErrInvalidKey},
+		{"a/../x", "", ErrInvalidKey},
+		{"a/..", "", ErrInvalidKey},
+		{"./x", "", ErrInvalidKey},
+		{"a//b", "", ErrInvalidKey},
+		{"/etc/passwd", "", ErrInvalidKey},
+		{`..\x`, "", ErrInvalidKey},
+		{`a\..\..\x`, "", ErrInvalidKey},
+		{"a\x00b", "", ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		got, err := s.Path(tt.key)
+		if err != tt.wantErr || got != tt.want {
+			t.Errorf("Path(%q) = %q, %v, want %q, %v", tt.key, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// pngHeader 只有文件头的 png, 声明的尺寸为 w*h
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 6 // 8 位 RGBA
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf := bytes.NewBuffer([]byte("\x89PNG\r\n\x1a\n"))
+	binary.Write(buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.Write(chunk)
+	binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestLocalStorageReceive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewLocalStorage(dir, "https://example.com", "secret")
+
+	img := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	img.Set(10, 10, color.White)
+	small := bytes.Buffer{}
+	if err := png.Encode(&small, img); err != nil {
+		t.Fatal(err)
+	}
+	huge := pngHeader(100000, 100000)
+
+	upload := func(key string, data []byte, limit int64) (string, error) {
+		credential, err := s.UploadCredential(UploadPolicy{
+			Key:          key,
+			FsizeLimit:   limit,
+			MimeLimit:    "image/*",
+			Derivatives:  []Derivative{{Kind: DeriveThumbnail, Key: "micro/" + key}},
+			CallbackBody: "key=$(key)&fsize=$(fsize)&mimeType=$(mimeType)",
+			Expires:      60,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		form, err := s.Receive(credential.Token, bytes.NewReader(data))
+		return form.Encode(), err
+	}
+
+	form, err := upload("a.png", small.Bytes(), 1<<20)
+	if err != nil || form != "fsize="+strconv.Itoa(small.Len())+"&key=a.png&mimeType=image%2Fpng" {
+		t.Fatalf("small: form = %q, err = %v", form, err)
+	}
+	thumb, err := os.Open(filepath.Join(dir, "micro", "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(thumb)
+	thumb.Close()
+	if err != nil || format != "jpeg" || cfg.Width != 160 || cfg.Height != 100 {
+		t.Errorf("small thumbnail = %s %dx%d, %v", format, cfg.Width, cfg.Height, err)
+	}
+
+	// 尺寸过大的图片不解码, 使用原图作为缩略图
+	if _, err = thumbnail(bytes.NewReader(huge), 160); err != errImageTooLarge {
+		t.Errorf("huge: thumbnail err = %v, want %v", err, errImageTooLarge)
+	}
+	if _, err = upload("b.png", huge, 1<<20); err != nil {
+		t.Fatalf("huge: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "micro", "b.png")); !bytes.Equal(data, huge) {
+		t.Errorf("huge thumbnail is not the original")
+	}
+
+	if _, err = upload("c.png", small.Bytes(), 10); err != ErrTooLarge {
+		t.Errorf("too large: err = %v, want %v", err, ErrTooLarge)
+	}
+	if _, err = upload("d.txt", []byte(strings.Repeat("text ", 200)), 1<<20); err != ErrMimeNotAllowed {
+		t.Errorf("mime: err = %v, want %v", err, ErrMimeNotAllowed)
+	}
+	for _, name := range []string{"c.png", "d.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s: rejected upload was saved", name)
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), localTempPattern) {
+			t.Errorf("temporary file %s left behind", f.Name())
+		}
+	}
+}
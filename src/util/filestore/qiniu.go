@@ -0,0 +1,73 @@
+package filestore
+
+import (
+	"config"
+	"constant"
+	"strings"
+	"time"
+	"util/token"
+
+	"github.com/qiniu/api.v7/storage"
+)
+
+// qiniuDeriveOps 衍生文件对应的七牛处理指令
+var qiniuDeriveOps = map[string]string{
+	DeriveThumbnail:  constant.ImgOps,
+	DeriveAudioMP3:   constant.AttachmentAudioOps,
+	DeriveVideoCover: constant.AttachmentVideoOps,
+	DerivePDFPreview: constant.AttachmentFileOps,
+}
+
+// qiniuStorage 七牛, 访问域名为 constant.ImgURIPrefix
+type qiniuStorage struct{}
+
+func (qiniuStorage) Backend() string {
+	return constant.StorageBackendQiniu
+}
+
+func (qiniuStorage) UploadCredential(policy UploadPolicy) (UploadCredential, error) {
+	fops := []string{}
+	for _, derivative := range policy.Derivatives {
+		ops, ok := qiniuDeriveOps[derivative.Kind]
+		if !ok {
+			return UploadCredential{}, ErrUnsupported
+		}
+		fops = append(fops, ops+"|saveas/"+storage.EncodedEntry(config.Conf.Qiniu.Bucket, derivative.Key))
+	}
+	upToken := token.GetLimitedUpToken(policy.Key, strings.Join(fops, ";"), policy.FsizeLimit, policy.MimeLimit, policy.CallbackBody, policy.Expires)
+	return UploadCredential{
+		Backend: constant.StorageBackendQiniu,
+		Token:   upToken,
+		Fields: map[string]string{
+			"token": upToken,
+			"key":   policy.Key,
+		},
+	}, nil
+}
+
+func (qiniuStorage) Supports(kind string) bool {
+	_, ok := qiniuDeriveOps[kind]
+	return ok
+}
+
+func (qiniuStorage) URL(key string) string {
+	return constant.ImgURIPrefix + key
+}
+
+func (qiniuStorage) SignedURL(key string, expires time.Duration) string {
+	deadline := time.Now().Add(expires).Unix()
+	return token.GetQiniuPrivateURL(strings.TrimSuffix(constant.ImgURIPrefix, "/"), key, deadline)
+}
+
+// KeyFromURL 兼容以前保存的其他域名的链接, 只按路径解析
+func (qiniuStorage) KeyFromURL(rawURL string, prefixes ...string) (string, bool) {
+	return token.QiniuKeyFromURL(rawURL, prefixes...)
+}
+
+func (qiniuStorage) Delete(key string) error {
+	return token.DeleteQiniuFile(key)
+}
+
+func (qiniuStorage) Registers() bool {
+	return config.Conf.Qiniu.CallbackURL != ""
+}
@@ -0,0 +1,243 @@
+package filestore
+
+import (
+	"config"
+	"constant"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, 见 https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+const (
+	s3Algorithm        = "AWS4-HMAC-SHA256"
+	s3Terminator       = "aws4_request"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3TimeFormat       = "20060102T150405Z"
+	s3DateFormat       = "20060102"
+	s3PolicyTimeFormat = "2006-01-02T15:04:05.000Z"
+	s3PresignMaxExpire = 7 * 24 * time.Hour
+)
+
+// s3Storage MinIO 等 S3 兼容存储, 不支持上传回调和衍生文件
+type s3Storage struct {
+	endpoint  string // 不以 / 结尾
+	host      string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+}
+
+func newS3Storage() s3Storage {
+	conf := config.Conf.Storage.S3
+	s := s3Storage{
+		endpoint:  strings.TrimSuffix(conf.Endpoint, "/"),
+		region:    conf.Region,
+		bucket:    conf.Bucket,
+		accessKey: conf.AccessKey,
+		secretKey: conf.SecretKey,
+		publicURL: conf.PublicURL,
+		client:    &http.Client{Timeout: constant.UpstreamTimeout},
+	}
+	if u, err := url.Parse(s.endpoint); err == nil {
+		s.host = u.Host
+	}
+	if s.publicURL == "" {
+		s.publicURL = s.endpoint + "/" + s.bucket + "/"
+	}
+	return s
+}
+
+func (s s3Storage) Backend() string {
+	return constant.StorageBackendS3
+}
+
+// UploadCredential 浏览器 POST 上传的表单字段, 客户端需附带与 MimeLimit 相符的 Content-Type 字段
+// S3 的 policy 无法表示多个 MIME 类型, 此时不限制
+func (s s3Storage) UploadCredential(policy UploadPolicy) (UploadCredential, error) {
+	if len(policy.Derivatives) > 0 {
+		return UploadCredential{}, ErrUnsupported
+	}
+	now := time.Now().UTC()
+	credential := s.accessKey + "/" + s.scope(now)
+	fields := map[string]string{
+		"key":              policy.Key,
+		"x-amz-algorithm":  s3Algorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format(s3TimeFormat),
+	}
+	conditions := []interface{}{
+		map[string]string{"bucket": s.bucket},
+	}
+	for name, value := range fields {
+		conditions = append(conditions, map[string]string{name: value})
+	}
+	if policy.FsizeLimit > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", 0, policy.FsizeLimit})
+	}
+	if mime := policy.MimeLimit; mime != "" && !strings.Contains(mime, ";") {
+		if strings.HasSuffix(mime, "/*") {
+			conditions = append(conditions, []interface{}{"starts-with", "$Content-Type", strings.TrimSuffix(mime, "*")})
+		} else {
+			conditions = append(conditions, []interface{}{"eq", "$Content-Type", mime})
+		}
+	}
+
+	doc, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(time.Duration(policy.Expires) * time.Second).Format(s3PolicyTimeFormat),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return UploadCredential{}, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(doc)
+	fields["policy"] = encoded
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(s.signingKey(now), encoded))
+	return UploadCredential{
+		Backend: constant.StorageBackendS3,
+		URL:     s.endpoint + "/" + s.bucket,
+		Fields:  fields,
+	}, nil
+}
+
+func (s s3Storage) Supports(kind string) bool {
+	return false
+}
+
+func (s s3Storage) URL(key string) string {
+	return s.publicURL + key
+}
+
+// SignedURL 预签名的 GET 链接, 最长有效 7 天
+func (s s3Storage) SignedURL(key string, expires time.Duration) string {
+	if expires > s3PresignMaxExpire {
+		expires = s3PresignMaxExpire
+	}
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	path := s.objectPath(key)
+	canonicalQuery := s3CanonicalQuery(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet, path, canonicalQuery, "host:" + s.host + "\n", "host", s3UnsignedPayload,
+	}, "\n")
+	return s.endpoint + path + "?" + canonicalQuery + "&X-Amz-Signature=" + s.sign(now, canonicalRequest)
+}
+
+// KeyFromURL 支持公开链接和 SignedURL 生成的 path-style 链接
+func (s s3Storage) KeyFromURL(rawURL string, prefixes ...string) (string, bool) {
+	if key, ok := keyFromURL(s.publicURL, rawURL, prefixes...); ok {
+		return key, true
+	}
+	return keyFromURL(s.endpoint+"/"+s.bucket+"/", rawURL, prefixes...)
+}
+
+func (s s3Storage) Delete(key string) error {
+	now := time.Now().UTC()
+	amzDate := now.Format(s3TimeFormat)
+	path := s.objectPath(key)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + s.host + "\n" +
+		"x-amz-content-sha256:" + s3EmptyPayloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		http.MethodDelete, path, "", canonicalHeaders, signedHeaders, s3EmptyPayloadHash,
+	}, "\n")
+
+	req, err := http.NewRequest(http.MethodDelete, s.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-amz-content-sha256", s3EmptyPayloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, s.scope(now), signedHeaders, s.sign(now, canonicalRequest)))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 文件不存在时 S3 也返回 204
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("filestore: s3 delete %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (s s3Storage) Registers() bool {
+	return false
+}
+
+// objectPath path-style 的对象路径
+func (s s3Storage) objectPath(key string) string {
+	return "/" + s.bucket + "/" + s3Escape(key, true)
+}
+
+func (s s3Storage) scope(t time.Time) string {
+	return t.Format(s3DateFormat) + "/" + s.region + "/s3/" + s3Terminator
+}
+
+func (s s3Storage) signingKey(t time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format(s3DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, s3Terminator)
+}
+
+func (s s3Storage) sign(t time.Time, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, t.Format(s3TimeFormat), s.scope(t), hex.EncodeToString(sum[:])}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.signingKey(t), stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape 除 A-Za-z0-9-_.~ 外都编码, 路径中保留 /
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && keepSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+/*
+   圈子邀请码: 5 位主体 + 1 位校验位, 字符集同 Base34
+   - 主体: 自增序号经密钥 Feistel 置换后编码, 序号不重复则邀请码不重复, 且无法由一个邀请码推出其他邀请码
+   - 校验位: Luhn mod 34, 可以发现单个字符错误和相邻字符互换(0 和 Z 互换除外), 输错时无需查库
+   旧的 4 位邀请码没有校验位, 仍然可以使用
+*/
+
+const (
+	groupCodeBodyLen   = 5
+	groupCodeLen       = groupCodeBodyLen + 1
+	groupCodeHalfBits  = 13 // 2^26 > 34^5, 置换结果超出范围时继续置换(cycle walking)
+	groupCodeRounds    = 4
+	groupCodeLegacyLen = 4
+)
+
+var ErrGroupCodeExhausted = errors.New("group code sequence exhausted")
+
+// GroupCodeFromSeq 由序号生成邀请码, seq 需小于 34^5
+func GroupCodeFromSeq(seq uint64, key string) (string, error) {
+	max := groupCodeMax()
+	if seq >= max {
+		return "", ErrGroupCodeExhausted
+	}
+	n := feistel(seq, key)
+	for n >= max {
+		n = feistel(n, key)
+	}
+
+	body := make([]byte, groupCodeBodyLen)
+	for i := groupCodeBodyLen - 1; i >= 0; i-- {
+		body[i] = base[n%baseStrLen]
+		n /= baseStrLen
+	}
+	return string(body) + string(groupCodeCheckChar(body)), nil
+}
+
+// NormalizeGroupCode 统一大小写和易混淆字符(O -> 0, I -> 1), 并检查校验位
+func NormalizeGroupCode(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.NewReplacer("O", "0", "I", "1").Replace(code)
+	if len(code) != groupCodeLen && len(code) != groupCodeLegacyLen {
+		return "", false
+	}
+	for i := 0; i < len(code); i++ {
+		if _, ok := baseMap[code[i]]; !ok {
+			return "", false
+		}
+	}
+	if len(code) == groupCodeLegacyLen {
+		return code, true
+	}
+	body := []byte(code[:groupCodeBodyLen])
+	return code, groupCodeCheckChar(body) == code[groupCodeBodyLen]
+}
+
+func groupCodeMax() uint64 {
+	max := uint64(1)
+	for i := 0; i < groupCodeBodyLen; i++ {
+		max *= baseStrLen
+	}
+	return max
+}
+
+// feistel 2*groupCodeHalfBits 位上的置换
+func feistel(n uint64, key string) uint64 {
+	mask := uint64(1)<<groupCodeHalfBits - 1
+	l, r := (n>>groupCodeHalfBits)&mask, n&mask
+	for i := 0; i < groupCodeRounds; i++ {
+		l, r = r, l^(feistelRound(key, i, r)&mask)
+	}
+	return l<<groupCodeHalfBits | r
+}
+
+func feistelRound(key string, round int, r uint64) uint64 {
+	mac := hmac.New(sha256.New, []byte(key))
+	buf := make([]byte, 9)
+	buf[0] = byte(round)
+	binary.BigEndian.PutUint64(buf[1:], r)
+	mac.Write(buf)
+	return uint64(binary.BigEndian.Uint32(mac.Sum(nil)))
+}
+
+// groupCodeCheckChar Luhn mod N 校验位
+func groupCodeCheckChar(body []byte) byte {
+	factor := uint64(2)
+	sum := uint64(0)
+	for i := len(body) - 1; i >= 0; i-- {
+		addend := factor * uint64(baseMap[body[i]])
+		factor = 3 - factor
+		sum += addend/baseStrLen + addend%baseStrLen
+	}
+	return base[(baseStrLen-sum%baseStrLen)%baseStrLen]
+}
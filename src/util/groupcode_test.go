@@ -0,0 +1,113 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+const testGroupCodeKey = "group-code-test-key"
+
+// feistelInverse feistel 的逆置换
+func feistelInverse(n uint64, key string) uint64 {
+	mask := uint64(1)<<groupCodeHalfBits - 1
+	l, r := (n>>groupCodeHalfBits)&mask, n&mask
+	for i := groupCodeRounds - 1; i >= 0; i-- {
+		l, r = r^(feistelRound(key, i, l)&mask), l
+	}
+	return l<<groupCodeHalfBits | r
+}
+
+func TestFeistelRoundTrip(t *testing.T) {
+	tests := []uint64{0, 1, 2, 33, 34, 1<<groupCodeHalfBits - 1, 1 << groupCodeHalfBits, groupCodeMax() - 1, 1<<(2*groupCodeHalfBits) - 1}
+	for _, n := range tests {
+		got := feistelInverse(feistel(n, testGroupCodeKey), testGroupCodeKey)
+		if got != n {
+			t.Errorf("feistelInverse(feistel(%d)) = %d", n, got)
+		}
+	}
+}
+
+func TestGroupCodeFromSeq(t *testing.T) {
+	seen := map[string]uint64{}
+	for seq := uint64(0); seq < 5000; seq++ {
+		code, err := GroupCodeFromSeq(seq, testGroupCodeKey)
+		if err != nil {
+			t.Fatalf("GroupCodeFromSeq(%d): %v", seq, err)
+		}
+		if prev, ok := seen[code]; ok {
+			t.Fatalf("GroupCodeFromSeq(%d) = %s, same as seq %d", seq, code, prev)
+		}
+		seen[code] = seq
+		if got, ok := NormalizeGroupCode(strings.ToLower(code)); !ok || got != code {
+			t.Fatalf("NormalizeGroupCode(%s) = %s, %v", code, got, ok)
+		}
+	}
+
+	other, _ := GroupCodeFromSeq(1, testGroupCodeKey+"2")
+	if code, _ := GroupCodeFromSeq(1, testGroupCodeKey); code == other {
+		t.Errorf("GroupCodeFromSeq with different keys = %s", code)
+	}
+	if _, err := GroupCodeFromSeq(groupCodeMax(), testGroupCodeKey); err != ErrGroupCodeExhausted {
+		t.Errorf("GroupCodeFromSeq(max) err = %v, want %v", err, ErrGroupCodeExhausted)
+	}
+}
+
+func TestNormalizeGroupCode(t *testing.T) {
+	code, err := GroupCodeFromSeq(42, testGroupCodeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		code string
+		want string
+		ok   bool
+	}{
+		{"valid", code, code, true},
+		{"lower case and spaces", " " + strings.ToLower(code) + " ", code, true},
+		{"legacy", "AB12", "AB12", true},
+		{"confusable letters", "oi12", "0112", true},
+		{"too short", code[:5], "", false},
+		{"too long", code + "0", "", false},
+		{"invalid char", "AB1-", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeGroupCode(tt.code)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s: NormalizeGroupCode(%q) = %q, %v, want %q, %v", tt.name, tt.code, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// 输错一个字符或互换相邻的两个字符都能被校验位发现
+// Luhn mod N 无法发现 0 和最后一个字符 Z 的互换
+func TestNormalizeGroupCodeRejectsTypos(t *testing.T) {
+	for seq := uint64(0); seq < 200; seq++ {
+		code, _ := GroupCodeFromSeq(seq, testGroupCodeKey)
+		for i := 0; i < len(code); i++ {
+			for j := 0; j < len(baseStr); j++ {
+				if baseStr[j] == code[i] {
+					continue
+				}
+				typo := code[:i] + string(baseStr[j]) + code[i+1:]
+				if _, ok := NormalizeGroupCode(typo); ok {
+					t.Errorf("NormalizeGroupCode(%s) accepted, original %s", typo, code)
+				}
+			}
+		}
+		for i := 0; i+1 < len(code); i++ {
+			if code[i] == code[i+1] || isZeroZ(code[i], code[i+1]) {
+				continue
+			}
+			swapped := code[:i] + string(code[i+1]) + string(code[i]) + code[i+2:]
+			if _, ok := NormalizeGroupCode(swapped); ok {
+				t.Errorf("NormalizeGroupCode(%s) accepted, original %s", swapped, code)
+			}
+		}
+	}
+}
+
+func isZeroZ(a, b byte) bool {
+	last := baseStr[len(baseStr)-1]
+	return (a == baseStr[0] && b == last) || (a == last && b == baseStr[0])
+}
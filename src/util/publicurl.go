@@ -0,0 +1,119 @@
+package util
+
+/*
+   用户填写的回调地址(提醒 webhook、群组 webhook)只允许访问公网, 防止借服务端请求内网服务
+   - 保存时 CheckPublicURL 解析域名, 拒绝回环、内网、链路本地等地址
+   - 发送时 HTTPPostPublic 在建立连接前再校验一次实际连接的地址, 域名重新解析到内网或重定向到内网时同样拒绝
+*/
+import (
+	"constant"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/imroc/req"
+)
+
+var (
+	// nonPublicNets 不允许回调的网段, net.IP 的 IsLoopback 等方法之外的部分
+	nonPublicNets = parseCIDRs(
+		"0.0.0.0/8",      // 本网络
+		"10.0.0.0/8",     // 内网
+		"100.64.0.0/10",  // 运营商级 NAT
+		"172.16.0.0/12",  // 内网
+		"192.0.0.0/24",   // IETF 协议分配
+		"192.168.0.0/16", // 内网
+		"198.18.0.0/15",  // 基准测试
+		"fc00::/7",       // IPv6 唯一本地地址
+	)
+
+	publicReq = newPublicReq() // 请求用户填写的回调地址的 http client
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// IsPublicIP ip 是否为公网地址
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPublicURL 校验回调地址: 必须为 https, 域名解析出的所有地址都必须是公网地址
+func CheckPublicURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return constant.ErrorParamWrong
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return constant.ErrorParamWrong
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return constant.ErrorParamWrong
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return constant.ErrorParamWrong
+		}
+	}
+	return nil
+}
+
+func newPublicReq() *req.Req {
+	dialer := &net.Dialer{
+		Timeout: constant.UpstreamTimeout,
+		// 连接前校验实际连接的地址, 包括重定向后的地址
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return constant.ErrorParamWrong
+			}
+			return nil
+		},
+	}
+	r := req.New()
+	r.SetClient(&http.Client{
+		// 不使用环境变量中的代理, 否则校验的是代理的地址
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: constant.UpstreamTimeout,
+		},
+		Timeout: constant.UpstreamTimeout,
+	})
+	return r
+}
+
+// HTTPPostPublic POST 用户填写的回调地址, 只会连接公网地址
+func HTTPPostPublic(ctx context.Context, rawURL string, v ...interface{}) (*req.Resp, error) {
+	if u, err := url.Parse(rawURL); err != nil || u.Scheme != "https" {
+		return nil, constant.ErrorParamWrong
+	}
+	return publicReq.Post(rawURL, append(v, ctx)...)
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"constant"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.32.0.1", true},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // 云服务器元数据
+		{"100.64.0.1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://8.8.8.8/hook", nil},
+		{"https://[2001:4860:4860::8888]:8443/hook", nil},
+		{"http://8.8.8.8/hook", constant.ErrorParamWrong},
+		{"https://127.0.0.1/hook", constant.ErrorParamWrong},
+		{"https://[::1]/hook", constant.ErrorParamWrong},
+		{"https://10.0.0.1:8080/hook", constant.ErrorParamWrong},
+		{"https://169.254.169.254/latest/meta-data", constant.ErrorParamWrong},
+		{"https:///hook", constant.ErrorParamWrong},
+		{"://bad", constant.ErrorParamWrong},
+	}
+	for _, tt := range tests {
+		if err := CheckPublicURL(context.Background(), tt.url); err != tt.want {
+			t.Errorf("CheckPublicURL(%s) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HMACSHA256Hex 返回 hex 编码的 HMAC-SHA256 签名
+func HMACSHA256Hex(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHMACSHA256Hex 使用常量时间比较签名
+func VerifyHMACSHA256Hex(secret, message, signature string) bool {
+	expected := HMACSHA256Hex(secret, message)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// RandomHex 返回 n 字节随机数的 hex 编码
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ServiceSignMessage 服务间请求的待签名字符串, uri 包含 query
+func ServiceSignMessage(method, uri, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// TimestampWithin 秒级时间戳与当前时间相差不超过 maxSkew, 用于拒绝过期的签名请求
+func TimestampWithin(timestamp string, maxSkew time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	return skew <= maxSkew && skew >= -maxSkew
+}
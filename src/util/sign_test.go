@@ -0,0 +1,70 @@
+package util
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyHMACSHA256Hex(t *testing.T) {
+	// RFC 4231 test case 2
+	const secret, message = "Jefe", "what do ya want for nothing?"
+	const signature = "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := HMACSHA256Hex(secret, message); got != signature {
+		t.Fatalf("HMACSHA256Hex = %s, want %s", got, signature)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		message   string
+		signature string
+		want      bool
+	}{
+		{"ok", secret, message, signature, true},
+		{"wrong secret", "jefe", message, signature, false},
+		{"wrong message", secret, message + " ", signature, false},
+		{"uppercase hex", secret, message, "5BDCC146BF60754E6A042426089575C75A003F089D2739839DEC58B964EC3843", false},
+		{"truncated", secret, message, signature[:32], false},
+		{"empty", secret, message, "", false},
+	}
+	for _, tt := range tests {
+		if got := VerifyHMACSHA256Hex(tt.secret, tt.message, tt.signature); got != tt.want {
+			t.Errorf("%s: VerifyHMACSHA256Hex = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServiceSignMessage(t *testing.T) {
+	got := ServiceSignMessage("POST", "/api/unopen/x?a=1", "1500000000", "0123456789abcdef", []byte("{}"))
+	want := "POST\n/api/unopen/x?a=1\n1500000000\n0123456789abcdef\n44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	if got != want {
+		t.Errorf("ServiceSignMessage = %q, want %q", got, want)
+	}
+}
+
+func TestTimestampWithin(t *testing.T) {
+	now := time.Now()
+	ts := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+	tests := []struct {
+		name      string
+		timestamp string
+		want      bool
+	}{
+		{"now", ts(0), true},
+		{"past in range", ts(-4 * time.Minute), true},
+		{"future in range", ts(4 * time.Minute), true},
+		{"too old", ts(-6 * time.Minute), false},
+		{"too far in future", ts(6 * time.Minute), false},
+		{"milliseconds", strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10), false},
+		{"empty", "", false},
+		{"not a number", "abc", false},
+	}
+	for _, tt := range tests {
+		if got := TimestampWithin(tt.timestamp, 5*time.Minute); got != tt.want {
+			t.Errorf("%s: TimestampWithin(%s) = %v, want %v", tt.name, tt.timestamp, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"constant"
+	"context"
+	"sync"
+	"time"
+)
+
+// 异步任务和定时任务都由 task group 追踪, 退出前等待其完成
+var (
+	tasks       sync.WaitGroup
+	tasksMutex  sync.Mutex
+	tasksClosed bool
+
+	// taskCtx 所有任务的根 ctx, 等待超时后取消以中断仍在运行的任务
+	taskCtx, cancelTasks = context.WithCancel(context.Background())
+)
+
+// GoBackground 启动异步任务, 任务不随请求取消, 但最长执行 constant.BackgroundTaskTimeout
+// 调用 WaitTasks 之后启动的任务会被丢弃
+func GoBackground(fn func(ctx context.Context)) {
+	if !addTask() {
+		return
+	}
+	go func() {
+		defer tasks.Done()
+		ctx, cancel := context.WithTimeout(taskCtx, constant.BackgroundTaskTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// RunTask 同步执行任务, 如定时任务, 最长执行 timeout
+func RunTask(timeout time.Duration, fn func(ctx context.Context)) {
+	if !addTask() {
+		return
+	}
+	defer tasks.Done()
+	ctx, cancel := context.WithTimeout(taskCtx, timeout)
+	defer cancel()
+	fn(ctx)
+}
+
+// WaitTasks 停止接收新任务并等待运行中的任务完成
+// ctx 结束时取消剩余任务并返回 ctx.Err()
+func WaitTasks(ctx context.Context) error {
+	tasksMutex.Lock()
+	tasksClosed = true
+	tasksMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancelTasks()
+		return ctx.Err()
+	}
+}
+
+func addTask() bool {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+	if tasksClosed {
+		return false
+	}
+	tasks.Add(1)
+	return true
+}
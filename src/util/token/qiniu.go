@@ -3,6 +3,9 @@ package token
 import (
 	"config"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/qiniu/api.v7/auth/qbox"
 	"github.com/qiniu/api.v7/storage"
@@ -25,6 +28,33 @@ func GetCustomUpToken(keyToOverwrite, persistentOps string, expires uint32) stri
 	return putPolicy.UploadToken(mac)
 }
 
+// GetLimitedUpToken 限制文件大小和 MIME 类型的覆盖上传凭证, 超出限制时七牛拒绝上传
+// mimeLimit 如 "image/*", 多个用 ; 分隔
+// 配置了 CallbackURL 时上传成功后七牛以表单格式回调 callbackBody, 回调失败时上传失败
+func GetLimitedUpToken(keyToOverwrite, persistentOps string, fsizeLimit int64, mimeLimit, callbackBody string, expires uint32) string {
+	mac := qbox.NewMac(accessKey, secretKey)
+
+	putPolicy := storage.PutPolicy{
+		Scope:         fmt.Sprintf("%s:%s", bucket, keyToOverwrite),
+		PersistentOps: persistentOps,
+		Expires:       expires,
+		FsizeLimit:    fsizeLimit,
+		MimeLimit:     mimeLimit,
+		DetectMime:    1,
+	}
+	if callbackURL := config.Conf.Qiniu.CallbackURL; callbackURL != "" && callbackBody != "" {
+		putPolicy.CallbackURL = callbackURL
+		putPolicy.CallbackBody = callbackBody
+	}
+	return putPolicy.UploadToken(mac)
+}
+
+// VerifyQiniuCallback 校验上传回调的签名, 表单格式时签名包括请求体
+func VerifyQiniuCallback(req *http.Request) (bool, error) {
+	mac := qbox.NewMac(accessKey, secretKey)
+	return mac.VerifyCallback(req)
+}
+
 func GetQiniuSimpleUpToken() string {
 	// 简单上传凭证
 	putPolicy := storage.PutPolicy{
@@ -113,3 +143,35 @@ func GetQiniuOpsUpToken(persistentOps, persistentNotifyURL string) string {
 	}
 	return putPolicy.UploadToken(mac)
 }
+
+// GetQiniuPrivateURL 私有空间文件的临时下载链接, domain 如 "http://<image hostname>"
+func GetQiniuPrivateURL(domain, key string, deadline int64) string {
+	mac := qbox.NewMac(accessKey, secretKey)
+	return storage.MakePrivateURL(mac, domain, key, deadline)
+}
+
+// DeleteQiniuFile 删除空间中的文件, 文件不存在时不返回错误
+func DeleteQiniuFile(key string) error {
+	mac := qbox.NewMac(accessKey, secretKey)
+	bucketManager := storage.NewBucketManager(mac, &storage.Config{UseHTTPS: true})
+	err := bucketManager.Delete(bucket, key)
+	if err != nil && strings.Contains(err.Error(), "no such file or directory") {
+		return nil
+	}
+	return err
+}
+
+// QiniuKeyFromURL 从图片链接中解析文件名, 只处理 prefixes 下的文件, 避免误删默认头像等公共图片
+func QiniuKeyFromURL(rawURL string, prefixes ...string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -3,14 +3,22 @@ package util
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"sort"
+	"strings"
 
 	jsoniter "github.com/json-iterator/go"
 )
 
 var (
 	ErrAppIDNotMatch       = errors.New("app id not match")
+	ErrInvalidAESKey       = errors.New("invalid encoding aes key")
+	ErrInvalidMsgLength    = errors.New("invalid msg length")
 	ErrInvalidBlockSize    = errors.New("invalid block size")
 	ErrInvalidPKCS7Data    = errors.New("invalid PKCS7 data")
 	ErrInvalidPKCS7Padding = errors.New("invalid padding on input")
@@ -55,9 +63,14 @@ func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
 	c := data[len(data)-1]
 	n := int(c)
 
-	if n == 0 || n > len(data) {
+	if n == 0 || n > blockSize || n > len(data) {
 		return nil, ErrInvalidPKCS7Padding
 	}
+	for _, b := range data[len(data)-n:] {
+		if b != c {
+			return nil, ErrInvalidPKCS7Padding
+		}
+	}
 
 	return data[:len(data)-n], nil
 }
@@ -96,3 +109,67 @@ func (w *WXBizDataCrypt) Decrypt(encryptedData, iv string) (*DecryptUserInfo, er
 	}
 	return &userInfo, nil
 }
+
+/****************************************** official account message ****************************************/
+
+// CheckWeixinSignature 校验公众号服务器推送的签名
+// 明文模式 params 为 timestamp, nonce; 安全模式校验 msg_signature 时还需加上 Encrypt 字段
+func CheckWeixinSignature(token, signature string, params ...string) bool {
+	strs := append([]string{token}, params...)
+	sort.Strings(strs)
+	sum := sha1.Sum([]byte(strings.Join(strs, "")))
+	expected := hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// WXMsgCrypt 公众号安全模式的消息解密
+type WXMsgCrypt struct {
+	appID  string
+	aesKey []byte
+}
+
+func NewWXMsgCrypt(appID, encodingAESKey string) (*WXMsgCrypt, error) {
+	aesKey, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil || len(aesKey) != 32 {
+		return nil, ErrInvalidAESKey
+	}
+	return &WXMsgCrypt{
+		appID:  appID,
+		aesKey: aesKey,
+	}, nil
+}
+
+// Decrypt 解密 Encrypt 字段, 明文格式: random(16B) + msg_len(4B) + msg + appid
+func (w *WXMsgCrypt) Decrypt(encrypted string) ([]byte, error) {
+	cipherText, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(w.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < block.BlockSize() || len(cipherText)%block.BlockSize() != 0 {
+		return nil, ErrInvalidBlockSize
+	}
+	mode := cipher.NewCBCDecrypter(block, w.aesKey[:block.BlockSize()])
+	mode.CryptBlocks(cipherText, cipherText)
+	// 微信使用 32 字节的 PKCS7 填充
+	plain, err := pkcs7Unpad(cipherText, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plain) < 20 {
+		return nil, ErrInvalidMsgLength
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if msgLen < 0 || 20+msgLen > len(plain) {
+		return nil, ErrInvalidMsgLength
+	}
+	msg := plain[20 : 20+msgLen]
+	if string(plain[20+msgLen:]) != w.appID {
+		return nil, ErrAppIDNotMatch
+	}
+	return msg, nil
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const testWXAppID = "wx0123456789abcdef"
+
+func testWXAESKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+// wxPlain 安全模式的明文: random(16B) + msg_len(4B) + msg + appid
+func wxPlain(msgLen int, msg, appID string) []byte {
+	plain := make([]byte, 20, 20+len(msg)+len(appID))
+	copy(plain, "0123456789abcdef")
+	binary.BigEndian.PutUint32(plain[16:20], uint32(msgLen))
+	return append(append(plain, msg...), appID...)
+}
+
+// wxPad 按 32 字节 PKCS7 填充
+func wxPad(plain []byte) []byte {
+	n := 32 - len(plain)%32
+	return append(plain, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+// wxEncrypt 以微信的方式加密已填充的明文
+func wxEncrypt(t *testing.T, padded []byte) string {
+	key := testWXAESKey()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherText := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, key[:block.BlockSize()]).CryptBlocks(cipherText, padded)
+	return base64.StdEncoding.EncodeToString(cipherText)
+}
+
+func TestWXMsgCryptDecrypt(t *testing.T) {
+	encodingAESKey := strings.TrimSuffix(base64.StdEncoding.EncodeToString(testWXAESKey()), "=")
+	crypt, err := NewWXMsgCrypt(testWXAppID, encodingAESKey)
+	if err != nil {
+		t.Fatalf("NewWXMsgCrypt: %v", err)
+	}
+	msg := "<xml><Event>subscribe</Event></xml>"
+
+	badPadding := wxPad(wxPlain(len(msg), msg, testWXAppID))
+	badPadding[len(badPadding)-2]++
+
+	zeroPadding := wxPlain(len(msg), msg, testWXAppID)
+	zeroPadding = append(zeroPadding, make([]byte, 32-len(zeroPadding)%32)...)
+
+	tests := []struct {
+		name      string
+		encrypted string
+		want      string
+		wantErr   error
+	}{
+		{"ok", wxEncrypt(t, wxPad(wxPlain(len(msg), msg, testWXAppID))), msg, nil},
+		{"empty msg", wxEncrypt(t, wxPad(wxPlain(0, "", testWXAppID))), "", nil},
+		{"appid mismatch", wxEncrypt(t, wxPad(wxPlain(len(msg), msg, "wxother"))), "", ErrAppIDNotMatch},
+		{"appid missing", wxEncrypt(t, wxPad(wxPlain(len(msg), msg, ""))), "", ErrAppIDNotMatch},
+		{"msg_len too long", wxEncrypt(t, wxPad(wxPlain(len(msg)+len(testWXAppID)+1, msg, testWXAppID))), "", ErrInvalidMsgLength},
+		{"msg_len overflow", wxEncrypt(t, wxPad(wxPlain(-1, msg, testWXAppID))), "", ErrInvalidMsgLength},
+		{"plain too short", wxEncrypt(t, wxPad([]byte("0123456789"))), "", ErrInvalidMsgLength},
+		{"padding bytes differ", wxEncrypt(t, badPadding), "", ErrInvalidPKCS7Padding},
+		{"zero padding", wxEncrypt(t, zeroPadding), "", ErrInvalidPKCS7Padding},
+		{"not 32 bytes aligned", wxEncrypt(t, make([]byte, 48)), "", ErrInvalidPKCS7Data},
+		{"not block aligned", base64.StdEncoding.EncodeToString(make([]byte, 40)), "", ErrInvalidBlockSize},
+	}
+	for _, tt := range tests {
+		got, err := crypt.Decrypt(tt.encrypted)
+		if err != tt.wantErr {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: msg = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}